@@ -0,0 +1,422 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudbuild/v1"
+	"google.golang.org/api/clouddeploy/v1"
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/logging/v2"
+	oauth2api "google.golang.org/api/oauth2/v2"
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+	"google.golang.org/api/serviceusage/v1"
+)
+
+const (
+	// maxTestPermissions is the maximum number of permissions of a testIamPermissions request.
+	maxTestPermissions = 100
+	// maxRolloutIDLength is the maximum length of a Cloud Deploy rollout ID.
+	maxRolloutIDLength = 63
+	// operationPollInterval is the time between checks of a long-running operation.
+	operationPollInterval = 2 * time.Second
+	// maxLogEntriesPageSize is the maximum number of log entries of a list page.
+	maxLogEntriesPageSize = 1000
+)
+
+var errStopPaging = errors.New("stop paging")
+
+// NewAPIClients creates the typed clients over the Google Cloud client libraries
+// using the Application Default Credentials.
+func NewAPIClients(ctx context.Context, opts ...option.ClientOption) (Clients, error) {
+	// the email scope allows the identity client to get the account of the credentials
+	creds, err := google.FindDefaultCredentials(ctx, cloudbuild.CloudPlatformScope, oauth2api.UserinfoEmailScope)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to find default credentials: %w", err)
+	}
+	opts = append([]option.ClientOption{option.WithCredentials(creds)}, opts...)
+	build, err := cloudbuild.NewService(ctx, opts...)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create Cloud Build service: %w", err)
+	}
+	deploy, err := clouddeploy.NewService(ctx, opts...)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create Cloud Deploy service: %w", err)
+	}
+	usage, err := serviceusage.NewService(ctx, opts...)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create Service Usage service: %w", err)
+	}
+	secrets, err := secretmanager.NewService(ctx, opts...)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create Secret Manager service: %w", err)
+	}
+	crm, err := cloudresourcemanager.NewService(ctx, opts...)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create Resource Manager service: %w", err)
+	}
+	logs, err := logging.NewService(ctx, opts...)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create Cloud Logging service: %w", err)
+	}
+	identity, err := oauth2api.NewService(ctx, opts...)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create OAuth2 service: %w", err)
+	}
+	return Clients{
+		CloudBuild:      &cloudBuildAPI{svc: build},
+		CloudDeploy:     &cloudDeployAPI{svc: deploy},
+		ServiceUsage:    &serviceUsageAPI{svc: usage},
+		SecretManager:   &secretManagerAPI{svc: secrets},
+		ResourceManager: &resourceManagerAPI{svc: crm},
+		Logging:         &loggingAPI{svc: logs},
+		Identity:        &identityAPI{svc: identity, tokens: creds.TokenSource},
+	}, nil
+}
+
+type cloudBuildAPI struct {
+	svc *cloudbuild.Service
+}
+
+func (c *cloudBuildAPI) ListBuilds(ctx context.Context, projectID, region, filter string, limit int64) ([]Build, error) {
+	builds := []Build{}
+	call := c.svc.Projects.Locations.Builds.List(fmt.Sprintf("projects/%s/locations/%s", projectID, region)).Filter(filter)
+	if limit > 0 {
+		call = call.PageSize(limit)
+	}
+	err := call.Pages(ctx, func(resp *cloudbuild.ListBuildsResponse) error {
+		for _, b := range resp.Builds {
+			builds = append(builds, Build{ID: b.Id, Status: b.Status, CreateTime: b.CreateTime})
+			if limit > 0 && int64(len(builds)) >= limit {
+				return errStopPaging
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopPaging) {
+		return nil, fmt.Errorf("failed to list builds: %w", err)
+	}
+	return builds, nil
+}
+
+func (c *cloudBuildAPI) GetBuild(ctx context.Context, projectID, region, buildID string) (Build, error) {
+	b, err := c.svc.Projects.Locations.Builds.Get(fmt.Sprintf("projects/%s/locations/%s/builds/%s", projectID, region, buildID)).Context(ctx).Do()
+	if err != nil {
+		return Build{}, fmt.Errorf("failed to get build %s: %w", buildID, err)
+	}
+	return Build{ID: b.Id, Status: b.Status, CreateTime: b.CreateTime}, nil
+}
+
+func (c *cloudBuildAPI) RetryBuild(ctx context.Context, buildName string) (string, error) {
+	retryOperation, err := c.svc.Projects.Locations.Builds.Retry(buildName, &cloudbuild.RetryBuildRequest{}).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to retry build: %w", err)
+	}
+	var data RetryOp
+	err = json.Unmarshal(retryOperation.Metadata, &data)
+	if err != nil {
+		return "", fmt.Errorf("error unmarshaling retry operation metadata: %v", err)
+	}
+	return data.Build.ID, nil
+}
+
+func (c *cloudBuildAPI) CancelBuild(ctx context.Context, projectID, region, buildID string) error {
+	_, err := c.svc.Projects.Locations.Builds.Cancel(fmt.Sprintf("projects/%s/locations/%s/builds/%s", projectID, region, buildID), &cloudbuild.CancelBuildRequest{}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to cancel build %s: %w", buildID, err)
+	}
+	return nil
+}
+
+func (c *cloudBuildAPI) GetWorkerPool(ctx context.Context, workerPoolName string) (WorkerPool, error) {
+	wp, err := c.svc.Projects.Locations.WorkerPools.Get(workerPoolName).Context(ctx).Do()
+	if err != nil {
+		return WorkerPool{}, fmt.Errorf("failed to get worker pool %s: %w", workerPoolName, err)
+	}
+	pool := WorkerPool{Name: wp.Name}
+	if wp.PrivatePoolV1Config != nil && wp.PrivatePoolV1Config.NetworkConfig != nil {
+		pool.EgressOption = wp.PrivatePoolV1Config.NetworkConfig.EgressOption
+		pool.PeeredNetwork = wp.PrivatePoolV1Config.NetworkConfig.PeeredNetwork
+		pool.PeeredNetworkIPRange = wp.PrivatePoolV1Config.NetworkConfig.PeeredNetworkIpRange
+	}
+	return pool, nil
+}
+
+type cloudDeployAPI struct {
+	svc *clouddeploy.Service
+}
+
+func (c *cloudDeployAPI) GetRelease(ctx context.Context, releaseName string) (Release, error) {
+	r, err := c.svc.Projects.Locations.DeliveryPipelines.Releases.Get(releaseName).Context(ctx).Do()
+	if err != nil {
+		return Release{}, fmt.Errorf("failed to get release %s: %w", releaseName, err)
+	}
+	release := Release{Name: r.Name}
+	if r.DeliveryPipelineSnapshot != nil && r.DeliveryPipelineSnapshot.SerialPipeline != nil {
+		for _, stage := range r.DeliveryPipelineSnapshot.SerialPipeline.Stages {
+			if _, ok := r.TargetArtifacts[stage.TargetId]; ok {
+				release.TargetIDs = append(release.TargetIDs, stage.TargetId)
+			}
+		}
+	}
+	if len(release.TargetIDs) == 0 {
+		release.TargetIDs = slices.Sorted(maps.Keys(r.TargetArtifacts))
+	}
+	return release, nil
+}
+
+func (c *cloudDeployAPI) ListRollouts(ctx context.Context, releaseName, targetID string) ([]Rollout, error) {
+	rollouts := []Rollout{}
+	err := c.svc.Projects.Locations.DeliveryPipelines.Releases.Rollouts.List(releaseName).
+		Filter(fmt.Sprintf("targetId=%q", targetID)).
+		Pages(ctx, func(resp *clouddeploy.ListRolloutsResponse) error {
+			for _, r := range resp.Rollouts {
+				rollouts = append(rollouts, newRollout(r))
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rollouts of release %s: %w", releaseName, err)
+	}
+	return rollouts, nil
+}
+
+func (c *cloudDeployAPI) GetRollout(ctx context.Context, rolloutName string) (Rollout, error) {
+	r, err := c.svc.Projects.Locations.DeliveryPipelines.Releases.Rollouts.Get(rolloutName).Context(ctx).Do()
+	if err != nil {
+		return Rollout{}, fmt.Errorf("failed to get rollout %s: %w", rolloutName, err)
+	}
+	return newRollout(r), nil
+}
+
+func (c *cloudDeployAPI) ApproveRollout(ctx context.Context, rolloutName string) error {
+	_, err := c.svc.Projects.Locations.DeliveryPipelines.Releases.Rollouts.Approve(rolloutName, &clouddeploy.ApproveRolloutRequest{Approved: true}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to approve rollout %s: %w", rolloutName, err)
+	}
+	return nil
+}
+
+func (c *cloudDeployAPI) AdvanceRollout(ctx context.Context, rolloutName, phaseID string) error {
+	_, err := c.svc.Projects.Locations.DeliveryPipelines.Releases.Rollouts.Advance(rolloutName, &clouddeploy.AdvanceRolloutRequest{PhaseId: phaseID}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to advance rollout %s to phase %s: %w", rolloutName, phaseID, err)
+	}
+	return nil
+}
+
+// RollbackTarget creates a rollout of the last successful release to the target, like gcloud deploy targets rollback.
+func (c *cloudDeployAPI) RollbackTarget(ctx context.Context, pipelineName, targetID string) (string, error) {
+	prefix := "rollback-" + targetID
+	suffix := fmt.Sprintf("-%d", time.Now().Unix())
+	if len(prefix)+len(suffix) > maxRolloutIDLength {
+		prefix = strings.TrimRight(prefix[:maxRolloutIDLength-len(suffix)], "-")
+	}
+	id := prefix + suffix
+	resp, err := c.svc.Projects.Locations.DeliveryPipelines.RollbackTarget(pipelineName, &clouddeploy.RollbackTargetRequest{
+		TargetId:  targetID,
+		RolloutId: id,
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to roll back target %s of delivery pipeline %s: %w", targetID, pipelineName, err)
+	}
+	if resp.RollbackConfig == nil || resp.RollbackConfig.Rollout == nil {
+		return "", nil
+	}
+	return resp.RollbackConfig.Rollout.Name, nil
+}
+
+// newRollout converts a Cloud Deploy API rollout.
+func newRollout(r *clouddeploy.Rollout) Rollout {
+	rollout := Rollout{
+		Name:          r.Name,
+		TargetID:      r.TargetId,
+		State:         r.State,
+		ApprovalState: r.ApprovalState,
+		FailureReason: r.FailureReason,
+		CreateTime:    r.CreateTime,
+	}
+	for _, p := range r.Phases {
+		rollout.Phases = append(rollout.Phases, RolloutPhase{ID: p.Id, State: p.State})
+	}
+	return rollout
+}
+
+// PromoteRelease creates a rollout of the release to the target, like gcloud deploy releases promote.
+func (c *cloudDeployAPI) PromoteRelease(ctx context.Context, releaseName, targetID string) error {
+	existing, err := c.ListRollouts(ctx, releaseName, targetID)
+	if err != nil {
+		return err
+	}
+	id := rolloutID(releaseName, targetID, len(existing)+1)
+	_, err = c.svc.Projects.Locations.DeliveryPipelines.Releases.Rollouts.Create(releaseName, &clouddeploy.Rollout{TargetId: targetID}).
+		RolloutId(id).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to promote release %s to target %s: %w", releaseName, targetID, err)
+	}
+	return nil
+}
+
+// rolloutID returns the ID gcloud uses for the n-th rollout of a release to a target, RELEASE-to-TARGET-000N.
+// The release ID is truncated to fit the maximum length of the rollout ID.
+func rolloutID(releaseName, targetID string, n int) string {
+	releaseID := releaseName[strings.LastIndex(releaseName, "/")+1:]
+	suffix := fmt.Sprintf("-to-%s-%04d", targetID, n)
+	if len(releaseID)+len(suffix) > maxRolloutIDLength {
+		releaseID = strings.TrimRight(releaseID[:max(0, maxRolloutIDLength-len(suffix))], "-")
+	}
+	return releaseID + suffix
+}
+
+type serviceUsageAPI struct {
+	svc *serviceusage.Service
+}
+
+func (c *serviceUsageAPI) IsServiceEnabled(ctx context.Context, projectID, service string) (bool, error) {
+	s, err := c.svc.Services.Get(fmt.Sprintf("projects/%s/services/%s", projectID, service)).Context(ctx).Do()
+	if err != nil {
+		return false, fmt.Errorf("failed to get service %s in project %s: %w", service, projectID, err)
+	}
+	return s.State == "ENABLED", nil
+}
+
+// EnableServices enables the services and waits for the operation to finish, like gcloud services enable.
+func (c *serviceUsageAPI) EnableServices(ctx context.Context, projectID string, services []string) error {
+	op, err := c.svc.Services.BatchEnable(fmt.Sprintf("projects/%s", projectID), &serviceusage.BatchEnableServicesRequest{ServiceIds: services}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to enable services %s in project %s: %w", strings.Join(services, ", "), projectID, err)
+	}
+	for !op.Done {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(operationPollInterval):
+		}
+		name := op.Name
+		op, err = c.svc.Operations.Get(name).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("failed to get operation %s: %w", name, err)
+		}
+	}
+	if op.Error != nil {
+		return fmt.Errorf("failed to enable services %s in project %s: %s", strings.Join(services, ", "), projectID, op.Error.Message)
+	}
+	return nil
+}
+
+type secretManagerAPI struct {
+	svc *secretmanager.Service
+}
+
+func (c *secretManagerAPI) AccessSecretVersion(ctx context.Context, versionName string) (string, error) {
+	resp, err := c.svc.Projects.Secrets.Versions.Access(versionName).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to access secret version %s: %w", versionName, err)
+	}
+	if resp.Payload == nil {
+		return "", nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode secret version %s: %w", versionName, err)
+	}
+	return string(decoded), nil
+}
+
+type resourceManagerAPI struct {
+	svc *cloudresourcemanager.Service
+}
+
+// TestIAMPermissions tests the permissions in chunks, the API accepts at most 100 permissions per request.
+func (c *resourceManagerAPI) TestIAMPermissions(ctx context.Context, resource string, permissions []string) ([]string, error) {
+	granted := []string{}
+	for chunk := range slices.Chunk(permissions, maxTestPermissions) {
+		req := &cloudresourcemanager.TestIamPermissionsRequest{Permissions: chunk}
+		var resp *cloudresourcemanager.TestIamPermissionsResponse
+		var err error
+		switch {
+		case strings.HasPrefix(resource, "projects/"):
+			resp, err = c.svc.Projects.TestIamPermissions(resource, req).Context(ctx).Do()
+		case strings.HasPrefix(resource, "folders/"):
+			resp, err = c.svc.Folders.TestIamPermissions(resource, req).Context(ctx).Do()
+		case strings.HasPrefix(resource, "organizations/"):
+			resp, err = c.svc.Organizations.TestIamPermissions(resource, req).Context(ctx).Do()
+		default:
+			return nil, fmt.Errorf("invalid resource '%s', use projects/PROJECT_ID, folders/FOLDER_ID or organizations/ORG_ID", resource)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to test permissions on %s: %w", resource, err)
+		}
+		granted = append(granted, resp.Permissions...)
+	}
+	return granted, nil
+}
+
+type loggingAPI struct {
+	svc *logging.Service
+}
+
+func (c *loggingAPI) ListLogEntries(ctx context.Context, projectID, filter string) ([]LogEntry, error) {
+	entries := []LogEntry{}
+	req := &logging.ListLogEntriesRequest{
+		ResourceNames: []string{"projects/" + projectID},
+		Filter:        filter,
+		OrderBy:       "timestamp asc",
+		PageSize:      maxLogEntriesPageSize,
+	}
+	err := c.svc.Entries.List(req).Pages(ctx, func(resp *logging.ListLogEntriesResponse) error {
+		for _, e := range resp.Entries {
+			entries = append(entries, LogEntry{InsertID: e.InsertId, Timestamp: e.Timestamp, Labels: e.Labels, Text: e.TextPayload})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log entries: %w", err)
+	}
+	return entries, nil
+}
+
+type identityAPI struct {
+	svc    *oauth2api.Service
+	tokens oauth2.TokenSource
+}
+
+// ActiveAccount returns the email of the credentials from the token info of their access token.
+func (c *identityAPI) ActiveAccount(ctx context.Context) (string, error) {
+	token, err := c.tokens.Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+	info, err := c.svc.Tokeninfo().AccessToken(token.AccessToken).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to get token info: %w", err)
+	}
+	if info.Email == "" {
+		return "", errors.New("the access token of the credentials has no email, check that the credentials have the userinfo.email scope")
+	}
+	return info.Email, nil
+}
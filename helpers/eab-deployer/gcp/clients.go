@@ -0,0 +1,182 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// WorkerPool is the network configuration of a Cloud Build private worker pool.
+type WorkerPool struct {
+	Name                 string
+	EgressOption         string
+	PeeredNetwork        string
+	PeeredNetworkIPRange string
+}
+
+// Release is a Cloud Deploy release.
+// TargetIDs are the targets of the release in the order of the delivery pipeline stages.
+type Release struct {
+	Name      string
+	TargetIDs []string
+}
+
+// Rollout is a Cloud Deploy rollout of a release to a target.
+// Phases are the phases of the rollout in order, like canary-25 and stable for canary deployments.
+type Rollout struct {
+	Name          string
+	TargetID      string
+	State         string
+	ApprovalState string
+	FailureReason string
+	CreateTime    string
+	Phases        []RolloutPhase
+}
+
+// RolloutPhase is a phase of a Cloud Deploy rollout.
+type RolloutPhase struct {
+	ID    string
+	State string
+}
+
+// LogEntry is a Cloud Logging log entry with a text payload.
+type LogEntry struct {
+	InsertID  string
+	Timestamp string
+	Labels    map[string]string
+	Text      string
+}
+
+// CloudBuildClient is the Cloud Build API used by the helper.
+// Builds are listed from the most recent to the oldest, filter uses the Cloud Build API filter syntax
+// and limit is the maximum number of builds returned, zero for no limit.
+type CloudBuildClient interface {
+	ListBuilds(ctx context.Context, projectID, region, filter string, limit int64) ([]Build, error)
+	GetBuild(ctx context.Context, projectID, region, buildID string) (Build, error)
+	RetryBuild(ctx context.Context, buildName string) (string, error)
+	CancelBuild(ctx context.Context, projectID, region, buildID string) error
+	GetWorkerPool(ctx context.Context, workerPoolName string) (WorkerPool, error)
+}
+
+// CloudDeployClient is the Cloud Deploy API used by the helper.
+// RollbackTarget rolls back the target of a delivery pipeline to its last successful release and returns the name of the rollback rollout.
+type CloudDeployClient interface {
+	GetRelease(ctx context.Context, releaseName string) (Release, error)
+	ListRollouts(ctx context.Context, releaseName, targetID string) ([]Rollout, error)
+	GetRollout(ctx context.Context, rolloutName string) (Rollout, error)
+	PromoteRelease(ctx context.Context, releaseName, targetID string) error
+	ApproveRollout(ctx context.Context, rolloutName string) error
+	AdvanceRollout(ctx context.Context, rolloutName, phaseID string) error
+	RollbackTarget(ctx context.Context, pipelineName, targetID string) (string, error)
+}
+
+// ServiceUsageClient is the Service Usage API used by the helper.
+type ServiceUsageClient interface {
+	IsServiceEnabled(ctx context.Context, projectID, service string) (bool, error)
+	EnableServices(ctx context.Context, projectID string, services []string) error
+}
+
+// SecretManagerClient is the Secret Manager API used by the helper.
+// AccessSecretVersion returns the decoded payload of the secret version.
+type SecretManagerClient interface {
+	AccessSecretVersion(ctx context.Context, versionName string) (string, error)
+}
+
+// ResourceManagerClient is the Resource Manager API used by the helper.
+// Resource is projects/PROJECT_ID, folders/FOLDER_ID or organizations/ORG_ID.
+type ResourceManagerClient interface {
+	TestIAMPermissions(ctx context.Context, resource string, permissions []string) ([]string, error)
+}
+
+// LoggingClient is the Cloud Logging API used by the helper.
+// Entries of the project that satisfy the filter are listed in timestamp order.
+type LoggingClient interface {
+	ListLogEntries(ctx context.Context, projectID, filter string) ([]LogEntry, error)
+}
+
+// IdentityClient is the identity of the credentials used by the helper.
+// ActiveAccount returns the email of the user or service account of the credentials.
+type IdentityClient interface {
+	ActiveAccount(ctx context.Context) (string, error)
+}
+
+// Clients are the typed Google Cloud API clients used by the wrapper.
+// A nil client means that the wrapper uses the gcloud CLI for the operations of that API.
+type Clients struct {
+	CloudBuild      CloudBuildClient
+	CloudDeploy     CloudDeployClient
+	ServiceUsage    ServiceUsageClient
+	SecretManager   SecretManagerClient
+	ResourceManager ResourceManagerClient
+	Logging         LoggingClient
+	Identity        IdentityClient
+}
+
+var (
+	useGcloud      bool
+	defaultClients = sync.OnceValue(func() Clients {
+		if useGcloud {
+			return Clients{}
+		}
+		clients, err := NewAPIClients(context.Background())
+		if err != nil {
+			fmt.Printf("# Google Cloud client libraries not available, using gcloud. Error: %s\n", err.Error())
+			return Clients{}
+		}
+		return clients
+	})
+)
+
+// UseGcloud makes the wrappers created by NewGCP use the gcloud CLI instead of the Google Cloud client libraries.
+// It must be called before the first wrapper is created.
+func UseGcloud() {
+	useGcloud = true
+}
+
+// apiBuildFilter converts a gcloud builds list filter, like `substitutions.COMMIT_SHA:SHA`
+// or `source.repoSource.repoName:REPO`, to the Cloud Build API filter syntax.
+func apiBuildFilter(filter string) string {
+	key, value, found := strings.Cut(filter, ":")
+	if !found {
+		return filter
+	}
+	fields := strings.Split(key, ".")
+	for i, f := range fields {
+		// substitution names are user defined and are kept as they are
+		if i > 0 && fields[i-1] == "substitutions" {
+			continue
+		}
+		fields[i] = snakeCase(f)
+	}
+	return fmt.Sprintf("%s=%q", strings.Join(fields, "."), strings.Trim(value, `"`))
+}
+
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,333 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gotest "testing"
+
+	"github.com/mitchellh/go-testing-interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestAPIBuildFilter(t *gotest.T) {
+	assert.Equal(t, `substitutions.COMMIT_SHA="abc123"`, apiBuildFilter("substitutions.COMMIT_SHA:abc123"))
+	assert.Equal(t, `source.repo_source.repo_name="eab-fleetscope"`, apiBuildFilter("source.repoSource.repoName:eab-fleetscope"))
+	assert.Equal(t, `status="SUCCESS"`, apiBuildFilter(`status="SUCCESS"`))
+}
+
+func TestRolloutID(t *gotest.T) {
+	release := "projects/p/locations/us-central1/deliveryPipelines/hello-world/releases/hello-world-0123456"
+	assert.Equal(t, "hello-world-0123456-to-production-0001", rolloutID(release, "production", 1))
+
+	id := rolloutID("releases/"+strings.Repeat("a", 60), "nonproduction", 2)
+	assert.Len(t, id, maxRolloutIDLength)
+	assert.True(t, strings.HasSuffix(id, "-to-nonproduction-0002"))
+}
+
+func TestGetBuildsWithClient(t *gotest.T) {
+	cb := &fakeCloudBuild{builds: []Build{
+		{ID: "b2", Status: BuildStatusWorking},
+		{ID: "b1", Status: BuildStatusFailure},
+	}}
+	g := GCP{Clients: Clients{CloudBuild: cb}}
+
+	assert.Equal(t, map[string]string{"b2": BuildStatusWorking, "b1": BuildStatusFailure}, g.GetBuilds(t, "prj", "us-central1", "substitutions.COMMIT_SHA:abc"))
+	status, id := g.GetLastBuildStatus(t, "prj", "us-central1", "substitutions.COMMIT_SHA:abc")
+	assert.Equal(t, BuildStatusWorking, status)
+	assert.Equal(t, "b2", id)
+	assert.Equal(t, []string{`substitutions.COMMIT_SHA="abc"`, `substitutions.COMMIT_SHA="abc"`}, cb.filters)
+}
+
+func TestWaitBuildSuccessWithClient(t *gotest.T) {
+	cb := &fakeCloudBuild{
+		builds: []Build{{ID: "b1", Status: BuildStatusQueued}},
+		statuses: map[string][]string{
+			"b1": {BuildStatusQueued, BuildStatusWorking, BuildStatusSuccess},
+		},
+	}
+	g := GCP{
+		Clients: Clients{CloudBuild: cb},
+		wait:    testWait,
+		TriggerNewBuild: func(t testing.TB, ctx context.Context, buildName string) (string, error) {
+			return cb.RetryBuild(ctx, buildName)
+		},
+		Runf: func(t testing.TB, cmd string, args ...interface{}) gjson.Result {
+			assert.Fail(t, "gcloud must not be called", cmd)
+			return gjson.Result{}
+		},
+	}
+
+	err := g.WaitBuildSuccess(context.Background(), t, "prj", "us-central1", "repo", "abc", "failed", time.Minute, 2, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Empty(t, cb.retried)
+}
+
+func TestWaitReleaseSuccessWithClient(t *gotest.T) {
+	release := "projects/prj/locations/us-central1/deliveryPipelines/hello-world/releases/hello-world-abc"
+	cd := &fakeCloudDeploy{
+		releases: map[string]Release{
+			release: {Name: release, TargetIDs: []string{"development", "nonproduction", "production"}},
+		},
+		rollouts: map[string][]Rollout{
+			"development": {{TargetID: "development", State: ReleaseStatusSuccess}},
+		},
+		promotedState: ReleaseStatusSuccess,
+	}
+	g := GCP{Clients: Clients{CloudDeploy: cd}, wait: testWait}
+
+	err := g.WaitReleaseSuccess(context.Background(), t, "prj", "us-central1", "hello-world", "abc", "failed", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"nonproduction", "production"}, cd.promoted)
+
+	cd.rollouts = map[string][]Rollout{
+		"development": {{TargetID: "development", State: ReleaseStatusSuccess}},
+	}
+	cd.promoted = nil
+	cd.promotedState = ReleaseStatusFailure
+	err = g.WaitReleaseSuccess(context.Background(), t, "prj", "us-central1", "hello-world", "abc", "failed", time.Minute)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"nonproduction"}, cd.promoted)
+	assert.Equal(t, []string{"nonproduction"}, cd.rolledBack)
+}
+
+func TestWaitRelease(t *gotest.T) {
+	release := "projects/prj/locations/us-central1/deliveryPipelines/hello-world/releases/hello-world-abc"
+	tests := []struct {
+		name           string
+		rollouts       RolloutOptions
+		promotedState  string
+		promotedPhases []RolloutPhase
+		approvedState  string
+		lag            bool
+		wantErr        bool
+		wantStates     []string
+		wantApproved   int
+		wantAdvanced   []string
+		wantRollback   string
+	}{
+		{
+			name:          "approval",
+			rollouts:      RolloutOptions{AutoApprove: true},
+			promotedState: RolloutStatusPendingApproval,
+			approvedState: ReleaseStatusSuccess,
+			wantStates:    []string{ReleaseStatusSuccess, ReleaseStatusSuccess},
+			wantApproved:  1,
+		},
+		{
+			name:          "approval with lag",
+			rollouts:      RolloutOptions{AutoApprove: true},
+			promotedState: RolloutStatusPendingApproval,
+			approvedState: ReleaseStatusSuccess,
+			lag:           true,
+			wantStates:    []string{ReleaseStatusSuccess, ReleaseStatusSuccess},
+			wantApproved:  1,
+		},
+		{
+			name:          "approval timeout",
+			rollouts:      RolloutOptions{ApprovalTimeout: 10 * time.Millisecond},
+			promotedState: RolloutStatusPendingApproval,
+			wantErr:       true,
+			wantStates:    []string{ReleaseStatusSuccess, RolloutStatusPendingApproval},
+		},
+		{
+			name:          "canary",
+			promotedState: ReleaseStatusWorking,
+			promotedPhases: []RolloutPhase{
+				{ID: "canary-25", State: PhaseStatusSucceeded},
+				{ID: "canary-50", State: PhaseStatusPending},
+				{ID: "stable", State: PhaseStatusPending},
+			},
+			wantStates:   []string{ReleaseStatusSuccess, ReleaseStatusSuccess},
+			wantAdvanced: []string{"canary-50", "stable"},
+		},
+		{
+			name:          "canary with lag",
+			promotedState: ReleaseStatusWorking,
+			promotedPhases: []RolloutPhase{
+				{ID: "canary-25", State: PhaseStatusSucceeded},
+				{ID: "canary-50", State: PhaseStatusPending},
+				{ID: "stable", State: PhaseStatusPending},
+			},
+			lag:          true,
+			wantStates:   []string{ReleaseStatusSuccess, ReleaseStatusSuccess},
+			wantAdvanced: []string{"canary-50", "stable"},
+		},
+		{
+			name:          "rollback",
+			promotedState: ReleaseStatusFailure,
+			wantErr:       true,
+			wantStates:    []string{ReleaseStatusSuccess, ReleaseStatusFailure},
+			wantRollback:  ReleaseStatusSuccess,
+		},
+		{
+			name:          "rollback disabled",
+			rollouts:      RolloutOptions{DisableRollback: true},
+			promotedState: ReleaseStatusFailure,
+			wantErr:       true,
+			wantStates:    []string{ReleaseStatusSuccess, ReleaseStatusFailure},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *gotest.T) {
+			cd := &fakeCloudDeploy{
+				releases: map[string]Release{
+					release: {Name: release, TargetIDs: []string{"development", "production"}},
+				},
+				rollouts: map[string][]Rollout{
+					"development": {{Name: release + "/rollouts/hello-world-abc-to-development-0001", TargetID: "development", State: ReleaseStatusSuccess}},
+				},
+				promotedState:  tt.promotedState,
+				promotedPhases: tt.promotedPhases,
+				approvedState:  tt.approvedState,
+				lag:            tt.lag,
+			}
+			wait := testWait
+			wait.Rollouts = tt.rollouts
+			g := GCP{Clients: Clients{CloudDeploy: cd}, wait: wait}
+
+			results, err := g.WaitRelease(context.Background(), t, "prj", "us-central1", "hello-world", "abc", time.Minute)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			states := []string{}
+			for _, r := range results {
+				states = append(states, r.State)
+			}
+			assert.Equal(t, tt.wantStates, states)
+			assert.Len(t, cd.approved, tt.wantApproved)
+			assert.Equal(t, tt.wantAdvanced, cd.advanced)
+			assert.Equal(t, tt.wantRollback, results[1].Rollback)
+		})
+	}
+}
+
+func TestWaitReleaseNotStarted(t *gotest.T) {
+	release := "projects/prj/locations/us-central1/deliveryPipelines/hello-world/releases/hello-world-abc"
+	cd := &fakeCloudDeploy{
+		releases: map[string]Release{
+			release: {Name: release, TargetIDs: []string{"development", "nonproduction", "production"}},
+		},
+		rollouts: map[string][]Rollout{
+			"development": {{TargetID: "development", State: ReleaseStatusFailure}},
+		},
+	}
+	g := GCP{Clients: Clients{CloudDeploy: cd}, wait: testWait}
+	g.wait.Rollouts.DisableRollback = true
+
+	results, err := g.WaitRelease(context.Background(), t, "prj", "us-central1", "hello-world", "abc", time.Minute)
+	assert.Error(t, err)
+	assert.Equal(t, "development: FAILED", results[0].String())
+	assert.Equal(t, RolloutStatusNotStarted, results[1].State)
+	assert.Equal(t, RolloutStatusNotStarted, results[2].State)
+	assert.Empty(t, cd.promoted)
+}
+
+func TestGetReleaseTargets(t *gotest.T) {
+	g := GCP{
+		Runf: func(t testing.TB, cmd string, args ...interface{}) gjson.Result {
+			return gjson.Parse(`{
+				"targetArtifacts": {"production": {}, "development": {}, "nonproduction": {}},
+				"deliveryPipelineSnapshot": {"serialPipeline": {"stages": [
+					{"targetId": "development"}, {"targetId": "nonproduction"}, {"targetId": "production"}
+				]}}
+			}`)
+		},
+	}
+	assert.Equal(t, []string{"development", "nonproduction", "production"}, g.GetReleaseTargets(t, "release"))
+}
+
+func TestServiceUsageWithClient(t *gotest.T) {
+	su := &fakeServiceUsage{enabled: map[string][]string{"prj": {"iam.googleapis.com"}}}
+	g := GCP{Clients: Clients{ServiceUsage: su}}
+
+	assert.True(t, g.IsApiEnabled(t, "prj", "iam.googleapis.com"))
+	assert.False(t, g.IsApiEnabled(t, "prj", "cloudbuild.googleapis.com"))
+	g.EnableApis(t, "prj", []string{"cloudbuild.googleapis.com"})
+	assert.True(t, g.IsApiEnabled(t, "prj", "cloudbuild.googleapis.com"))
+}
+
+func TestGetSecretValueWithClient(t *gotest.T) {
+	sm := &fakeSecretManager{secrets: map[string]string{
+		"projects/prj/secrets/github-token/versions/latest": "token",
+	}}
+	g := GCP{Clients: Clients{SecretManager: sm}}
+	assert.Equal(t, "token", g.GetSecretValue(t, "projects/prj/secrets/github-token"))
+}
+
+func TestTestIAMPermissionsWithClient(t *gotest.T) {
+	rm := &fakeResourceManager{granted: map[string][]string{
+		"folders/123": {"resourcemanager.folders.get", "resourcemanager.projects.create"},
+	}}
+	g := GCP{Clients: Clients{ResourceManager: rm}}
+	granted, err := g.TestIAMPermissions(t, "folders/123", []string{"resourcemanager.folders.get", "resourcemanager.folders.delete"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"resourcemanager.folders.get"}, granted)
+}
+
+func TestGetActiveAccountWithClient(t *gotest.T) {
+	g := GCP{
+		Clients: Clients{Identity: &fakeIdentity{account: "sa@prj.iam.gserviceaccount.com"}},
+		Runf: func(t testing.TB, cmd string, args ...interface{}) gjson.Result {
+			t.Fatalf("gcloud must not be called, called with: %s", fmt.Sprintf(cmd, args...))
+			return gjson.Result{}
+		},
+	}
+	assert.Equal(t, "sa@prj.iam.gserviceaccount.com", g.GetActiveAccount(t))
+}
+
+func TestGetWorkerPool(t *gotest.T) {
+	name := "projects/prj/locations/us-central1/workerPools/pool"
+	expected := WorkerPool{
+		Name:                 name,
+		EgressOption:         "NO_PUBLIC_EGRESS",
+		PeeredNetwork:        "projects/123/global/networks/net",
+		PeeredNetworkIPRange: "/24",
+	}
+	g := GCP{Clients: Clients{CloudBuild: &fakeCloudBuild{workerPools: map[string]WorkerPool{name: expected}}}}
+	assert.Equal(t, expected, g.GetWorkerPool(t, "prj", "us-central1", "pool"))
+
+	g = GCP{
+		Runf: func(t testing.TB, cmd string, args ...interface{}) gjson.Result {
+			assert.Equal(t, "builds worker-pools describe pool --region=us-central1 --project=prj", fmt.Sprintf(cmd, args...))
+			return gjson.Parse(`{"name": "` + name + `", "privatePoolV1Config": {"networkConfig": {
+				"egressOption": "NO_PUBLIC_EGRESS", "peeredNetwork": "projects/123/global/networks/net", "peeredNetworkIpRange": "/24"}}}`)
+		},
+	}
+	assert.Equal(t, expected, g.GetWorkerPool(t, "prj", "us-central1", "pool"))
+}
+
+func TestLatestRolloutGcloud(t *gotest.T) {
+	g := GCP{
+		Runf: func(t testing.TB, cmd string, args ...interface{}) gjson.Result {
+			return gjson.Parse(`[
+				{"name": "r-0001", "targetId": "production", "state": "FAILED", "createTime": "2025-01-01T10:00:00Z"},
+				{"name": "r-0002", "targetId": "production", "state": "IN_PROGRESS", "createTime": "2025-01-01T11:00:00Z",
+				 "phases": [{"id": "canary-50", "state": "SUCCEEDED"}, {"id": "stable", "state": "PENDING"}]}
+			]`)
+		},
+	}
+	rollout, err := g.latestRollout(t, "prj", "us-central1", "hello-world", "release", "production")
+	assert.NoError(t, err)
+	assert.Equal(t, "r-0002", rollout.Name)
+	assert.Equal(t, "stable", rollout.nextPhase())
+}
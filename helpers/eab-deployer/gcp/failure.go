@@ -0,0 +1,158 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const troubleshootingURL = "https://github.com/GoogleCloudPlatform/terraform-google-enterprise-application/blob/main/docs/TROUBLESHOOTING.md"
+
+var (
+	// logStepPrefixRegexp matches the build step prefix of the lines of a Cloud Build log, like `Step #0 - "tf plan": `.
+	logStepPrefixRegexp = regexp.MustCompile(`^Step #\d+(?: - "[^"]*")?: ?`)
+	// terraformResourceRegexp matches the line of a Terraform error with the address of the failing resource.
+	terraformResourceRegexp = regexp.MustCompile(`^\s*with (\S+),$`)
+
+	// FailureCauses are the known root causes of failed builds, checked in order.
+	FailureCauses = []FailureCause{
+		{
+			ID:          "billing-quota",
+			Description: "Billing quota exceeded",
+			Remediation: "Request a billing quota increase for the service account of the stage in https://support.google.com/code/contact/billing_quota_increase and retry the build after the confirmation.",
+			DocsURL:     troubleshootingURL + "#billing-quota-exceeded",
+			Pattern:     regexp.MustCompile(`Cloud billing quota exceeded|Error setting billing account .*Precondition check failed`),
+		},
+		{
+			ID:          "vpc-sc",
+			Description: "Request blocked by VPC Service Controls",
+			Remediation: "Add an ingress or egress rule for the identity and service of the request to the service perimeter, the vpcServiceControlsUniqueIdentifier of the error identifies the violation in the audit logs.",
+			DocsURL:     "https://cloud.google.com/vpc-service-controls/docs/troubleshooting",
+			Pattern:     regexp.MustCompile(`Request is prohibited by organization's policy|vpcServiceControlsUniqueIdentifier|VPC_SERVICE_CONTROLS`),
+		},
+		{
+			ID:          "group-admin",
+			Description: "Missing Group Admin role",
+			Remediation: "Request a Super Admin to grant the Group Admin role in the Admin Console of the Google Workspace to the service account of the stage.",
+			DocsURL:     "https://cloud.google.com/identity/docs/how-to/setup#assigning_an_admin_role_to_the_service_account",
+			Pattern:     regexp.MustCompile(`Error (creating|reading|updating) Group.*Error 403|cloudidentity\.googleapis\.com.*(PERMISSION_DENIED|Error 403)`),
+		},
+		{
+			ID:          "state-lock",
+			Description: "Terraform state locked",
+			Remediation: "Make sure there are no other builds running for the stage and release the lock with `terraform force-unlock LOCK_ID` using the ID in the lock info of the error.",
+			DocsURL:     troubleshootingURL + "#terraform-error-acquiring-the-state-lock",
+			Pattern:     regexp.MustCompile(`Error acquiring the state lock`),
+		},
+		{
+			ID:          "cpu-quota",
+			Description: "Compute Engine CPU quota exceeded",
+			Remediation: "Request an increase of the CPUS_ALL_REGIONS quota of the project in the quotas page of the console.",
+			DocsURL:     troubleshootingURL + "#quota-cpus_all_regions-exceeded",
+			Pattern:     regexp.MustCompile(`Quota 'CPUS_ALL_REGIONS' exceeded`),
+		},
+		{
+			ID:          "ip-exhausted",
+			Description: "Subnetwork IP range exhausted",
+			Remediation: "Add a secondary range to the subnetwork of the cluster, or expand the exhausted range.",
+			DocsURL:     troubleshootingURL + "#insufficient-free-ip-addresses",
+			Pattern:     regexp.MustCompile(`Insufficient free IP addresses`),
+		},
+	}
+)
+
+// FailureCause is a known root cause of failed builds, identified by a pattern in the build log.
+type FailureCause struct {
+	ID          string
+	Description string
+	Remediation string
+	DocsURL     string
+	Pattern     *regexp.Regexp
+}
+
+// BuildFailure is the classification of the log of a failed build.
+// Cause is nil when the root cause is not known.
+// Resource and ErrorBlock are the address of the failing Terraform resource and the Terraform error, if found.
+type BuildFailure struct {
+	Cause      *FailureCause
+	Resource   string
+	ErrorBlock string
+}
+
+// ClassifyBuildFailure finds the root cause and the Terraform error of a failed build in its log.
+func ClassifyBuildFailure(logs string) BuildFailure {
+	var f BuildFailure
+	for i, c := range FailureCauses {
+		if c.Pattern.MatchString(logs) {
+			f.Cause = &FailureCauses[i]
+			break
+		}
+	}
+	f.Resource, f.ErrorBlock = terraformError(logs)
+	return f
+}
+
+// Hint returns the description of the failure to be shown to the user, empty if nothing is known about it.
+func (f BuildFailure) Hint() string {
+	var b strings.Builder
+	if f.Cause != nil {
+		fmt.Fprintf(&b, "Cause: %s.\n", f.Cause.Description)
+		fmt.Fprintf(&b, "Remediation: %s\n", f.Cause.Remediation)
+		fmt.Fprintf(&b, "Docs: %s\n", f.Cause.DocsURL)
+	}
+	if f.Resource != "" {
+		fmt.Fprintf(&b, "Resource: %s\n", f.Resource)
+	}
+	if f.ErrorBlock != "" {
+		fmt.Fprintf(&b, "Terraform error:\n%s\n", f.ErrorBlock)
+	}
+	return b.String()
+}
+
+// terraformError returns the address of the failing resource and the block of the first Terraform error in the log.
+// The block ends with the closing mark of the error box, or with an empty line when the error is not in a box.
+func terraformError(logs string) (string, string) {
+	lines := strings.Split(logs, "\n")
+	start := -1
+	boxed := false
+	for i, l := range lines {
+		l = logStepPrefixRegexp.ReplaceAllString(l, "")
+		text := strings.TrimLeft(l, "│ ")
+		if strings.HasPrefix(text, "Error: ") {
+			start = i
+			boxed = strings.HasPrefix(l, "│")
+			break
+		}
+	}
+	if start < 0 {
+		return "", ""
+	}
+	resource := ""
+	block := []string{}
+	for _, l := range lines[start:] {
+		l = strings.TrimRight(logStepPrefixRegexp.ReplaceAllString(l, ""), " \r")
+		if (boxed && strings.HasPrefix(l, "╵")) || (!boxed && l == "") {
+			break
+		}
+		l = strings.TrimPrefix(strings.TrimPrefix(l, "│"), " ")
+		if m := terraformResourceRegexp.FindStringSubmatch(l); m != nil && resource == "" {
+			resource = m[1]
+		}
+		block = append(block, l)
+	}
+	return resource, strings.TrimRight(strings.Join(block, "\n"), "\n")
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"os"
+	"path/filepath"
+
+	gotest "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyBuildFailure(t *gotest.T) {
+	tests := []struct {
+		name     string
+		logs     string
+		cause    string
+		resource string
+		block    string
+	}{
+		{
+			name:  "billing quota",
+			logs:  `Error: Error setting billing account "XXXXXX-XXXXXX-XXXXXX" for project "projects/some-project": googleapi: Error 400: Precondition check failed., failedPrecondition`,
+			cause: "billing-quota",
+			block: `Error: Error setting billing account "XXXXXX-XXXXXX-XXXXXX" for project "projects/some-project": googleapi: Error 400: Precondition check failed., failedPrecondition`,
+		},
+		{
+			name:  "vpc-sc",
+			logs:  "Step #0: ERROR: (gcloud.artifacts.docker.images.list) Request is prohibited by organization's policy. vpcServiceControlsUniqueIdentifier: abc123",
+			cause: "vpc-sc",
+		},
+		{
+			name:  "cpu quota",
+			logs:  "Step #3 - \"tf apply\": Error: Insufficient quota to satisfy the request: Quota 'CPUS_ALL_REGIONS' exceeded. Limit: 32.0 globally.\nStep #3 - \"tf apply\": \nStep #3 - \"tf apply\": more",
+			cause: "cpu-quota",
+			block: "Error: Insufficient quota to satisfy the request: Quota 'CPUS_ALL_REGIONS' exceeded. Limit: 32.0 globally.",
+		},
+		{
+			name:  "unknown",
+			logs:  "Step #0: npm ERR! code ELIFECYCLE",
+			cause: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *gotest.T) {
+			f := ClassifyBuildFailure(tt.logs)
+			if tt.cause == "" {
+				assert.Nil(t, f.Cause)
+				assert.Empty(t, f.Hint())
+			} else if assert.NotNil(t, f.Cause) {
+				assert.Equal(t, tt.cause, f.Cause.ID)
+			}
+			assert.Equal(t, tt.resource, f.Resource)
+			assert.Equal(t, tt.block, f.ErrorBlock)
+		})
+	}
+}
+
+func TestClassifyBuildFailureTerraformError(t *gotest.T) {
+	logs, err := os.ReadFile(filepath.Join(".", "testdata", "failed_build_state_lock.log"))
+	assert.NoError(t, err)
+	f := ClassifyBuildFailure(string(logs))
+	assert.Equal(t, "state-lock", f.Cause.ID)
+	assert.Empty(t, f.Resource)
+	assert.Equal(t, `Error: Error acquiring the state lock
+
+Error message: writing "gs://bkt-tfstate/terraform/multitenant/development/default.tflock" failed: googleapi: Error 412: At least one of the pre-conditions you specified did not hold., conditionNotMet
+Lock Info:
+  ID:        1718123456789012
+  Path:      gs://bkt-tfstate/terraform/multitenant/development/default.tflock
+  Operation: OperationTypePlan`, f.ErrorBlock)
+
+	logs, err = os.ReadFile(filepath.Join(".", "testdata", "failed_build_group_admin.log"))
+	assert.NoError(t, err)
+	f = ClassifyBuildFailure(string(logs))
+	assert.Equal(t, "group-admin", f.Cause.ID)
+	assert.Equal(t, `module.app_group["hello-world"].google_cloud_identity_group.admins`, f.Resource)
+	assert.Contains(t, f.Hint(), "Cause: Missing Group Admin role.\n")
+	assert.Contains(t, f.Hint(), "Resource: module.app_group[\"hello-world\"].google_cloud_identity_group.admins\n")
+	assert.Contains(t, f.Hint(), "Terraform error:\nError: Error creating Group: googleapi: Error 403")
+}
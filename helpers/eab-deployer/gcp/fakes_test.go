@@ -0,0 +1,302 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// fakeCloudBuild is an in-memory Cloud Build.
+// Each call to GetBuild advances the build to its next status.
+type fakeCloudBuild struct {
+	mu          sync.Mutex
+	builds      []Build
+	statuses    map[string][]string
+	filters     []string
+	retried     []string
+	cancelled   []string
+	workerPools map[string]WorkerPool
+}
+
+func (f *fakeCloudBuild) ListBuilds(ctx context.Context, projectID, region, filter string, limit int64) ([]Build, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.filters = append(f.filters, filter)
+	builds := slices.Clone(f.builds)
+	if limit > 0 && int64(len(builds)) > limit {
+		builds = builds[:limit]
+	}
+	return builds, nil
+}
+
+func (f *fakeCloudBuild) GetBuild(ctx context.Context, projectID, region, buildID string) (Build, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	statuses := f.statuses[buildID]
+	if len(statuses) == 0 {
+		return Build{}, fmt.Errorf("build %s not found", buildID)
+	}
+	if len(statuses) > 1 {
+		f.statuses[buildID] = statuses[1:]
+	}
+	return Build{ID: buildID, Status: statuses[0]}, nil
+}
+
+func (f *fakeCloudBuild) RetryBuild(ctx context.Context, buildName string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.retried = append(f.retried, buildName)
+	return fmt.Sprintf("retry-%d", len(f.retried)), nil
+}
+
+func (f *fakeCloudBuild) CancelBuild(ctx context.Context, projectID, region, buildID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelled = append(f.cancelled, buildID)
+	return nil
+}
+
+func (f *fakeCloudBuild) GetWorkerPool(ctx context.Context, workerPoolName string) (WorkerPool, error) {
+	wp, ok := f.workerPools[workerPoolName]
+	if !ok {
+		return WorkerPool{}, fmt.Errorf("worker pool %s not found", workerPoolName)
+	}
+	return wp, nil
+}
+
+// fakeCloudDeploy is an in-memory Cloud Deploy.
+// Promoting a release creates a rollout to the target with the state and the canary phases in promotedState and promotedPhases.
+// Approving a rollout moves it to approvedState, advancing the last phase succeeds it,
+// and rolling back a target creates a successful rollback rollout.
+// With lag, the approvals and advances are only visible after the next read of the rollout, like the Cloud Deploy API.
+type fakeCloudDeploy struct {
+	mu             sync.Mutex
+	releases       map[string]Release
+	rollouts       map[string][]Rollout
+	promoted       []string
+	promotedState  string
+	promotedPhases []RolloutPhase
+	approvedState  string
+	approved       []string
+	advanced       []string
+	rolledBack     []string
+	lag            bool
+	pending        []func()
+}
+
+func (f *fakeCloudDeploy) GetRelease(ctx context.Context, releaseName string) (Release, error) {
+	r, ok := f.releases[releaseName]
+	if !ok {
+		return Release{}, fmt.Errorf("release %s not found", releaseName)
+	}
+	return r, nil
+}
+
+func (f *fakeCloudDeploy) ListRollouts(ctx context.Context, releaseName, targetID string) ([]Rollout, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer f.applyPending()
+	rollouts := slices.Clone(f.rollouts[targetID])
+	for i := range rollouts {
+		rollouts[i].Phases = slices.Clone(rollouts[i].Phases)
+	}
+	return rollouts, nil
+}
+
+func (f *fakeCloudDeploy) PromoteRelease(ctx context.Context, releaseName, targetID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.promoted = append(f.promoted, targetID)
+	f.rollouts[targetID] = append(f.rollouts[targetID], Rollout{
+		Name:     rolloutID(releaseName, targetID, len(f.rollouts[targetID])+1),
+		TargetID: targetID,
+		State:    f.promotedState,
+		Phases:   slices.Clone(f.promotedPhases),
+	})
+	return nil
+}
+
+// rollout returns the rollout with the given name, f.mu must be held.
+func (f *fakeCloudDeploy) rollout(name string) (*Rollout, error) {
+	for _, rollouts := range f.rollouts {
+		for i := range rollouts {
+			if rollouts[i].Name == name {
+				return &rollouts[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("rollout %s not found", name)
+}
+
+// update updates the rollout with the given name, after the next read of the rollouts with lag. f.mu must be held.
+func (f *fakeCloudDeploy) update(name string, update func(r *Rollout)) error {
+	r, err := f.rollout(name)
+	if err != nil {
+		return err
+	}
+	if !f.lag {
+		update(r)
+		return nil
+	}
+	f.pending = append(f.pending, func() {
+		if r, err := f.rollout(name); err == nil {
+			update(r)
+		}
+	})
+	return nil
+}
+
+// applyPending applies the updates delayed by the lag, f.mu must be held.
+func (f *fakeCloudDeploy) applyPending() {
+	for _, update := range f.pending {
+		update()
+	}
+	f.pending = nil
+}
+
+func (f *fakeCloudDeploy) GetRollout(ctx context.Context, rolloutName string) (Rollout, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer f.applyPending()
+	r, err := f.rollout(rolloutName)
+	if err != nil {
+		return Rollout{}, err
+	}
+	rollout := *r
+	rollout.Phases = slices.Clone(r.Phases)
+	return rollout, nil
+}
+
+func (f *fakeCloudDeploy) ApproveRollout(ctx context.Context, rolloutName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.approved = append(f.approved, rolloutName)
+	return f.update(rolloutName, func(r *Rollout) {
+		r.ApprovalState = ApprovalApproved
+		r.State = f.approvedState
+	})
+}
+
+func (f *fakeCloudDeploy) AdvanceRollout(ctx context.Context, rolloutName, phaseID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advanced = append(f.advanced, phaseID)
+	return f.update(rolloutName, func(r *Rollout) {
+		for i := range r.Phases {
+			if r.Phases[i].ID == phaseID {
+				r.Phases[i].State = PhaseStatusSucceeded
+				if i == len(r.Phases)-1 {
+					r.State = ReleaseStatusSuccess
+				}
+			}
+		}
+	})
+}
+
+func (f *fakeCloudDeploy) RollbackTarget(ctx context.Context, pipelineName, targetID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rolledBack = append(f.rolledBack, targetID)
+	name := fmt.Sprintf("%s/releases/previous/rollouts/rollback-%s", pipelineName, targetID)
+	f.rollouts["rollback"] = append(f.rollouts["rollback"], Rollout{Name: name, TargetID: targetID, State: ReleaseStatusSuccess})
+	return name, nil
+}
+
+// fakeServiceUsage is an in-memory Service Usage, enabled holds the enabled services by project.
+type fakeServiceUsage struct {
+	mu      sync.Mutex
+	enabled map[string][]string
+}
+
+func (f *fakeServiceUsage) IsServiceEnabled(ctx context.Context, projectID, service string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Contains(f.enabled[projectID], service), nil
+}
+
+func (f *fakeServiceUsage) EnableServices(ctx context.Context, projectID string, services []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enabled[projectID] = append(f.enabled[projectID], services...)
+	return nil
+}
+
+// fakeSecretManager is an in-memory Secret Manager, secrets holds the values by secret version name.
+type fakeSecretManager struct {
+	secrets map[string]string
+}
+
+func (f *fakeSecretManager) AccessSecretVersion(ctx context.Context, versionName string) (string, error) {
+	v, ok := f.secrets[versionName]
+	if !ok {
+		return "", fmt.Errorf("secret version %s not found", versionName)
+	}
+	return v, nil
+}
+
+// fakeResourceManager is an in-memory Resource Manager, granted holds the permissions by resource.
+type fakeResourceManager struct {
+	granted map[string][]string
+}
+
+func (f *fakeResourceManager) TestIAMPermissions(ctx context.Context, resource string, permissions []string) ([]string, error) {
+	result := []string{}
+	for _, p := range permissions {
+		if slices.Contains(f.granted[resource], p) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// fakeLogging is an in-memory Cloud Logging, entries are in timestamp order.
+// The timestamp condition of the filter is honored, other conditions are ignored.
+type fakeLogging struct {
+	entries []LogEntry
+}
+
+func (f *fakeLogging) ListLogEntries(ctx context.Context, projectID, filter string) ([]LogEntry, error) {
+	_, since, _ := strings.Cut(filter, `timestamp>="`)
+	since = strings.TrimSuffix(since, `"`)
+	entries := []LogEntry{}
+	for _, e := range f.entries {
+		if e.Timestamp >= since {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// failingLogging is a Cloud Logging that fails to list the log entries.
+type failingLogging struct {
+	err error
+}
+
+func (f *failingLogging) ListLogEntries(ctx context.Context, projectID, filter string) ([]LogEntry, error) {
+	return nil, f.err
+}
+
+// fakeIdentity is the identity of in-memory credentials.
+type fakeIdentity struct {
+	account string
+}
+
+func (f *fakeIdentity) ActiveAccount(ctx context.Context) (string, error) {
+	return f.account, nil
+}
@@ -15,12 +15,15 @@
 package gcp
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"maps"
-	"regexp"
+	"net/http"
 	"slices"
 	"strings"
 	"time"
@@ -36,16 +39,19 @@ import (
 )
 
 const (
-	BuildStatusQueued      = "QUEUED"
-	BuildStatusWorking     = "WORKING"
-	BuildStatusSuccess     = "SUCCESS"
-	BuildStatusFailure     = "FAILURE"
-	BuildStatusCancelled   = "CANCELLED"
-	ReleaseStatusWorking   = "IN_PROGRESS"
-	ReleaseStatusQueued    = "PENDING_RELEASE"
-	ReleaseStatusSuccess   = "SUCCEEDED"
-	ReleaseStatusFailure   = "FAILED"
-	ReleaseStatusCancelled = "CANCELLED"
+	BuildStatusQueued        = "QUEUED"
+	BuildStatusWorking       = "WORKING"
+	BuildStatusSuccess       = "SUCCESS"
+	BuildStatusFailure       = "FAILURE"
+	BuildStatusCancelled     = "CANCELLED"
+	BuildStatusTimeout       = "TIMEOUT"
+	BuildStatusExpired       = "EXPIRED"
+	BuildStatusInternalError = "INTERNAL_ERROR"
+	ReleaseStatusWorking     = "IN_PROGRESS"
+	ReleaseStatusQueued      = "PENDING_RELEASE"
+	ReleaseStatusSuccess     = "SUCCEEDED"
+	ReleaseStatusFailure     = "FAILED"
+	ReleaseStatusCancelled   = "CANCELLED"
 )
 
 type RetryOp struct {
@@ -58,26 +64,16 @@ type Build struct {
 	CreateTime string `json:"createTime"`
 }
 
-var (
-	retryRegexp = map[*regexp.Regexp]string{}
-	// ctx         = context.Background()
-)
-
-func init() {
-	for e, m := range testutils.RetryableTransientErrors {
-		r, err := regexp.Compile(fmt.Sprintf("(?s)%s", e)) //(?s) enables dot (.) to match newline.
-		if err != nil {
-			panic(fmt.Sprintf("failed to compile regex %s: %s", e, err.Error()))
-		}
-		retryRegexp[r] = m
-	}
-}
-
+// GCP is a wrapper for Google Cloud Platform.
+// Operations use the typed Clients when they are set and fall back to the gcloud CLI, through Runf, when they are not.
 type GCP struct {
+	Clients
 	Runf            func(t testing.TB, cmd string, args ...interface{}) gjson.Result
 	RunCmd          func(t testing.TB, cmd string, args ...interface{}) string
+	RunCmdE         func(t testing.TB, cmd string, args ...interface{}) (string, error)
 	TriggerNewBuild func(t testing.TB, ctx context.Context, buildName string) (string, error)
-	sleepTime       time.Duration
+	wait            WaitOptions
+	logPrefix       string
 }
 
 // runCmd is a wrapper around gcloud.RunCmd because the original function has an input with a private type
@@ -85,6 +81,11 @@ func runCmd(t testing.TB, cmd string, args ...interface{}) string {
 	return gcloud.RunCmd(t, utils.StringFromTextAndArgs(append([]interface{}{cmd}, args...)...))
 }
 
+// runCmdE is like runCmd, but it returns the error of the command instead of failing.
+func runCmdE(t testing.TB, cmd string, args ...interface{}) (string, error) {
+	return gcloud.RunCmdE(t, utils.StringFromTextAndArgs(append([]interface{}{cmd}, args...)...))
+}
+
 // triggerNewBuild triggers a new build based on the build provided
 func triggerNewBuild(t testing.TB, ctx context.Context, buildName string) (string, error) {
 
@@ -106,19 +107,54 @@ func triggerNewBuild(t testing.TB, ctx context.Context, buildName string) (strin
 	return data.Build.ID, nil
 }
 
-// NewGCP creates a new wrapper for Google Cloud Platform CLI.
+// NewGCP creates a new wrapper for Google Cloud Platform.
+// It uses the Google Cloud client libraries when the Application Default Credentials are available,
+// and the gcloud CLI otherwise or if UseGcloud was called.
 func NewGCP() GCP {
-	return GCP{
+	g := GCP{
+		Clients:         defaultClients(),
 		Runf:            gcloud.Runf,
 		RunCmd:          runCmd,
+		RunCmdE:         runCmdE,
 		TriggerNewBuild: triggerNewBuild,
-		sleepTime:       20,
+		wait:            WaitOptions{Backoff: DefaultBackoff},
+	}
+	if g.CloudBuild != nil {
+		cb := g.CloudBuild
+		g.TriggerNewBuild = func(t testing.TB, ctx context.Context, buildName string) (string, error) {
+			return cb.RetryBuild(ctx, buildName)
+		}
+	}
+	return g
+}
+
+// WithLogPrefix returns a copy of the wrapper that adds the given prefix to the messages it prints.
+func (g GCP) WithLogPrefix(prefix string) GCP {
+	g.logPrefix = prefix
+	return g
+}
+
+// logf prints a message adding the log prefix, if any.
+func (g GCP) logf(format string, args ...interface{}) {
+	if g.logPrefix != "" {
+		format = "[" + strings.ReplaceAll(g.logPrefix, "%", "%%") + "] " + format
 	}
+	fmt.Printf(format, args...)
 }
 
 // GetBuilds gets all Cloud Build builds form a project and region that satisfy the given filter.
 func (g GCP) GetBuilds(t testing.TB, projectID, region, filter string) map[string]string {
 	var result = map[string]string{}
+	if g.CloudBuild != nil {
+		builds, err := g.CloudBuild.ListBuilds(context.Background(), projectID, region, apiBuildFilter(filter), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range builds {
+			result[b.ID] = b.Status
+		}
+		return result
+	}
 	builds := g.Runf(t, "builds list --project %s --region %s --filter %s", projectID, region, filter).Array()
 	if len(builds) > 0 {
 		for _, b := range builds {
@@ -130,6 +166,16 @@ func (g GCP) GetBuilds(t testing.TB, projectID, region, filter string) map[strin
 
 // GetLastBuildStatus gets the status of the last build form a project and region that satisfy the given filter.
 func (g GCP) GetLastBuildStatus(t testing.TB, projectID, region, filter string) (string, string) {
+	if g.CloudBuild != nil {
+		builds, err := g.CloudBuild.ListBuilds(context.Background(), projectID, region, apiBuildFilter(filter), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(builds) == 0 {
+			return "", ""
+		}
+		return builds[0].Status, builds[0].ID
+	}
 	builds := g.Runf(t, "builds list --project %s --region %s --limit 1 --sort-by ~createTime --filter %s", projectID, region, filter).Array()
 	if len(builds) == 0 {
 		return "", ""
@@ -140,79 +186,75 @@ func (g GCP) GetLastBuildStatus(t testing.TB, projectID, region, filter string)
 
 // GetBuildStatus gets the status of the given build
 func (g GCP) GetBuildStatus(t testing.TB, projectID, region, buildID string) string {
+	if g.CloudBuild != nil {
+		build, err := g.CloudBuild.GetBuild(context.Background(), projectID, region, buildID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return build.Status
+	}
 	return g.Runf(t, "builds describe %s  --project %s --region %s", buildID, projectID, region).Get("status").String()
 }
 
-// GetRunningBuildID gets the current build running for the given project, region, and filter
-func (g GCP) GetRunningBuildID(t testing.TB, projectID, region, filter string, retryGetBuild int) string {
-	currentRetry := 1
-	time.Sleep(g.sleepTime * time.Second)
-	builds := g.GetBuilds(t, projectID, region, filter)
-	if len(builds) == 0 && currentRetry <= retryGetBuild {
-		return g.GetRunningBuildID(t, projectID, region, filter, retryGetBuild-currentRetry)
-	}
-	for id, status := range builds {
-		if status == BuildStatusQueued || status == BuildStatusWorking {
-			return id
+// GetRunningBuildID gets the current build running for the given project, region, and filter.
+// The builds are listed up to retryGetBuild times, waiting for the build to be started.
+func (g GCP) GetRunningBuildID(ctx context.Context, t testing.TB, projectID, region, filter string, retryGetBuild int) string {
+	for attempt := 0; attempt <= retryGetBuild; attempt++ {
+		if sleep(ctx, g.wait.Backoff.Delay(attempt)) != nil {
+			return ""
+		}
+		builds := g.GetBuilds(t, projectID, region, filter)
+		if len(builds) == 0 {
+			continue
+		}
+		for id, status := range builds {
+			if status == BuildStatusQueued || status == BuildStatusWorking {
+				return id
+			}
 		}
+		return ""
 	}
 	return ""
 }
 
 // GetFinalBuildState gets the terminal status of the given build. It will wait if build is not finished.
-func (g GCP) GetFinalBuildState(t testing.TB, projectID, region, buildID string, maxBuildRetry int) (string, error) {
-	var status string
-	count := 0
-	fmt.Printf("waiting for build %s execution.\n", buildID)
-	status = g.GetBuildStatus(t, projectID, region, buildID)
-	fmt.Printf("build status is %s\n", status)
-	for status != BuildStatusSuccess && status != BuildStatusFailure && status != BuildStatusCancelled {
-		fmt.Printf("build status is %s\n", status)
-		if count >= maxBuildRetry {
-			return "", fmt.Errorf("timeout waiting for build '%s' execution", buildID)
-		}
-		count = count + 1
-		time.Sleep(g.sleepTime * time.Second)
-		status = g.GetBuildStatus(t, projectID, region, buildID)
-	}
-	fmt.Printf("final build status is %s\n", status)
-	return status, nil
-}
-
-// GetRollouts gets all Cloud Deploy Rollouts form a project and region that satisfy the given filter.
-func (g GCP) GetRolloutsStatus(t testing.TB, projectID, region, service, releaseFullName, targetID string) string {
-	rollout := g.Runf(t, "deploy rollouts list --project=%s --delivery-pipeline=%s --region=%s --release=%s --filter targetId=%s", projectID, service, region, releaseFullName, targetID).Array()
-	if len(rollout) > 0 {
-		return rollout[0].Get("state").String()
-	}
-	return ""
-}
-
-// GetFinalRolloutState gets the terminal status of the given rollout. It will wait if build is not finished.
-func (g GCP) GetFinalRolloutState(t testing.TB, projectID, region, serviceName, releaseFullName, targetID string, maxRetry int) (string, error) {
-	var status string
-	count := 0
-	fmt.Printf("waiting for rollout %s execution.\n", releaseFullName)
-	status = g.GetRolloutsStatus(t, projectID, region, serviceName, releaseFullName, targetID)
-	fmt.Printf("rollout status is %s\n", status)
-	for status != ReleaseStatusSuccess && status != ReleaseStatusFailure && status != ReleaseStatusCancelled {
-		fmt.Printf("release status is %s\n", status)
-		if count >= maxRetry {
-			return "", fmt.Errorf("timeout waiting for release '%s' execution", releaseFullName)
+// The build status is polled with backoff until the timeout, or until the context is done.
+// If the wait is interrupted the build is cancelled, when the wrapper is configured to do so.
+func (g GCP) GetFinalBuildState(ctx context.Context, t testing.TB, projectID, region, buildID string, timeout time.Duration) (string, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	g.logf("waiting for build %s execution.\n", buildID)
+	tail := &buildLogTail{projectID: projectID, buildID: buildID}
+	status := g.GetBuildStatus(t, projectID, region, buildID)
+	g.logf("build status is %s\n", status)
+	for attempt := 0; !isFinalBuildStatus(status); attempt++ {
+		g.tailBuildLogs(t, tail)
+		d := g.wait.Backoff.Delay(attempt)
+		if g.wait.Logs.Stream {
+			d = min(d, logPollInterval)
+		}
+		event, err := g.waitBuildChange(waitCtx, buildID, d)
+		if err != nil {
+			g.cancelInterruptedBuild(t, ctx, projectID, region, buildID)
+			return "", waitError(err, "build", buildID)
+		}
+		if event != "" {
+			status = event
+			break
 		}
-		count = count + 1
-		time.Sleep(g.sleepTime * time.Second)
-		status = g.GetRolloutsStatus(t, projectID, region, serviceName, releaseFullName, targetID)
+		status = g.GetBuildStatus(t, projectID, region, buildID)
+		g.logf("build status is %s\n", status)
 	}
-	fmt.Printf("final rollout status is %s\n", status)
+	g.tailBuildLogs(t, tail)
+	g.logf("final build status is %s\n", status)
 	return status, nil
 }
 
 // WaitBuildSuccess waits for the current build in a repo to finish.
-func (g GCP) WaitBuildSuccess(t testing.TB, project, region, repo, commitSha, failureMsg string, maxBuildRetry, maxErrorRetries int, timeBetweenErrorRetries time.Duration) error {
+// Each build is waited up to the timeout, and builds failed with retryable errors are retried up to maxErrorRetries times.
+func (g GCP) WaitBuildSuccess(ctx context.Context, t testing.TB, project, region, repo, commitSha, failureMsg string, timeout time.Duration, maxErrorRetries int, timeBetweenErrorRetries time.Duration) error {
 	var filter, status, build string
 	var timeoutErr, err error
-	ctx := context.Background()
 
 	if commitSha == "" {
 		filter = fmt.Sprintf("source.repoSource.repoName:%s", repo)
@@ -220,53 +262,58 @@ func (g GCP) WaitBuildSuccess(t testing.TB, project, region, repo, commitSha, fa
 		filter = fmt.Sprintf("substitutions.COMMIT_SHA:%s", commitSha)
 	}
 
-	build = g.GetRunningBuildID(t, project, region, filter, 5)
-	for i := 0; i < maxErrorRetries; i++ {
+	build = g.GetRunningBuildID(ctx, t, project, region, filter, 5)
+	for retry := 0; ; retry++ {
 		if build != "" {
-			status, timeoutErr = g.GetFinalBuildState(t, project, region, build, maxBuildRetry)
+			status, timeoutErr = g.GetFinalBuildState(ctx, t, project, region, build, timeout)
 			if timeoutErr != nil {
 				return timeoutErr
 			}
 		} else {
+			if ctx.Err() != nil {
+				return waitError(ctx.Err(), "build of repository", repo)
+			}
 			status, build = g.GetLastBuildStatus(t, project, region, filter)
 			if build == "" {
 				return fmt.Errorf("no build found for filter: %s", filter)
 			}
 		}
 
-		if status != BuildStatusSuccess {
-			if !g.IsRetryableError(t, project, region, build) {
-				return fmt.Errorf("%s\nSee:\nhttps://console.cloud.google.com/cloud-build/builds;region=%s/%s?project=%s\nfor details", failureMsg, region, build, project)
-			}
-			fmt.Println("build failed with retryable error. a new build will be triggered.")
-		} else {
+		if status == BuildStatusSuccess {
 			return nil // Build succeeded
 		}
+		logs := g.GetBuildLogs(t, project, region, build)
+		g.saveBuildLog(build, logs)
+		pattern, retryable := g.wait.Retries.Match(logs)
+		if !retryable {
+			return fmt.Errorf("%s\n%sSee:\nhttps://console.cloud.google.com/cloud-build/builds;region=%s/%s?project=%s\nfor details", failureMsg, ClassifyBuildFailure(logs).Hint(), region, build, project)
+		}
+		g.logf("error '%s' is worth of a retry\n", pattern.Message)
+		maxRetries, timeBetweenRetries := pattern.retries(maxErrorRetries, timeBetweenErrorRetries)
+		if retry >= maxRetries {
+			return fmt.Errorf("%s\nbuild failed after %d retries.\nSee Cloud Build logs for details", failureMsg, retry)
+		}
+		g.logf("build failed with retryable error. a new build will be triggered.\n")
 
+		// Wait before retrying
+		if err := sleep(ctx, timeBetweenRetries); err != nil {
+			return waitError(err, "build", build)
+		}
 		// Trigger a new build
 		build, err = g.TriggerNewBuild(t, ctx, fmt.Sprintf("projects/%s/locations/%s/builds/%s", project, region, build))
 		if err != nil {
-			return fmt.Errorf("failed to trigger new build (attempt %d/%d): %w", i+1, maxErrorRetries, err)
-		}
-		fmt.Printf("triggered new build with ID: %s (attempt %d/%d)\n", build, i+1, maxErrorRetries)
-		if i < maxErrorRetries-1 {
-			time.Sleep(timeBetweenErrorRetries) // Wait before retrying
+			return fmt.Errorf("failed to trigger new build (attempt %d/%d): %w", retry+1, maxRetries, err)
 		}
+		g.logf("triggered new build with ID: %s (attempt %d/%d)\n", build, retry+1, maxRetries)
 	}
-	return fmt.Errorf("%s\nbuild failed after %d retries.\nSee Cloud Build logs for details", failureMsg, maxErrorRetries)
 }
 
 // IsRetryableError checks the logs of a failed Cloud Build build
 // and verify if the error is a transient one and can be retried
 func (g GCP) IsRetryableError(t testing.TB, projectID, region, build string) bool {
-	logs := g.GetBuildLogs(t, projectID, region, build)
-	found := false
-	for pattern, msg := range retryRegexp {
-		if pattern.MatchString(logs) {
-			found = true
-			fmt.Printf("error '%s' is worth of a retry\n", msg)
-			break
-		}
+	pattern, found := g.wait.Retries.Match(g.GetBuildLogs(t, projectID, region, build))
+	if found {
+		g.logf("error '%s' is worth of a retry\n", pattern.Message)
 	}
 	return found
 }
@@ -277,24 +324,20 @@ func (g GCP) GetBuildLogs(t testing.TB, projectID, region, buildID string) strin
 }
 
 // WaitReleaseSuccess waits for the current release in a repo to finish.
-func (g GCP) WaitReleaseSuccess(t testing.TB, project, region, serviceName, commitSha, failureMsg string, maxRetry int) error {
-
-	releaseFullName := fmt.Sprintf("projects/%s/locations/%s/deliveryPipelines/%s/releases/%s-%s", project, region, serviceName, serviceName, commitSha)
-
-	releaseTargets := slices.Collect(maps.Keys(g.GetRelease(t, releaseFullName).Get("targetArtifacts").Map()))
-	if len(releaseTargets) > 0 {
-		for i, targetID := range releaseTargets {
-			status, err := g.GetFinalRolloutState(t, project, region, serviceName, releaseFullName, targetID, maxRetry)
-			if err != nil {
-				return err
-			}
-			if status != ReleaseStatusSuccess {
-				return fmt.Errorf("%s\nSee:\nhttps://console.cloud.google.com/deploy/delivery-pipelines?project=%s\nfor details.\n", failureMsg, project)
-			}
-			if status == ReleaseStatusSuccess && i+1 < len(releaseTargets) {
-				g.PromoteRelease(t, releaseFullName, serviceName, region, releaseTargets[i+1])
-			}
+// The release is rolled out through the targets of its delivery pipeline by WaitRelease, and the result of each target is printed.
+func (g GCP) WaitReleaseSuccess(ctx context.Context, t testing.TB, project, region, serviceName, commitSha, failureMsg string, timeout time.Duration) error {
+	results, err := g.WaitRelease(ctx, t, project, region, serviceName, commitSha, timeout)
+	if len(results) > 0 {
+		fmt.Printf("# rollouts of release %s-%s:\n", serviceName, commitSha)
+		for _, r := range results {
+			fmt.Printf("#   %s\n", r)
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, errRolloutFailed) {
+			return err
 		}
+		return fmt.Errorf("%s %s\nSee:\nhttps://console.cloud.google.com/deploy/delivery-pipelines?project=%s\nfor details.\n", failureMsg, err.Error(), project)
 	}
 	return nil
 }
@@ -304,9 +347,36 @@ func (g GCP) GetRelease(t testing.TB, releaseFullName string) gjson.Result {
 	return g.Runf(t, "deploy releases describe %s", releaseFullName).Array()[0]
 }
 
+// GetReleaseTargets gets the targets of a release in the order of the delivery pipeline stages.
+func (g GCP) GetReleaseTargets(t testing.TB, releaseFullName string) []string {
+	if g.CloudDeploy != nil {
+		release, err := g.CloudDeploy.GetRelease(context.Background(), releaseFullName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return release.TargetIDs
+	}
+	release := g.GetRelease(t, releaseFullName)
+	artifacts := release.Get("targetArtifacts").Map()
+	targets := []string{}
+	for _, stage := range release.Get("deliveryPipelineSnapshot.serialPipeline.stages").Array() {
+		if _, ok := artifacts[stage.Get("targetId").String()]; ok {
+			targets = append(targets, stage.Get("targetId").String())
+		}
+	}
+	if len(targets) == 0 {
+		targets = slices.Sorted(maps.Keys(artifacts))
+	}
+	return targets
+}
+
 // PromoteRelease promote for the current release.
-func (g GCP) PromoteRelease(t testing.TB, releaseFullName, serviceName, region, nextTargetId string) gjson.Result {
-	return g.Runf(t, "deploy releases promote --release=%s --delivery-pipeline=%s --region=%s --to-target=%s", releaseFullName, serviceName, region, nextTargetId)
+func (g GCP) PromoteRelease(t testing.TB, releaseFullName, serviceName, region, nextTargetId string) error {
+	if g.CloudDeploy != nil {
+		return g.CloudDeploy.PromoteRelease(context.Background(), releaseFullName, nextTargetId)
+	}
+	g.Runf(t, "deploy releases promote --release=%s --delivery-pipeline=%s --region=%s --to-target=%s", releaseFullName, serviceName, region, nextTargetId)
+	return nil
 }
 
 // HasSccNotification checks if a Security Command Center notification exists
@@ -331,17 +401,38 @@ func (g GCP) HasTagKey(t testing.TB, orgID, tag string) bool {
 
 // EnableApis enables the apis in the given project
 func (g GCP) EnableApis(t testing.TB, project string, apis []string) {
+	if g.ServiceUsage != nil {
+		err := g.ServiceUsage.EnableServices(context.Background(), project, apis)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
 	g.Runf(t, "services enable %s --project %s", strings.Join(apis, " "), project)
 }
 
 // IsApiEnabled checks if the api is enabled in the given project
 func (g GCP) IsApiEnabled(t testing.TB, project, api string) bool {
+	if g.ServiceUsage != nil {
+		enabled, err := g.ServiceUsage.IsServiceEnabled(context.Background(), project, api)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enabled
+	}
 	filter := fmt.Sprintf("config.name=%s", api)
 	return len(g.Runf(t, "services list --enabled --project %s --filter %s", project, filter).Array()) > 0
 }
 
-// IsApiEnabled checks if the api is enabled in the given project
+// GetSecretValue gets the value of the latest version of the given secret
 func (g GCP) GetSecretValue(t testing.TB, secretID string) string {
+	if g.SecretManager != nil {
+		value, err := g.SecretManager.AccessSecretVersion(context.Background(), secretID+"/versions/latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
 	secret := g.Runf(t, "secrets versions access %s/versions/latest", secretID)
 	decoded, err := base64.StdEncoding.DecodeString(secret.Get("payload.data").String())
 	if err != nil {
@@ -375,3 +466,80 @@ func (g GCP) GetAuthToken(t testing.TB) string {
 
 	return result.Get("token").String()
 }
+
+// GetActiveAccount gets the account of the credentials of the clients, or the account configured in the active gcloud configuration
+func (g GCP) GetActiveAccount(t testing.TB) string {
+	if g.Identity != nil {
+		account, err := g.Identity.ActiveAccount(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return account
+	}
+	return g.Runf(t, "config get-value account").String()
+}
+
+// EnablePrivateGoogleAccess enables Private Google Access in the given subnet
+func (g GCP) EnablePrivateGoogleAccess(t testing.TB, project, region, subnet string) {
+	g.Runf(t, "compute networks subnets update %s --region=%s --project=%s --enable-private-ip-google-access", subnet, region, project)
+}
+
+// GetWorkerPool gets the network configuration of the given Cloud Build worker pool
+func (g GCP) GetWorkerPool(t testing.TB, project, region, workerPool string) WorkerPool {
+	if g.CloudBuild != nil {
+		wp, err := g.CloudBuild.GetWorkerPool(context.Background(), fmt.Sprintf("projects/%s/locations/%s/workerPools/%s", project, region, workerPool))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wp
+	}
+	res := g.Runf(t, "builds worker-pools describe %s --region=%s --project=%s", workerPool, region, project)
+	networkConfig := res.Get("privatePoolV1Config.networkConfig")
+	return WorkerPool{
+		Name:                 res.Get("name").String(),
+		EgressOption:         networkConfig.Get("egressOption").String(),
+		PeeredNetwork:        networkConfig.Get("peeredNetwork").String(),
+		PeeredNetworkIPRange: networkConfig.Get("peeredNetworkIpRange").String(),
+	}
+}
+
+// TestIAMPermissions gets the permissions, of the given ones, that the active identity has on a
+// project, folder or organization, using the cloudresourcemanager testIamPermissions V3 API.
+func (g GCP) TestIAMPermissions(t testing.TB, parent string, permissions []string) ([]string, error) {
+	if g.ResourceManager != nil {
+		return g.ResourceManager.TestIAMPermissions(context.Background(), parent, permissions)
+	}
+	client := &http.Client{}
+	identityPermissions := []string{}
+	// avoid "The number of permissions (xxx) is greater than the maximum allowed (100).
+	for chunk := range slices.Chunk(permissions, maxTestPermissions) {
+		jsonBody, err := json.Marshal(map[string][]string{"permissions": chunk})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest("POST", fmt.Sprintf("https://cloudresourcemanager.googleapis.com/v3/%s:testIamPermissions", parent), bytes.NewBuffer(jsonBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Authorization", "Bearer "+g.GetAuthToken(t))
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error making request: %w", err)
+		}
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("request failed with status code: %d, body: %s", resp.StatusCode, string(bodyBytes))
+		}
+		bodyJson := map[string][]string{}
+		err = json.Unmarshal(bodyBytes, &bodyJson)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+		}
+		identityPermissions = append(identityPermissions, bodyJson["permissions"]...)
+	}
+	return identityPermissions, nil
+}
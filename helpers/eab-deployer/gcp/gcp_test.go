@@ -29,6 +29,9 @@ import (
 	"github.com/tidwall/gjson"
 )
 
+// testWait polls builds and rollouts without waiting.
+var testWait = WaitOptions{Backoff: Backoff{Initial: time.Millisecond, Max: time.Millisecond}}
+
 func TestIsComponentInstalledFound(t *gotest.T) {
 	betaComponents, err := os.ReadFile(filepath.Join(".", "testdata", "beta_components_installed.json"))
 	assert.NoError(t, err)
@@ -39,7 +42,7 @@ func TestIsComponentInstalledFound(t *gotest.T) {
 				Raw:  string(betaComponents[:]),
 			}
 		},
-		sleepTime: 1,
+		wait: testWait,
 	}
 	componentID := "beta"
 	result := gcp.IsComponentInstalled(t, componentID)
@@ -56,7 +59,7 @@ func TestIsComponentInstalledNotFound(t *gotest.T) {
 				Raw:  string(betaComponents[:]),
 			}
 		},
-		sleepTime: 1,
+		wait: testWait,
 	}
 	componentID := "beta"
 	result := gcp.IsComponentInstalled(t, componentID)
@@ -73,7 +76,7 @@ func TestGetLastBuildStatus(t *gotest.T) {
 				Raw:  fmt.Sprintf("[%s]", string(current[:])),
 			}
 		},
-		sleepTime: 1,
+		wait: testWait,
 	}
 	status, _ := gcp.GetLastBuildStatus(t, "prj-b-cicd-0123", "us-central1", "filter")
 	assert.Equal(t, BuildStatusSuccess, status)
@@ -103,10 +106,10 @@ func TestGetFinalBuildState(t *gotest.T) {
 			callCount = callCount + 1
 			return resp
 		},
-		sleepTime: 1,
+		wait: testWait,
 	}
 
-	status2, err := gcp.GetFinalBuildState(t, "prj-b-cicd-0123", "us-central1", "buildID", 40)
+	status2, err := gcp.GetFinalBuildState(context.Background(), t, "prj-b-cicd-0123", "us-central1", "buildID", time.Minute)
 	assert.NoError(t, err)
 	assert.Equal(t, BuildStatusFailure, status2)
 	assert.Equal(t, callCount, 2, "Runf must be called twice")
@@ -139,10 +142,10 @@ func TestWaitBuildSuccess(t *gotest.T) {
 		RunCmd: func(t testing.TB, cmd string, args ...interface{}) string {
 			return ""
 		},
-		sleepTime: 1,
+		wait: testWait,
 	}
 
-	err = gcp.WaitBuildSuccess(t, "prj-b-cicd-0123", "us-central1", "repo", "", "failed_test_for_WaitBuildSuccess", 40, 2, 1*time.Second)
+	err = gcp.WaitBuildSuccess(context.Background(), t, "prj-b-cicd-0123", "us-central1", "repo", "", "failed_test_for_WaitBuildSuccess", time.Minute, 2, time.Millisecond)
 	assert.Error(t, err, "should have failed")
 	assert.Contains(t, err.Error(), "failed_test_for_WaitBuildSuccess", "should have failed with custom info")
 	assert.Equal(t, callCount, 3, "Runf must be called three times")
@@ -159,28 +162,25 @@ func TestWaitBuildTimeout(t *gotest.T) {
 			Raw: fmt.Sprintf("[%s]", string(working[:]))},
 		{Type: gjson.JSON,
 			Raw: string(working[:])},
-		{Type: gjson.JSON,
-			Raw: string(working[:])},
-		{Type: gjson.JSON,
-			Raw: string(working[:])},
 	}
 
 	gcp := GCP{
 		Runf: func(t testing.TB, cmd string, args ...interface{}) gjson.Result {
-			resp := runfCalls[callCount]
+			// the build keeps working after the first describe
+			resp := runfCalls[min(callCount, len(runfCalls)-1)]
 			callCount = callCount + 1
 			return resp
 		},
 		RunCmd: func(t testing.TB, cmd string, args ...interface{}) string {
 			return ""
 		},
-		sleepTime: 1,
+		wait: testWait,
 	}
 
-	err = gcp.WaitBuildSuccess(t, "prj-b-cicd-0123", "us-central1", "repo", "", "failed_test_for_WaitBuildSuccess", 1, 1, 1*time.Second)
+	err = gcp.WaitBuildSuccess(context.Background(), t, "prj-b-cicd-0123", "us-central1", "repo", "", "failed_test_for_WaitBuildSuccess", 20*time.Millisecond, 1, time.Millisecond)
 	assert.Error(t, err, "should have failed")
 	assert.Contains(t, err.Error(), "timeout waiting for build '736f4689-2497-4382-afd0-b5f0f50eea5b' execution", "should have failed with timeout error")
-	assert.Equal(t, callCount, 3, "Runf must be called three times")
+	assert.GreaterOrEqual(t, callCount, 3, "Runf must be called until the timeout")
 }
 
 func TestWaitBuildSuccessRetry(t *gotest.T) {
@@ -224,13 +224,36 @@ func TestWaitBuildSuccessRetry(t *gotest.T) {
 			triggerNewBuildCallCount = triggerNewBuildCallCount + 1
 			return "845f5790-2497-4382-afd0-b5f0f50eea5a", nil // buildService.Projects.Locations.Builds.Retry
 		},
-		sleepTime: 1,
+		wait: testWait,
 	}
 
-	err = gcp.WaitBuildSuccess(t, "prj-b-cicd-0123", "us-central1", "repo", "", "", 40, 2, 1*time.Second)
+	err = gcp.WaitBuildSuccess(context.Background(), t, "prj-b-cicd-0123", "us-central1", "repo", "", "", time.Minute, 2, time.Millisecond)
 
 	assert.Nil(t, err, "should have succeeded")
 	assert.Equal(t, runfCallCount, 5, "Runf must be called five times")
 	assert.Equal(t, runCmdCallCount, 1, "runCmd getLogs must be called once")
 	assert.Equal(t, triggerNewBuildCallCount, 1, "TriggerNewBuild must be called once")
 }
+
+func TestGetActiveAccount(t *gotest.T) {
+	gcp := GCP{
+		Runf: func(t testing.TB, cmd string, args ...interface{}) gjson.Result {
+			return gjson.Parse(`"operator@example.com"`)
+		},
+		wait: testWait,
+	}
+	assert.Equal(t, "operator@example.com", gcp.GetActiveAccount(t))
+}
+
+func TestEnablePrivateGoogleAccess(t *gotest.T) {
+	var command string
+	gcp := GCP{
+		Runf: func(t testing.TB, cmd string, args ...interface{}) gjson.Result {
+			command = fmt.Sprintf(cmd, args...)
+			return gjson.Result{}
+		},
+		wait: testWait,
+	}
+	gcp.EnablePrivateGoogleAccess(t, "prj-net", "us-central1", "sb-dev")
+	assert.Equal(t, "compute networks subnets update sb-dev --region=us-central1 --project=prj-net --enable-private-ip-google-access", command)
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/mitchellh/go-testing-interface"
+	"github.com/tidwall/gjson"
+)
+
+// logPollInterval is the maximum time between reads of the log of a build when the logs are streamed.
+const logPollInterval = 10 * time.Second
+
+var (
+	// buildStepRegexp matches the build_step label of the log entries of a build step, like `Step #0 - "plan"`.
+	buildStepRegexp = regexp.MustCompile(`^Step #(\d+)(?: - "(.*)")?$`)
+	// unsafeFileNameRegexp matches the characters replaced in the name of the saved build logs.
+	unsafeFileNameRegexp = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+)
+
+// BuildLogOptions configure the logs of the builds being waited.
+// If Stream is true the log lines are written to Logger, or to the standard output if Logger is nil,
+// prefixed with Prefix and the build step name.
+// If Dir is set the full log of a failed build is saved in it.
+type BuildLogOptions struct {
+	Stream bool
+	Logger *logger.Logger
+	Prefix string
+	Dir    string
+}
+
+// buildLogTail follows the log of a build.
+// The entries with the timestamp of the last entry written are remembered, so they are not written again.
+type buildLogTail struct {
+	projectID string
+	buildID   string
+	since     string
+	written   map[string]bool
+}
+
+// GetBuildLogEntries gets the log entries of a build with timestamp equal or after since, in timestamp order.
+func (g GCP) GetBuildLogEntries(t testing.TB, projectID, buildID, since string) ([]LogEntry, error) {
+	filter := fmt.Sprintf(`resource.type="build" AND resource.labels.build_id="%s"`, buildID)
+	if since != "" {
+		filter = fmt.Sprintf(`%s AND timestamp>="%s"`, filter, since)
+	}
+	if g.Logging != nil {
+		return g.Logging.ListLogEntries(context.Background(), projectID, filter)
+	}
+	out, err := g.RunCmdE(t, "logging read '%s' --project %s --order=asc", filter, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if !gjson.Valid(out) {
+		return nil, fmt.Errorf("invalid log entries of build %s: %s", buildID, out)
+	}
+	entries := []LogEntry{}
+	for _, e := range gjson.Parse(out).Array() {
+		labels := map[string]string{}
+		for k, v := range e.Get("labels").Map() {
+			labels[k] = v.String()
+		}
+		entries = append(entries, LogEntry{
+			InsertID:  e.Get("insertId").String(),
+			Timestamp: e.Get("timestamp").String(),
+			Labels:    labels,
+			Text:      e.Get("textPayload").String(),
+		})
+	}
+	return entries, nil
+}
+
+// tailBuildLogs writes the log lines of the build produced since the last call.
+// Errors reading the logs are printed and do not stop the wait of the build, the lines are read again in the next call.
+func (g GCP) tailBuildLogs(t testing.TB, tail *buildLogTail) {
+	if !g.wait.Logs.Stream {
+		return
+	}
+	entries, err := g.GetBuildLogEntries(t, tail.projectID, tail.buildID, tail.since)
+	if err != nil {
+		g.logf("failed to read log of build %s. Error: %s\n", tail.buildID, err.Error())
+		return
+	}
+	for _, e := range entries {
+		if e.Timestamp == tail.since && tail.written[e.InsertID] {
+			continue
+		}
+		if e.Timestamp != tail.since {
+			tail.since = e.Timestamp
+			tail.written = map[string]bool{}
+		}
+		tail.written[e.InsertID] = true
+		g.writeBuildLogLine(t, buildStepName(e.Labels["build_step"]), strings.TrimRight(e.Text, "\n"))
+	}
+}
+
+func (g GCP) writeBuildLogLine(t testing.TB, step, text string) {
+	line := fmt.Sprintf("[%s] %s", step, text)
+	if g.wait.Logs.Prefix != "" {
+		line = fmt.Sprintf("[%s] %s", g.wait.Logs.Prefix, line)
+	}
+	if g.wait.Logs.Logger != nil {
+		g.wait.Logs.Logger.Logf(t, "%s", line)
+		return
+	}
+	g.logf("%s\n", line)
+}
+
+// buildStepName returns the name of a build step from the build_step label of its log entries.
+// Steps without id are named by their index.
+func buildStepName(label string) string {
+	m := buildStepRegexp.FindStringSubmatch(label)
+	switch {
+	case label == "":
+		return "build"
+	case m == nil:
+		return label
+	case m[2] != "":
+		return m[2]
+	default:
+		return "step " + m[1]
+	}
+}
+
+// saveBuildLog saves the full log of a failed build, if the logs directory is set.
+func (g GCP) saveBuildLog(buildID, logs string) {
+	if g.wait.Logs.Dir == "" {
+		return
+	}
+	name := "build"
+	if g.wait.Logs.Prefix != "" {
+		name = unsafeFileNameRegexp.ReplaceAllString(g.wait.Logs.Prefix, "-")
+	}
+	path := filepath.Join(g.wait.Logs.Dir, fmt.Sprintf("%s-%s.log", name, buildID))
+	err := os.WriteFile(path, []byte(logs), 0644)
+	if err != nil {
+		g.logf("failed to save log of build %s. Error: %s\n", buildID, err.Error())
+		return
+	}
+	g.logf("log of build %s saved in %s\n", buildID, path)
+}
@@ -0,0 +1,132 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	gotest "testing"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	grunttest "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/mitchellh/go-testing-interface"
+	"github.com/stretchr/testify/assert"
+)
+
+// linesLogger records the lines logged.
+type linesLogger struct {
+	lines *[]string
+}
+
+func (l linesLogger) Logf(t grunttest.TestingT, format string, args ...interface{}) {
+	*l.lines = append(*l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestBuildStepName(t *gotest.T) {
+	assert.Equal(t, "tf plan", buildStepName(`Step #1 - "tf plan"`))
+	assert.Equal(t, "step 2", buildStepName("Step #2"))
+	assert.Equal(t, "MAIN", buildStepName("MAIN"))
+	assert.Equal(t, "build", buildStepName(""))
+}
+
+func TestStreamBuildLogs(t *gotest.T) {
+	step := map[string]string{"build_step": `Step #0 - "tf plan"`}
+	logs := &fakeLogging{entries: []LogEntry{
+		{InsertID: "1", Timestamp: "2025-01-01T00:00:01Z", Labels: map[string]string{"build_step": "MAIN"}, Text: "FETCHSOURCE\n"},
+		{InsertID: "2", Timestamp: "2025-01-01T00:00:02Z", Labels: step, Text: "Initializing the backend...\n"},
+		{InsertID: "3", Timestamp: "2025-01-01T00:00:02Z", Labels: step, Text: "Plan: 1 to add, 0 to change, 0 to destroy.\n"},
+	}}
+	cb := &fakeCloudBuild{statuses: map[string][]string{"b1": {BuildStatusWorking, BuildStatusWorking, BuildStatusSuccess}}}
+	lines := []string{}
+	g := GCP{
+		Clients: Clients{CloudBuild: cb, Logging: logs},
+		wait: WaitOptions{
+			Backoff: testWait.Backoff,
+			Logs:    BuildLogOptions{Stream: true, Logger: logger.New(linesLogger{lines: &lines}), Prefix: "eab-multitenant"},
+		},
+	}
+
+	status, err := g.GetFinalBuildState(context.Background(), t, "prj", "us-central1", "b1", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, BuildStatusSuccess, status)
+	assert.Equal(t, []string{
+		"[eab-multitenant] [MAIN] FETCHSOURCE",
+		"[eab-multitenant] [tf plan] Initializing the backend...",
+		"[eab-multitenant] [tf plan] Plan: 1 to add, 0 to change, 0 to destroy.",
+	}, lines, "each line must be written once")
+}
+
+func TestGetBuildLogEntries(t *gotest.T) {
+	g := GCP{
+		RunCmdE: func(t testing.TB, cmd string, args ...interface{}) (string, error) {
+			assert.Equal(t, `logging read 'resource.type="build" AND resource.labels.build_id="b1" AND timestamp>="2025-01-01T00:00:01Z"' --project prj --order=asc`, fmt.Sprintf(cmd, args...))
+			return `[{"insertId": "1", "timestamp": "2025-01-01T00:00:01Z", "labels": {"build_step": "Step #0"}, "textPayload": "hello"}]`, nil
+		},
+	}
+	entries, err := g.GetBuildLogEntries(t, "prj", "b1", "2025-01-01T00:00:01Z")
+	assert.NoError(t, err)
+	assert.Equal(t, []LogEntry{
+		{InsertID: "1", Timestamp: "2025-01-01T00:00:01Z", Labels: map[string]string{"build_step": "Step #0"}, Text: "hello"},
+	}, entries)
+
+	g.RunCmdE = func(t testing.TB, cmd string, args ...interface{}) (string, error) {
+		return "", errors.New("PERMISSION_DENIED")
+	}
+	_, err = g.GetBuildLogEntries(t, "prj", "b1", "")
+	assert.ErrorContains(t, err, "PERMISSION_DENIED")
+}
+
+func TestGetFinalBuildStateKeepsWaitingOnLogErrors(t *gotest.T) {
+	cb := &fakeCloudBuild{statuses: map[string][]string{"b1": {BuildStatusWorking, BuildStatusWorking, BuildStatusSuccess}}}
+	lines := []string{}
+	g := GCP{
+		Clients: Clients{CloudBuild: cb, Logging: &failingLogging{err: errors.New("logging API unavailable")}},
+		wait: WaitOptions{
+			Backoff: testWait.Backoff,
+			Logs:    BuildLogOptions{Stream: true, Logger: logger.New(linesLogger{lines: &lines})},
+		},
+	}
+
+	status, err := g.GetFinalBuildState(context.Background(), t, "prj", "us-central1", "b1", time.Minute)
+	assert.NoError(t, err, "errors reading the logs should not stop the wait")
+	assert.Equal(t, BuildStatusSuccess, status)
+	assert.Empty(t, lines)
+}
+
+func TestWaitBuildSuccessSavesFailedBuildLog(t *gotest.T) {
+	dir := t.TempDir()
+	cb := &fakeCloudBuild{
+		builds:   []Build{{ID: "b1", Status: BuildStatusWorking}},
+		statuses: map[string][]string{"b1": {BuildStatusFailure}},
+	}
+	g := GCP{
+		Clients: Clients{CloudBuild: cb},
+		RunCmd: func(t testing.TB, cmd string, args ...interface{}) string {
+			return "Step #0: Error: Invalid value for variable\n"
+		},
+		wait: WaitOptions{Backoff: testWait.Backoff, Logs: BuildLogOptions{Prefix: "hello-world/admin", Dir: dir}},
+	}
+
+	err := g.WaitBuildSuccess(context.Background(), t, "prj", "us-central1", "repo", "abc", "failed", time.Minute, 2, time.Millisecond)
+	assert.ErrorContains(t, err, "failed\nTerraform error:\nError: Invalid value for variable\n")
+	logs, err := os.ReadFile(filepath.Join(dir, "hello-world-admin-b1.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Step #0: Error: Invalid value for variable\n", string(logs))
+}
@@ -0,0 +1,173 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/test/integration/testutils"
+)
+
+// defaultRetryCatalog has the built-in retryable errors.
+var defaultRetryCatalog = func() *RetryCatalog {
+	patterns := []RetryPattern{}
+	for _, p := range slices.Sorted(maps.Keys(testutils.RetryableTransientErrors)) {
+		patterns = append(patterns, RetryPattern{Pattern: p, Message: testutils.RetryableTransientErrors[p]})
+	}
+	c, err := NewRetryCatalog(patterns)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}()
+
+// RetryPattern is an error in the log of failed builds that is worth of a retry.
+// MaxRetries and Backoff, if set, replace the number of retries and the time between retries
+// of the builds failed with the error.
+type RetryPattern struct {
+	Pattern    string        `yaml:"pattern"`
+	Message    string        `yaml:"message"`
+	MaxRetries int           `yaml:"max_retries"`
+	Backoff    time.Duration `yaml:"backoff"`
+	regexp     *regexp.Regexp
+}
+
+// RetryCount is the number of times a retry pattern was found in the logs of failed builds.
+type RetryCount struct {
+	Pattern string
+	Message string
+	Count   int
+}
+
+// RetryCatalog is the list of retryable errors of failed builds, checked in order.
+// It counts the errors found, and is safe for concurrent use.
+type RetryCatalog struct {
+	patterns []RetryPattern
+	mu       sync.Mutex
+	counts   map[string]int
+}
+
+// retryFile is the format of a file with retry patterns.
+type retryFile struct {
+	Patterns []RetryPattern `yaml:"patterns"`
+}
+
+// NewRetryCatalog creates a catalog with the given patterns.
+// Patterns are regular expressions where the dot also matches new lines.
+func NewRetryCatalog(patterns []RetryPattern) (*RetryCatalog, error) {
+	c := &RetryCatalog{counts: map[string]int{}}
+	for _, p := range patterns {
+		if p.Pattern == "" {
+			return nil, fmt.Errorf("retry pattern with message '%s' has an empty pattern", p.Message)
+		}
+		if p.MaxRetries < 0 || p.Backoff < 0 {
+			return nil, fmt.Errorf("retry pattern '%s' has a negative max_retries or backoff", p.Pattern)
+		}
+		r, err := regexp.Compile(fmt.Sprintf("(?s)%s", p.Pattern)) //(?s) enables dot (.) to match newline.
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile retry pattern '%s': %w", p.Pattern, err)
+		}
+		p.regexp = r
+		c.patterns = append(c.patterns, p)
+	}
+	return c, nil
+}
+
+// LoadRetryCatalog creates a catalog with the patterns of a YAML or JSON file followed by the built-in ones,
+// so the patterns of the file take precedence.
+func LoadRetryCatalog(path string) (*RetryCatalog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open retry patterns file: %w", err)
+	}
+	defer f.Close()
+	var rf retryFile
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&rf); err != nil {
+		return nil, fmt.Errorf("failed to parse retry patterns file %s: %w", path, err)
+	}
+	return NewRetryCatalog(append(rf.Patterns, defaultRetryCatalog.patterns...))
+}
+
+// orDefault returns the built-in catalog for a nil catalog.
+func (c *RetryCatalog) orDefault() *RetryCatalog {
+	if c == nil {
+		return defaultRetryCatalog
+	}
+	return c
+}
+
+// Match returns the first pattern found in the log of a failed build, and counts it.
+func (c *RetryCatalog) Match(logs string) (RetryPattern, bool) {
+	c = c.orDefault()
+	for _, p := range c.patterns {
+		if p.regexp.MatchString(logs) {
+			c.mu.Lock()
+			c.counts[p.Pattern]++
+			c.mu.Unlock()
+			return p, true
+		}
+	}
+	return RetryPattern{}, false
+}
+
+// Counts returns the patterns found, the most frequent first.
+func (c *RetryCatalog) Counts() []RetryCount {
+	c = c.orDefault()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := []RetryCount{}
+	for _, p := range c.patterns {
+		n := c.counts[p.Pattern]
+		if n == 0 || slices.ContainsFunc(counts, func(rc RetryCount) bool { return rc.Pattern == p.Pattern }) {
+			continue
+		}
+		counts = append(counts, RetryCount{Pattern: p.Pattern, Message: p.Message, Count: n})
+	}
+	slices.SortStableFunc(counts, func(a, b RetryCount) int { return cmp.Compare(b.Count, a.Count) })
+	return counts
+}
+
+// Messages returns the messages of the patterns by pattern, in the format of the terraform retryable errors.
+func (c *RetryCatalog) Messages() map[string]string {
+	messages := map[string]string{}
+	for _, p := range c.orDefault().patterns {
+		if _, ok := messages[p.Pattern]; !ok {
+			messages[p.Pattern] = p.Message
+		}
+	}
+	return messages
+}
+
+// retries returns the number of retries and the time between retries of the builds failed with the error.
+func (p RetryPattern) retries(maxRetries int, timeBetweenRetries time.Duration) (int, time.Duration) {
+	if p.MaxRetries > 0 {
+		maxRetries = p.MaxRetries
+	}
+	if p.Backoff > 0 {
+		timeBetweenRetries = p.Backoff
+	}
+	return maxRetries, timeBetweenRetries
+}
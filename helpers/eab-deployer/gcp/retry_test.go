@@ -0,0 +1,121 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	gotest "testing"
+
+	"github.com/mitchellh/go-testing-interface"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRetryCatalog(t *gotest.T) {
+	for _, file := range []string{"retry_patterns.yaml", "retry_patterns.json"} {
+		t.Run(file, func(t *gotest.T) {
+			c, err := LoadRetryCatalog(filepath.Join(".", "testdata", file))
+			assert.NoError(t, err)
+
+			p, found := c.Match("Error: googleapi: Error 400: Workload Identity Pool does not exist (pool).")
+			assert.True(t, found)
+			assert.Equal(t, "Workload Identity Pool propagation.", p.Message)
+			maxRetries, backoff := p.retries(2, time.Minute)
+			assert.Equal(t, 4, maxRetries)
+			assert.Equal(t, 30*time.Second, backoff)
+
+			p, found = c.Match("Error: Error 403: Compute Engine API has not been used in project 123")
+			assert.True(t, found, "built-in patterns must be kept")
+			maxRetries, backoff = p.retries(2, time.Minute)
+			assert.Equal(t, 2, maxRetries)
+			assert.Equal(t, time.Minute, backoff)
+
+			_, found = c.Match("Error: Invalid value for variable")
+			assert.False(t, found)
+		})
+	}
+}
+
+func TestLoadRetryCatalogPrecedence(t *gotest.T) {
+	c, err := LoadRetryCatalog(filepath.Join(".", "testdata", "retry_patterns.yaml"))
+	assert.NoError(t, err)
+	p, found := c.Match("Error 409: unable to queue the operation")
+	assert.True(t, found)
+	assert.Equal(t, "Queue full, wait longer.", p.Message, "patterns of the file must take precedence over the built-in ones")
+	assert.Equal(t, "Queue full, wait longer.", c.Messages()[".*Error 409.*unable to queue the operation.*"])
+}
+
+func TestLoadRetryCatalogErrors(t *gotest.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"unknown-field.yaml": "patterns:\n  - pattern: abc\n    retries: 3\n",
+		"bad-regexp.yaml":    "patterns:\n  - pattern: \"(abc\"\n",
+		"empty-pattern.json": `{"patterns": [{"message": "abc"}]}`,
+		"negative.yaml":      "patterns:\n  - pattern: abc\n    max_retries: -1\n",
+	} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		_, err := LoadRetryCatalog(path)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRetryCounts(t *gotest.T) {
+	c, err := NewRetryCatalog([]RetryPattern{
+		{Pattern: ".*502.*", Message: "Bad Gateway"},
+		{Pattern: ".*Error 409.*", Message: "Conflict"},
+		{Pattern: ".*Error 403.*", Message: "Forbidden"},
+	})
+	assert.NoError(t, err)
+	c.Match("Error 409")
+	c.Match("got 502")
+	c.Match("Error 409 again")
+	c.Match("nothing")
+
+	assert.Equal(t, []RetryCount{
+		{Pattern: ".*Error 409.*", Message: "Conflict", Count: 2},
+		{Pattern: ".*502.*", Message: "Bad Gateway", Count: 1},
+	}, c.Counts())
+}
+
+func TestWaitBuildSuccessPatternMaxRetries(t *gotest.T) {
+	retries, err := NewRetryCatalog([]RetryPattern{{Pattern: ".*Error 409.*", Message: "Conflict", MaxRetries: 1, Backoff: time.Millisecond}})
+	assert.NoError(t, err)
+	cb := &fakeCloudBuild{
+		builds: []Build{{ID: "b1", Status: BuildStatusWorking}},
+		statuses: map[string][]string{
+			"b1":      {BuildStatusFailure},
+			"retry-1": {BuildStatusFailure},
+		},
+	}
+	g := GCP{
+		Clients: Clients{CloudBuild: cb},
+		RunCmd: func(t testing.TB, cmd string, args ...interface{}) string {
+			return "Error 409: conflict"
+		},
+		TriggerNewBuild: func(t testing.TB, ctx context.Context, buildName string) (string, error) {
+			return cb.RetryBuild(ctx, buildName)
+		},
+		wait: WaitOptions{Backoff: testWait.Backoff, Retries: retries},
+	}
+
+	err = g.WaitBuildSuccess(context.Background(), t, "prj", "us-central1", "repo", "abc", "failed", time.Minute, 3, time.Hour)
+	assert.ErrorContains(t, err, "build failed after 1 retries")
+	assert.Len(t, cb.retried, 1, "the max retries of the pattern must replace the default")
+	assert.Equal(t, []RetryCount{{Pattern: ".*Error 409.*", Message: "Conflict", Count: 2}}, retries.Counts())
+}
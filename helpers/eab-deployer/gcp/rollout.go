@@ -0,0 +1,306 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-testing-interface"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	RolloutStatusPendingApproval  = "PENDING_APPROVAL"
+	RolloutStatusApprovalRejected = "APPROVAL_REJECTED"
+	RolloutStatusHalted           = "HALTED"
+	RolloutStatusNotStarted       = "NOT_STARTED"
+
+	PhaseStatusPending    = "PENDING"
+	PhaseStatusInProgress = "IN_PROGRESS"
+	PhaseStatusSucceeded  = "SUCCEEDED"
+
+	ApprovalApproved     = "APPROVED"
+	ApprovalAutoApproved = "AUTO_APPROVED"
+	ApprovalRejected     = "REJECTED"
+
+	// DefaultApprovalTimeout is the time to wait for the approval of a rollout.
+	DefaultApprovalTimeout = 24 * time.Hour
+)
+
+// errRolloutFailed is returned when the rollout to a target finishes without success.
+var errRolloutFailed = errors.New("rollout failed")
+
+// RolloutOptions configure how the rollouts of a release are managed.
+// AutoApprove approves the rollouts to targets that require approval, otherwise the approval is waited up to ApprovalTimeout.
+// DisableRollback keeps a failed target as it is, otherwise it is rolled back to its last successful release.
+type RolloutOptions struct {
+	AutoApprove     bool
+	ApprovalTimeout time.Duration
+	DisableRollback bool
+}
+
+// RolloutResult is the result of the rollout of a release to a target.
+// Approval is set for rollouts that required approval, Phases are the canary phases advanced by the helper,
+// and Rollback is the state of the rollback of a failed target.
+type RolloutResult struct {
+	TargetID string
+	Rollout  string
+	State    string
+	Approval string
+	Phases   []string
+	Rollback string
+}
+
+// rollbackStarted is the rollback state of a target when the rollback rollout is not waited.
+const rollbackStarted = "STARTED"
+
+// String returns a one line summary of the result.
+func (r RolloutResult) String() string {
+	s := fmt.Sprintf("%s: %s", r.TargetID, r.State)
+	if r.Approval != "" {
+		s += fmt.Sprintf(", approval %s", r.Approval)
+	}
+	if len(r.Phases) > 0 {
+		s += fmt.Sprintf(", advanced phases %s", strings.Join(r.Phases, ", "))
+	}
+	if r.Rollback != "" {
+		s += fmt.Sprintf(", rollback %s", r.Rollback)
+	}
+	return s
+}
+
+// nextPhase returns the phase of a rollout that waits to be advanced, a pending phase after a succeeded one,
+// or an empty string if no phase is waiting.
+func (r Rollout) nextPhase() string {
+	for i, p := range r.Phases {
+		if p.State == PhaseStatusInProgress {
+			return ""
+		}
+		if p.State == PhaseStatusPending && i > 0 && r.Phases[i-1].State == PhaseStatusSucceeded {
+			return p.ID
+		}
+	}
+	return ""
+}
+
+// WaitRelease rolls out a release through the targets of its delivery pipeline, in the order of the pipeline stages,
+// and returns the result of each target. Targets after a failed one are not started.
+// The rollout to each target is waited up to the timeout, and up to the approval timeout while it waits for approval.
+// A failed target is rolled back to its last successful release unless rollback is disabled.
+func (g GCP) WaitRelease(ctx context.Context, t testing.TB, project, region, serviceName, commitSha string, timeout time.Duration) ([]RolloutResult, error) {
+	pipeline := fmt.Sprintf("projects/%s/locations/%s/deliveryPipelines/%s", project, region, serviceName)
+	releaseFullName := fmt.Sprintf("%s/releases/%s-%s", pipeline, serviceName, commitSha)
+
+	targets := g.GetReleaseTargets(t, releaseFullName)
+	results := make([]RolloutResult, len(targets))
+	for i, targetID := range targets {
+		results[i] = RolloutResult{TargetID: targetID, State: RolloutStatusNotStarted}
+	}
+	for i, targetID := range targets {
+		// the release is rolled out to the first target when it is created
+		if i > 0 {
+			err := g.PromoteRelease(t, releaseFullName, serviceName, region, targetID)
+			if err != nil {
+				return results, err
+			}
+		}
+		result, err := g.waitRollout(ctx, t, targetID, func() (Rollout, error) {
+			return g.latestRollout(t, project, region, serviceName, releaseFullName, targetID)
+		}, timeout)
+		results[i] = result
+		if err != nil {
+			return results, err
+		}
+		if result.State == ReleaseStatusSuccess {
+			continue
+		}
+		if result.State == ReleaseStatusFailure && !g.wait.Rollouts.DisableRollback {
+			results[i].Rollback = g.rollback(ctx, t, project, region, pipeline, targetID, timeout)
+		}
+		return results, fmt.Errorf("rollout of release %s to target %s finished with state %s: %w", releaseFullName, targetID, result.State, errRolloutFailed)
+	}
+	return results, nil
+}
+
+// waitRollout waits for the rollout returned by get to finish, approving it if it is allowed and advancing its canary phases.
+// A rollout that does not exist yet has an empty name.
+func (g GCP) waitRollout(ctx context.Context, t testing.TB, targetID string, get func() (Rollout, error), timeout time.Duration) (RolloutResult, error) {
+	result := RolloutResult{TargetID: targetID}
+	approvalTimeout := g.wait.Rollouts.ApprovalTimeout
+	if approvalTimeout == 0 {
+		approvalTimeout = DefaultApprovalTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	waitingApproval := false
+	// the state of a rollout can lag behind the actions sent, they are sent once for each rollout and phase
+	approved := map[string]bool{}
+	advanced := map[string]bool{}
+	for attempt := 0; ; attempt++ {
+		rollout, err := get()
+		if err != nil {
+			return result, err
+		}
+		result.Rollout = rollout.Name
+		result.State = rollout.State
+		if rollout.ApprovalState == ApprovalApproved && result.Approval == "" {
+			result.Approval = ApprovalApproved
+		}
+		g.logf("rollout %s to target %s status is %s\n", rollout.Name, targetID, rollout.State)
+
+		switch rollout.State {
+		case ReleaseStatusSuccess, ReleaseStatusFailure, ReleaseStatusCancelled, RolloutStatusHalted:
+			return result, nil
+		case RolloutStatusApprovalRejected:
+			result.Approval = ApprovalRejected
+			return result, nil
+		case RolloutStatusPendingApproval:
+			if g.wait.Rollouts.AutoApprove {
+				if !approved[rollout.Name] {
+					fmt.Printf("# approving rollout %s to target %s\n", rollout.Name, targetID)
+					if err := g.ApproveRollout(t, rollout.Name); err != nil {
+						return result, err
+					}
+					approved[rollout.Name] = true
+					result.Approval = ApprovalAutoApproved
+				}
+			} else if !waitingApproval {
+				fmt.Printf("# rollout %s to target %s requires approval, approve it with:\n", rollout.Name, targetID)
+				fmt.Printf("# gcloud deploy rollouts approve %s\n", rollout.Name)
+				deadline = time.Now().Add(approvalTimeout)
+				waitingApproval = true
+			}
+		default:
+			if waitingApproval {
+				deadline = time.Now().Add(timeout)
+				waitingApproval = false
+			}
+			if phase := rollout.nextPhase(); phase != "" && !advanced[rollout.Name+"/"+phase] {
+				fmt.Printf("# advancing rollout %s to target %s to phase %s\n", rollout.Name, targetID, phase)
+				if err := g.AdvanceRollout(t, rollout.Name, phase); err != nil {
+					return result, err
+				}
+				advanced[rollout.Name+"/"+phase] = true
+				result.Phases = append(result.Phases, phase)
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return result, waitError(context.DeadlineExceeded, "rollout to target", targetID)
+		}
+		if err := sleep(ctx, g.wait.Backoff.Delay(attempt)); err != nil {
+			return result, waitError(err, "rollout to target", targetID)
+		}
+	}
+}
+
+// rollback rolls back a target to its last successful release and returns the final state of the rollback rollout.
+func (g GCP) rollback(ctx context.Context, t testing.TB, project, region, pipeline, targetID string, timeout time.Duration) string {
+	fmt.Printf("# rolling back target %s to its last successful release\n", targetID)
+	name, err := g.RollbackTarget(t, project, region, pipeline, targetID)
+	if err != nil {
+		g.logf("failed to roll back target %s. Error: %s\n", targetID, err.Error())
+		return ReleaseStatusFailure
+	}
+	if name == "" {
+		return rollbackStarted
+	}
+	result, err := g.waitRollout(ctx, t, targetID, func() (Rollout, error) {
+		return g.GetRollout(t, name)
+	}, timeout)
+	if err != nil {
+		g.logf("failed to wait for the rollback of target %s. Error: %s\n", targetID, err.Error())
+		return ReleaseStatusFailure
+	}
+	return result.State
+}
+
+// latestRollout returns the most recent rollout of a release to a target, a rollout without name if there is none yet.
+func (g GCP) latestRollout(t testing.TB, projectID, region, service, releaseFullName, targetID string) (Rollout, error) {
+	var rollouts []Rollout
+	if g.CloudDeploy != nil {
+		var err error
+		rollouts, err = g.CloudDeploy.ListRollouts(context.Background(), releaseFullName, targetID)
+		if err != nil {
+			return Rollout{}, err
+		}
+	} else {
+		for _, r := range g.Runf(t, "deploy rollouts list --project=%s --delivery-pipeline=%s --region=%s --release=%s --filter targetId=%s", projectID, service, region, releaseFullName, targetID).Array() {
+			rollouts = append(rollouts, rolloutFromJSON(r))
+		}
+	}
+	latest := Rollout{TargetID: targetID}
+	for _, r := range rollouts {
+		if latest.Name == "" || r.CreateTime >= latest.CreateTime {
+			latest = r
+		}
+	}
+	return latest, nil
+}
+
+// GetRollout gets a Cloud Deploy rollout by its full name.
+func (g GCP) GetRollout(t testing.TB, rolloutName string) (Rollout, error) {
+	if g.CloudDeploy != nil {
+		return g.CloudDeploy.GetRollout(context.Background(), rolloutName)
+	}
+	return rolloutFromJSON(g.Runf(t, "deploy rollouts describe %s", rolloutName).Array()[0]), nil
+}
+
+// ApproveRollout approves a rollout that requires approval.
+func (g GCP) ApproveRollout(t testing.TB, rolloutName string) error {
+	if g.CloudDeploy != nil {
+		return g.CloudDeploy.ApproveRollout(context.Background(), rolloutName)
+	}
+	g.Runf(t, "deploy rollouts approve %s --quiet", rolloutName)
+	return nil
+}
+
+// AdvanceRollout advances a rollout to the given phase.
+func (g GCP) AdvanceRollout(t testing.TB, rolloutName, phaseID string) error {
+	if g.CloudDeploy != nil {
+		return g.CloudDeploy.AdvanceRollout(context.Background(), rolloutName, phaseID)
+	}
+	g.Runf(t, "deploy rollouts advance %s --phase-id=%s --quiet", rolloutName, phaseID)
+	return nil
+}
+
+// RollbackTarget rolls back a target of a delivery pipeline to its last successful release and returns the name of the rollback rollout.
+// The gcloud CLI does not return the rollback rollout, so the name is empty and the rollback is not waited.
+func (g GCP) RollbackTarget(t testing.TB, projectID, region, pipeline, targetID string) (string, error) {
+	if g.CloudDeploy != nil {
+		return g.CloudDeploy.RollbackTarget(context.Background(), pipeline, targetID)
+	}
+	g.Runf(t, "deploy targets rollback %s --delivery-pipeline=%s --region=%s --project=%s --quiet", targetID, pipeline[strings.LastIndex(pipeline, "/")+1:], region, projectID)
+	return "", nil
+}
+
+// rolloutFromJSON converts a rollout returned by the gcloud CLI.
+func rolloutFromJSON(r gjson.Result) Rollout {
+	rollout := Rollout{
+		Name:          r.Get("name").String(),
+		TargetID:      r.Get("targetId").String(),
+		State:         r.Get("state").String(),
+		ApprovalState: r.Get("approvalState").String(),
+		FailureReason: r.Get("failureReason").String(),
+		CreateTime:    r.Get("createTime").String(),
+	}
+	for _, p := range r.Get("phases").Array() {
+		rollout.Phases = append(rollout.Phases, RolloutPhase{ID: p.Get("id").String(), State: p.Get("state").String()})
+	}
+	return rollout
+}
@@ -0,0 +1,226 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/mitchellh/go-testing-interface"
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+const (
+	// cancelBuildTimeout is the time to cancel a build after the wait is interrupted.
+	cancelBuildTimeout = 30 * time.Second
+	// maxPulledMessages is the maximum number of notifications received in a pull.
+	maxPulledMessages = 100
+	// pullDelay is the time between pulls when only notifications of other builds are received,
+	// so they are not pulled again right after they are released.
+	pullDelay = 2 * time.Second
+)
+
+// DefaultBackoff is the backoff used to poll builds and rollouts.
+var DefaultBackoff = Backoff{
+	Initial:    5 * time.Second,
+	Max:        time.Minute,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Backoff is an exponential backoff with jitter.
+// The delay of an attempt grows from Initial by Multiplier up to Max,
+// and is randomized by plus or minus Jitter, a fraction of the delay.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// Delay returns the time to wait before the given attempt, starting from zero.
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Initial) * math.Pow(max(b.Multiplier, 1), float64(attempt))
+	if b.Max > 0 {
+		d = min(d, float64(b.Max))
+	}
+	if b.Jitter > 0 {
+		d = d * (1 + b.Jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(d)
+}
+
+// WaitOptions configure how builds and rollouts are waited.
+// CancelBuildOnInterrupt cancels the build being waited when the wait is interrupted.
+// BuildEvents, if set, is used to be notified of build status changes between the polls.
+// Logs configure the streaming and saving of the build logs.
+// Retries are the errors of failed builds that are retried, the built-in ones if nil.
+// Rollouts configure the approvals, canary phases and rollbacks of the Cloud Deploy rollouts.
+type WaitOptions struct {
+	Backoff                Backoff
+	CancelBuildOnInterrupt bool
+	BuildEvents            BuildEventSource
+	Logs                   BuildLogOptions
+	Retries                *RetryCatalog
+	Rollouts               RolloutOptions
+}
+
+// BuildEvent is a Cloud Build notification of a build status change.
+type BuildEvent struct {
+	BuildID string
+	Status  string
+}
+
+// BuildEventSource receives Cloud Build notifications.
+// Receive waits until there are notifications of the build or the context is done,
+// notifications of other builds are left to other receivers.
+type BuildEventSource interface {
+	Receive(ctx context.Context, buildID string) ([]BuildEvent, error)
+}
+
+// pubsubBuildEvents receives the notifications published by Cloud Build
+// in the cloud-builds topic from a Pub/Sub subscription.
+type pubsubBuildEvents struct {
+	svc          *pubsub.Service
+	subscription string
+}
+
+// NewPubSubBuildEvents creates a source of the Cloud Build notifications received
+// by the subscription, projects/PROJECT_ID/subscriptions/SUBSCRIPTION, of the cloud-builds topic.
+func NewPubSubBuildEvents(ctx context.Context, subscription string, opts ...option.ClientOption) (BuildEventSource, error) {
+	svc, err := pubsub.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Pub/Sub service: %w", err)
+	}
+	return &pubsubBuildEvents{svc: svc, subscription: subscription}, nil
+}
+
+func (p *pubsubBuildEvents) Receive(ctx context.Context, buildID string) ([]BuildEvent, error) {
+	for {
+		resp, err := p.svc.Projects.Subscriptions.Pull(p.subscription, &pubsub.PullRequest{MaxMessages: maxPulledMessages}).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to pull notifications from %s: %w", p.subscription, err)
+		}
+		events := []BuildEvent{}
+		ack := []string{}
+		others := []string{}
+		for _, m := range resp.ReceivedMessages {
+			if m.Message == nil || m.Message.Attributes["buildId"] != buildID {
+				others = append(others, m.AckId)
+				continue
+			}
+			events = append(events, BuildEvent{BuildID: buildID, Status: m.Message.Attributes["status"]})
+			ack = append(ack, m.AckId)
+		}
+		// notifications of other builds are made available again right away
+		if len(others) > 0 {
+			_, err = p.svc.Projects.Subscriptions.ModifyAckDeadline(p.subscription, &pubsub.ModifyAckDeadlineRequest{AckIds: others, AckDeadlineSeconds: 0}).Context(ctx).Do()
+			if err != nil {
+				return nil, fmt.Errorf("failed to release notifications of %s: %w", p.subscription, err)
+			}
+		}
+		if len(ack) > 0 {
+			_, err = p.svc.Projects.Subscriptions.Acknowledge(p.subscription, &pubsub.AcknowledgeRequest{AckIds: ack}).Context(ctx).Do()
+			if err != nil {
+				return nil, fmt.Errorf("failed to acknowledge notifications of %s: %w", p.subscription, err)
+			}
+			return events, nil
+		}
+		if err := sleep(ctx, pullDelay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// WithWaitOptions returns a copy of the wrapper that waits for builds and rollouts with the given options.
+func (g GCP) WithWaitOptions(wait WaitOptions) GCP {
+	g.wait = wait
+	return g
+}
+
+// sleep waits for the given time or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// waitBuildChange waits until the next poll of the build status, or until a notification of the build arrives.
+// A notification with a final status is returned, so the build is not polled again.
+func (g GCP) waitBuildChange(ctx context.Context, buildID string, d time.Duration) (string, error) {
+	if g.wait.BuildEvents == nil {
+		return "", sleep(ctx, d)
+	}
+	eventCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	events, err := g.wait.BuildEvents.Receive(eventCtx, buildID)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		g.logf("failed to receive build notifications, polling build status. Error: %s\n", err.Error())
+		return "", sleep(ctx, d)
+	}
+	for _, e := range events {
+		if isFinalBuildStatus(e.Status) {
+			return e.Status, nil
+		}
+	}
+	return "", nil
+}
+
+// waitError converts the error of a wait interrupted by the context into a timeout or cancellation error.
+func waitError(err error, kind, name string) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timeout waiting for %s '%s' execution", kind, name)
+	}
+	return fmt.Errorf("waiting for %s '%s' execution was interrupted: %w", kind, name, err)
+}
+
+// cancelInterruptedBuild cancels the build if the wait was interrupted and the wrapper is configured to cancel it.
+func (g GCP) cancelInterruptedBuild(t testing.TB, ctx context.Context, projectID, region, buildID string) {
+	if !g.wait.CancelBuildOnInterrupt || !errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+	g.logf("cancelling build %s.\n", buildID)
+	if g.CloudBuild != nil {
+		cancelCtx, cancel := context.WithTimeout(context.Background(), cancelBuildTimeout)
+		defer cancel()
+		err := g.CloudBuild.CancelBuild(cancelCtx, projectID, region, buildID)
+		if err != nil {
+			g.logf("failed to cancel build %s. Error: %s\n", buildID, err.Error())
+		}
+		return
+	}
+	g.Runf(t, "builds cancel %s --project %s --region %s", buildID, projectID, region)
+}
+
+func isFinalBuildStatus(status string) bool {
+	return status == BuildStatusSuccess || status == BuildStatusFailure || status == BuildStatusCancelled ||
+		status == BuildStatusTimeout || status == BuildStatusInternalError || status == BuildStatusExpired
+}
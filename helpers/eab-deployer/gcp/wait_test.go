@@ -0,0 +1,132 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	gotest "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// fakeBuildEvents returns the events of the build, one per call, and then waits until the context is done.
+type fakeBuildEvents struct {
+	events []BuildEvent
+}
+
+func (f *fakeBuildEvents) Receive(ctx context.Context, buildID string) ([]BuildEvent, error) {
+	if len(f.events) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	e := f.events[0]
+	f.events = f.events[1:]
+	if e.BuildID != buildID {
+		return nil, errors.New("unexpected build")
+	}
+	return []BuildEvent{e}, nil
+}
+
+func TestBackoffDelay(t *gotest.T) {
+	b := Backoff{Initial: time.Second, Max: 5 * time.Second, Multiplier: 2}
+	assert.Equal(t, time.Second, b.Delay(0))
+	assert.Equal(t, 2*time.Second, b.Delay(1))
+	assert.Equal(t, 4*time.Second, b.Delay(2))
+	assert.Equal(t, 5*time.Second, b.Delay(3))
+	assert.Equal(t, 5*time.Second, b.Delay(30))
+
+	b.Jitter = 0.5
+	for attempt := range 10 {
+		d := b.Delay(attempt)
+		assert.GreaterOrEqual(t, d, time.Second/2)
+		assert.LessOrEqual(t, d, 15*time.Second/2)
+	}
+
+	assert.Equal(t, time.Second, Backoff{Initial: time.Second}.Delay(3), "a missing multiplier keeps the delay constant")
+}
+
+func TestGetFinalBuildStateWithEvents(t *gotest.T) {
+	cb := &fakeCloudBuild{statuses: map[string][]string{"b1": {BuildStatusWorking}}}
+	g := GCP{
+		Clients: Clients{CloudBuild: cb},
+		wait: WaitOptions{
+			Backoff:     Backoff{Initial: time.Hour},
+			BuildEvents: &fakeBuildEvents{events: []BuildEvent{{BuildID: "b1", Status: BuildStatusWorking}, {BuildID: "b1", Status: BuildStatusSuccess}}},
+		},
+	}
+
+	status, err := g.GetFinalBuildState(context.Background(), t, "prj", "us-central1", "b1", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, BuildStatusSuccess, status)
+}
+
+func TestGetFinalBuildStateInterrupted(t *gotest.T) {
+	cb := &fakeCloudBuild{statuses: map[string][]string{"b1": {BuildStatusWorking}}}
+	g := GCP{
+		Clients: Clients{CloudBuild: cb},
+		wait:    WaitOptions{Backoff: Backoff{Initial: time.Hour}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := g.GetFinalBuildState(ctx, t, "prj", "us-central1", "b1", time.Minute)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, cb.cancelled, "the build must not be cancelled by default")
+
+	g.wait.CancelBuildOnInterrupt = true
+	_, err = g.GetFinalBuildState(ctx, t, "prj", "us-central1", "b1", time.Minute)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"b1"}, cb.cancelled)
+
+	_, err = g.GetFinalBuildState(context.Background(), t, "prj", "us-central1", "b1", time.Millisecond)
+	assert.EqualError(t, err, "timeout waiting for build 'b1' execution")
+	assert.Equal(t, []string{"b1"}, cb.cancelled, "the build must not be cancelled on timeout")
+}
+
+func TestPubSubBuildEventsWaitsBetweenPulls(t *gotest.T) {
+	var pulls, released atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, ":pull"):
+			pulls.Add(1)
+			_, _ = w.Write([]byte(`{"receivedMessages": [{"ackId": "a1", "message": {"attributes": {"buildId": "other", "status": "WORKING"}}}]}`))
+		case strings.HasSuffix(r.URL.Path, ":modifyAckDeadline"):
+			released.Add(1)
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	events, err := NewPubSubBuildEvents(context.Background(), "projects/prj/subscriptions/builds", option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), pullDelay/2)
+	defer cancel()
+	_, err = events.Receive(ctx, "b1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), pulls.Load(), "notifications of other builds should not be pulled again right away")
+	assert.Equal(t, int32(1), released.Load())
+}
@@ -15,20 +15,33 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	gotest "testing"
+	"time"
 
 	"github.com/mitchellh/go-testing-interface"
 
-	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/msg"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/gcp"
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/stages"
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
 )
 
+const (
+	// retryPatternsEnv is the environment variable with the default file of additional retryable errors.
+	retryPatternsEnv = "EAB_RETRY_PATTERNS"
+)
+
 var (
 	validatorApis = []string{
 		"securitycenter.googleapis.com",
@@ -38,33 +51,138 @@ var (
 
 type cfg struct {
 	tfvarsFile    string
+	vars          utils.Overrides
 	stepsFile     string
 	resetStep     string
 	quiet         bool
 	help          bool
 	listSteps     bool
+	listFormat    string
 	disablePrompt bool
 	validate      bool
+	validateOff   bool
+	validateFmt   string
+	validateOut   string
+	fix           bool
 	destroy       bool
+	dryRun        bool
+	drift         bool
+	driftBuilds   bool
+	upgrade       bool
+	upgradeVer    string
+	parallelism   int
+	useGcloud     bool
+	cancelBuild   bool
+	buildSub      string
+	streamLogs    bool
+	retryFile     string
+	stages        string
+	envs          string
+	apps          string
+	profile       string
+	forcePush     bool
+	promotionWait time.Duration
+	autoApprove   bool
+	approvalWait  time.Duration
+	noRollback    bool
 }
 
 func parseFlags() cfg {
-	var c cfg
+	c := cfg{vars: utils.Overrides{}}
 
 	flag.StringVar(&c.tfvarsFile, "tfvars_file", "", "Full path to the Terraform .tfvars `file` with the configuration to be used.")
-	flag.StringVar(&c.stepsFile, "steps_file", ".steps.json", "Path to the steps `file` to be used to save progress.")
+	flag.Var(c.vars, "var", "Value of an input of the tfvars file, `name=value`, replacing the value of the file and of the "+utils.TFVarEnvPrefix+"name environment variable. Can be repeated.")
+	flag.StringVar(&c.stepsFile, "steps_file", ".steps.json", "Path to the steps `file` to be used to save progress. Use gs://BUCKET/OBJECT to save progress in Cloud Storage.")
 	flag.StringVar(&c.resetStep, "reset_step", "", "Name of a `step` to be reset. The step will be marked as pending.")
 	flag.BoolVar(&c.quiet, "quiet", false, "If true, additional output is suppressed.")
 	flag.BoolVar(&c.help, "help", false, "Prints this help text and exits.")
 	flag.BoolVar(&c.listSteps, "list_steps", false, "List the existing steps.")
+	flag.StringVar(&c.listFormat, "list_format", steps.TableFormat, "Output `format` of the existing steps listed with -list_steps, table or json.")
 	flag.BoolVar(&c.disablePrompt, "disable_prompt", false, "Disable interactive prompt.")
 	flag.BoolVar(&c.validate, "validate", false, "Validate tfvars file inputs.")
+	flag.BoolVar(&c.validateOff, "validate_offline", false, "Validate tfvars file inputs without calling gcloud or Google Cloud APIs.")
+	flag.StringVar(&c.validateFmt, "validate_format", stages.TextFormat, "Output `format` of the -validate and -validate_offline report: text, json or junit.")
+	flag.StringVar(&c.validateOut, "validate_output", "", "Write the -validate and -validate_offline report to this `file` instead of the standard output.")
+	flag.BoolVar(&c.fix, "fix", false, "Validate tfvars file inputs and apply the remediation of the fixable findings.")
 	flag.BoolVar(&c.destroy, "destroy", false, "Destroy the deployment.")
+	flag.BoolVar(&c.dryRun, "dry_run", false, "Generate the tfvars files, run terraform plan for local steps, and show the changes to be committed and pushed, without deploying.")
+	flag.BoolVar(&c.drift, "drift", false, "Run terraform plan in the Terraform directories of the deployed stages and report the drift, without applying anything.")
+	flag.BoolVar(&c.driftBuilds, "drift_plan_builds", false, "Open a plan-only build in the repositories of the stages with drift found by -drift.")
+	flag.BoolVar(&c.upgrade, "upgrade", false, "Commit the code of the Enterprise Application Blueprint in the repositories of the deployed stages and apply it.")
+	flag.StringVar(&c.upgradeVer, "upgrade_version", "", "Blueprint `version` used in the -upgrade commits and tags. Defaults to the git describe of the blueprint code.")
+	flag.IntVar(&c.parallelism, "parallelism", 1, "Maximum `number` of independent stages, like 3-fleetscope and 4-appfactory, and of app infra services deployed concurrently.")
+	flag.BoolVar(&c.useGcloud, "use_gcloud", false, "Use the gcloud CLI instead of the Google Cloud client libraries to call Google Cloud APIs.")
+	flag.BoolVar(&c.cancelBuild, "cancel_build_on_interrupt", false, "Cancel the Cloud Build build being waited when the deploy is interrupted with Ctrl-C.")
+	flag.BoolVar(&c.streamLogs, "stream_build_logs", false, "Stream the logs of the Cloud Build builds while they are waited.")
+	flag.StringVar(&c.retryFile, "retry_patterns", os.Getenv(retryPatternsEnv), "YAML or JSON `file` with additional retryable errors of failed builds. Defaults to the "+retryPatternsEnv+" environment variable.")
+	flag.StringVar(&c.stages, "stages", "", "Comma-separated `list` of stages to be deployed or destroyed, by name or directory, like 3-fleetscope,5-appinfra. Defaults to all the stages.")
+	flag.StringVar(&c.envs, "envs", "", "Comma-separated `list` of environments to be deployed or destroyed, the shared environment is included only if it is listed. Defaults to all the environments.")
+	flag.StringVar(&c.apps, "apps", "", "Comma-separated `list` of applications, like default-example, or services, like default-example.hello-world, to be deployed or destroyed. Selects only the 5-appinfra and 6-appsource stages if -stages is not used. Defaults to all the applications.")
+	flag.StringVar(&c.profile, "profile", "", "Name of an example of the blueprint code, like cymbal-bank, whose overlays and inputs are deployed with the stages.")
+	flag.BoolVar(&c.forcePush, "force_push", false, "Promote the changes by force-pushing the plan and environment branches of GitHub and GitLab repositories instead of merging pull requests.")
+	flag.DurationVar(&c.promotionWait, "promotion_timeout", stages.PromotionTimeout, "Maximum `duration` to wait for the checks and the approval of a pull request opened to promote the changes.")
+	flag.BoolVar(&c.autoApprove, "approve_rollouts", false, "Approve the Cloud Deploy rollouts of the application services to targets that require approval.")
+	flag.DurationVar(&c.approvalWait, "approval_timeout", gcp.DefaultApprovalTimeout, "Maximum `duration` to wait for the approval of a Cloud Deploy rollout when -approve_rollouts is not set.")
+	flag.BoolVar(&c.noRollback, "disable_rollback", false, "Do not roll back a Cloud Deploy target to its last successful release when the rollout of a new release fails.")
+	flag.StringVar(&c.buildSub, "build_subscription", "", "Pub/Sub `subscription`, projects/PROJECT_ID/subscriptions/SUBSCRIPTION, of the cloud-builds topic used to be notified of build status changes.")
 
 	flag.Parse()
 	return c
 }
 
+func releaseLock(release func() error) {
+	if err := release(); err != nil {
+		fmt.Printf("# failed to release state file lock. Error: %s\n", err.Error())
+	}
+}
+
+// runInfo identifies the operator, the active gcloud account or the local user,
+// and the commit of the Enterprise Application Blueprint code being deployed.
+func runInfo(t testing.TB, conf stages.CommonConf) steps.RunInfo {
+	operator := gcp.NewGCP().GetActiveAccount(t)
+	if operator == "" {
+		operator = os.Getenv("USER")
+	}
+	commit, err := utils.GetRepoOnly(t, conf.EABPath, conf.Logger).GetCommitSha()
+	if err != nil {
+		commit = ""
+	}
+	return steps.RunInfo{
+		Operator: operator,
+		Commit:   commit,
+	}
+}
+
+// validate runs the validators and writes the report to stdout, or to the -validate_output file, and returns the exit code.
+// The messages are written to stderr when stdout has a JSON or JUnit report.
+func validate(c cfg, validators []stages.Validator, stdout, stderr io.Writer) int {
+	if !slices.Contains([]string{stages.TextFormat, stages.JSONFormat, stages.JUnitFormat}, c.validateFmt) {
+		fmt.Fprintf(stderr, "# Invalid validation report format '%s', valid formats are text, json and junit.\n", c.validateFmt)
+		return 1
+	}
+
+	out, log := stdout, stdout
+	if c.validateOut != "" {
+		f, err := os.Create(c.validateOut)
+		if err != nil {
+			fmt.Fprintf(stderr, "# Failed to create validation report file. Error: %s\n", err.Error())
+			return 1
+		}
+		defer f.Close()
+		out = f
+	} else if c.validateFmt != stages.TextFormat {
+		log = stderr
+	}
+
+	fmt.Fprintln(log, "# Validating tfvars file and deploy requirements.")
+	report := stages.RunValidators(validators)
+	if err := report.Write(out, c.validateFmt); err != nil {
+		fmt.Fprintf(stderr, "# Failed to write validation report. Error: %s\n", err.Error())
+		return 1
+	}
+	return report.ExitCode()
+}
+
 func main() {
 
 	cfg := parseFlags()
@@ -74,13 +192,44 @@ func main() {
 		return
 	}
 
+	if cfg.useGcloud {
+		gcp.UseGcloud()
+	}
+
+	if cfg.dryRun && cfg.destroy {
+		fmt.Println("# Flags -dry_run and -destroy can not be used together.")
+		os.Exit(1)
+	}
+
 	// load tfvars
-	globalTFVars, err := stages.ReadGlobalTFVars(cfg.tfvarsFile)
+	overrides := []utils.Overrides{utils.EnvOverrides(os.Environ()), cfg.vars}
+	globalTFVars, err := stages.ReadGlobalTFVars(cfg.tfvarsFile, overrides...)
 	if err != nil {
 		fmt.Printf("# Failed to read GlobalTFVars file. Error: %s\n", err.Error())
 		os.Exit(1)
 	}
 
+	// init infra
+	gotest.Init()
+	t := &testing.RuntimeT{}
+
+	// validate inputs offline, the directories may not exist where the tfvars file is checked
+	if cfg.validateOff {
+		os.Exit(validate(cfg, stages.OfflineValidators(t, globalTFVars), os.Stdout, os.Stderr))
+	}
+
+	// interrupt the wait of builds and rollouts and the prompts on the first Ctrl-C, the second one exits right away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		signal.Stop(interrupts)
+		fmt.Println("# Interrupted, stopping the current wait or prompt. Press Ctrl-C again to exit.")
+		cancel()
+	}()
+
 	// validate Directories
 	err = stages.ValidateDirectories(globalTFVars)
 	if err != nil {
@@ -88,46 +237,97 @@ func main() {
 		os.Exit(1)
 	}
 
-	// init infra
-	gotest.Init()
-	t := &testing.RuntimeT{}
+	// load the example profile, its inputs replace the inputs of the tfvars file but not the -var and TF_VAR_ overrides
+	profile, err := stages.LoadProfile(globalTFVars.EABCodePath, cfg.profile)
+	if err != nil {
+		fmt.Printf("# Failed to load profile. Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	applied, err := profile.ApplyTFVars(globalTFVars.EABCodePath, &globalTFVars, overrides...)
+	if err != nil {
+		fmt.Printf("# Failed to apply the inputs of profile %s. Error: %s\n", profile.Name, err.Error())
+		os.Exit(1)
+	}
+	if len(applied) > 0 {
+		fmt.Printf("# Profile %s inputs applied: %s\n", profile.Name, strings.Join(applied, ", "))
+	}
+
 	conf := stages.CommonConf{
+		Context:       ctx,
 		EABPath:       globalTFVars.EABCodePath,
 		CheckoutPath:  globalTFVars.CodeCheckoutPath,
 		PolicyPath:    filepath.Join(globalTFVars.EABCodePath, "policy-library"),
 		DisablePrompt: cfg.disablePrompt,
+		Parallelism:   cfg.parallelism,
 		Logger:        utils.GetLogger(cfg.quiet),
+		Wait:          waitOptions(ctx, cfg),
+		Profile:       profile,
+		Prompts:       &sync.Mutex{},
+		Targets: stages.Targets{
+			Stages: splitList(cfg.stages),
+			Envs:   splitList(cfg.envs),
+			Apps:   splitList(cfg.apps),
+		},
+	}
+	err = conf.Targets.Validate(globalTFVars)
+	if err != nil {
+		fmt.Printf("# Invalid targets. Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	// load additional retryable errors
+	if cfg.retryFile != "" {
+		conf.Wait.Retries, err = gcp.LoadRetryCatalog(cfg.retryFile)
+		if err != nil {
+			fmt.Printf("# Failed to load retry patterns. Error: %s\n", err.Error())
+			os.Exit(1)
+		}
 	}
 
 	// validate inputs
 	if cfg.validate {
-		stages.ValidateComponents(t)
-		stages.ValidateBasicFields(t, globalTFVars)
-		stages.ValidateDestroyFlags(t, globalTFVars)
-		stages.ValidatePermissions(t, globalTFVars)
-		stages.ValidateRequiredAPIs(t, globalTFVars)
-		stages.ValidateRepositories(t, globalTFVars)
-		stages.ValidateNetworkRequirementes(t, globalTFVars)
-		stages.ValidatePrivateWorkerPoolRequirementes(t, globalTFVars)
-		stages.ValidateVPCSCRequirements(t, globalTFVars)
-		return
+		os.Exit(validate(cfg, stages.Validators(t, globalTFVars, cfg.forcePush), os.Stdout, os.Stderr))
 	}
 
-	s, err := steps.LoadSteps(cfg.stepsFile)
+	store, err := steps.NewStateStore(cfg.stepsFile)
 	if err != nil {
-		fmt.Printf("# failed to load state file %s. Error: %s\n", cfg.stepsFile, err.Error())
+		fmt.Printf("# failed to open state file %s. Error: %s\n", cfg.stepsFile, err.Error())
 		os.Exit(2)
 	}
 
+	// lock the steps file, listing the steps does not change it
+	release := func() error { return nil }
+	if !cfg.listSteps {
+		release, err = store.Lock()
+		if err != nil {
+			fmt.Printf("# failed to lock state file %s. Error: %s\n", cfg.stepsFile, err.Error())
+			os.Exit(2)
+		}
+	}
+	defer releaseLock(release)
+	exit := func(code int) {
+		printRetryCounts(conf.Wait.Retries)
+		releaseLock(release)
+		os.Exit(code)
+	}
+
+	s, err := steps.LoadStepsFromStore(store)
+	if err != nil {
+		fmt.Printf("# failed to load state file %s. Error: %s\n", cfg.stepsFile, err.Error())
+		exit(2)
+	}
+
 	if cfg.listSteps {
-		fmt.Println("# Executed steps:")
-		e := s.ListSteps()
-		if len(e) == 0 {
-			fmt.Println("# No steps executed")
-			return
+		if cfg.listFormat == steps.TableFormat {
+			fmt.Println("# Executed steps:")
+			if len(s.Steps) == 0 {
+				fmt.Println("# No steps executed")
+				return
+			}
 		}
-		for _, step := range e {
-			fmt.Println(step)
+		if err := s.WriteReport(os.Stdout, cfg.listFormat); err != nil {
+			fmt.Printf("# failed to list steps. Error: %s\n", err.Error())
+			os.Exit(1)
 		}
 		return
 	}
@@ -135,143 +335,217 @@ func main() {
 	if cfg.resetStep != "" {
 		if err := s.ResetStep(cfg.resetStep); err != nil {
 			fmt.Printf("# Reset step failed. Error: %s\n", err.Error())
-			os.Exit(3)
+			exit(3)
 		}
 		return
 	}
 
-	// destroy stages
-	if cfg.destroy {
-		// Note: destroy is only terraform destroy, local directories are not deleted.
-		// 5-appinfra
-		msg.PrintStageMsg("Destroying 5-appinfra stage")
-		err = s.RunDestroyStep("appinfra-hello-world", func() error {
-			io := stages.GetAppFactoryStepOutputs(t, filepath.Join(conf.CheckoutPath, globalTFVars.InfraCloudbuildV2RepositoryConfig.Repositories["applicationfactory"].RepositoryName))
-			return stages.DestroyAppInfraStage(t, s, globalTFVars, io, conf)
-		})
+	// record who runs the steps and which version of the code is used
+	s.SetRunInfo(runInfo(t, conf))
+
+	// fix validation findings
+	if cfg.fix {
+		fmt.Println("# Validating tfvars file and deploy requirements.")
+		report := stages.RunValidators(stages.Validators(t, globalTFVars, cfg.forcePush))
+		if err := report.WriteText(os.Stdout); err != nil {
+			fmt.Printf("# Failed to write validation report. Error: %s\n", err.Error())
+		}
+		if err := stages.ApplyFixes(ctx, t, s, report, cfg.disablePrompt); err != nil {
+			fmt.Printf("# Remediation failed. Error: %s\n", err.Error())
+			exit(3)
+		}
+		fmt.Println("")
+		fmt.Println("# Remediation finished. Validating tfvars file and deploy requirements again.")
+		report = stages.RunValidators(stages.Validators(t, globalTFVars, cfg.forcePush))
+		if err := report.WriteText(os.Stdout); err != nil {
+			fmt.Printf("# Failed to write validation report. Error: %s\n", err.Error())
+		}
+		if report.HasErrors() {
+			exit(1)
+		}
+		return
+	}
+
+	if cfg.dryRun {
+		conf.DryRunReport = stages.NewDryRunReport()
+	}
+	if cfg.drift {
+		conf.DriftReport = stages.NewDriftReport(cfg.driftBuilds)
+	}
+	if cfg.upgrade {
+		conf.UpgradeVersion, err = upgradeVersion(t, cfg, conf)
 		if err != nil {
-			fmt.Printf("# App Infra hello world step destroy failed. Error: %s\n", err.Error())
-			os.Exit(3)
+			fmt.Printf("# Failed to get the blueprint version. Error: %s\n", err.Error())
+			exit(3)
 		}
+	}
 
-		// 4-appfactory
-		msg.PrintStageMsg("Destroying 4-appfactory stage")
-		err = s.RunDestroyStep("gcp-appfactory", func() error {
-			bo := stages.GetBootstrapStepOutputs(t, conf.EABPath)
-			return stages.DestroyAppFactoryStage(t, s, globalTFVars, bo, conf)
-		})
+	// promote the changes with pull requests unless force push is used
+	if !cfg.dryRun && !cfg.destroy {
+		conf.Promotion, err = stages.NewPromotion(t, globalTFVars, cfg.forcePush, cfg.promotionWait)
 		if err != nil {
-			fmt.Printf("# AppFactory step destroy failed. Error: %s\n", err.Error())
-			os.Exit(3)
+			fmt.Printf("# Failed to configure the promotion of the changes. Error: %s\n", err.Error())
+			exit(3)
 		}
+		conf.AppSourcePromotion, err = stages.NewAppSourcePromotion(t, globalTFVars, cfg.forcePush, cfg.promotionWait)
+		if err != nil {
+			fmt.Printf("# Failed to configure the promotion of the application source. Error: %s\n", err.Error())
+			exit(3)
+		}
+	}
 
-		// 3-fleetscope
-		msg.PrintStageMsg("Destroying 3-fleetscope stage")
-		err = s.RunDestroyStep("gcp-fleetscope", func() error {
-			bo := stages.GetBootstrapStepOutputs(t, conf.EABPath)
-			return stages.DestroyFleetscopeStage(t, s, globalTFVars, bo, conf)
-		})
+	// targeted executions run again the completed steps of the selected targets
+	if conf.Targets.IsSet() && !cfg.dryRun && !cfg.drift && !cfg.upgrade {
+		s = s.WithRerun()
+	}
+	filter := conf.Targets.StageFilter(cfg.parallelism)
+
+	// register stages
+	r := steps.NewRegistry()
+	outputs := stages.NewStageOutputs(t, globalTFVars, conf)
+	err = stages.RegisterDefaultStages(t, r, s, globalTFVars, outputs, conf)
+	if err != nil {
+		fmt.Printf("# Failed to register stages. Error: %s\n", err.Error())
+		exit(3)
+	}
+
+	// plan stages
+	if cfg.dryRun {
+		err = s.PlanStages(r, conf.DryRunReport.Skip)
+		if err := conf.DryRunReport.Write(os.Stdout); err != nil {
+			fmt.Printf("# failed to write dry run summary. Error: %s\n", err.Error())
+		}
 		if err != nil {
-			fmt.Printf("# Fleetscope step destroy failed. Error: %s\n", err.Error())
-			os.Exit(3)
+			fmt.Printf("# Dry run failed. Error: %s\n", err.Error())
+			exit(3)
 		}
+		return
+	}
 
-		// 2-multitenant
-		msg.PrintStageMsg("Destroying 2-multitenant stage")
-		err = s.RunDestroyStep("gcp-multitenant", func() error {
-			bo := stages.GetBootstrapStepOutputs(t, conf.EABPath)
-			return stages.DestroyMultitenantStage(t, s, globalTFVars, bo, conf)
-		})
+	// check the drift of the deployed stages
+	if cfg.drift {
+		err = s.DriftStages(r, filter, conf.DriftReport.Skip)
+		if err := conf.DriftReport.Write(os.Stdout); err != nil {
+			fmt.Printf("# failed to write drift report. Error: %s\n", err.Error())
+		}
 		if err != nil {
-			fmt.Printf("# Multitenant step destroy failed. Error: %s\n", err.Error())
-			os.Exit(3)
+			fmt.Printf("# Drift detection failed. Error: %s\n", err.Error())
+			exit(3)
+		}
+		if conf.DriftReport.HasDrift() {
+			exit(4)
 		}
+		return
+	}
 
-		// 1-bootstrap
-		msg.PrintStageMsg("Destroying 1-bootstrap stage")
-		err = s.RunDestroyStep("gcp-bootstrap", func() error {
-			return stages.DestroyBootstrapStage(t, s, globalTFVars, conf)
+	// upgrade the deployed stages
+	if cfg.upgrade {
+		err = s.UpgradeStages(r, filter, func(stage, reason string) {
+			fmt.Printf("# skipping stage '%s' upgrade: %s\n", stage, reason)
 		})
 		if err != nil {
-			fmt.Printf("# Bootstrap step destroy failed. Error: %s\n", err.Error())
-			os.Exit(3)
+			fmt.Printf("# Upgrade failed. Error: %s\n", err.Error())
+			exit(3)
+		}
+		printRetryCounts(conf.Wait.Retries)
+		fmt.Printf("# Upgrade to version %s finished, the stage repositories are tagged %s.\n", conf.UpgradeVersion, stages.UpgradeTag(conf.UpgradeVersion))
+		return
+	}
+
+	// destroy stages
+	if cfg.destroy {
+		// Note: destroy is only terraform destroy, local directories are not deleted.
+		err = s.DestroyStages(r, filter)
+		if err != nil {
+			fmt.Printf("# Destroy failed. Error: %s\n", err.Error())
+			exit(3)
+		}
+		printRetryCounts(conf.Wait.Retries)
+		if conf.Targets.IsSet() {
+			return
 		}
 
 		// clean up the steps file
-		err = steps.DeleteStepsFile(cfg.stepsFile)
+		err = s.Delete()
 		if err != nil {
 			fmt.Printf("# failed to delete state file %s. Error: %s\n", cfg.stepsFile, err.Error())
-			os.Exit(3)
+			exit(3)
 		}
 		return
 	}
 
 	// deploy stages
-
-	// 1-bootstrap
-	msg.PrintStageMsg("Deploying 1-bootstrap stage")
-	err = s.RunStep("gcp-bootstrap", func() error {
-		return stages.DeployBootstrapStage(t, s, globalTFVars, conf)
-	})
+	err = s.DeployStages(r, filter)
 	if err != nil {
-		fmt.Printf("# Bootstrap step failed. Error: %s\n", err.Error())
-		os.Exit(3)
+		fmt.Printf("# Deploy failed. Error: %s\n", err.Error())
+		exit(3)
 	}
+	printRetryCounts(conf.Wait.Retries)
+}
 
-	bo := stages.GetBootstrapStepOutputs(t, conf.EABPath)
-
-	// 2-Multitenant
-	msg.PrintStageMsg("Deploying 2-Multitenant stage")
-	err = s.RunStep("gcp-multitenant", func() error {
-		return stages.DeployMultitenantStage(t, s, globalTFVars, bo, conf)
-	})
-	if err != nil {
-		fmt.Printf("# Multitenant step failed. Error: %s\n", err.Error())
-		os.Exit(3)
+// waitOptions returns how builds and rollouts are waited.
+func waitOptions(ctx context.Context, c cfg) gcp.WaitOptions {
+	wait := gcp.WaitOptions{
+		Backoff:                gcp.DefaultBackoff,
+		CancelBuildOnInterrupt: c.cancelBuild,
+		Logs: gcp.BuildLogOptions{
+			Stream: c.streamLogs,
+			Dir:    buildLogsDir(c.stepsFile),
+		},
+		Rollouts: gcp.RolloutOptions{
+			AutoApprove:     c.autoApprove,
+			ApprovalTimeout: c.approvalWait,
+			DisableRollback: c.noRollback,
+		},
 	}
-
-	// 3-fleetscope
-	msg.PrintStageMsg("Deploying 3-fleetscope stage")
-	err = s.RunStep("gcp-fleetscope", func() error {
-		return stages.DeployFleetscopeStage(t, s, globalTFVars, bo, conf)
-	})
-	if err != nil {
-		fmt.Printf("# Fleetscope step failed. Error: %s\n", err.Error())
-		os.Exit(3)
+	if c.buildSub == "" {
+		return wait
 	}
-
-	err = s.RunStep("gcp-appfactory", func() error {
-		// 4-appfactory
-		msg.PrintStageMsg("Deploying 4-appfactory stage")
-		msg.ConfirmQuota(bo.CBServiceAccountsEmails["applicationfactory"], conf.DisablePrompt)
-		return stages.DeployAppFactoryStage(t, s, globalTFVars, bo, conf)
-	})
+	events, err := gcp.NewPubSubBuildEvents(ctx, c.buildSub)
 	if err != nil {
-		fmt.Printf("# Projects step failed. Error: %s\n", err.Error())
-		os.Exit(3)
+		fmt.Printf("# Build notifications not available, polling build status. Error: %s\n", err.Error())
+		return wait
 	}
+	wait.BuildEvents = events
+	return wait
+}
 
-	// 5-appinfra
-	msg.PrintStageMsg("Deploying 5-appinfra stage")
-	io := stages.GetAppFactoryStepOutputs(t, filepath.Join(conf.CheckoutPath, globalTFVars.InfraCloudbuildV2RepositoryConfig.Repositories["applicationfactory"].RepositoryName))
+// buildLogsDir returns the directory where the logs of failed builds are saved, the directory of the steps file.
+// The current directory is used when the steps file is in Cloud Storage.
+func buildLogsDir(stepsFile string) string {
+	if strings.HasPrefix(stepsFile, "gs://") {
+		return "."
+	}
+	return filepath.Dir(stepsFile)
+}
 
-	err = s.RunStep("appinfra-hello-world", func() error {
-		return stages.DeployAppInfraStage(t, s, globalTFVars, bo, io, conf)
-	})
-	if err != nil {
-		fmt.Printf("# Example app infra step failed. Error: %s\n", err.Error())
-		os.Exit(3)
+// printRetryCounts prints the retryable errors found in the failed builds of the run.
+func printRetryCounts(retries *gcp.RetryCatalog) {
+	counts := retries.Counts()
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Println("# Retryable errors found in failed builds:")
+	for _, c := range counts {
+		fmt.Printf("#   %d x %s (%s)\n", c.Count, c.Message, c.Pattern)
 	}
+}
 
-	// // 6-appsource
-	msg.PrintStageMsg("Deploying 6-appsource stage")
-	appInfraOutputs := stages.GetAppInfraStepOutputs(t, filepath.Join(conf.CheckoutPath, globalTFVars.InfraCloudbuildV2RepositoryConfig.Repositories["hello-world"].RepositoryName))
-	err = s.RunStep("gcp-appsource-hello-world", func() error {
-		return stages.DeployAppSourceStage(t, s, globalTFVars, appInfraOutputs, conf)
-	})
-	if err != nil {
-		fmt.Printf("# Appsource step failed. Error: %s\n", err.Error())
-		os.Exit(3)
+// splitList splits a comma-separated flag value, ignoring empty items.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
 
+// upgradeVersion returns the version of the blueprint code used by -upgrade.
+func upgradeVersion(t testing.TB, c cfg, conf stages.CommonConf) (string, error) {
+	if c.upgradeVer != "" {
+		return c.upgradeVer, nil
+	}
+	return utils.GetRepoOnly(t, conf.EABPath, conf.Logger).Describe()
 }
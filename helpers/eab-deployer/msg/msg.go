@@ -16,9 +16,11 @@ package msg
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 )
 
 const (
@@ -36,17 +38,11 @@ var (
 )
 
 func PressEnter(msg string) {
-	reader := bufio.NewReader(os.Stdin)
 	t := "# Press Enter to continue"
 	if msg != "" {
 		t = msg
 	}
-	fmt.Print(t)
-	_, err := reader.ReadString('\n')
-	if err != nil {
-		fmt.Printf("# Failed to read string. Error: %s\n", err.Error())
-		os.Exit(3)
-	}
+	_, _ = readLine(context.Background(), t)
 }
 
 func pad(msg string, size int) string {
@@ -109,14 +105,106 @@ func PrintAdminGroupPermissionMsg(sa string, disablePrompt bool) {
 	}
 }
 
-func ConfirmQuota(sa string, disablePrompt bool) {
+// line is a line read from the standard input.
+type line struct {
+	text string
+	err  error
+}
+
+var (
+	stdinOnce  sync.Once
+	stdinLines = make(chan line)
+)
+
+// readStdin reads the lines of the standard input with a single reader, the lines buffered by the reader
+// are not lost between prompts. A line is read when a prompt waits for it.
+func readStdin() {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		text, err := reader.ReadString('\n')
+		stdinLines <- line{text: text, err: err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readLine reads a line from the standard input.
+// It returns the error of the context if the context is done first, like when the deploy is interrupted with Ctrl-C.
+func readLine(ctx context.Context, msg string) (string, error) {
+	fmt.Print(msg)
+	if err := ctx.Err(); err != nil {
+		fmt.Println("")
+		return "", fmt.Errorf("prompt interrupted: %w", err)
+	}
+	stdinOnce.Do(func() { go readStdin() })
+	select {
+	case <-ctx.Done():
+		fmt.Println("")
+		return "", fmt.Errorf("prompt interrupted: %w", ctx.Err())
+	case r := <-stdinLines:
+		if r.err != nil {
+			fmt.Printf("# Failed to read string. Error: %s\n", r.err.Error())
+			os.Exit(3)
+		}
+		return r.text, nil
+	}
+}
+
+// pressEnter waits for the Enter key like PressEnter, or until the context is done.
+func pressEnter(ctx context.Context, msg string) error {
+	if msg == "" {
+		msg = "# Press Enter to continue"
+	}
+	if _, err := readLine(ctx, msg); err != nil {
+		return err
+	}
+	fmt.Println("")
+	return nil
+}
+
+func ConfirmQuota(ctx context.Context, sa string, disablePrompt bool) error {
 	fmt.Println("")
 	fmt.Println("# Proceed if you received confirmation of billing quota increase for the service account of stage 4-appfactory")
 	fmt.Printf("# %s \n", sa)
 	fmt.Printf("# Quota increase link is: %s\n", quotaURL)
 	fmt.Println("")
-	if !disablePrompt {
-		PressEnter("")
-		fmt.Println("")
+	if disablePrompt {
+		return nil
+	}
+	return pressEnter(ctx, "")
+}
+
+func ConfirmFix(ctx context.Context, description, command string, disablePrompt bool) error {
+	fmt.Println("")
+	fmt.Printf("# Remediation: %s\n", description)
+	fmt.Printf("# %s\n", command)
+	if disablePrompt {
+		return nil
+	}
+	return pressEnter(ctx, "# Press Enter to apply the remediation or Ctrl-C to cancel")
+}
+
+func ConfirmUpgrade(ctx context.Context, repo, version string, files []string, disablePrompt bool) error {
+	fmt.Println("")
+	fmt.Printf("# Changes to upgrade repository %s to version %s:\n", repo, version)
+	for _, f := range files {
+		fmt.Printf("#   %s\n", f)
+	}
+	if disablePrompt {
+		return nil
+	}
+	return pressEnter(ctx, "# Press Enter to commit and apply the changes or Ctrl-C to cancel")
+}
+
+// ConfirmOverwrite asks before overwriting a file with local changes.
+// The file is not overwritten if the context is done before the answer.
+func ConfirmOverwrite(ctx context.Context, path string) bool {
+	fmt.Println("")
+	fmt.Printf("# %s has local changes that will be lost if it is updated with the blueprint version.\n", path)
+	answer, err := readLine(ctx, "# Overwrite it? [y/N] ")
+	if err != nil {
+		return false
 	}
+	return strings.EqualFold(strings.TrimSpace(answer), "y")
 }
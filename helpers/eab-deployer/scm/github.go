@@ -0,0 +1,261 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// gitHub is the provider of GitHub and GitHub Enterprise.
+type gitHub struct {
+	api apiClient
+}
+
+// NewGitHub creates a GitHub provider for the REST API in baseURL,
+// https://api.github.com for GitHub or https://HOST/api/v3 for GitHub Enterprise.
+func NewGitHub(baseURL, token string, client *http.Client) Provider {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	return gitHub{api: newAPIClient(baseURL, header, client)}
+}
+
+func (g gitHub) GetRepository(ctx context.Context, path string) (Repository, error) {
+	var repo struct {
+		FullName      string `json:"full_name"`
+		Private       bool   `json:"private"`
+		DefaultBranch string `json:"default_branch"`
+		Permissions   struct {
+			Push bool `json:"push"`
+		} `json:"permissions"`
+	}
+	err := g.api.do(ctx, http.MethodGet, "/repos/"+path, nil, &repo)
+	if err != nil {
+		return Repository{}, err
+	}
+	return Repository{
+		Path:          repo.FullName,
+		Private:       repo.Private,
+		DefaultBranch: repo.DefaultBranch,
+		CanPush:       repo.Permissions.Push,
+	}, nil
+}
+
+func (g gitHub) IsBranchProtected(ctx context.Context, path, branch string) (bool, error) {
+	var b struct {
+		Protected bool `json:"protected"`
+	}
+	err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/branches/%s", path, url.PathEscape(branch)), nil, &b)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return b.Protected, err
+}
+
+// CreateRepository creates the repository in the account of the token owner, or in the organization of the path.
+func (g gitHub) CreateRepository(ctx context.Context, path string) error {
+	owner, name, ok := strings.Cut(path, "/")
+	if !ok {
+		return fmt.Errorf("invalid GitHub repository '%s', the format is OWNER/NAME", path)
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	err := g.api.do(ctx, http.MethodGet, "/user", nil, &user)
+	if err != nil {
+		return err
+	}
+	endpoint := "/orgs/" + owner + "/repos"
+	if strings.EqualFold(user.Login, owner) {
+		endpoint = "/user/repos"
+	}
+	body := map[string]any{
+		"name":    name,
+		"private": true,
+	}
+	return g.api.do(ctx, http.MethodPost, endpoint, body, nil)
+}
+
+// gitHubPull is a pull request of the GitHub API.
+type gitHubPull struct {
+	Number         int    `json:"number"`
+	HTMLURL        string `json:"html_url"`
+	State          string `json:"state"`
+	Merged         bool   `json:"merged"`
+	MergeCommitSHA string `json:"merge_commit_sha"`
+	Head           struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+func (p gitHubPull) pullRequest() PullRequest {
+	pr := PullRequest{
+		Number:  p.Number,
+		URL:     p.HTMLURL,
+		State:   PullRequestOpen,
+		HeadSHA: p.Head.SHA,
+	}
+	switch {
+	case p.Merged:
+		pr.State = PullRequestMerged
+		pr.MergeCommitSHA = p.MergeCommitSHA
+	case p.State == "closed":
+		pr.State = PullRequestClosed
+	}
+	return pr
+}
+
+func (g gitHub) FindPullRequest(ctx context.Context, path, head, base string) (PullRequest, error) {
+	owner, _, _ := strings.Cut(path, "/")
+	query := url.Values{}
+	query.Set("state", "open")
+	query.Set("head", owner+":"+head)
+	query.Set("base", base)
+	var pulls []gitHubPull
+	err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls?%s", path, query.Encode()), nil, &pulls)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	if len(pulls) == 0 {
+		return PullRequest{}, fmt.Errorf("pull request from %s to %s: %w", head, base, ErrNotFound)
+	}
+	return pulls[0].pullRequest(), nil
+}
+
+func (g gitHub) CreatePullRequest(ctx context.Context, path, head, base, title, body string) (PullRequest, error) {
+	req := map[string]any{
+		"title": title,
+		"head":  head,
+		"base":  base,
+		"body":  body,
+	}
+	var pull gitHubPull
+	err := g.api.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/pulls", path), req, &pull)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	return pull.pullRequest(), nil
+}
+
+// GetPullRequest returns the pull request, approved if a reviewer approved it and no reviewer requested changes in their latest review.
+// The checks are the commit statuses and the check runs of the head commit.
+func (g gitHub) GetPullRequest(ctx context.Context, path string, number int) (PullRequest, error) {
+	var pull gitHubPull
+	err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls/%d", path, number), nil, &pull)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	pr := pull.pullRequest()
+
+	var reviews []struct {
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		State string `json:"state"`
+	}
+	err = g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls/%d/reviews?per_page=100", path, number), nil, &reviews)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	latest := map[string]string{}
+	for _, r := range reviews {
+		if r.State == "APPROVED" || r.State == "CHANGES_REQUESTED" || r.State == "DISMISSED" {
+			latest[r.User.Login] = r.State
+		}
+	}
+	for _, state := range latest {
+		if state == "CHANGES_REQUESTED" {
+			pr.Approved = false
+			break
+		}
+		if state == "APPROVED" {
+			pr.Approved = true
+		}
+	}
+
+	var status struct {
+		Statuses []struct {
+			State string `json:"state"`
+		} `json:"statuses"`
+	}
+	err = g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/commits/%s/status", path, pr.HeadSHA), nil, &status)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	var runs struct {
+		CheckRuns []struct {
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_runs"`
+	}
+	err = g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/commits/%s/check-runs", path, pr.HeadSHA), nil, &runs)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	states := []string{}
+	for _, s := range status.Statuses {
+		switch s.State {
+		case "success":
+			states = append(states, ChecksSuccess)
+		case "pending":
+			states = append(states, ChecksPending)
+		default:
+			states = append(states, ChecksFailure)
+		}
+	}
+	for _, r := range runs.CheckRuns {
+		switch {
+		case r.Status != "completed":
+			states = append(states, ChecksPending)
+		case r.Conclusion == "success" || r.Conclusion == "neutral" || r.Conclusion == "skipped":
+			states = append(states, ChecksSuccess)
+		default:
+			states = append(states, ChecksFailure)
+		}
+	}
+	pr.Checks = combineChecks(states)
+	return pr, nil
+}
+
+func (g gitHub) MergePullRequest(ctx context.Context, path string, number int) (string, error) {
+	var merge struct {
+		SHA string `json:"sha"`
+	}
+	req := map[string]any{
+		"merge_method": "merge",
+	}
+	err := g.api.do(ctx, http.MethodPut, fmt.Sprintf("/repos/%s/pulls/%d/merge", path, number), req, &merge)
+	return merge.SHA, err
+}
+
+// DeleteBranch deletes the ref of the branch. The git refs API expects the slashes of the ref unescaped,
+// like heads/eab-deployer/plan-1a2b3c4, so only the segments of the branch are escaped.
+func (g gitHub) DeleteBranch(ctx context.Context, path, branch string) error {
+	return g.api.do(ctx, http.MethodDelete, fmt.Sprintf("/repos/%s/git/refs/heads/%s", path, escapeSegments(branch)), nil, nil)
+}
+
+// escapeSegments escapes each segment of a slash separated name, keeping the slashes.
+func escapeSegments(name string) string {
+	segments := strings.Split(name, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
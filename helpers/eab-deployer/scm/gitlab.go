@@ -0,0 +1,247 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// gitLabDeveloperAccess is the minimum access level of a GitLab member to push to a repository.
+const gitLabDeveloperAccess = 30
+
+// gitLab is the provider of GitLab and self-managed GitLab.
+type gitLab struct {
+	api apiClient
+}
+
+// NewGitLab creates a GitLab provider for the REST API in baseURL,
+// https://gitlab.com/api/v4 for GitLab or https://HOST/api/v4 for self-managed GitLab.
+func NewGitLab(baseURL, token string, client *http.Client) Provider {
+	header := http.Header{}
+	header.Set("PRIVATE-TOKEN", token)
+	return gitLab{api: newAPIClient(baseURL, header, client)}
+}
+
+func (g gitLab) GetRepository(ctx context.Context, path string) (Repository, error) {
+	var project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		Visibility        string `json:"visibility"`
+		DefaultBranch     string `json:"default_branch"`
+		Permissions       struct {
+			ProjectAccess *struct {
+				AccessLevel int `json:"access_level"`
+			} `json:"project_access"`
+			GroupAccess *struct {
+				AccessLevel int `json:"access_level"`
+			} `json:"group_access"`
+		} `json:"permissions"`
+	}
+	err := g.api.do(ctx, http.MethodGet, "/projects/"+url.PathEscape(path), nil, &project)
+	if err != nil {
+		return Repository{}, err
+	}
+	access := 0
+	if p := project.Permissions.ProjectAccess; p != nil {
+		access = max(access, p.AccessLevel)
+	}
+	if p := project.Permissions.GroupAccess; p != nil {
+		access = max(access, p.AccessLevel)
+	}
+	return Repository{
+		Path:          project.PathWithNamespace,
+		Private:       project.Visibility != "public",
+		DefaultBranch: project.DefaultBranch,
+		CanPush:       access >= gitLabDeveloperAccess,
+	}, nil
+}
+
+func (g gitLab) IsBranchProtected(ctx context.Context, path, branch string) (bool, error) {
+	err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%s/protected_branches/%s", url.PathEscape(path), url.PathEscape(branch)), nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CreateRepository creates the project in the group or user namespace of the path.
+func (g gitLab) CreateRepository(ctx context.Context, path string) error {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return fmt.Errorf("invalid GitLab repository '%s', the format is GROUP/NAME", path)
+	}
+	var namespace struct {
+		ID int `json:"id"`
+	}
+	err := g.api.do(ctx, http.MethodGet, "/namespaces/"+url.PathEscape(path[:i]), nil, &namespace)
+	if err != nil {
+		return err
+	}
+	body := map[string]any{
+		"name":         path[i+1:],
+		"path":         path[i+1:],
+		"namespace_id": namespace.ID,
+		"visibility":   "private",
+	}
+	return g.api.do(ctx, http.MethodPost, "/projects", body, nil)
+}
+
+// gitLabMergeRequest is a merge request of the GitLab API.
+type gitLabMergeRequest struct {
+	IID             int    `json:"iid"`
+	WebURL          string `json:"web_url"`
+	State           string `json:"state"`
+	SHA             string `json:"sha"`
+	MergeCommitSHA  string `json:"merge_commit_sha"`
+	SquashCommitSHA string `json:"squash_commit_sha"`
+	TargetBranch    string `json:"target_branch"`
+}
+
+func (m gitLabMergeRequest) pullRequest() PullRequest {
+	pr := PullRequest{
+		Number:  m.IID,
+		URL:     m.WebURL,
+		State:   PullRequestOpen,
+		HeadSHA: m.SHA,
+	}
+	switch m.State {
+	case "merged":
+		pr.State = PullRequestMerged
+		pr.MergeCommitSHA = m.MergeCommitSHA
+		if pr.MergeCommitSHA == "" {
+			pr.MergeCommitSHA = m.SquashCommitSHA
+		}
+	case "closed":
+		pr.State = PullRequestClosed
+	}
+	return pr
+}
+
+func (g gitLab) FindPullRequest(ctx context.Context, path, head, base string) (PullRequest, error) {
+	query := url.Values{}
+	query.Set("state", "opened")
+	query.Set("source_branch", head)
+	query.Set("target_branch", base)
+	var mrs []gitLabMergeRequest
+	err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%s/merge_requests?%s", url.PathEscape(path), query.Encode()), nil, &mrs)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	if len(mrs) == 0 {
+		return PullRequest{}, fmt.Errorf("merge request from %s to %s: %w", head, base, ErrNotFound)
+	}
+	return mrs[0].pullRequest(), nil
+}
+
+func (g gitLab) CreatePullRequest(ctx context.Context, path, head, base, title, body string) (PullRequest, error) {
+	req := map[string]any{
+		"source_branch": head,
+		"target_branch": base,
+		"title":         title,
+		"description":   body,
+	}
+	var mr gitLabMergeRequest
+	err := g.api.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%s/merge_requests", url.PathEscape(path)), req, &mr)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	return mr.pullRequest(), nil
+}
+
+// GetPullRequest returns the merge request, approved if its approval rules are satisfied.
+// The checks are the commit statuses of the head commit.
+func (g gitLab) GetPullRequest(ctx context.Context, path string, number int) (PullRequest, error) {
+	var mr gitLabMergeRequest
+	err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%s/merge_requests/%d", url.PathEscape(path), number), nil, &mr)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	pr := mr.pullRequest()
+	if pr.State == PullRequestMerged && pr.MergeCommitSHA == "" {
+		pr.MergeCommitSHA, err = g.targetHead(ctx, path, mr.TargetBranch)
+		if err != nil {
+			return PullRequest{}, err
+		}
+	}
+
+	var approvals struct {
+		Approved bool `json:"approved"`
+	}
+	err = g.api.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%s/merge_requests/%d/approvals", url.PathEscape(path), number), nil, &approvals)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	pr.Approved = approvals.Approved
+
+	var statuses []struct {
+		Status string `json:"status"`
+	}
+	err = g.api.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%s/repository/commits/%s/statuses", url.PathEscape(path), pr.HeadSHA), nil, &statuses)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	states := []string{}
+	for _, s := range statuses {
+		switch s.Status {
+		case "success", "skipped":
+			states = append(states, ChecksSuccess)
+		case "failed", "canceled":
+			states = append(states, ChecksFailure)
+		default:
+			states = append(states, ChecksPending)
+		}
+	}
+	pr.Checks = combineChecks(states)
+	return pr, nil
+}
+
+// MergePullRequest merges the merge request and returns the merge commit, or the squash commit.
+// Fast-forward merges have neither, the last commit of the target branch is returned.
+func (g gitLab) MergePullRequest(ctx context.Context, path string, number int) (string, error) {
+	var mr gitLabMergeRequest
+	err := g.api.do(ctx, http.MethodPut, fmt.Sprintf("/projects/%s/merge_requests/%d/merge", url.PathEscape(path), number), map[string]any{}, &mr)
+	if err != nil {
+		return "", err
+	}
+	if sha := mr.pullRequest().MergeCommitSHA; sha != "" {
+		return sha, nil
+	}
+	return g.targetHead(ctx, path, mr.TargetBranch)
+}
+
+// targetHead returns the last commit of the target branch of a merged merge request.
+func (g gitLab) targetHead(ctx context.Context, path, branch string) (string, error) {
+	var b struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%s/repository/branches/%s", url.PathEscape(path), url.PathEscape(branch)), nil, &b)
+	if err != nil {
+		return "", err
+	}
+	if b.Commit.ID == "" {
+		return "", fmt.Errorf("branch %s of repository %s has no commit", branch, path)
+	}
+	return b.Commit.ID, nil
+}
+
+func (g gitLab) DeleteBranch(ctx context.Context, path, branch string) error {
+	return g.api.do(ctx, http.MethodDelete, fmt.Sprintf("/projects/%s/repository/branches/%s", url.PathEscape(path), url.PathEscape(branch)), nil, nil)
+}
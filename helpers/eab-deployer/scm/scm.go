@@ -0,0 +1,222 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scm calls the APIs of the source code management systems hosting the stage repositories,
+// GitHub, GitHub Enterprise, GitLab and self-managed GitLab.
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	GitHubType = "GITHUBv2"
+	GitLabType = "GITLABv2"
+
+	gitHubHost   = "github.com"
+	gitHubAPIURL = "https://api.github.com"
+)
+
+// ErrNotFound is returned when a repository or a branch does not exist, or the token can not see it.
+var ErrNotFound = errors.New("not found")
+
+// Repository is the state of a repository.
+type Repository struct {
+	Path          string
+	Private       bool
+	DefaultBranch string
+	CanPush       bool
+}
+
+const (
+	ChecksPending = "PENDING"
+	ChecksSuccess = "SUCCESS"
+	ChecksFailure = "FAILURE"
+	// ChecksNone is the state of a commit without checks reported, like in a repository without CI
+	ChecksNone = "NONE"
+
+	PullRequestOpen   = "OPEN"
+	PullRequestMerged = "MERGED"
+	PullRequestClosed = "CLOSED"
+)
+
+// PullRequest is the state of a GitHub pull request or a GitLab merge request.
+// Checks combines the statuses reported for the head commit, like the Cloud Build plan build.
+type PullRequest struct {
+	Number         int
+	URL            string
+	State          string
+	HeadSHA        string
+	MergeCommitSHA string
+	Approved       bool
+	Checks         string
+}
+
+// Provider is the API of a source code management system.
+// Repositories are identified by their path, "<owner>/<name>" in GitHub or "<group>/<subgroup>/<name>" in GitLab.
+type Provider interface {
+	// GetRepository returns the repository, or ErrNotFound if it does not exist.
+	GetRepository(ctx context.Context, path string) (Repository, error)
+	// IsBranchProtected returns true if the branch exists and is protected.
+	IsBranchProtected(ctx context.Context, path, branch string) (bool, error)
+	// CreateRepository creates a private repository.
+	CreateRepository(ctx context.Context, path string) error
+	// FindPullRequest returns the open pull request from branch head to branch base, or ErrNotFound if there is none.
+	FindPullRequest(ctx context.Context, path, head, base string) (PullRequest, error)
+	// CreatePullRequest opens a pull request from branch head to branch base.
+	CreatePullRequest(ctx context.Context, path, head, base, title, body string) (PullRequest, error)
+	// GetPullRequest returns the pull request with its approval and the checks of its head commit.
+	GetPullRequest(ctx context.Context, path string, number int) (PullRequest, error)
+	// MergePullRequest merges the pull request with a merge commit and returns the SHA of the merge commit.
+	MergePullRequest(ctx context.Context, path string, number int) (string, error)
+	// DeleteBranch deletes a branch of the repository.
+	DeleteBranch(ctx context.Context, path, branch string) error
+}
+
+// NewProvider creates the provider of a repository type, GITHUBv2 or GITLABv2, for the host of the repository URL.
+// Repositories not hosted in github.com use the GitHub Enterprise API of their host.
+// The GitLab API is the API of gitlabHostURI, if set, or of the host of the repository URL.
+func NewProvider(repoType, repoURL, gitlabHostURI, token string, client *http.Client) (Provider, error) {
+	u, _, err := ParseRepositoryURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	switch repoType {
+	case GitHubType:
+		if u.Host == gitHubHost {
+			return NewGitHub(gitHubAPIURL, token, client), nil
+		}
+		return NewGitHub(fmt.Sprintf("%s://%s/api/v3", u.Scheme, u.Host), token, client), nil
+	case GitLabType:
+		base := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+		if gitlabHostURI != "" {
+			base = strings.TrimSuffix(gitlabHostURI, "/")
+		}
+		return NewGitLab(base+"/api/v4", token, client), nil
+	}
+	return nil, fmt.Errorf("repository type '%s' is not supported", repoType)
+}
+
+// ParseRepositoryURL returns the base URL of the host and the path of a repository from its HTTPS or SSH clone URL,
+// like https://github.com/owner/name.git or git@gitlab.com:group/subgroup/name.git.
+func ParseRepositoryURL(repoURL string) (*url.URL, string, error) {
+	raw := repoURL
+	if user, rest, ok := strings.Cut(repoURL, "@"); ok && !strings.Contains(user, "://") {
+		host, path, _ := strings.Cut(rest, ":")
+		raw = fmt.Sprintf("https://%s/%s", host, path)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid repository URL '%s': %w", repoURL, err)
+	}
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if u.Host == "" || !strings.Contains(path, "/") {
+		return nil, "", fmt.Errorf("invalid repository URL '%s', the format is https://HOST/OWNER/NAME", repoURL)
+	}
+	return &url.URL{Scheme: u.Scheme, Host: u.Host}, path, nil
+}
+
+// combineChecks combines the states of the checks of a commit.
+// The result is ChecksNone if there are no checks, ChecksFailure if any check failed, ChecksPending if any check is not finished,
+// and ChecksSuccess otherwise.
+func combineChecks(states []string) string {
+	if len(states) == 0 {
+		return ChecksNone
+	}
+	result := ChecksSuccess
+	for _, s := range states {
+		switch s {
+		case ChecksFailure:
+			return ChecksFailure
+		case ChecksPending:
+			result = ChecksPending
+		}
+	}
+	return result
+}
+
+// apiClient calls a REST API with JSON requests and responses.
+type apiClient struct {
+	baseURL string
+	header  http.Header
+	http    *http.Client
+}
+
+func newAPIClient(baseURL string, header http.Header, client *http.Client) apiClient {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return apiClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		header:  header,
+		http:    client,
+	}
+}
+
+// do sends a request with the body encoded as JSON, if not nil, and decodes the response in out, if not nil.
+// A response with status 404 returns ErrNotFound, and other statuses not in the 2xx range return an error with the response message.
+func (c apiClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s %s: %w", method, path, ErrNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("%s %s: status %d: %s", method, path, resp.StatusCode, e.Message)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
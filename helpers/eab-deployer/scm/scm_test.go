@@ -0,0 +1,284 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPI serves canned JSON responses by method and path, and records the request bodies.
+type fakeAPI struct {
+	responses map[string]string
+	requests  map[string]map[string]any
+	headers   http.Header
+}
+
+func newFakeAPI(t *testing.T, responses map[string]string) (*fakeAPI, *httptest.Server) {
+	f := &fakeAPI{responses: responses, requests: map[string]map[string]any{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.EscapedPath()
+		f.headers = r.Header.Clone()
+		// like GitHub, the git refs API does not find refs with escaped slashes
+		if strings.Contains(key, "/git/refs/") && strings.Contains(key, "%2F") {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+			return
+		}
+		if r.Body != nil {
+			body, _ := io.ReadAll(r.Body)
+			if len(body) > 0 {
+				req := map[string]any{}
+				_ = json.Unmarshal(body, &req)
+				f.requests[key] = req
+			}
+		}
+		resp, ok := f.responses[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(resp))
+	}))
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func TestParseRepositoryURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		host string
+		path string
+	}{
+		{name: "github https", url: "https://github.com/owner/eab-multitenant.git", host: "https://github.com", path: "owner/eab-multitenant"},
+		{name: "github ssh", url: "git@github.com:owner/eab-multitenant.git", host: "https://github.com", path: "owner/eab-multitenant"},
+		{name: "gitlab subgroups", url: "https://gitlab.example.com/group/subgroup/eab-fleetscope", host: "https://gitlab.example.com", path: "group/subgroup/eab-fleetscope"},
+		{name: "gitlab ssh subgroups", url: "git@gitlab.com:group/subgroup/eab-fleetscope.git", host: "https://gitlab.com", path: "group/subgroup/eab-fleetscope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, path, err := ParseRepositoryURL(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.host, host.String())
+			assert.Equal(t, tt.path, path)
+		})
+	}
+
+	_, _, err := ParseRepositoryURL("https://github.com/eab-multitenant")
+	assert.Error(t, err)
+}
+
+func TestNewProvider(t *testing.T) {
+	p, err := NewProvider(GitHubType, "https://github.com/owner/repo.git", "", "token", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.github.com", p.(gitHub).api.baseURL)
+
+	p, err = NewProvider(GitHubType, "https://github.example.com/owner/repo.git", "", "token", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.example.com/api/v3", p.(gitHub).api.baseURL)
+
+	p, err = NewProvider(GitLabType, "https://gitlab.com/group/repo.git", "", "token", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab.com/api/v4", p.(gitLab).api.baseURL)
+
+	p, err = NewProvider(GitLabType, "https://gitlab.example.com/group/repo.git", "https://gitlab.internal.example.com/", "token", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab.internal.example.com/api/v4", p.(gitLab).api.baseURL)
+
+	_, err = NewProvider("CSR", "https://github.com/owner/repo.git", "", "token", nil)
+	assert.Error(t, err)
+}
+
+func TestGitHub(t *testing.T) {
+	ctx := context.Background()
+	f, server := newFakeAPI(t, map[string]string{
+		"GET /repos/org/infra":                     `{"full_name": "org/infra", "private": true, "default_branch": "main", "permissions": {"push": true}}`,
+		"GET /repos/org/infra/branches/plan":       `{"name": "plan", "protected": false}`,
+		"GET /repos/org/infra/branches/production": `{"name": "production", "protected": true}`,
+		"GET /user":            `{"login": "me"}`,
+		"POST /orgs/org/repos": `{}`,
+		"POST /user/repos":     `{}`,
+	})
+	g := NewGitHub(server.URL, "secret", server.Client())
+
+	repo, err := g.GetRepository(ctx, "org/infra")
+	require.NoError(t, err)
+	assert.Equal(t, Repository{Path: "org/infra", Private: true, DefaultBranch: "main", CanPush: true}, repo)
+	assert.Equal(t, "Bearer secret", f.headers.Get("Authorization"))
+
+	_, err = g.GetRepository(ctx, "org/missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	protected, err := g.IsBranchProtected(ctx, "org/infra", "plan")
+	require.NoError(t, err)
+	assert.False(t, protected)
+	protected, err = g.IsBranchProtected(ctx, "org/infra", "production")
+	require.NoError(t, err)
+	assert.True(t, protected)
+	protected, err = g.IsBranchProtected(ctx, "org/infra", "development")
+	require.NoError(t, err)
+	assert.False(t, protected)
+
+	require.NoError(t, g.CreateRepository(ctx, "org/new"))
+	assert.Equal(t, map[string]any{"name": "new", "private": true}, f.requests["POST /orgs/org/repos"])
+	require.NoError(t, g.CreateRepository(ctx, "me/new"))
+	assert.Equal(t, map[string]any{"name": "new", "private": true}, f.requests["POST /user/repos"])
+}
+
+func TestGitLab(t *testing.T) {
+	ctx := context.Background()
+	f, server := newFakeAPI(t, map[string]string{
+		"GET /projects/group%2Fsub%2Finfra":                               `{"path_with_namespace": "group/sub/infra", "visibility": "private", "default_branch": "main", "permissions": {"project_access": null, "group_access": {"access_level": 40}}}`,
+		"GET /projects/group%2Fpublic":                                    `{"path_with_namespace": "group/public", "visibility": "public", "default_branch": "main", "permissions": {"project_access": {"access_level": 20}}}`,
+		"GET /projects/group%2Fsub%2Finfra/protected_branches/production": `{"name": "production"}`,
+		"GET /namespaces/group%2Fsub":                                     `{"id": 42}`,
+		"POST /projects":                                                  `{}`,
+	})
+	g := NewGitLab(server.URL, "secret", server.Client())
+
+	repo, err := g.GetRepository(ctx, "group/sub/infra")
+	require.NoError(t, err)
+	assert.Equal(t, Repository{Path: "group/sub/infra", Private: true, DefaultBranch: "main", CanPush: true}, repo)
+	assert.Equal(t, "secret", f.headers.Get("PRIVATE-TOKEN"))
+
+	repo, err = g.GetRepository(ctx, "group/public")
+	require.NoError(t, err)
+	assert.False(t, repo.Private)
+	assert.False(t, repo.CanPush)
+
+	_, err = g.GetRepository(ctx, "group/missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	protected, err := g.IsBranchProtected(ctx, "group/sub/infra", "production")
+	require.NoError(t, err)
+	assert.True(t, protected)
+	protected, err = g.IsBranchProtected(ctx, "group/sub/infra", "plan")
+	require.NoError(t, err)
+	assert.False(t, protected)
+
+	require.NoError(t, g.CreateRepository(ctx, "group/sub/new"))
+	assert.Equal(t, map[string]any{"name": "new", "path": "new", "namespace_id": float64(42), "visibility": "private"}, f.requests["POST /projects"])
+}
+
+func TestCombineChecks(t *testing.T) {
+	assert.Equal(t, ChecksNone, combineChecks(nil), "no checks reported")
+	assert.Equal(t, ChecksSuccess, combineChecks([]string{ChecksSuccess, ChecksSuccess}))
+	assert.Equal(t, ChecksPending, combineChecks([]string{ChecksSuccess, ChecksPending}))
+	assert.Equal(t, ChecksFailure, combineChecks([]string{ChecksPending, ChecksFailure}))
+}
+
+func TestGitHubPullRequest(t *testing.T) {
+	ctx := context.Background()
+	f, server := newFakeAPI(t, map[string]string{
+		"GET /repos/org/infra/pulls":                                   `[]`,
+		"POST /repos/org/infra/pulls":                                  `{"number": 7, "html_url": "https://github.com/org/infra/pull/7", "state": "open", "head": {"sha": "abc"}}`,
+		"GET /repos/org/infra/pulls/7":                                 `{"number": 7, "html_url": "https://github.com/org/infra/pull/7", "state": "open", "head": {"sha": "abc"}}`,
+		"GET /repos/org/infra/pulls/7/reviews":                         `[{"user": {"login": "a"}, "state": "CHANGES_REQUESTED"}, {"user": {"login": "a"}, "state": "APPROVED"}, {"user": {"login": "b"}, "state": "COMMENTED"}]`,
+		"GET /repos/org/infra/commits/abc/status":                      `{"state": "success", "statuses": [{"state": "success"}]}`,
+		"GET /repos/org/infra/commits/abc/check-runs":                  `{"check_runs": [{"status": "completed", "conclusion": "success"}, {"status": "in_progress"}]}`,
+		"PUT /repos/org/infra/pulls/7/merge":                           `{"sha": "merge-sha", "merged": true}`,
+		"DELETE /repos/org/infra/git/refs/heads/eab-deployer/plan-abc": ``,
+	})
+	g := NewGitHub(server.URL, "secret", server.Client())
+
+	_, err := g.FindPullRequest(ctx, "org/infra", "plan", "development")
+	assert.ErrorIs(t, err, ErrNotFound)
+	pr, err := g.CreatePullRequest(ctx, "org/infra", "plan", "development", "Apply", "body")
+	require.NoError(t, err)
+	assert.Equal(t, 7, pr.Number)
+	assert.Equal(t, map[string]any{"title": "Apply", "head": "plan", "base": "development", "body": "body"}, f.requests["POST /repos/org/infra/pulls"])
+
+	pr, err = g.GetPullRequest(ctx, "org/infra", 7)
+	require.NoError(t, err)
+	assert.Equal(t, PullRequestOpen, pr.State)
+	assert.True(t, pr.Approved, "the latest review of each reviewer is used")
+	assert.Equal(t, ChecksPending, pr.Checks)
+
+	sha, err := g.MergePullRequest(ctx, "org/infra", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "merge-sha", sha)
+	assert.Equal(t, map[string]any{"merge_method": "merge"}, f.requests["PUT /repos/org/infra/pulls/7/merge"])
+	assert.NoError(t, g.DeleteBranch(ctx, "org/infra", "eab-deployer/plan-abc"))
+	assert.Equal(t, "eab-deployer/plan%20a%3Fb", escapeSegments("eab-deployer/plan a?b"))
+}
+
+func TestGitLabMergeRequest(t *testing.T) {
+	ctx := context.Background()
+	f, server := newFakeAPI(t, map[string]string{
+		"GET /projects/group%2Finfra/merge_requests":                  `[{"iid": 3, "web_url": "https://gitlab.com/group/infra/-/merge_requests/3", "state": "opened", "sha": "abc"}]`,
+		"GET /projects/group%2Finfra/merge_requests/3":                `{"iid": 3, "web_url": "https://gitlab.com/group/infra/-/merge_requests/3", "state": "merged", "sha": "abc", "merge_commit_sha": "merge-sha"}`,
+		"GET /projects/group%2Finfra/merge_requests/3/approvals":      `{"approved": true}`,
+		"GET /projects/group%2Finfra/repository/commits/abc/statuses": `[{"status": "success"}, {"status": "failed"}]`,
+		"PUT /projects/group%2Finfra/merge_requests/3/merge":          `{"iid": 3, "state": "merged", "merge_commit_sha": "merge-sha"}`,
+		"POST /projects/group%2Finfra/merge_requests":                 `{"iid": 4, "state": "opened", "sha": "def"}`,
+	})
+	g := NewGitLab(server.URL, "secret", server.Client())
+
+	pr, err := g.FindPullRequest(ctx, "group/infra", "plan", "development")
+	require.NoError(t, err)
+	assert.Equal(t, 3, pr.Number)
+
+	pr, err = g.CreatePullRequest(ctx, "group/infra", "plan", "production", "Apply", "body")
+	require.NoError(t, err)
+	assert.Equal(t, 4, pr.Number)
+	assert.Equal(t, map[string]any{"source_branch": "plan", "target_branch": "production", "title": "Apply", "description": "body"}, f.requests["POST /projects/group%2Finfra/merge_requests"])
+
+	pr, err = g.GetPullRequest(ctx, "group/infra", 3)
+	require.NoError(t, err)
+	assert.Equal(t, PullRequestMerged, pr.State)
+	assert.Equal(t, "merge-sha", pr.MergeCommitSHA)
+	assert.True(t, pr.Approved)
+	assert.Equal(t, ChecksFailure, pr.Checks)
+
+	sha, err := g.MergePullRequest(ctx, "group/infra", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "merge-sha", sha)
+}
+
+func TestGitLabMergeRequestCommit(t *testing.T) {
+	ctx := context.Background()
+	_, server := newFakeAPI(t, map[string]string{
+		"PUT /projects/group%2Finfra/merge_requests/3/merge":          `{"iid": 3, "state": "merged", "merge_commit_sha": null, "squash_commit_sha": "squash-sha", "target_branch": "plan"}`,
+		"PUT /projects/group%2Finfra/merge_requests/4/merge":          `{"iid": 4, "state": "merged", "merge_commit_sha": null, "squash_commit_sha": null, "target_branch": "plan"}`,
+		"GET /projects/group%2Finfra/merge_requests/4":                `{"iid": 4, "state": "merged", "sha": "abc", "merge_commit_sha": null, "target_branch": "plan"}`,
+		"GET /projects/group%2Finfra/merge_requests/4/approvals":      `{"approved": true}`,
+		"GET /projects/group%2Finfra/repository/commits/abc/statuses": `[]`,
+		"GET /projects/group%2Finfra/repository/branches/plan":        `{"name": "plan", "commit": {"id": "head-sha"}}`,
+	})
+	g := NewGitLab(server.URL, "secret", server.Client())
+
+	sha, err := g.MergePullRequest(ctx, "group/infra", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "squash-sha", sha, "squashed merge requests should return the squash commit")
+
+	sha, err = g.MergePullRequest(ctx, "group/infra", 4)
+	require.NoError(t, err)
+	assert.Equal(t, "head-sha", sha, "fast-forward merges should return the last commit of the target branch")
+
+	pr, err := g.GetPullRequest(ctx, "group/infra", 4)
+	require.NoError(t, err)
+	assert.Equal(t, "head-sha", pr.MergeCommitSHA)
+	assert.Equal(t, ChecksNone, pr.Checks, "commits without statuses have no checks")
+}
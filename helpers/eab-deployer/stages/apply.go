@@ -15,6 +15,7 @@
 package stages
 
 import (
+	"context"
 	"fmt"
 	"maps"
 	"os"
@@ -26,57 +27,18 @@ import (
 	"github.com/mitchellh/go-testing-interface"
 
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/gcp"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/msg"
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
 )
 
 func DeployBootstrapStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, c CommonConf) error {
-	var kmsProject *string
-	if tfvars.AttestationKMSKey != nil {
-		kmsInfo, err := extractInfoWithRegex(*tfvars.AttestationKMSKey, `projects/(?P<project>[^/]+)/locations/(?P<location>[^/]+)/keyRings/(?P<keyRing>[^/]+)/cryptoKeys/(?P<cryptoKey>[^/]+)`)
-		if err != nil {
-			fmt.Printf("# error extracting info for attestation KMS key. %v \n", err)
-			return err
-		}
-
-		if len(kmsInfo) > 0 {
-			auxProject := kmsInfo["project"]
-			kmsProject = &auxProject
-		}
-	}
-	bootstrapTfvars := BootstrapTfvars{
-		ProjectID:                    tfvars.ProjectID,
-		BucketPrefix:                 tfvars.BucketPrefix,
-		BucketForceDestroy:           tfvars.BucketForceDestroy,
-		Location:                     tfvars.Location,
-		TriggerLocation:              tfvars.TriggerLocation,
-		TFApplyBranches:              slices.Collect(maps.Keys(tfvars.Envs)),
-		Envs:                         tfvars.Envs,
-		CommonFolderID:               tfvars.CommonFolderID,
-		CloudbuildV2RepositoryConfig: tfvars.InfraCloudbuildV2RepositoryConfig,
-		WorkerPoolID:                 tfvars.WorkerPoolID,
-		AccessLevelName:              tfvars.AccessLevelName,
-		ServicePerimeterName:         tfvars.ServicePerimeterName,
-		ServicePerimeterMode:         tfvars.ServicePerimeterMode,
-		LoggingBucket:                tfvars.LoggingBucket,
-		BucketKMSKey:                 tfvars.BucketKMSKey,
-		AttestationKMSProject:        kmsProject,
-		OrgID:                        tfvars.OrgID,
-	}
-
-	err := utils.WriteTfvars(filepath.Join(c.EABPath, BootstrapStep, "terraform.tfvars"), bootstrapTfvars)
+	err := writeBootstrapTfvars(tfvars, c)
 	if err != nil {
 		return err
 	}
 
-	terraformDir := filepath.Join(c.EABPath, BootstrapStep)
-	options := &terraform.Options{
-		TerraformDir:       terraformDir,
-		Logger:             c.Logger,
-		NoColor:            true,
-		MaxRetries:         MaxErrorRetries,
-		TimeBetweenRetries: TimeBetweenErrorRetries,
-	}
+	options := bootstrapOptions(c)
 	// terraform deploy
 	err = applyLocal(t, options, "", c.PolicyPath, c.ValidatorProject)
 	if err != nil {
@@ -130,33 +92,84 @@ func DeployBootstrapStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, c Co
 	return nil
 }
 
-func DeployMultitenantStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) error {
+// bootstrapInputs returns the inputs of the 1-bootstrap stage that are not global inputs.
+func bootstrapInputs(tfvars GlobalTFVars) (StageInputs, error) {
+	var kmsProject *string
+	if tfvars.AttestationKMSKey != nil {
+		kmsInfo, err := extractInfoWithRegex(*tfvars.AttestationKMSKey, kmsKeyPattern)
+		if err != nil {
+			fmt.Printf("# error extracting info for attestation KMS key. %v \n", err)
+			return nil, err
+		}
 
-	workerPoolInfo, err := extractInfoWithRegex(tfvars.WorkerPoolID, `projects/(?P<project>[^/]+)/locations/(?P<location>[^/]+)/workerPools/(?P<workerPool>[^/]+)`)
+		if len(kmsInfo) > 0 {
+			auxProject := kmsInfo["project"]
+			kmsProject = &auxProject
+		}
+	}
+	return StageInputs{
+		"tf_apply_branches":       slices.Collect(maps.Keys(tfvars.Envs)),
+		"attestation_kms_project": kmsProject,
+	}, nil
+}
+
+// writeBootstrapTfvars writes the 1-bootstrap tfvars file.
+func writeBootstrapTfvars(tfvars GlobalTFVars, c CommonConf) error {
+	inputs, err := bootstrapInputs(tfvars)
 	if err != nil {
-		fmt.Printf("# error extracting info for private workerpool. %v \n", err)
 		return err
 	}
-	multitenantTfvars := MultiTenantTfvars{
-		Envs:                         tfvars.Envs,
-		Apps:                         tfvars.Apps,
-		ServicePerimeterName:         tfvars.ServicePerimeterName,
-		ServicePerimeterMode:         *tfvars.ServicePerimeterMode,
-		CBPrivateWorkerpoolProjectID: workerPoolInfo["project"],
-		AccessLevelName:              tfvars.AccessLevelName,
-		DeletionProtection:           tfvars.DeletionProtection,
+	return writeStageTfvars(filepath.Join(c.EABPath, BootstrapStep), BootstrapStep, tfvars, inputs)
+}
+
+// bootstrapOptions creates the terraform options for the 1-bootstrap stage, applied locally.
+func bootstrapOptions(c CommonConf) *terraform.Options {
+	return &terraform.Options{
+		TerraformDir:       filepath.Join(c.EABPath, BootstrapStep),
+		Logger:             c.Logger,
+		NoColor:            true,
+		MaxRetries:         MaxErrorRetries,
+		TimeBetweenRetries: TimeBetweenErrorRetries,
 	}
-	err = utils.WriteTfvars(filepath.Join(c.EABPath, MultitenantStep, "terraform.tfvars"), multitenantTfvars)
+}
+
+func DeployMultitenantStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) error {
+	stageConf, err := multitenantStageConf(t, tfvars, outputs, c)
 	if err != nil {
 		return err
 	}
+	return deployStage(t, stageConf, s, c)
+}
+
+// multitenantInputs returns the inputs of the 2-multitenant stage that are not global inputs.
+func multitenantInputs(tfvars GlobalTFVars) (StageInputs, error) {
+	workerPoolInfo, err := extractInfoWithRegex(tfvars.WorkerPoolID, workerPoolIDPattern)
+	if err != nil {
+		fmt.Printf("# error extracting info for private workerpool. %v \n", err)
+		return nil, err
+	}
+	return StageInputs{
+		"cb_private_workerpool_project_id": workerPoolInfo["project"],
+	}, nil
+}
+
+// multitenantStageConf writes the 2-multitenant tfvars file and clones the stage repository.
+func multitenantStageConf(t testing.TB, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) (StageConf, error) {
+	inputs, err := multitenantInputs(tfvars)
+	if err != nil {
+		return StageConf{}, err
+	}
+	err = writeStageTfvars(filepath.Join(c.EABPath, MultitenantStep), MultitenantStep, tfvars, inputs)
+	if err != nil {
+		return StageConf{}, err
+	}
 
 	repoConfig := tfvars.InfraCloudbuildV2RepositoryConfig
 	multitenantRepo := repoConfig.Repositories["multitenant"]
 	gitPath := filepath.Join(c.CheckoutPath, multitenantRepo.RepositoryName)
 	conf := utils.GitClone(t, repoConfig.RepoType, multitenantRepo.RepositoryName, multitenantRepo.RepositoryURL, gitPath, outputs.ProjectID, c.Logger)
 
-	stageConf := StageConf{
+	return StageConf{
 		Stage:         tfvars.InfraCloudbuildV2RepositoryConfig.Repositories["multitenant"].RepositoryName,
 		CICDProject:   outputs.ProjectID,
 		Step:          MultitenantStep,
@@ -165,29 +178,29 @@ func DeployMultitenantStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, ou
 		GitConf:       conf,
 		Envs:          slices.Collect(maps.Keys(tfvars.Envs)),
 		DefaultRegion: tfvars.TriggerLocation,
-	}
-
-	return deployStage(t, stageConf, s, c)
+	}, nil
 }
 
 func DeployFleetscopeStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) error {
+	stageConf, err := fleetscopeStageConf(t, tfvars, outputs, c)
+	if err != nil {
+		return err
+	}
+	return deployStage(t, stageConf, s, c)
+}
 
-	fleetscopeTfvars := FleetscopeTfvars{
-		RemoteStateBucket:           outputs.StateBucket,
-		NamespaceIDs:                tfvars.NamespaceIDs,
-		ConfigSyncSecretType:        tfvars.ConfigSyncSecretType,
-		ConfigSyncRepositoryURL:     tfvars.ConfigSyncRepositoryURL,
-		DisableIstioOnNamespaces:    tfvars.DisableIstioOnNamespaces,
-		ConfigSyncPolicyDir:         tfvars.ConfigSyncPolicyDir,
-		ConfigSyncBranch:            tfvars.ConfigSyncBranch,
-		AttestationKMSKey:           tfvars.AttestationKMSKey,
-		AttestationEvaluationMode:   tfvars.AttestationEvaluationMode,
-		EnableKueue:                 tfvars.EnableKueue,
-		EnableMulticlusterDiscovery: tfvars.EnableMulticlusterDiscovery,
+// fleetscopeInputs returns the inputs of the 3-fleetscope stage that are not global inputs.
+func fleetscopeInputs(outputs BootstrapOutputs) StageInputs {
+	return StageInputs{
+		"remote_state_bucket": outputs.StateBucket,
 	}
-	err := utils.WriteTfvars(filepath.Join(c.EABPath, FleetscopeStep, "terraform.tfvars"), fleetscopeTfvars)
+}
+
+// fleetscopeStageConf writes the 3-fleetscope tfvars file and clones the stage repository.
+func fleetscopeStageConf(t testing.TB, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) (StageConf, error) {
+	err := writeStageTfvars(filepath.Join(c.EABPath, FleetscopeStep), FleetscopeStep, tfvars, fleetscopeInputs(outputs))
 	if err != nil {
-		return err
+		return StageConf{}, err
 	}
 
 	repoConfig := tfvars.InfraCloudbuildV2RepositoryConfig
@@ -195,25 +208,32 @@ func DeployFleetscopeStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, out
 	gitPath := filepath.Join(c.CheckoutPath, fleetscopeRepo.RepositoryName)
 	conf := utils.GitClone(t, repoConfig.RepoType, fleetscopeRepo.RepositoryName, fleetscopeRepo.RepositoryURL, gitPath, outputs.ProjectID, c.Logger)
 
-	stageConf := StageConf{
+	return StageConf{
 		Stage:         tfvars.InfraCloudbuildV2RepositoryConfig.Repositories["fleetscope"].RepositoryName,
 		CICDProject:   outputs.ProjectID,
 		Step:          FleetscopeStep,
 		Repo:          tfvars.InfraCloudbuildV2RepositoryConfig.Repositories["fleetscope"].RepositoryName,
 		StageSA:       outputs.CBServiceAccountsEmails["fleetscope"],
 		GitConf:       conf,
+		Overlays:      c.Profile.overlays(c.EABPath, FleetscopeStep, tfvars),
 		Envs:          slices.Collect(maps.Keys(tfvars.Envs)),
 		DefaultRegion: tfvars.TriggerLocation,
-	}
-
-	return deployStage(t, stageConf, s, c)
+	}, nil
 }
 
 func DeployAppFactoryStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) error {
+	stageConf, err := appFactoryStageConf(t, tfvars, outputs, c)
+	if err != nil {
+		return err
+	}
+	return deployStage(t, stageConf, s, c)
+}
 
+// appFactoryInputs returns the inputs of the 4-appfactory stage that are not global inputs.
+func appFactoryInputs(tfvars GlobalTFVars, outputs BootstrapOutputs) StageInputs {
 	var kmsProject *string
 	if tfvars.BucketKMSKey != nil {
-		kmsInfo, err := extractInfoWithRegex(*tfvars.BucketKMSKey, `projects/(?P<project>[^/]+)/locations/(?P<location>[^/]+)/keyRings/(?P<keyRing>[^/]+)/cryptoKeys/(?P<cryptoKey>[^/]+)`)
+		kmsInfo, err := extractInfoWithRegex(*tfvars.BucketKMSKey, kmsKeyPattern)
 		if err != nil {
 			fmt.Printf("# error extracting info for BUCKET KMS PROJECT. %v \n", err)
 		}
@@ -222,27 +242,18 @@ func DeployAppFactoryStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, out
 			kmsProject = &auxProject
 		}
 	}
-	appFactory := AppFactoryTfvars{
-		RemoteStateBucket:            outputs.StateBucket,
-		CommonFolderID:               tfvars.CommonFolderID,
-		OrgID:                        tfvars.OrgID,
-		BillingAccount:               tfvars.BillingAccount,
-		Envs:                         tfvars.Envs,
-		BucketPrefix:                 tfvars.BucketPrefix,
-		BucketForceDestroy:           tfvars.BucketForceDestroy,
-		Location:                     tfvars.Location,
-		TriggerLocation:              tfvars.TriggerLocation,
-		TFApplyBranches:              slices.Collect(maps.Keys(tfvars.Envs)),
-		Applications:                 tfvars.Applications,
-		CloudbuildV2RepositoryConfig: tfvars.InfraCloudbuildV2RepositoryConfig,
-		KMSProjectID:                 kmsProject,
-		ServicePerimeterName:         tfvars.ServicePerimeterName,
-		ServicePerimeterMode:         *tfvars.ServicePerimeterMode,
-		InfraProjectAPIs:             tfvars.InfraProjectAPIs,
+	return StageInputs{
+		"remote_state_bucket": outputs.StateBucket,
+		"tf_apply_branches":   slices.Collect(maps.Keys(tfvars.Envs)),
+		"kms_project_id":      kmsProject,
 	}
-	err := utils.WriteTfvars(filepath.Join(c.EABPath, AppFactoryStep, "terraform.tfvars"), appFactory)
+}
+
+// appFactoryStageConf writes the 4-appfactory tfvars file and clones the stage repository.
+func appFactoryStageConf(t testing.TB, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) (StageConf, error) {
+	err := writeStageTfvars(filepath.Join(c.EABPath, AppFactoryStep), AppFactoryStep, tfvars, appFactoryInputs(tfvars, outputs))
 	if err != nil {
-		return err
+		return StageConf{}, err
 	}
 
 	repoConfig := tfvars.InfraCloudbuildV2RepositoryConfig
@@ -250,7 +261,7 @@ func DeployAppFactoryStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, out
 	gitPath := filepath.Join(c.CheckoutPath, appFactoryRepo.RepositoryName)
 	conf := utils.GitClone(t, repoConfig.RepoType, appFactoryRepo.RepositoryName, appFactoryRepo.RepositoryURL, gitPath, outputs.ProjectID, c.Logger)
 
-	stageConf := StageConf{
+	return StageConf{
 		Stage:         tfvars.InfraCloudbuildV2RepositoryConfig.Repositories["applicationfactory"].RepositoryName,
 		StageSA:       outputs.CBServiceAccountsEmails["applicationfactory"],
 		CICDProject:   outputs.ProjectID,
@@ -262,101 +273,207 @@ func DeployAppFactoryStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, out
 		Envs:          []string{"shared"},
 		GroupingUnits: []string{"envs"},
 		DefaultRegion: tfvars.TriggerLocation,
-	}
-	return deployStage(t, stageConf, s, c)
+		Overlays:      c.Profile.overlays(c.EABPath, AppFactoryStep, tfvars),
+	}, nil
 }
 
 func DeployAppInfraStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, bootstrapOutputs BootstrapOutputs, outputs AppFactoryOutputs, c CommonConf) error {
-	//for each environment
+	inputs := appInfraInputs(tfvars, bootstrapOutputs)
+	services := slices.DeleteFunc(appInfraServices(tfvars), func(appGroupIndex string) bool {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		return !c.Targets.includesApp(exampleName, serviceName)
+	})
+	return steps.RunParallel(services, c.Parallelism, func(appGroupIndex string) error {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		sc, ss := c, s
+		if c.Parallelism > 1 {
+			sc.Logger = utils.GetPrefixedLogger(c.Logger, appGroupIndex)
+			ss = s.WithLogPrefix(appGroupIndex)
+		}
+		err := ss.RunStep(fmt.Sprintf("%s.%s", AppInfraStageName, appGroupIndex), func() error {
+			return deployAppInfraService(t, ss, tfvars, inputs, exampleName, serviceName, outputs, sc)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", appGroupIndex, err)
+		}
+		return nil
+	})
+}
 
-	appInfraTfvars := AppInfraTfvars{
-		Region:                       tfvars.Region,
-		BucketsForceDestroy:          tfvars.BucketForceDestroy,
-		RemoteStateBucket:            bootstrapOutputs.StateBucket,
-		EnvironmentNames:             slices.Collect(maps.Keys(tfvars.Envs)),
-		CloudbuildV2RepositoryConfig: tfvars.AppServicesCloudbuildV2RepositoryConfig,
-		AccessLevelName:              tfvars.AccessLevelName,
-		LoggingBucket:                tfvars.LoggingBucket,
-		BucketKMSKey:                 tfvars.BucketKMSKey,
-		AttestationKMSKey:            tfvars.AttestationKMSKey,
-		BucketPrefix:                 tfvars.BucketPrefix,
+// appInfraInputs returns the inputs of the 5-appinfra stage that are not global inputs, shared by all the services.
+func appInfraInputs(tfvars GlobalTFVars, bootstrapOutputs BootstrapOutputs) StageInputs {
+	return StageInputs{
+		"remote_state_bucket": bootstrapOutputs.StateBucket,
+		"environment_names":   slices.Collect(maps.Keys(tfvars.Envs)),
 	}
+}
 
-	var err error
-	for exampleName, services := range tfvars.Applications {
-		for serviceName := range services {
-			appGroupIndex := fmt.Sprintf("%s.%s", exampleName, serviceName)
-			envs := []string{"shared"}
-			if len(outputs.AppGroup[appGroupIndex].AppInfraProjectIDs) > 0 {
-				envs = append(envs, slices.Collect(maps.Keys(tfvars.Envs))...)
-			}
+// appInfraServices lists the services of all the applications, in the format "<application>.<service>", sorted.
+func appInfraServices(tfvars GlobalTFVars) []string {
+	services := []string{}
+	for exampleName, svcs := range tfvars.Applications {
+		for serviceName := range svcs {
+			services = append(services, fmt.Sprintf("%s.%s", exampleName, serviceName))
+		}
+	}
+	slices.Sort(services)
+	return services
+}
 
-			err := utils.WriteTfvars(filepath.Join(c.EABPath, AppInfraStep, "apps", exampleName, serviceName, "envs", "shared", "terraform.tfvars"), appInfraTfvars)
-			if err != nil {
-				return err
-			}
+// deployAppInfraService deploys the 5-appinfra code of a single service of an application.
+func deployAppInfraService(t testing.TB, s steps.Steps, tfvars GlobalTFVars, inputs StageInputs, exampleName, serviceName string, outputs AppFactoryOutputs, c CommonConf) error {
+	stageConf, err := appInfraServiceStageConf(t, tfvars, inputs, exampleName, serviceName, outputs, c)
+	if err != nil {
+		return err
+	}
+	return deployStage(t, stageConf, s, c)
+}
 
-			for _, env := range envs {
-				err = utils.ReplaceStringInFile(filepath.Join(c.EABPath, AppInfraStep, "apps", exampleName, serviceName, "envs", env, "backend.tf"), "UPDATE_INFRA_REPO_STATE", strings.SplitAfter(outputs.AppGroup[appGroupIndex].AppCloudbuildWorkspaceStateBucketName, "https://www.googleapis.com/storage/v1/b/")[1])
-				if err != nil {
-					return err
-				}
-			}
+// appInfraServiceStageConf writes the 5-appinfra tfvars and backend files of a service and clones the service repository.
+func appInfraServiceStageConf(t testing.TB, tfvars GlobalTFVars, inputs StageInputs, exampleName, serviceName string, outputs AppFactoryOutputs, c CommonConf) (StageConf, error) {
+	appGroupIndex := fmt.Sprintf("%s.%s", exampleName, serviceName)
+	envs := []string{"shared"}
+	if len(outputs.AppGroup[appGroupIndex].AppInfraProjectIDs) > 0 {
+		envs = append(envs, slices.Collect(maps.Keys(tfvars.Envs))...)
+	}
 
-			repoConfig := tfvars.InfraCloudbuildV2RepositoryConfig
-			serviceRepo := repoConfig.Repositories[serviceName]
-			gitPath := filepath.Join(c.CheckoutPath, serviceRepo.RepositoryName)
-			conf := utils.GitClone(t, repoConfig.RepoType, serviceRepo.RepositoryName, serviceRepo.RepositoryURL, gitPath, outputs.AppGroup[appGroupIndex].AppAdminProjectID, c.Logger)
-
-			serviceAccountID := strings.Split(outputs.AppGroup[appGroupIndex].AppCloudbuildWorkspaceCloudbuildSAEmail, "/")
-			stageConf := StageConf{
-				Stage:         tfvars.InfraCloudbuildV2RepositoryConfig.Repositories[serviceName].RepositoryName,
-				StageSA:       serviceAccountID[len(serviceAccountID)-1],
-				CICDProject:   outputs.AppGroup[appGroupIndex].AppAdminProjectID,
-				Step:          AppInfraStep,
-				Repo:          tfvars.InfraCloudbuildV2RepositoryConfig.Repositories[serviceName].RepositoryName,
-				GitConf:       conf,
-				HasLocalStep:  true,
-				LocalSteps:    []string{"shared"},
-				GroupingUnits: []string{fmt.Sprintf("apps/%s/%s/envs/", exampleName, serviceName)},
-				Envs:          envs,
-				DefaultRegion: tfvars.TriggerLocation,
-			}
+	serviceDir := filepath.Join(c.EABPath, c.appInfraServiceDir(exampleName, serviceName))
+	err := writeStageTfvars(filepath.Join(serviceDir, "envs", "shared"), AppInfraStep, tfvars, inputs)
+	if err != nil {
+		return StageConf{}, err
+	}
 
-			err = deployStage(t, stageConf, s, c)
-			if err != nil {
-				return err
-			}
+	for _, env := range envs {
+		err = utils.ReplaceStringInFile(filepath.Join(serviceDir, "envs", env, "backend.tf"), "UPDATE_INFRA_REPO_STATE", strings.SplitAfter(outputs.AppGroup[appGroupIndex].AppCloudbuildWorkspaceStateBucketName, "https://www.googleapis.com/storage/v1/b/")[1])
+		if err != nil {
+			return StageConf{}, err
 		}
 	}
-	return err
-}
 
-func DeployAppSourceStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outputs AppInfraOutputs, c CommonConf) error {
+	repoConfig := tfvars.InfraCloudbuildV2RepositoryConfig
+	serviceRepo := repoConfig.Repositories[serviceName]
+	gitPath := filepath.Join(c.CheckoutPath, serviceRepo.RepositoryName)
+	conf := utils.GitClone(t, repoConfig.RepoType, serviceRepo.RepositoryName, serviceRepo.RepositoryURL, gitPath, outputs.AppGroup[appGroupIndex].AppAdminProjectID, c.Logger)
 
-	var err error
-	for _, repository := range tfvars.AppServicesCloudbuildV2RepositoryConfig.Repositories {
-
-		gitPath := filepath.Join(c.CheckoutPath, outputs.ServiceRepositoryName)
-		conf := utils.GitClone(t, tfvars.AppServicesCloudbuildV2RepositoryConfig.RepoType, repository.RepositoryName, repository.RepositoryURL, gitPath, outputs.ServiceRepositoryProjectID, c.Logger)
-
-		stageConf := StageConf{
-			Stage:         outputs.ServiceRepositoryName,
-			CICDProject:   outputs.ServiceRepositoryProjectID,
-			Step:          filepath.Join(AppSourceStep, "hello-world"),
-			Repo:          outputs.ServiceRepositoryName,
-			GitConf:       conf,
-			DefaultRegion: tfvars.TriggerLocation,
-			Envs:          slices.Collect(maps.Keys(tfvars.Envs)),
-			SkipPlan:      true,
-		}
+	serviceAccountID := strings.Split(outputs.AppGroup[appGroupIndex].AppCloudbuildWorkspaceCloudbuildSAEmail, "/")
+	stageConf := StageConf{
+		Stage:         tfvars.InfraCloudbuildV2RepositoryConfig.Repositories[serviceName].RepositoryName,
+		StageSA:       serviceAccountID[len(serviceAccountID)-1],
+		CICDProject:   outputs.AppGroup[appGroupIndex].AppAdminProjectID,
+		Step:          AppInfraStep,
+		Repo:          tfvars.InfraCloudbuildV2RepositoryConfig.Repositories[serviceName].RepositoryName,
+		GitConf:       conf,
+		HasLocalStep:  true,
+		LocalSteps:    []string{"shared"},
+		GroupingUnits: []string{fmt.Sprintf("apps/%s/%s/envs/", exampleName, serviceName)},
+		Envs:          envs,
+		DefaultRegion: tfvars.TriggerLocation,
+		Overlays:      c.Profile.overlays(c.EABPath, AppInfraStep, tfvars),
+	}
+	if c.Parallelism > 1 {
+		stageConf.LogPrefix = appGroupIndex
+	}
+	return stageConf, nil
+}
 
-		err = deployApp(t, stageConf, s, c)
+// DeployAppSourceStage deploys the 6-appsource code of the selected services of all the applications.
+// The 5-appinfra outputs of each service, like its source repository and CI/CD project, are read with appInfraOutputs.
+// Services without a source repository in app_services_cloudbuildv2_repository_config are skipped.
+func DeployAppSourceStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, appInfraOutputs func(exampleName, serviceName string) AppInfraOutputs, c CommonConf) error {
+	for _, appGroupIndex := range appSourceServices(tfvars) {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		if !c.Targets.includesApp(exampleName, serviceName) {
+			continue
+		}
+		stageConf, err := appSourceStageConf(t, tfvars, exampleName, serviceName, appInfraOutputs(exampleName, serviceName), c)
+		if err != nil {
+			return err
+		}
+		err = deployApp(t, stageConf, serviceName, s, c)
 		if err != nil {
 			return err
 		}
 	}
-	return err
+	return nil
+}
+
+// appSourceRepository returns the source repository of a service of an application.
+// Repositories are keyed by "eab-<application>-<service>", like in the 5-appinfra code, or by the service name.
+func appSourceRepository(tfvars GlobalTFVars, exampleName, serviceName string) (Repository, bool) {
+	repositories := tfvars.AppServicesCloudbuildV2RepositoryConfig.Repositories
+	if repository, ok := repositories[fmt.Sprintf("eab-%s-%s", exampleName, serviceName)]; ok {
+		return repository, true
+	}
+	repository, ok := repositories[serviceName]
+	return repository, ok
+}
+
+// appSourceServices lists the services of all the applications with a source repository in app_services_cloudbuildv2_repository_config,
+// in the format "<application>.<service>", sorted.
+func appSourceServices(tfvars GlobalTFVars) []string {
+	services := []string{}
+	for _, appGroupIndex := range appInfraServices(tfvars) {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		if _, ok := appSourceRepository(tfvars, exampleName, serviceName); !ok {
+			fmt.Printf("# service %s has no repository in app_services_cloudbuildv2_repository_config, its source is not deployed\n", appGroupIndex)
+			continue
+		}
+		services = append(services, appGroupIndex)
+	}
+	return services
+}
+
+// appSourceDir returns the directory, relative to the blueprint code, with the 6-appsource code of a service of an application.
+// The directories checked are 6-appsource/<application>/<service>, 6-appsource/<service>, like 6-appsource/hello-world,
+// and 6-appsource/<application>, for applications with all their services in one source repository.
+// With a 6-appsource overlay, the same directories of the overlay are checked first, and then the overlay itself.
+func appSourceDir(eabPath string, profile Profile, exampleName, serviceName string) (string, error) {
+	candidates := []string{}
+	if overlay, ok := profile.Overlays[AppSourceStep]; ok {
+		candidates = append(candidates,
+			filepath.Join(overlay, exampleName, serviceName),
+			filepath.Join(overlay, serviceName),
+			filepath.Join(overlay, exampleName),
+			overlay,
+		)
+	}
+	candidates = append(candidates,
+		filepath.Join(AppSourceStep, exampleName, serviceName),
+		filepath.Join(AppSourceStep, serviceName),
+		filepath.Join(AppSourceStep, exampleName),
+	)
+	for _, dir := range candidates {
+		if isDir(filepath.Join(eabPath, dir)) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("source code of service %s of application %s not found, expected one of the directories %s", serviceName, exampleName, strings.Join(candidates, ", "))
+}
+
+// appSourceStageConf clones the source repository of a service of an application for the 6-appsource stage.
+func appSourceStageConf(t testing.TB, tfvars GlobalTFVars, exampleName, serviceName string, outputs AppInfraOutputs, c CommonConf) (StageConf, error) {
+	step, err := appSourceDir(c.EABPath, c.Profile, exampleName, serviceName)
+	if err != nil {
+		return StageConf{}, err
+	}
+	repository, _ := appSourceRepository(tfvars, exampleName, serviceName)
+	gitPath := filepath.Join(c.CheckoutPath, outputs.ServiceRepositoryName)
+	conf := utils.GitClone(t, tfvars.AppServicesCloudbuildV2RepositoryConfig.RepoType, repository.RepositoryName, repository.RepositoryURL, gitPath, outputs.ServiceRepositoryProjectID, c.Logger)
+
+	stageConf := StageConf{
+		Stage:         outputs.ServiceRepositoryName,
+		CICDProject:   outputs.ServiceRepositoryProjectID,
+		Step:          step,
+		Repo:          outputs.ServiceRepositoryName,
+		GitConf:       conf,
+		DefaultRegion: tfvars.TriggerLocation,
+		Envs:          slices.Collect(maps.Keys(tfvars.Envs)),
+		SkipPlan:      true,
+	}
+	if c.Parallelism > 1 {
+		stageConf.LogPrefix = fmt.Sprintf("%s.%s", exampleName, serviceName)
+	}
+	return stageConf, nil
 }
 
 func deployStage(t testing.TB, sc StageConf, s steps.Steps, c CommonConf) error {
@@ -367,7 +484,8 @@ func deployStage(t testing.TB, sc StageConf, s steps.Steps, c CommonConf) error
 	}
 
 	err = s.RunStep(fmt.Sprintf("%s.copy-code", sc.Stage), func() error {
-		return copyStepCode(t, sc.GitConf, c.EABPath, c.CheckoutPath, sc.Repo, sc.Step, sc.CustomTargetDirPath, sc.Envs)
+		sc.printf("%s\n", filepath.Join(c.CheckoutPath, sc.Repo))
+		return copyStepCode(t, sc.GitConf, c.EABPath, c.CheckoutPath, sc.Repo, sc.Step, sc.CustomTargetDirPath, sc.Overlays, sc.Envs, c.confirmOverwrite)
 	})
 	if err != nil {
 		return err
@@ -397,31 +515,33 @@ func deployStage(t testing.TB, sc StageConf, s steps.Steps, c CommonConf) error
 		}
 	}
 
+	g := gcp.NewGCP().WithLogPrefix(sc.LogPrefix).WithWaitOptions(c.waitOptions(sc.Stage))
 	err = s.RunStep(fmt.Sprintf("%s.plan", sc.Stage), func() error {
-		return planStage(t, sc.GitConf, sc.CICDProject, sc.DefaultRegion, sc.Repo)
+		return planStage(c.Context, t, g, c.Promotion, sc.GitConf, sc.CICDProject, sc.DefaultRegion, sc.Repo)
 	})
 	if err != nil {
 		return err
 	}
 
-	for _, env := range sc.Envs {
+	for _, env := range c.Targets.filterEnvs(sc.Envs) {
 		err = s.RunStep(fmt.Sprintf("%s.%s", sc.Stage, env), func() error {
 			aEnv := env
 			if env == "shared" {
 				aEnv = "production"
 			}
-			return applyEnv(t, sc.GitConf, sc.CICDProject, sc.DefaultRegion, sc.Repo, aEnv)
+			return applyEnv(c.Context, t, g, c.Promotion, sc.GitConf, sc.CICDProject, sc.DefaultRegion, sc.Repo, aEnv)
 		})
 		if err != nil {
 			return err
 		}
 	}
 
-	fmt.Println("end of", sc.Step, "deploy")
+	sc.printf("end of %s deploy\n", sc.Step)
 	return nil
 }
 
-func deployApp(t testing.TB, sc StageConf, s steps.Steps, c CommonConf) error {
+// deployApp pushes the source code of a service and waits for the release of its Cloud Deploy delivery pipeline, named after the service.
+func deployApp(t testing.TB, sc StageConf, serviceName string, s steps.Steps, c CommonConf) error {
 
 	err := sc.GitConf.CheckoutBranch("main")
 	if err != nil {
@@ -436,13 +556,13 @@ func deployApp(t testing.TB, sc StageConf, s steps.Steps, c CommonConf) error {
 	}
 
 	err = s.RunStep(sc.Stage, func() error {
-		return deployEnvApp(t, sc.GitConf, sc.CICDProject, sc.DefaultRegion, sc.Repo, "hello-world", sc.Envs)
+		return deployEnvApp(c.Context, t, gcp.NewGCP().WithLogPrefix(sc.LogPrefix).WithWaitOptions(c.waitOptions(sc.Stage)), c.AppSourcePromotion, sc.GitConf, sc.CICDProject, sc.DefaultRegion, sc.Repo, serviceName, sc.Envs)
 	})
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("end of", sc.Step, "deploy")
+	sc.printf("end of %s deploy\n", sc.Step)
 	return nil
 }
 
@@ -472,100 +592,127 @@ func copyAppSourceCode(t testing.TB, conf utils.GitRepo, EABPath, checkoutPath,
 	return err
 }
 
-func copyStepCode(t testing.TB, conf utils.GitRepo, EABPath, checkoutPath, repo, step, customPath string, environmentNames []string) error {
+// gitignore has the patterns merged into the .gitignore file of the stage repositories.
+const gitignore = `### https://raw.github.com/github/gitignore/90f149de451a5433aebd94d02d11b0e28843a1af/Terraform.gitignore
+# Local .terraform directories
+*.terraform*
+**/.terraform/*
+
+# .tfstate files
+*.tfstate
+*.tfstate.*
+# tf lock file
+.terraform.lock.hcl
+`
+
+// copyStepCode copies the code of a step to the stage repository.
+// Only the files owned by the blueprint, listed in the managed files manifest of the repository, are updated,
+// and confirm is called before overwriting the files with local changes.
+// The blueprint patterns are merged into the .gitignore file of the repository.
+func copyStepCode(t testing.TB, conf utils.GitRepo, EABPath, checkoutPath, repo, step, customPath string, overlays []Overlay, environmentNames []string, confirm func(path string) bool) error {
 	gcpPath := filepath.Join(checkoutPath, repo)
 	targetDir := gcpPath
-	fmt.Println(targetDir)
 	if customPath != "" {
 		targetDir = filepath.Join(gcpPath, customPath)
 	}
-	err := utils.CopyDirectory(filepath.Join(EABPath, step), targetDir)
+	managed, err := utils.OpenManagedRepo(gcpPath, confirm)
 	if err != nil {
 		return err
 	}
-
-	err = utils.CopyFile(filepath.Join(EABPath, "build/cloudbuild-tf-apply.yaml"), filepath.Join(gcpPath, "cloudbuild-tf-apply.yaml"))
+	err = managed.CopyDirectory(filepath.Join(EABPath, step), targetDir)
 	if err != nil {
 		return err
 	}
-	err = utils.CopyFile(filepath.Join(EABPath, "build/cloudbuild-tf-plan.yaml"), filepath.Join(gcpPath, "cloudbuild-tf-plan.yaml"))
+	err = copyOverlays(managed, EABPath, targetDir, overlays)
 	if err != nil {
 		return err
 	}
 
-	err = utils.CopyDirectory(filepath.Join(EABPath, "modules"), filepath.Join(targetDir, "modules"))
+	err = managed.CopyFile(filepath.Join(EABPath, "build/cloudbuild-tf-apply.yaml"), filepath.Join(gcpPath, "cloudbuild-tf-apply.yaml"))
+	if err != nil {
+		return err
+	}
+	err = managed.CopyFile(filepath.Join(EABPath, "build/cloudbuild-tf-plan.yaml"), filepath.Join(gcpPath, "cloudbuild-tf-plan.yaml"))
 	if err != nil {
 		return err
 	}
 
-	fileName := filepath.Join(gcpPath, ".gitignore")
-	content := `### https://raw.github.com/github/gitignore/90f149de451a5433aebd94d02d11b0e28843a1af/Terraform.gitignore
-# Local .terraform directories
-*.terraform*
-**/.terraform/*
-
-# .tfstate files
-*.tfstate
-*.tfstate.*
-# tf lock file
-.terraform.lock.hcl
-`
-	file, err := os.Create(fileName)
+	err = managed.CopyDirectory(filepath.Join(EABPath, "modules"), filepath.Join(targetDir, "modules"))
 	if err != nil {
-		fmt.Printf("Error creating file: %v\n", err)
+		return err
 	}
-	// Ensure the file is closed when the function exits.
-	// This is crucial for releasing resources and flushing any buffered data.
-	defer file.Close()
 
-	// Write the string content to the file.
-	// file.WriteString returns the number of bytes written and an error.
-	_, err = file.WriteString(content)
+	err = utils.MergeGitignore(filepath.Join(gcpPath, ".gitignore"), gitignore)
 	if err != nil {
 		return err
 	}
-	err = utils.CopyFile(filepath.Join(EABPath, "build/tf-wrapper.sh"), filepath.Join(gcpPath, "tf-wrapper.sh"))
+
+	wrapper := filepath.Join(gcpPath, "tf-wrapper.sh")
+	err = managed.CopyFile(filepath.Join(EABPath, "build/tf-wrapper.sh"), wrapper)
 	if err != nil {
 		return err
 	}
 
 	oldValue := "^(development|nonproduction|production|shared)$"
 	newValue := fmt.Sprintf("^(%s)$", strings.Join(environmentNames, "|"))
-	err = utils.ReplaceStringInFile(filepath.Join(gcpPath, "tf-wrapper.sh"), oldValue, newValue)
+	err = utils.ReplaceStringInFile(wrapper, oldValue, newValue)
 	if err != nil {
 		return err
 	}
-	s, err := os.Stat(filepath.Join(gcpPath, "tf-wrapper.sh"))
+	s, err := os.Stat(wrapper)
 	if err != nil {
 		return err
 	}
 	permissions := s.Mode().Perm()
 	newPermissions := permissions | 0111
-	err = os.Chmod(filepath.Join(gcpPath, "tf-wrapper.sh"), newPermissions)
+	err = os.Chmod(wrapper, newPermissions)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return managed.Save()
+}
+
+// confirmOverwrite asks before overwriting a file of the blueprint with local changes.
+// The local changes are kept if the prompt is disabled.
+// The prompts of the stages deployed in parallel are asked one at a time.
+func (c CommonConf) confirmOverwrite(path string) bool {
+	if c.DisablePrompt {
+		return false
+	}
+	if c.Prompts != nil {
+		c.Prompts.Lock()
+		defer c.Prompts.Unlock()
+	}
+	return msg.ConfirmOverwrite(c.Context, path)
+}
+
+// keepLocalChanges never overwrites a file of the blueprint with local changes.
+func keepLocalChanges(string) bool {
+	return false
+}
+
+// waitOptions returns the options to wait for the builds of a stage.
+// The streamed build logs are written to the stage logger prefixed with the stage name.
+func (c CommonConf) waitOptions(stage string) gcp.WaitOptions {
+	wait := c.Wait
+	wait.Logs.Logger = c.Logger
+	wait.Logs.Prefix = stage
+	return wait
 }
 
-func planStage(t testing.TB, conf utils.GitRepo, project, region, repo string) error {
+func planStage(ctx context.Context, t testing.TB, g gcp.GCP, p Promotion, conf utils.GitRepo, project, region, repo string) error {
 
 	err := conf.CommitFiles(fmt.Sprintf("Initialize %s repo", repo))
 	if err != nil {
 		return err
 	}
-	err = conf.PushBranch("plan", "origin")
+	commitSha, err := p.promote(ctx, conf, "plan", "plan", fmt.Sprintf("Plan %s", repo))
 	if err != nil {
 		return err
 	}
 
-	commitSha, err := conf.GetCommitSha()
-	if err != nil {
-		return err
-	}
-
-	return gcp.NewGCP().WaitBuildSuccess(t, project, region, repo, commitSha, fmt.Sprintf("Terraform %s plan build Failed.", repo), MaxBuildRetries, MaxErrorRetries, TimeBetweenErrorRetries)
+	return g.WaitBuildSuccess(ctx, t, project, region, repo, commitSha, fmt.Sprintf("Terraform %s plan build Failed.", repo), BuildTimeout, MaxErrorRetries, TimeBetweenErrorRetries)
 }
 
 func saveBootstrapCodeOnly(t testing.TB, sc StageConf, s steps.Steps, c CommonConf) error {
@@ -576,7 +723,8 @@ func saveBootstrapCodeOnly(t testing.TB, sc StageConf, s steps.Steps, c CommonCo
 	}
 
 	err = s.RunStep(fmt.Sprintf("%s.copy-code", sc.Stage), func() error {
-		return copyStepCode(t, sc.GitConf, c.EABPath, c.CheckoutPath, sc.Repo, sc.Step, sc.CustomTargetDirPath, sc.Envs)
+		sc.printf("%s\n", filepath.Join(c.CheckoutPath, sc.Repo))
+		return copyStepCode(t, sc.GitConf, c.EABPath, c.CheckoutPath, sc.Repo, sc.Step, sc.CustomTargetDirPath, sc.Overlays, sc.Envs, c.confirmOverwrite)
 	})
 	if err != nil {
 		return err
@@ -587,7 +735,8 @@ func saveBootstrapCodeOnly(t testing.TB, sc StageConf, s steps.Steps, c CommonCo
 		if err != nil {
 			return err
 		}
-		return sc.GitConf.PushBranch("plan", "origin")
+		_, err = c.Promotion.promote(c.Context, sc.GitConf, "plan", "plan", fmt.Sprintf("Save %s code", sc.Repo))
+		return err
 	})
 
 	if err != nil {
@@ -600,75 +749,67 @@ func saveBootstrapCodeOnly(t testing.TB, sc StageConf, s steps.Steps, c CommonCo
 			if env == "shared" {
 				aEnv = "production"
 			}
-			err := sc.GitConf.CheckoutBranch(aEnv)
-			if err != nil {
-				return err
-			}
-			return sc.GitConf.PushBranch(aEnv, "origin")
+			_, err := c.Promotion.promote(c.Context, sc.GitConf, "plan", aEnv, fmt.Sprintf("Save %s code to %s", sc.Repo, aEnv))
+			return err
 		})
 		if err != nil {
 			return err
 		}
 	}
 
-	fmt.Println("end of", sc.Step, "deploy")
+	sc.printf("end of %s deploy\n", sc.Step)
 	return nil
 }
 
-func deployEnvApp(t testing.TB, conf utils.GitRepo, project, region, repo, service string, envs []string) error {
+func deployEnvApp(ctx context.Context, t testing.TB, g gcp.GCP, p Promotion, conf utils.GitRepo, project, region, repo, service string, envs []string) error {
 	var err error
 
 	err = conf.CommitFiles(fmt.Sprintf("Initialize %s repo", repo))
 	if err != nil {
 		return err
 	}
-	err = conf.PushBranch("main", "origin")
+	commitSha, err := p.promote(ctx, conf, "main", "main", fmt.Sprintf("Deploy %s", repo))
 	if err != nil {
 		return err
 	}
 
-	commitSha, err := conf.GetCommitSha()
+	err = g.WaitBuildSuccess(ctx, t, project, region, repo, commitSha, fmt.Sprintf("Build %s env %s build Failed.", repo, service), BuildTimeout, MaxErrorRetries, TimeBetweenErrorRetries)
 	if err != nil {
 		return err
 	}
 
-	err = gcp.NewGCP().WaitBuildSuccess(t, project, region, repo, commitSha, fmt.Sprintf("Build %s env %s build Failed.", repo, service), MaxBuildRetries, MaxErrorRetries, TimeBetweenErrorRetries)
-	if err != nil {
-		return err
-	}
-
-	err = gcp.NewGCP().WaitReleaseSuccess(t, project, region, service, commitSha[0:7], fmt.Sprintf("Deploy %s env %s build Failed.", repo, service), MaxBuildRetries)
+	err = g.WaitReleaseSuccess(ctx, t, project, region, service, commitSha[0:7], fmt.Sprintf("Deploy %s env %s build Failed.", repo, service), BuildTimeout)
 
 	return err
 }
 
-func applyEnv(t testing.TB, conf utils.GitRepo, project, region, repo, environment string) error {
-	err := conf.CheckoutBranch(environment)
+func applyEnv(ctx context.Context, t testing.TB, g gcp.GCP, p Promotion, conf utils.GitRepo, project, region, repo, environment string) error {
+	commitSha, err := p.promote(ctx, conf, "plan", environment, fmt.Sprintf("Apply %s to %s", repo, environment))
 	if err != nil {
 		return err
 	}
-	err = conf.PushBranch(environment, "origin")
-	if err != nil {
-		return err
+
+	return g.WaitBuildSuccess(ctx, t, project, region, repo, commitSha, fmt.Sprintf("Terraform %s apply %s build Failed.", repo, environment), BuildTimeout, MaxErrorRetries, TimeBetweenErrorRetries)
+}
+
+// setImpersonation sets the service account impersonated by terraform.
+// The service account is set in the terraform environment instead of the process environment
+// because local steps of different services can be applied in parallel.
+func setImpersonation(t testing.TB, options *terraform.Options, serviceAccount string) {
+	if serviceAccount == "" {
+		return
 	}
-	commitSha, err := conf.GetCommitSha()
-	if err != nil {
-		return err
+	t.Logf("Setting GOOGLE_IMPERSONATE_SERVICE_ACCOUNT as %s", serviceAccount)
+	if options.EnvVars == nil {
+		options.EnvVars = map[string]string{}
 	}
-
-	return gcp.NewGCP().WaitBuildSuccess(t, project, region, repo, commitSha, fmt.Sprintf("Terraform %s apply %s build Failed.", repo, environment), MaxBuildRetries, MaxErrorRetries, TimeBetweenErrorRetries)
+	options.EnvVars["GOOGLE_IMPERSONATE_SERVICE_ACCOUNT"] = serviceAccount
 }
 
 func applyLocal(t testing.TB, options *terraform.Options, serviceAccount, policyPath, validatorProjectId string) error {
 	var err error
 
-	if serviceAccount != "" {
-		t.Logf("Setting GOOGLE_IMPERSONATE_SERVICE_ACCOUNT as %s", serviceAccount)
-		err = os.Setenv("GOOGLE_IMPERSONATE_SERVICE_ACCOUNT", serviceAccount)
-		if err != nil {
-			return err
-		}
-	}
+	setImpersonation(t, options, serviceAccount)
 
 	_, err = terraform.InitE(t, options)
 	if err != nil {
@@ -681,22 +822,12 @@ func applyLocal(t testing.TB, options *terraform.Options, serviceAccount, policy
 
 	// Runs gcloud terraform vet
 	if validatorProjectId != "" {
-		err = TerraformVet(t, options.TerraformDir, policyPath, validatorProjectId)
+		err = TerraformVet(t, options.TerraformDir, policyPath, validatorProjectId, options.EnvVars)
 		if err != nil {
 			return err
 		}
 	}
 
 	_, err = terraform.ApplyE(t, options)
-	if err != nil {
-		return err
-	}
-
-	if serviceAccount != "" {
-		err = os.Unsetenv("GOOGLE_IMPERSONATE_SERVICE_ACCOUNT")
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return err
 }
@@ -0,0 +1,70 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppSourceServices(t *testing.T) {
+	g := readValidTFVars(t)
+	g.Applications["cymbal-bank"] = map[string]ApplicationService{
+		"frontend": {},
+		"contacts": {},
+		"ledger":   {},
+	}
+	g.AppServicesCloudbuildV2RepositoryConfig.Repositories["eab-cymbal-bank-frontend"] = Repository{RepositoryName: "frontend-i-r"}
+	g.AppServicesCloudbuildV2RepositoryConfig.Repositories["contacts"] = Repository{RepositoryName: "contacts-i-r"}
+
+	assert.Equal(t, []string{"cymbal-bank.contacts", "cymbal-bank.frontend", "default-example.hello-world"}, appSourceServices(g))
+
+	repository, ok := appSourceRepository(g, "default-example", "hello-world")
+	assert.True(t, ok)
+	assert.Equal(t, "hello-world-i-r", repository.RepositoryName)
+	repository, ok = appSourceRepository(g, "cymbal-bank", "contacts")
+	assert.True(t, ok)
+	assert.Equal(t, "contacts-i-r", repository.RepositoryName)
+	_, ok = appSourceRepository(g, "cymbal-bank", "ledger")
+	assert.False(t, ok)
+}
+
+func TestAppSourceDir(t *testing.T) {
+	eabPath := t.TempDir()
+	for _, dir := range []string{"6-appsource/hello-world", "6-appsource/cymbal-bank/frontend", "6-appsource/cymbal-shop"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(eabPath, dir), 0755))
+	}
+
+	tests := []struct {
+		app     string
+		service string
+		want    string
+	}{
+		{app: "default-example", service: "hello-world", want: "6-appsource/hello-world"},
+		{app: "cymbal-bank", service: "frontend", want: "6-appsource/cymbal-bank/frontend"},
+		{app: "cymbal-shop", service: "cymbalshop", want: "6-appsource/cymbal-shop"},
+	}
+	for _, tt := range tests {
+		dir, err := appSourceDir(eabPath, Profile{}, tt.app, tt.service)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, dir)
+	}
+
+	_, err := appSourceDir(eabPath, Profile{}, "agent", "capital-agent")
+	assert.ErrorContains(t, err, "source code of service capital-agent of application agent not found")
+}
@@ -15,17 +15,22 @@
 package stages
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gruntwork-io/terratest/modules/logger"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/mitchellh/go-testing-interface"
+	"github.com/zclconf/go-cty/cty"
 
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/gcp"
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
 )
 
@@ -40,16 +45,28 @@ const (
 	AppSourceStep           = "6-appsource"
 	MaxErrorRetries         = 2
 	TimeBetweenErrorRetries = 2 * time.Minute
-	MaxBuildRetries         = 60
+	BuildTimeout            = 20 * time.Minute
 )
 
 type CommonConf struct {
-	EABPath          string
-	CheckoutPath     string
-	PolicyPath       string
-	ValidatorProject string
-	DisablePrompt    bool
-	Logger           *logger.Logger
+	Context            context.Context
+	EABPath            string
+	CheckoutPath       string
+	PolicyPath         string
+	ValidatorProject   string
+	DisablePrompt      bool
+	Parallelism        int
+	Logger             *logger.Logger
+	DryRunReport       *DryRunReport
+	DriftReport        *DriftReport
+	Wait               gcp.WaitOptions
+	Targets            Targets
+	UpgradeVersion     string
+	Promotion          Promotion
+	AppSourcePromotion Promotion
+	Profile            Profile
+	// Prompts serializes the prompts of the stages deployed in parallel, like the services of 5-appinfra
+	Prompts *sync.Mutex
 }
 
 type StageConf struct {
@@ -66,6 +83,16 @@ type StageConf struct {
 	Envs                []string
 	LocalSteps          []string
 	SkipPlan            bool
+	LogPrefix           string
+	Overlays            []Overlay
+}
+
+// printf prints a message of the stage adding the log prefix, if any.
+func (sc StageConf) printf(format string, args ...interface{}) {
+	if sc.LogPrefix != "" {
+		format = "[" + strings.ReplaceAll(sc.LogPrefix, "%", "%%") + "] " + format
+	}
+	fmt.Printf(format, args...)
 }
 
 type BootstrapOutputs struct {
@@ -152,6 +179,8 @@ type GlobalTFVars struct {
 	Region                                  string                                   `hcl:"region"`
 	EABCodePath                             string                                   `hcl:"eab_code_path"`
 	CodeCheckoutPath                        string                                   `hcl:"code_checkout_path"`
+	// Extra are the inputs without a field, passed through to the stages that declare them as variables.
+	Extra map[string]cty.Value `hcl:",remain"`
 }
 
 type Env struct {
@@ -194,90 +223,88 @@ type ApplicationService struct {
 	CreateAdminProject bool    `hcl:"create_admin_project" cty:"create_admin_project"`
 }
 
-// CheckString checks if any of the string fields in the GlobalTFVars has the given string
-func (g GlobalTFVars) CheckString(s string) {
-	f := reflect.ValueOf(g)
-	for i := 0; i < f.NumField(); i++ {
-		if f.Field(i).Kind() == reflect.String && strings.Contains(f.Field(i).String(), s) {
-			fmt.Printf("# Replace value '%s' for input '%s'\n", s, f.Type().Field(i).Tag.Get("hcl"))
-		}
-	}
-}
-
-type BootstrapTfvars struct {
-	ProjectID                    string                       `hcl:"project_id"`
-	BucketPrefix                 string                       `hcl:"bucket_prefix"`
-	BucketForceDestroy           bool                         `hcl:"bucket_force_destroy"`
-	Location                     string                       `hcl:"location"`
-	TriggerLocation              string                       `hcl:"trigger_location"`
-	TFApplyBranches              []string                     `hcl:"tf_apply_branches"`
-	Envs                         map[string]Env               `hcl:"envs"`
-	CommonFolderID               string                       `hcl:"common_folder_id"`
-	CloudbuildV2RepositoryConfig CloudbuildV2RepositoryConfig `hcl:"cloudbuildv2_repository_config"`
-	WorkerPoolID                 string                       `hcl:"workerpool_id"`
-	AccessLevelName              *string                      `hcl:"access_level_name"`
-	ServicePerimeterName         *string                      `hcl:"service_perimeter_name"`
-	ServicePerimeterMode         *string                      `hcl:"service_perimeter_mode"`
-	LoggingBucket                *string                      `hcl:"logging_bucket"`
-	BucketKMSKey                 *string                      `hcl:"bucket_kms_key"`
-	AttestationKMSProject        *string                      `hcl:"attestation_kms_project"`
-	OrgID                        string                       `hcl:"org_id"`
-}
-
-type MultiTenantTfvars struct {
-	Envs                         map[string]Env `hcl:"envs"`
-	Apps                         map[string]App `hcl:"apps"`
-	ServicePerimeterName         *string        `hcl:"service_perimeter_name"`
-	ServicePerimeterMode         string         `hcl:"service_perimeter_mode"`
-	CBPrivateWorkerpoolProjectID string         `hcl:"cb_private_workerpool_project_id"`
-	AccessLevelName              *string        `hcl:"access_level_name"`
-	DeletionProtection           bool           `hcl:"deletion_protection"`
+// CheckString checks if any of the string values in the GlobalTFVars has the given string.
+// Nested structs, maps, lists and pointers are checked, and the inputs found are returned
+// as paths like `envs.production.subnets_self_links[0]`.
+func (g GlobalTFVars) CheckString(s string) []string {
+	return findString(reflect.ValueOf(g), "", s)
 }
 
-type FleetscopeTfvars struct {
-	NamespaceIDs                map[string]string `hcl:"namespace_ids"`
-	RemoteStateBucket           string            `hcl:"remote_state_bucket"`
-	ConfigSyncSecretType        *string           `hcl:"config_sync_secret_type"`
-	ConfigSyncRepositoryURL     *string           `hcl:"config_sync_repository_url"`
-	DisableIstioOnNamespaces    []string          `hcl:"disable_istio_on_namespaces"`
-	ConfigSyncPolicyDir         *string           `hcl:"config_sync_policy_dir"`
-	ConfigSyncBranch            *string           `hcl:"config_sync_branch"`
-	AttestationKMSKey           *string           `hcl:"attestation_kms_key"`
-	AttestationEvaluationMode   string            `hcl:"attestation_evaluation_mode"`
-	EnableKueue                 *bool             `hcl:"enable_kueue"`
-	EnableMulticlusterDiscovery *bool             `hcl:"enable_multicluster_discovery"`
+// findString returns the paths of the string values of v that contain s.
+func findString(v reflect.Value, path, s string) []string {
+	if v.IsValid() && v.Type() == reflect.TypeOf(cty.Value{}) {
+		return findCtyString(v.Interface().(cty.Value), path, s)
+	}
+	inputs := []string{}
+	switch v.Kind() {
+	case reflect.String:
+		if strings.Contains(v.String(), s) {
+			inputs = append(inputs, path)
+		}
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			inputs = append(inputs, findString(v.Elem(), path, s)...)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name, option, _ := strings.Cut(field.Tag.Get("hcl"), ",")
+			fieldPath := joinInputPath(path, name)
+			if option == "remain" {
+				// inputs without a field have the path of their struct
+				fieldPath = path
+			} else if name == "" {
+				fieldPath = joinInputPath(path, field.Name)
+			}
+			inputs = append(inputs, findString(v.Field(i), fieldPath, s)...)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, k := range keys {
+			inputs = append(inputs, findString(v.MapIndex(k), joinInputPath(path, fmt.Sprint(k)), s)...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			inputs = append(inputs, findString(v.Index(i), fmt.Sprintf("%s[%d]", path, i), s)...)
+		}
+	}
+	return inputs
 }
 
-type AppFactoryTfvars struct {
-	CommonFolderID               string                                   `hcl:"common_folder_id"`
-	OrgID                        string                                   `hcl:"org_id"`
-	BillingAccount               string                                   `hcl:"billing_account"`
-	Envs                         map[string]Env                           `hcl:"envs"`
-	BucketPrefix                 string                                   `hcl:"bucket_prefix"`
-	BucketForceDestroy           bool                                     `hcl:"bucket_force_destroy"`
-	Location                     string                                   `hcl:"location"`
-	TriggerLocation              string                                   `hcl:"trigger_location"`
-	TFApplyBranches              []string                                 `hcl:"tf_apply_branches"`
-	RemoteStateBucket            string                                   `hcl:"remote_state_bucket"`
-	Applications                 map[string]map[string]ApplicationService `hcl:"applications"`
-	CloudbuildV2RepositoryConfig CloudbuildV2RepositoryConfig             `hcl:"cloudbuildv2_repository_config"`
-	KMSProjectID                 *string                                  `hcl:"kms_project_id"`
-	ServicePerimeterName         *string                                  `hcl:"service_perimeter_name"`
-	ServicePerimeterMode         string                                   `hcl:"service_perimeter_mode"`
-	InfraProjectAPIs             *[]string                                `hcl:"infra_project_apis"`
+// findCtyString returns the paths of the string values of v, an input without a field, that contain s.
+func findCtyString(v cty.Value, path, s string) []string {
+	inputs := []string{}
+	_ = cty.Walk(v, func(p cty.Path, v cty.Value) (bool, error) {
+		if v.IsKnown() && !v.IsNull() && v.Type() == cty.String && strings.Contains(v.AsString(), s) {
+			inputPath := path
+			for _, step := range p {
+				switch step := step.(type) {
+				case cty.GetAttrStep:
+					inputPath = joinInputPath(inputPath, step.Name)
+				case cty.IndexStep:
+					if step.Key.Type() == cty.String {
+						inputPath = joinInputPath(inputPath, step.Key.AsString())
+					} else {
+						i, _ := step.Key.AsBigFloat().Int64()
+						inputPath = fmt.Sprintf("%s[%d]", inputPath, i)
+					}
+				}
+			}
+			inputs = append(inputs, inputPath)
+		}
+		return true, nil
+	})
+	return inputs
 }
 
-type AppInfraTfvars struct {
-	Region                       string                       `hcl:"region"`
-	BucketsForceDestroy          bool                         `hcl:"buckets_force_destroy"`
-	BucketPrefix                 string                       `hcl:"bucket_prefix"`
-	RemoteStateBucket            string                       `hcl:"remote_state_bucket"`
-	EnvironmentNames             []string                     `hcl:"environment_names"`
-	CloudbuildV2RepositoryConfig CloudbuildV2RepositoryConfig `hcl:"cloudbuildv2_repository_config"`
-	AccessLevelName              *string                      `hcl:"access_level_name"`
-	LoggingBucket                *string                      `hcl:"logging_bucket"`
-	BucketKMSKey                 *string                      `hcl:"bucket_kms_key"`
-	AttestationKMSKey            *string                      `hcl:"attestation_kms_key"`
+func joinInputPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
 }
 
 func GetBootstrapStepOutputs(t testing.TB, eabPath string) BootstrapOutputs {
@@ -304,9 +331,11 @@ func GetBootstrapStepOutputs(t testing.TB, eabPath string) BootstrapOutputs {
 	}
 }
 
-func GetAppInfraStepOutputs(t testing.TB, eabPath string) AppInfraOutputs {
+// GetAppInfraStepOutputs reads the outputs of the 5-appinfra shared environment of a service of an application
+// from the checkout of the service infra repository.
+func GetAppInfraStepOutputs(t testing.TB, repoPath, exampleName, serviceName string) AppInfraOutputs {
 	options := &terraform.Options{
-		TerraformDir: filepath.Join(eabPath, "apps/default-example/hello-world/envs/shared"),
+		TerraformDir: filepath.Join(repoPath, "apps", exampleName, serviceName, "envs", "shared"),
 		Logger:       logger.Discard,
 		NoColor:      true,
 	}
@@ -458,8 +487,9 @@ func GetAppFactoryStepOutputs(t testing.TB, eabPath string) AppFactoryOutputs {
 	return output
 }
 
-// ReadGlobalTFVars reads the tfvars file that has all the configuration for the deploy
-func ReadGlobalTFVars(file string) (GlobalTFVars, error) {
+// ReadGlobalTFVars reads the tfvars file that has all the configuration for the deploy,
+// with the values of the overrides, like -var options and TF_VAR_ environment variables, replacing the values of the file.
+func ReadGlobalTFVars(file string, overrides ...utils.Overrides) (GlobalTFVars, error) {
 	var globalTfvars GlobalTFVars
 	if file == "" {
 		return globalTfvars, fmt.Errorf("tfvars file is required")
@@ -468,7 +498,7 @@ func ReadGlobalTFVars(file string) (GlobalTFVars, error) {
 	if os.IsNotExist(err) {
 		return globalTfvars, fmt.Errorf("tfvars file '%s' does not exits\n", file)
 	}
-	err = utils.ReadTfvars(file, &globalTfvars)
+	err = utils.ReadTfvars(file, &globalTfvars, overrides...)
 	if err != nil {
 		return globalTfvars, fmt.Errorf("Failed to load tfvars file %s. Error: %s\n", file, err.Error())
 	}
@@ -27,7 +27,6 @@ import (
 
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
-	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/test/integration/testutils"
 )
 
 func DestroyBootstrapStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, c CommonConf) error {
@@ -126,6 +125,9 @@ func DestroyAppInfraStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outp
 	var err error
 	for exampleName, services := range tfvars.Applications {
 		for serviceName := range services {
+			if !c.Targets.includesApp(exampleName, serviceName) {
+				continue
+			}
 			appGroupIndex := fmt.Sprintf("%s.%s", exampleName, serviceName)
 			envs := []string{"shared"}
 			cbPathEmail := strings.Split(outputs.AppGroup[appGroupIndex].AppCloudbuildWorkspaceCloudbuildSAEmail, "/")
@@ -138,7 +140,7 @@ func DestroyAppInfraStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outp
 				Repo:          tfvars.InfraCloudbuildV2RepositoryConfig.Repositories[serviceName].RepositoryName,
 				Envs:          envs,
 				LocalSteps:    envs,
-				GroupingUnits: []string{"apps/default-example/hello-world/envs"},
+				GroupingUnits: []string{fmt.Sprintf("apps/%s/%s/envs", exampleName, serviceName)},
 				DefaultRegion: tfvars.TriggerLocation,
 			}
 			err = destroyStage(t, stageConf, s, tfvars, c)
@@ -148,14 +150,14 @@ func DestroyAppInfraStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outp
 }
 
 func destroyStage(t testing.TB, sc StageConf, s steps.Steps, tfvars GlobalTFVars, c CommonConf) error {
-	for _, e := range sc.Envs {
+	for _, e := range c.Targets.filterEnvs(sc.Envs) {
 		err := s.RunDestroyStep(fmt.Sprintf("%s.%s", sc.Repo, e), func() error {
 			for _, g := range sc.GroupingUnits {
 				options := &terraform.Options{
 					TerraformDir:             filepath.Join(c.CheckoutPath, sc.Repo, g, e),
 					Logger:                   c.Logger,
 					NoColor:                  true,
-					RetryableTerraformErrors: testutils.RetryableTransientErrors,
+					RetryableTerraformErrors: c.Wait.Retries.Messages(),
 					MaxRetries:               MaxErrorRetries,
 					TimeBetweenRetries:       TimeBetweenErrorRetries,
 				}
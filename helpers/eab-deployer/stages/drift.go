@@ -0,0 +1,350 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/mitchellh/go-testing-interface"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/gcp"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+const (
+	NoDrift    = "NO_DRIFT"
+	Drifted    = "DRIFTED"
+	DriftError = "ERROR"
+)
+
+// DriftResult is the result of the terraform plan of a Terraform directory of a deployed stage.
+type DriftResult struct {
+	Dir     string
+	Status  string
+	Add     int
+	Change  int
+	Destroy int
+	Error   string
+}
+
+// StageDrift is the drift of a deployed stage.
+// PlanBuilds are the repositories where a plan-only build was opened, with the build result.
+// Skipped is the reason the stage was not checked.
+type StageDrift struct {
+	Stage      string
+	Results    []DriftResult
+	PlanBuilds []string
+	Skipped    string
+}
+
+// DriftReport collects the drift of the deployed stages.
+// If PlanBuilds is true, a plan-only build is opened in the repositories of the stages with drift.
+// It is safe for concurrent use.
+type DriftReport struct {
+	PlanBuilds bool
+	mu         sync.Mutex
+	stages     []StageDrift
+}
+
+// NewDriftReport creates an empty drift report.
+func NewDriftReport(planBuilds bool) *DriftReport {
+	return &DriftReport{PlanBuilds: planBuilds}
+}
+
+// Add adds the drift of a stage to the report.
+func (r *DriftReport) Add(drift StageDrift) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages = append(r.stages, drift)
+}
+
+// Skip records that a stage was not checked and the reason.
+func (r *DriftReport) Skip(stage, reason string) {
+	r.Add(StageDrift{Stage: stage, Skipped: reason})
+}
+
+// Stages returns the drift of the stages in the order they were added.
+func (r *DriftReport) Stages() []StageDrift {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.stages)
+}
+
+// HasDrift returns true if any directory has drift or failed to be planned.
+func (r *DriftReport) HasDrift() bool {
+	for _, st := range r.Stages() {
+		if st.hasDrift() || slices.ContainsFunc(st.Results, func(d DriftResult) bool { return d.Status == DriftError }) {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds the drift of a stage checked without errors to the report.
+func (r *DriftReport) record(drift StageDrift, err error) error {
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		r.Add(drift)
+	}
+	return nil
+}
+
+// Write writes the per-stage drift report to w.
+func (r *DriftReport) Write(w io.Writer) error {
+	var b strings.Builder
+	counts := map[string]int{}
+	b.WriteString("# Drift report\n")
+	for _, st := range r.Stages() {
+		fmt.Fprintf(&b, "## %s\n", st.Stage)
+		if st.Skipped != "" {
+			fmt.Fprintf(&b, "   skipped: %s\n", st.Skipped)
+			continue
+		}
+		for _, d := range st.Results {
+			counts[d.Status]++
+			switch d.Status {
+			case Drifted:
+				fmt.Fprintf(&b, "   %s %s: %d to add, %d to change, %d to destroy\n", d.Status, d.Dir, d.Add, d.Change, d.Destroy)
+			case DriftError:
+				fmt.Fprintf(&b, "   %s %s: %s\n", d.Status, d.Dir, d.Error)
+			default:
+				fmt.Fprintf(&b, "   %s %s\n", d.Status, d.Dir)
+			}
+		}
+		for _, build := range st.PlanBuilds {
+			fmt.Fprintf(&b, "   plan build %s\n", build)
+		}
+	}
+	fmt.Fprintf(&b, "# Total: %d directories with drift, %d without drift, %d failed\n", counts[Drifted], counts[NoDrift], counts[DriftError])
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// hasDrift returns true if any directory of the stage has drift.
+func (st StageDrift) hasDrift() bool {
+	return slices.ContainsFunc(st.Results, func(d DriftResult) bool { return d.Status == Drifted })
+}
+
+// DriftBootstrapStage checks the drift of the local 1-bootstrap stage.
+func DriftBootstrapStage(t testing.TB, c CommonConf) (StageDrift, error) {
+	drift := StageDrift{Stage: BootstrapStageName}
+	d := planDrift(t, bootstrapOptions(c), "")
+	d.Dir = BootstrapStep
+	drift.Results = append(drift.Results, d)
+	return drift, nil
+}
+
+// DriftMultitenantStage checks the drift of the 2-multitenant stage.
+func DriftMultitenantStage(t testing.TB, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) (StageDrift, error) {
+	return driftStage(t, MultitenantStageName, infraDriftConf(tfvars, outputs, "multitenant", slices.Collect(maps.Keys(tfvars.Envs))), c)
+}
+
+// DriftFleetscopeStage checks the drift of the 3-fleetscope stage.
+func DriftFleetscopeStage(t testing.TB, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) (StageDrift, error) {
+	return driftStage(t, FleetscopeStageName, infraDriftConf(tfvars, outputs, "fleetscope", slices.Collect(maps.Keys(tfvars.Envs))), c)
+}
+
+// DriftAppFactoryStage checks the drift of the 4-appfactory stage.
+func DriftAppFactoryStage(t testing.TB, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) (StageDrift, error) {
+	return driftStage(t, AppFactoryStageName, infraDriftConf(tfvars, outputs, "applicationfactory", []string{"shared"}), c)
+}
+
+// DriftAppInfraStage checks the drift of the 5-appinfra stage for the selected services.
+func DriftAppInfraStage(t testing.TB, tfvars GlobalTFVars, outputs AppFactoryOutputs, c CommonConf) (StageDrift, error) {
+	drift := StageDrift{Stage: AppInfraStageName}
+	for _, appGroupIndex := range appInfraServices(tfvars) {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		if !c.Targets.includesApp(exampleName, serviceName) {
+			continue
+		}
+		group := outputs.AppGroup[appGroupIndex]
+		envs := []string{"shared"}
+		if len(group.AppInfraProjectIDs) > 0 {
+			envs = append(envs, slices.Collect(maps.Keys(tfvars.Envs))...)
+		}
+		serviceAccountID := strings.Split(group.AppCloudbuildWorkspaceCloudbuildSAEmail, "/")
+		repo := tfvars.InfraCloudbuildV2RepositoryConfig.Repositories[serviceName].RepositoryName
+		d, err := driftStage(t, AppInfraStageName, StageConf{
+			Stage:         repo,
+			StageSA:       serviceAccountID[len(serviceAccountID)-1],
+			CICDProject:   group.AppAdminProjectID,
+			Repo:          repo,
+			Envs:          envs,
+			GroupingUnits: []string{fmt.Sprintf("apps/%s/%s/envs", exampleName, serviceName)},
+			DefaultRegion: tfvars.TriggerLocation,
+		}, c)
+		drift.Results = append(drift.Results, d.Results...)
+		drift.PlanBuilds = append(drift.PlanBuilds, d.PlanBuilds...)
+		if err != nil {
+			return drift, err
+		}
+	}
+	return drift, nil
+}
+
+// infraDriftConf returns the configuration of the infra repository of a stage deployed by the bootstrap service accounts.
+func infraDriftConf(tfvars GlobalTFVars, outputs BootstrapOutputs, key string, envs []string) StageConf {
+	repo := tfvars.InfraCloudbuildV2RepositoryConfig.Repositories[key].RepositoryName
+	return StageConf{
+		Stage:         repo,
+		StageSA:       outputs.CBServiceAccountsEmails[key],
+		CICDProject:   outputs.ProjectID,
+		Repo:          repo,
+		Envs:          envs,
+		GroupingUnits: []string{"envs"},
+		DefaultRegion: tfvars.TriggerLocation,
+	}
+}
+
+// driftStage runs terraform plan in the environment directories of the checked-out stage repository,
+// using the last commit of the branch of each environment in the remote repository. Nothing is applied.
+// If the report asks for it, a plan-only build is opened when drift is found.
+// The local branches are not changed and the branch checked out before is checked out again.
+func driftStage(t testing.TB, stage string, sc StageConf, c CommonConf) (StageDrift, error) {
+	drift := StageDrift{Stage: stage}
+	conf := utils.GetRepoOnly(t, filepath.Join(c.CheckoutPath, sc.Repo), c.Logger)
+	restore, err := saveCheckout(conf)
+	if err != nil {
+		return drift, err
+	}
+	defer func() {
+		if err := restore(); err != nil {
+			fmt.Printf("# failed to restore the checkout of %s. Error: %s\n", sc.Repo, err.Error())
+		}
+	}()
+	err = conf.Fetch("origin")
+	if err != nil {
+		return drift, err
+	}
+	envs := c.Targets.filterEnvs(sc.Envs)
+	slices.Sort(envs)
+	for _, env := range envs {
+		err := conf.CheckoutDetached(fmt.Sprintf("origin/%s", envBranch(env)))
+		if err != nil {
+			return drift, err
+		}
+		for _, g := range sc.GroupingUnits {
+			options := &terraform.Options{
+				TerraformDir:             filepath.Join(c.CheckoutPath, sc.Repo, g, env),
+				Logger:                   c.Logger,
+				NoColor:                  true,
+				RetryableTerraformErrors: c.Wait.Retries.Messages(),
+				MaxRetries:               MaxErrorRetries,
+				TimeBetweenRetries:       TimeBetweenErrorRetries,
+			}
+			d := planDrift(t, options, sc.StageSA)
+			d.Dir = filepath.Join(sc.Repo, g, env)
+			drift.Results = append(drift.Results, d)
+		}
+	}
+
+	if drift.hasDrift() && c.DriftReport != nil && c.DriftReport.PlanBuilds {
+		g := gcp.NewGCP().WithWaitOptions(c.waitOptions(sc.Stage))
+		status := "SUCCESS"
+		if err := openPlanBuild(t, g, conf, sc, c); err != nil {
+			status = err.Error()
+		}
+		drift.PlanBuilds = append(drift.PlanBuilds, fmt.Sprintf("%s: %s", sc.Repo, status))
+	}
+	return drift, nil
+}
+
+// saveCheckout returns a function that checks out again the current branch of the repository,
+// or the current commit if no branch is checked out.
+func saveCheckout(conf utils.GitRepo) (func() error, error) {
+	branch, err := conf.GetCurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	head, err := conf.GetCommitSha()
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		if branch == "" {
+			return conf.CheckoutDetached(head)
+		}
+		return conf.CheckoutBranch(branch)
+	}, nil
+}
+
+// openPlanBuild pushes an empty commit on top of the plan branch of the remote stage repository, or to a feature branch
+// when changes are promoted with pull requests, and waits for the plan build.
+// The commit is not added to the local plan branch.
+func openPlanBuild(t testing.TB, g gcp.GCP, conf utils.GitRepo, sc StageConf, c CommonConf) error {
+	err := conf.CheckoutDetached("origin/plan")
+	if err != nil {
+		return err
+	}
+	err = conf.CommitEmpty(fmt.Sprintf("Check %s drift", sc.Repo))
+	if err != nil {
+		return err
+	}
+	commitSha, cleanup, err := c.Promotion.pushPlanBuild(c.Context, conf)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	return g.WaitBuildSuccess(c.Context, t, sc.CICDProject, sc.DefaultRegion, sc.Repo, commitSha, fmt.Sprintf("Terraform %s drift plan build Failed.", sc.Repo), BuildTimeout, MaxErrorRetries, TimeBetweenErrorRetries)
+}
+
+// envBranch returns the branch that applies an environment.
+// The shared environment is applied by the production branch.
+func envBranch(env string) string {
+	if env == "shared" {
+		return "production"
+	}
+	return env
+}
+
+// planDrift runs terraform init and plan with detailed exit code in a Terraform directory.
+func planDrift(t testing.TB, options *terraform.Options, serviceAccount string) DriftResult {
+	setImpersonation(t, options, serviceAccount)
+	_, err := terraform.InitE(t, options)
+	if err != nil {
+		return DriftResult{Status: DriftError, Error: err.Error()}
+	}
+	stdout, stderr, exit, err := terraform.RunTerraformCommandAndGetStdOutErrCodeE(t, options, terraform.FormatArgs(options, "plan", "-input=false", "-lock=false", "-detailed-exitcode")...)
+	return driftResult(t, stdout, stderr, exit, err)
+}
+
+// driftResult interprets the output of terraform plan -detailed-exitcode.
+// Exit code 0 means no changes, 2 means changes, and any other code is an error.
+func driftResult(t testing.TB, stdout, stderr string, exit int, err error) DriftResult {
+	switch exit {
+	case terraform.DefaultSuccessExitCode:
+		return DriftResult{Status: NoDrift}
+	case terraform.TerraformPlanChangesPresentExitCode:
+		count, cErr := terraform.GetResourceCountE(t, stdout)
+		if cErr != nil {
+			return DriftResult{Status: Drifted}
+		}
+		return DriftResult{Status: Drifted, Add: count.Add, Change: count.Change, Destroy: count.Destroy}
+	}
+	msg := strings.TrimSpace(stderr)
+	if msg == "" && err != nil {
+		msg = err.Error()
+	}
+	return DriftResult{Status: DriftError, Error: msg}
+}
@@ -0,0 +1,97 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriftResult(t *testing.T) {
+	assert.Equal(t, DriftResult{Status: NoDrift}, driftResult(t, "No changes.", "", 0, nil))
+	assert.Equal(t, DriftResult{Status: Drifted, Add: 1, Change: 2}, driftResult(t, "Plan: 1 to add, 2 to change, 0 to destroy.", "", 2, errors.New("exit status 2")))
+	assert.Equal(t, DriftResult{Status: DriftError, Error: "Error: Invalid provider"}, driftResult(t, "", "Error: Invalid provider\n", 1, errors.New("exit status 1")))
+	assert.Equal(t, DriftResult{Status: DriftError, Error: "terraform not found"}, driftResult(t, "", "", 1, errors.New("terraform not found")))
+}
+
+func TestDriftReport(t *testing.T) {
+	r := NewDriftReport(false)
+	r.Skip(AppSourceStageName, "stage does not support drift detection")
+	assert.False(t, r.HasDrift())
+
+	r.Add(StageDrift{Stage: MultitenantStageName, Results: []DriftResult{
+		{Dir: "eab-multitenant/envs/development", Status: Drifted, Change: 1},
+		{Dir: "eab-multitenant/envs/production", Status: NoDrift},
+	}, PlanBuilds: []string{"eab-multitenant: SUCCESS"}})
+	assert.True(t, r.HasDrift())
+
+	var b strings.Builder
+	assert.NoError(t, r.Write(&b))
+	assert.Equal(t, `# Drift report
+## gcp-appsource-hello-world
+   skipped: stage does not support drift detection
+## gcp-multitenant
+   DRIFTED eab-multitenant/envs/development: 0 to add, 1 to change, 0 to destroy
+   NO_DRIFT eab-multitenant/envs/production
+   plan build eab-multitenant: SUCCESS
+# Total: 1 directories with drift, 1 without drift, 0 failed
+`, b.String())
+
+	var nilReport *DriftReport
+	assert.NoError(t, nilReport.record(StageDrift{}, nil), "records are ignored without a report")
+	assert.ErrorContains(t, r.record(StageDrift{}, errors.New("failed")), "failed")
+}
+
+func TestDriftStageUsesRemoteBranches(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	checkoutPath := t.TempDir()
+	repo := filepath.Join(checkoutPath, "eab-multitenant")
+	other := filepath.Join(t.TempDir(), "other")
+	git := func(args ...string) string {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "--bare", "-b", "main", origin)
+	git("clone", origin, repo)
+	git("-C", repo, "commit", "--allow-empty", "-m", "initial commit")
+	git("-C", repo, "push", "origin", "HEAD:refs/heads/main", "HEAD:refs/heads/development")
+	git("-C", repo, "branch", "development", "HEAD")
+	staleSha := git("-C", repo, "rev-parse", "development")
+
+	// the development branch is updated by someone else
+	git("clone", "-b", "development", origin, other)
+	git("-C", other, "commit", "--allow-empty", "-m", "apply development")
+	git("-C", other, "push", "origin", "development")
+	remoteSha := git("-C", other, "rev-parse", "HEAD")
+
+	sc := StageConf{Repo: "eab-multitenant", Envs: []string{"development"}, GroupingUnits: []string{"envs"}}
+	c := CommonConf{CheckoutPath: checkoutPath, Logger: logger.Discard}
+	drift, err := driftStage(t, MultitenantStageName, sc, c)
+	require.NoError(t, err)
+	require.Len(t, drift.Results, 1)
+	assert.Equal(t, "eab-multitenant/envs/development", drift.Results[0].Dir)
+
+	assert.Contains(t, git("-C", repo, "reflog", "--format=%H"), remoteSha, "the last commit of the remote branch should be planned")
+	assert.Equal(t, "main", git("-C", repo, "branch", "--show-current"), "the original branch should be checked out again")
+	assert.Equal(t, staleSha, git("-C", repo, "rev-parse", "development"), "local branches should not be changed")
+}
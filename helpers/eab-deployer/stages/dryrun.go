@@ -0,0 +1,348 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/mitchellh/go-testing-interface"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+// PlanSummary is the summary of the terraform plan of a local step.
+type PlanSummary struct {
+	Dir     string
+	Add     int
+	Change  int
+	Destroy int
+}
+
+// RepoChanges are the files that would be committed to a stage repository and the branches that would be pushed.
+type RepoChanges struct {
+	Repo     string
+	Files    []string
+	Branches []string
+}
+
+// StageChanges are the changes that a stage would make.
+// Skipped is the reason the stage was not planned.
+type StageChanges struct {
+	Stage   string
+	Plans   []PlanSummary
+	Repos   []RepoChanges
+	Skipped string
+}
+
+// DryRunReport collects the changes of the stages planned in a dry run.
+// It is safe for concurrent use.
+type DryRunReport struct {
+	mu     sync.Mutex
+	stages []StageChanges
+}
+
+// NewDryRunReport creates an empty dry run report.
+func NewDryRunReport() *DryRunReport {
+	return &DryRunReport{}
+}
+
+// Add adds the changes of a stage to the report.
+func (r *DryRunReport) Add(changes StageChanges) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages = append(r.stages, changes)
+}
+
+// Skip records that a stage was not planned and the reason.
+func (r *DryRunReport) Skip(stage, reason string) {
+	r.Add(StageChanges{Stage: stage, Skipped: reason})
+}
+
+// Stages returns the changes of the stages in the order they were added.
+func (r *DryRunReport) Stages() []StageChanges {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.stages)
+}
+
+// record adds the changes of a stage planned without errors to the report.
+func (r *DryRunReport) record(changes StageChanges, err error) error {
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		r.Add(changes)
+	}
+	return nil
+}
+
+// Write writes the per-stage change summary to w.
+func (r *DryRunReport) Write(w io.Writer) error {
+	var b strings.Builder
+	total := PlanSummary{}
+	files := 0
+	b.WriteString("# Dry run summary\n")
+	for _, st := range r.Stages() {
+		fmt.Fprintf(&b, "## %s\n", st.Stage)
+		if st.Skipped != "" {
+			fmt.Fprintf(&b, "   skipped: %s\n", st.Skipped)
+			continue
+		}
+		for _, p := range st.Plans {
+			fmt.Fprintf(&b, "   terraform plan %s: %d to add, %d to change, %d to destroy\n", p.Dir, p.Add, p.Change, p.Destroy)
+			total.Add += p.Add
+			total.Change += p.Change
+			total.Destroy += p.Destroy
+		}
+		for _, repo := range st.Repos {
+			fmt.Fprintf(&b, "   repository %s: %d files to commit, branches to push: %s\n", repo.Repo, len(repo.Files), strings.Join(repo.Branches, ", "))
+			for _, f := range repo.Files {
+				fmt.Fprintf(&b, "     %s\n", f)
+			}
+			files += len(repo.Files)
+		}
+	}
+	fmt.Fprintf(&b, "# Total: %d to add, %d to change, %d to destroy in local steps, %d files to commit\n", total.Add, total.Change, total.Destroy, files)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// PlanBootstrapStage writes the 1-bootstrap tfvars file and runs terraform plan.
+func PlanBootstrapStage(t testing.TB, tfvars GlobalTFVars, c CommonConf) (StageChanges, error) {
+	changes := StageChanges{Stage: BootstrapStageName}
+	err := writeBootstrapTfvars(tfvars, c)
+	if err != nil {
+		return changes, err
+	}
+	plan, err := planLocal(t, bootstrapOptions(c), "")
+	if err != nil {
+		return changes, err
+	}
+	plan.Dir = BootstrapStep
+	changes.Plans = append(changes.Plans, plan)
+	return changes, nil
+}
+
+// PlanMultitenantStage reports the changes of the 2-multitenant stage.
+func PlanMultitenantStage(t testing.TB, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) (StageChanges, error) {
+	sc, err := multitenantStageConf(t, tfvars, outputs, c)
+	if err != nil {
+		return StageChanges{Stage: MultitenantStageName}, err
+	}
+	return dryRunStage(t, MultitenantStageName, sc, c)
+}
+
+// PlanFleetscopeStage reports the changes of the 3-fleetscope stage.
+func PlanFleetscopeStage(t testing.TB, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) (StageChanges, error) {
+	sc, err := fleetscopeStageConf(t, tfvars, outputs, c)
+	if err != nil {
+		return StageChanges{Stage: FleetscopeStageName}, err
+	}
+	return dryRunStage(t, FleetscopeStageName, sc, c)
+}
+
+// PlanAppFactoryStage reports the changes of the 4-appfactory stage.
+func PlanAppFactoryStage(t testing.TB, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) (StageChanges, error) {
+	sc, err := appFactoryStageConf(t, tfvars, outputs, c)
+	if err != nil {
+		return StageChanges{Stage: AppFactoryStageName}, err
+	}
+	return dryRunStage(t, AppFactoryStageName, sc, c)
+}
+
+// PlanAppInfraStage reports the changes of the 5-appinfra stage for all the services.
+func PlanAppInfraStage(t testing.TB, tfvars GlobalTFVars, bootstrapOutputs BootstrapOutputs, outputs AppFactoryOutputs, c CommonConf) (StageChanges, error) {
+	changes := StageChanges{Stage: AppInfraStageName}
+	inputs := appInfraInputs(tfvars, bootstrapOutputs)
+	services := appInfraServices(tfvars)
+	results := make([]StageChanges, len(services))
+	err := steps.RunParallel(services, c.Parallelism, func(appGroupIndex string) error {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		sc := c
+		if c.Parallelism > 1 {
+			sc.Logger = utils.GetPrefixedLogger(c.Logger, appGroupIndex)
+		}
+		stageConf, err := appInfraServiceStageConf(t, tfvars, inputs, exampleName, serviceName, outputs, sc)
+		if err != nil {
+			return fmt.Errorf("%s: %w", appGroupIndex, err)
+		}
+		r, err := dryRunStage(t, AppInfraStageName, stageConf, sc)
+		results[slices.Index(services, appGroupIndex)] = r
+		if err != nil {
+			return fmt.Errorf("%s: %w", appGroupIndex, err)
+		}
+		return nil
+	})
+	for _, r := range results {
+		changes.Plans = append(changes.Plans, r.Plans...)
+		changes.Repos = append(changes.Repos, r.Repos...)
+	}
+	return changes, err
+}
+
+// PlanAppSourceStage reports the changes of the 6-appsource stage for all the services.
+func PlanAppSourceStage(t testing.TB, tfvars GlobalTFVars, appInfraOutputs func(exampleName, serviceName string) AppInfraOutputs, c CommonConf) (StageChanges, error) {
+	changes := StageChanges{Stage: AppSourceStageName}
+	for _, appGroupIndex := range appSourceServices(tfvars) {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		sc, err := appSourceStageConf(t, tfvars, exampleName, serviceName, appInfraOutputs(exampleName, serviceName), c)
+		if err != nil {
+			return changes, err
+		}
+		repoChanges, err := dryRunAppSource(t, sc, c)
+		if err != nil {
+			return changes, err
+		}
+		changes.Repos = append(changes.Repos, repoChanges)
+	}
+	return changes, nil
+}
+
+// dryRunAppSource copies the source code of a service to a copy of its repository and lists the files that would be committed.
+func dryRunAppSource(t testing.TB, sc StageConf, c CommonConf) (RepoChanges, error) {
+	checkoutPath, conf, cleanup, err := copyCheckout(t, sc.Repo, c)
+	if err != nil {
+		return RepoChanges{}, err
+	}
+	defer cleanup()
+	err = conf.CheckoutBranch("main")
+	if err != nil {
+		return RepoChanges{}, err
+	}
+	err = copyAppSourceCode(t, conf, c.EABPath, checkoutPath, sc.Repo, sc.Step, sc.CustomTargetDirPath)
+	if err != nil {
+		return RepoChanges{}, err
+	}
+	files, err := conf.ChangedFiles()
+	if err != nil {
+		return RepoChanges{}, err
+	}
+	return RepoChanges{Repo: sc.Repo, Files: files, Branches: []string{"main"}}, nil
+}
+
+// copyCheckout copies the checkout of a stage repository to a temporary checkout path,
+// so a dry run can copy the stage code and list the changes without modifying the checkout.
+// The returned function removes the copy.
+func copyCheckout(t testing.TB, repo string, c CommonConf) (string, utils.GitRepo, func(), error) {
+	checkoutPath, err := os.MkdirTemp("", "eab-deployer-dry-run-")
+	if err != nil {
+		return "", utils.GitRepo{}, nil, err
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(checkoutPath); err != nil {
+			fmt.Printf("# failed to remove dry run checkout %s. Error: %s\n", checkoutPath, err.Error())
+		}
+	}
+	err = utils.CopyDirectory(filepath.Join(c.CheckoutPath, repo), filepath.Join(checkoutPath, repo))
+	if err != nil {
+		cleanup()
+		return "", utils.GitRepo{}, nil, err
+	}
+	return checkoutPath, utils.GetRepoOnly(t, filepath.Join(checkoutPath, repo), c.Logger), cleanup, nil
+}
+
+// dryRunStage copies the stage code to a copy of the stage repository and runs terraform plan for the local steps,
+// like deployStage, but the changes are reported instead of committed and pushed.
+// The checkout of the stage repository is not modified.
+func dryRunStage(t testing.TB, stage string, sc StageConf, c CommonConf) (StageChanges, error) {
+	changes := StageChanges{Stage: stage}
+	checkoutPath, conf, cleanup, err := copyCheckout(t, sc.Repo, c)
+	if err != nil {
+		return changes, err
+	}
+	defer cleanup()
+	err = conf.CheckoutBranch("plan")
+	if err != nil {
+		return changes, err
+	}
+	err = copyStepCode(t, conf, c.EABPath, checkoutPath, sc.Repo, sc.Step, sc.CustomTargetDirPath, sc.Overlays, sc.Envs, keepLocalChanges)
+	if err != nil {
+		return changes, err
+	}
+
+	if sc.HasLocalStep {
+		for _, bu := range sc.GroupingUnits {
+			for _, localStep := range sc.LocalSteps {
+				buOptions := &terraform.Options{
+					TerraformDir:       filepath.Join(filepath.Join(checkoutPath, sc.Repo), bu, localStep),
+					Logger:             c.Logger,
+					NoColor:            true,
+					MaxRetries:         MaxErrorRetries,
+					TimeBetweenRetries: TimeBetweenErrorRetries,
+				}
+				plan, err := planLocal(t, buOptions, sc.StageSA)
+				if err != nil {
+					return changes, err
+				}
+				plan.Dir = filepath.Join(sc.Repo, bu, localStep)
+				changes.Plans = append(changes.Plans, plan)
+			}
+		}
+	}
+
+	files, err := conf.ChangedFiles()
+	if err != nil {
+		return changes, err
+	}
+	changes.Repos = append(changes.Repos, RepoChanges{
+		Repo:     sc.Repo,
+		Files:    files,
+		Branches: append([]string{"plan"}, envBranches(sc.Envs)...),
+	})
+	return changes, nil
+}
+
+// envBranches returns the branches pushed to apply the given environments.
+// The shared environment is applied by the production branch.
+func envBranches(envs []string) []string {
+	branches := []string{}
+	for _, env := range envs {
+		if b := envBranch(env); !slices.Contains(branches, b) {
+			branches = append(branches, b)
+		}
+	}
+	slices.Sort(branches)
+	return branches
+}
+
+// planLocal runs terraform init and plan in a local step and summarizes the planned changes.
+func planLocal(t testing.TB, options *terraform.Options, serviceAccount string) (PlanSummary, error) {
+	setImpersonation(t, options, serviceAccount)
+	_, err := terraform.InitE(t, options)
+	if err != nil {
+		return PlanSummary{}, err
+	}
+	out, err := terraform.PlanE(t, options)
+	if err != nil {
+		return PlanSummary{}, err
+	}
+	count, err := terraform.GetResourceCountE(t, out)
+	if err != nil {
+		return PlanSummary{}, err
+	}
+	return PlanSummary{
+		Add:     count.Add,
+		Change:  count.Change,
+		Destroy: count.Destroy,
+	}, nil
+}
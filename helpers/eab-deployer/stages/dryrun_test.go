@@ -0,0 +1,64 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunStageKeepsCheckout(t *testing.T) {
+	eabPath := t.TempDir()
+	writeStageCode(t, eabPath, map[string]string{
+		"2-multitenant/envs/development/main.tf": "\n",
+		"build/cloudbuild-tf-apply.yaml":         "\n",
+		"build/cloudbuild-tf-plan.yaml":          "\n",
+		"build/tf-wrapper.sh":                    "^(development|nonproduction|production|shared)$\n",
+		"modules/module/main.tf":                 "\n",
+	})
+	checkoutPath := t.TempDir()
+	repo := filepath.Join(checkoutPath, "eab-multitenant")
+	for _, args := range [][]string{
+		{"init", "-b", "main", repo},
+		{"-C", repo, "commit", "--allow-empty", "-m", "initial commit"},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "local.txt"), []byte("local\n"), 0644))
+
+	sc := StageConf{Stage: "eab-multitenant", Step: MultitenantStep, Repo: "eab-multitenant", Envs: []string{"development"}}
+	c := CommonConf{EABPath: eabPath, CheckoutPath: checkoutPath, Logger: logger.Discard}
+	changes, err := dryRunStage(t, MultitenantStageName, sc, c)
+	require.NoError(t, err)
+	require.Len(t, changes.Repos, 1)
+	assert.Equal(t, []string{"plan", "development"}, changes.Repos[0].Branches)
+	assert.Contains(t, changes.Repos[0].Files, "?? envs/development/main.tf")
+	assert.Contains(t, changes.Repos[0].Files, "?? local.txt")
+
+	// the checkout keeps its branch and files
+	out, err := exec.Command("git", "-C", repo, "status", "--porcelain", "--branch", "--untracked-files=all").CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Equal(t, "## main\n?? local.txt\n", string(out))
+	out, err = exec.Command("git", "-C", repo, "branch", "--list", "plan").CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Empty(t, string(out))
+}
@@ -0,0 +1,237 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	SeverityError   = "ERROR"
+	SeverityWarning = "WARNING"
+	SeverityInfo    = "INFO"
+
+	TextFormat  = "text"
+	JSONFormat  = "json"
+	JUnitFormat = "junit"
+)
+
+// Finding is the result of a validation check that requires attention.
+// CheckID identifies the check, Resource is the input or cloud resource checked,
+// and Remediation describes how to fix the issue. Fix is set for findings that can be fixed with -fix.
+type Finding struct {
+	CheckID     string `json:"check_id"`
+	Severity    string `json:"severity"`
+	Resource    string `json:"resource"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+	Fix         *Fix   `json:"fix,omitempty"`
+}
+
+// newFinding creates a finding with ERROR severity.
+func newFinding(checkID, resource, message, remediation string) Finding {
+	return Finding{
+		CheckID:     checkID,
+		Severity:    SeverityError,
+		Resource:    resource,
+		Message:     message,
+		Remediation: remediation,
+	}
+}
+
+// withSeverity returns a copy of the finding with the given severity.
+func (f Finding) withSeverity(severity string) Finding {
+	f.Severity = severity
+	return f
+}
+
+// String creates a string representation of the finding
+func (f Finding) String() string {
+	s := fmt.Sprintf("[%s] %s %s: %s", f.Severity, f.CheckID, f.Resource, f.Message)
+	if f.Remediation != "" {
+		s = fmt.Sprintf("%s Remediation: %s", s, f.Remediation)
+	}
+	return s
+}
+
+// Validator is a named validation that returns its findings.
+type Validator struct {
+	Name  string
+	Check func() []Finding
+}
+
+// ValidationResult holds the findings of a validator.
+type ValidationResult struct {
+	Validator string    `json:"validator"`
+	Findings  []Finding `json:"findings"`
+}
+
+// ValidationReport holds the results of all the validators executed.
+type ValidationReport struct {
+	Results []ValidationResult `json:"results"`
+}
+
+// RunValidators runs the validators in order and collects their findings.
+func RunValidators(validators []Validator) ValidationReport {
+	report := ValidationReport{}
+	for _, v := range validators {
+		findings := v.Check()
+		if findings == nil {
+			findings = []Finding{}
+		}
+		report.Results = append(report.Results, ValidationResult{Validator: v.Name, Findings: findings})
+	}
+	return report
+}
+
+// Count returns the number of findings with the given severity.
+func (r ValidationReport) Count(severity string) int {
+	count := 0
+	for _, result := range r.Results {
+		for _, f := range result.Findings {
+			if f.Severity == severity {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// HasErrors checks if any finding has ERROR severity.
+func (r ValidationReport) HasErrors() bool {
+	return r.Count(SeverityError) > 0
+}
+
+// ExitCode returns the exit code of the validation, 1 if any finding has ERROR severity and 0 otherwise.
+func (r ValidationReport) ExitCode() int {
+	if r.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+// Write writes the report to w in the given format: text, json or junit.
+func (r ValidationReport) Write(w io.Writer, format string) error {
+	switch format {
+	case TextFormat:
+		return r.WriteText(w)
+	case JSONFormat:
+		return r.WriteJSON(w)
+	case JUnitFormat:
+		return r.WriteJUnit(w)
+	default:
+		return fmt.Errorf("invalid validation report format '%s', valid formats are '%s', '%s' and '%s'", format, TextFormat, JSONFormat, JUnitFormat)
+	}
+}
+
+// WriteText writes the findings as text, one per line.
+func (r ValidationReport) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, result := range r.Results {
+		fmt.Fprintf(&b, "# %s: %d findings\n", result.Validator, len(result.Findings))
+		for _, f := range result.Findings {
+			fmt.Fprintf(&b, "#   %s\n", f)
+		}
+	}
+	fmt.Fprintf(&b, "# Validation finished: %d errors, %d warnings\n", r.Count(SeverityError), r.Count(SeverityWarning))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the report as JSON.
+func (r ValidationReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML.
+// Each validator is a test suite and each finding is a test case, failed if the finding is an error.
+// A validator without findings has a single passed test case.
+func (r ValidationReport) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{Name: "eab-deployer-validate"}
+	for _, result := range r.Results {
+		suite := junitTestSuite{Name: result.Validator}
+		if len(result.Findings) == 0 {
+			suite.TestCases = append(suite.TestCases, junitTestCase{Name: result.Validator, ClassName: result.Validator})
+		}
+		for _, f := range result.Findings {
+			tc := junitTestCase{
+				Name:      fmt.Sprintf("%s %s", f.CheckID, f.Resource),
+				ClassName: result.Validator,
+			}
+			if f.Severity == SeverityError {
+				tc.Failure = &junitFailure{
+					Message: f.Message,
+					Type:    f.CheckID,
+					Text:    f.String(),
+				}
+				suite.Failures++
+			} else {
+				tc.SystemOut = f.String()
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		suite.Tests = len(suite.TestCases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReport() ValidationReport {
+	return RunValidators([]Validator{
+		{Name: "basic-fields", Check: func() []Finding {
+			return []Finding{
+				newFinding("tfvars.required", "project_id", "Input 'project_id' is required.", "Set 'project_id'."),
+				newFinding("tfvars.example", "envs", "Input 'envs' has the example value.", "").withSeverity(SeverityWarning),
+			}
+		}},
+		{Name: "network", Check: func() []Finding { return nil }},
+	})
+}
+
+func TestRunValidators(t *testing.T) {
+	report := testReport()
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, "basic-fields", report.Results[0].Validator)
+	assert.Equal(t, "network", report.Results[1].Validator)
+	assert.Equal(t, []Finding{}, report.Results[1].Findings, "validators without findings should have an empty list")
+	assert.Equal(t, 1, report.Count(SeverityError))
+	assert.Equal(t, 1, report.Count(SeverityWarning))
+	assert.Equal(t, 1, report.ExitCode())
+
+	warnings := RunValidators([]Validator{
+		{Name: "network", Check: func() []Finding {
+			return []Finding{newFinding("network.range", "subnet", "Small range.", "").withSeverity(SeverityWarning)}
+		}},
+	})
+	assert.False(t, warnings.HasErrors())
+	assert.Equal(t, 0, warnings.ExitCode(), "warnings should not fail the validation")
+}
+
+func TestWriteText(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, testReport().Write(&b, TextFormat))
+	assert.Equal(t, `# basic-fields: 2 findings
+#   [ERROR] tfvars.required project_id: Input 'project_id' is required. Remediation: Set 'project_id'.
+#   [WARNING] tfvars.example envs: Input 'envs' has the example value.
+# network: 0 findings
+# Validation finished: 1 errors, 1 warnings
+`, b.String())
+
+	assert.ErrorContains(t, testReport().Write(&b, "yaml"), "invalid validation report format 'yaml'")
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, testReport().Write(&b, JSONFormat))
+
+	var report ValidationReport
+	require.NoError(t, json.Unmarshal([]byte(b.String()), &report))
+	assert.Equal(t, testReport(), report)
+	assert.Contains(t, b.String(), `"check_id": "tfvars.required"`)
+	assert.Contains(t, b.String(), `"findings": []`)
+	assert.NotContains(t, b.String(), `"remediation": ""`, "empty remediations should be omitted")
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, testReport().Write(&b, JUnitFormat))
+	assert.True(t, strings.HasPrefix(b.String(), `<?xml version="1.0" encoding="UTF-8"?>`))
+
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal([]byte(b.String()), &suites))
+	assert.Equal(t, 3, suites.Tests)
+	assert.Equal(t, 1, suites.Failures)
+	require.Len(t, suites.Suites, 2)
+
+	basic := suites.Suites[0]
+	assert.Equal(t, "basic-fields", basic.Name)
+	require.Len(t, basic.TestCases, 2)
+	assert.Equal(t, "tfvars.required project_id", basic.TestCases[0].Name)
+	require.NotNil(t, basic.TestCases[0].Failure)
+	assert.Equal(t, "tfvars.required", basic.TestCases[0].Failure.Type)
+	assert.Nil(t, basic.TestCases[1].Failure, "warnings should not fail")
+	assert.Contains(t, basic.TestCases[1].SystemOut, "[WARNING] tfvars.example")
+
+	network := suites.Suites[1]
+	assert.Equal(t, 1, network.Tests, "validators without findings should have a passed test case")
+	assert.Equal(t, 0, network.Failures)
+	assert.Nil(t, network.TestCases[0].Failure)
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/go-testing-interface"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/gcp"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/msg"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/scm"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
+)
+
+const (
+	fixStepPrefix = "fix"
+)
+
+// Fix is the remediation of a finding.
+// Command is the gcloud command equivalent to the remediation.
+// Manual fixes are not applied by the helper, the command is printed to be executed by someone with the required access.
+type Fix struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Command     string `json:"command"`
+	Manual      bool   `json:"manual,omitempty"`
+	apply       func(t testing.TB) error
+}
+
+// withFix returns a copy of the finding with the given fix.
+func (f Finding) withFix(fix *Fix) Finding {
+	f.Fix = fix
+	return f
+}
+
+// enableAPIFix enables a missing API in a project.
+func enableAPIFix(project, api string) *Fix {
+	return &Fix{
+		ID:          fmt.Sprintf("enable-api.%s.%s", project, api),
+		Description: fmt.Sprintf("enable API %s in project %s", api, project),
+		Command:     fmt.Sprintf("gcloud services enable %s --project %s", api, project),
+		apply: func(t testing.TB) error {
+			gcp.NewGCP().EnableApis(t, project, []string{api})
+			return nil
+		},
+	}
+}
+
+// privateAccessFix enables Private Google Access in a subnet.
+func privateAccessFix(project, region, subnet string) *Fix {
+	return &Fix{
+		ID:          fmt.Sprintf("private-google-access.%s.%s.%s", project, region, subnet),
+		Description: fmt.Sprintf("enable Private Google Access in subnet %s", subnet),
+		Command:     fmt.Sprintf("gcloud compute networks subnets update %s --region=%s --project=%s --enable-private-ip-google-access", subnet, region, project),
+		apply: func(t testing.TB) error {
+			gcp.NewGCP().EnablePrivateGoogleAccess(t, project, region, subnet)
+			return nil
+		},
+	}
+}
+
+// iamBindingFix prints the IAM binding that grants a missing role on a project, folder or organization.
+func iamBindingFix(parent, member, role string) *Fix {
+	kind, id, _ := strings.Cut(parent, "/")
+	command := ""
+	switch kind {
+	case "projects":
+		command = fmt.Sprintf("gcloud projects add-iam-policy-binding %s --member=%s --role=%s", id, member, role)
+	case "organizations":
+		command = fmt.Sprintf("gcloud organizations add-iam-policy-binding %s --member=%s --role=%s", id, member, role)
+	default:
+		command = fmt.Sprintf("gcloud resource-manager folders add-iam-policy-binding %s --member=%s --role=%s", id, member, role)
+	}
+	return &Fix{
+		ID:          fmt.Sprintf("iam-binding.%s.%s", strings.ReplaceAll(parent, "/", "-"), role),
+		Description: fmt.Sprintf("grant role %s on %s to %s", role, parent, member),
+		Command:     command,
+		Manual:      true,
+	}
+}
+
+// iamMember returns the IAM member of a gcloud account.
+func iamMember(account string) string {
+	if strings.HasSuffix(account, ".gserviceaccount.com") {
+		return "serviceAccount:" + account
+	}
+	return "user:" + account
+}
+
+// ApplyFixes applies the remediation of the findings that have a fix, asking for confirmation unless the prompt is disabled.
+// Each remediation is recorded as a step, so a remediation already applied is not applied again.
+// Manual remediations are not applied nor recorded, they are printed on every run while the finding is reported.
+func ApplyFixes(ctx context.Context, t testing.TB, s steps.Steps, report ValidationReport, disablePrompt bool) error {
+	for _, result := range report.Results {
+		for _, f := range result.Findings {
+			if f.Fix == nil {
+				continue
+			}
+			fix := f.Fix
+			if fix.Manual {
+				fmt.Println("")
+				fmt.Printf("# Manual remediation required: %s\n", fix.Description)
+				fmt.Printf("# %s\n", fix.Command)
+				continue
+			}
+			err := s.RunStep(fmt.Sprintf("%s.%s", fixStepPrefix, fix.ID), func() error {
+				if err := msg.ConfirmFix(ctx, fix.Description, fix.Command, disablePrompt); err != nil {
+					return err
+				}
+				return fix.apply(t)
+			})
+			if err != nil {
+				return fmt.Errorf("remediation of '%s' failed: %w", f.CheckID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// createRepositoryFix creates a missing private repository with the API of its provider.
+func createRepositoryFix(provider scm.Provider, repoURL, path string) *Fix {
+	return &Fix{
+		ID:          fmt.Sprintf("create-repository.%s", strings.ReplaceAll(path, "/", "-")),
+		Description: fmt.Sprintf("create private repository %s", repoURL),
+		Command:     fmt.Sprintf("create the private repository %s in the repository host", repoURL),
+		apply: func(t testing.TB) error {
+			return provider.CreateRepository(context.Background(), path)
+		},
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	gotest "github.com/mitchellh/go-testing-interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
+)
+
+func testFix(id string, applied *[]string, err error) *Fix {
+	return &Fix{
+		ID:          id,
+		Description: fmt.Sprintf("fix %s", id),
+		Command:     fmt.Sprintf("gcloud fix %s", id),
+		apply: func(t gotest.TB) error {
+			*applied = append(*applied, id)
+			return err
+		},
+	}
+}
+
+func TestApplyFixes(t *testing.T) {
+	s, err := steps.LoadSteps(filepath.Join(t.TempDir(), "steps.json"))
+	require.NoError(t, err)
+	require.NoError(t, s.CompleteStep("fix.done"))
+
+	applied := []string{}
+	report := RunValidators([]Validator{
+		{Name: "fixes", Check: func() []Finding {
+			return []Finding{
+				newFinding("apis.enabled", "prj-a", "API not enabled.", "").withFix(testFix("apply", &applied, nil)),
+				newFinding("apis.enabled", "prj-b", "API not enabled.", "").withFix(testFix("done", &applied, nil)),
+				newFinding("tfvars.required", "project_id", "Input is required.", "Set it."),
+				newFinding("permissions.role", "projects/prj-a", "Missing role.", "").withFix(iamBindingFix("projects/prj-a", "user:a@example.com", "roles/owner")),
+			}
+		}},
+	})
+
+	require.NoError(t, ApplyFixes(context.Background(), t, s, report, true))
+	assert.Equal(t, []string{"apply"}, applied, "only fixes not completed before should be applied")
+	assert.True(t, s.IsStepComplete("fix.apply"), "applied fixes should be recorded")
+	assert.True(t, s.IsStepComplete("fix.done"))
+	manual := "fix.iam-binding.projects-prj-a.roles/owner"
+	assert.False(t, s.StepExists(manual), "manual fixes should not be recorded")
+
+	// a second run skips the applied fixes and prints the manual fix again
+	require.NoError(t, ApplyFixes(context.Background(), t, s, report, true))
+	assert.Equal(t, []string{"apply"}, applied)
+	assert.False(t, s.StepExists(manual))
+}
+
+func TestApplyFixesFailure(t *testing.T) {
+	s, err := steps.LoadSteps(filepath.Join(t.TempDir(), "steps.json"))
+	require.NoError(t, err)
+
+	applied := []string{}
+	report := RunValidators([]Validator{
+		{Name: "fixes", Check: func() []Finding {
+			return []Finding{
+				newFinding("apis.enabled", "prj-a", "API not enabled.", "").withFix(testFix("fail", &applied, fmt.Errorf("permission denied"))),
+				newFinding("apis.enabled", "prj-b", "API not enabled.", "").withFix(testFix("next", &applied, nil)),
+			}
+		}},
+	})
+
+	err = ApplyFixes(context.Background(), t, s, report, true)
+	assert.ErrorContains(t, err, "remediation of 'apis.enabled' failed: permission denied")
+	assert.Equal(t, []string{"fail"}, applied, "remediation should stop at the first failure")
+	assert.False(t, s.IsStepComplete("fix.fail"))
+	assert.Equal(t, "permission denied", s.GetStepError("fix.fail"))
+}
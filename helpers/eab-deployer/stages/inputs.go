@@ -0,0 +1,223 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+// StageInputs are the values of the variables of a stage that are not global inputs, like the outputs of the previous stages.
+// A nil value, like a nil pointer, is a variable without value.
+type StageInputs map[string]any
+
+// inputMappings are the global inputs of the variables of the stages with a different name, by step.
+var inputMappings = map[string]map[string]string{
+	BootstrapStep: {
+		"cloudbuildv2_repository_config": "infra_cloudbuildv2_repository_config",
+	},
+	AppFactoryStep: {
+		"cloudbuildv2_repository_config": "infra_cloudbuildv2_repository_config",
+	},
+	AppInfraStep: {
+		"cloudbuildv2_repository_config": "app_services_cloudbuildv2_repository_config",
+		"buckets_force_destroy":          "bucket_force_destroy",
+	},
+}
+
+// stageVariables returns the variables of the Terraform code of a stage, in dir and in its envs directories.
+// A variable is required if it is required in any of the directories.
+func stageVariables(dir string) ([]utils.Variable, error) {
+	envDirs, err := filepath.Glob(filepath.Join(dir, "envs", "*"))
+	if err != nil {
+		return nil, err
+	}
+	variables := []utils.Variable{}
+	for _, d := range append([]string{dir}, envDirs...) {
+		declared, err := utils.ReadVariables(d)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range declared {
+			i := slices.IndexFunc(variables, func(s utils.Variable) bool { return s.Name == v.Name })
+			if i < 0 {
+				variables = append(variables, v)
+			} else {
+				variables[i].Required = variables[i].Required || v.Required
+			}
+		}
+	}
+	if len(variables) == 0 {
+		return nil, fmt.Errorf("no variables found in the Terraform code of %s", dir)
+	}
+	return variables, nil
+}
+
+// stageTfvars returns the values of the variables of a stage and the required variables without value.
+// The value of a variable is the stage input, the global input mapped to it, or the global input with the same name.
+func stageTfvars(variables []utils.Variable, step string, tfvars GlobalTFVars, inputs StageInputs) (map[string]cty.Value, []string, error) {
+	values := map[string]cty.Value{}
+	missing := []string{}
+	for _, v := range variables {
+		var value any
+		var ok bool
+		if value, ok = inputs[v.Name]; !ok {
+			input := v.Name
+			if mapped, found := inputMappings[step][v.Name]; found {
+				input = mapped
+			}
+			value, ok = globalInput(tfvars, input)
+		}
+		if ok {
+			val, hasValue, err := inputValue(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to convert the value of variable %s of stage %s: %w", v.Name, step, err)
+			}
+			if hasValue {
+				values[v.Name] = val
+				continue
+			}
+		}
+		if v.Required {
+			missing = append(missing, v.Name)
+		}
+	}
+	return values, missing, nil
+}
+
+// writeStageTfvars writes the terraform.tfvars file of a stage, in dir, with the values of the variables of its Terraform code.
+// Required variables without value are reported, Terraform fails to plan the stage without them.
+// Variables set by hand in an existing file are kept, see utils.WriteTfvarsValues.
+func writeStageTfvars(dir, step string, tfvars GlobalTFVars, inputs StageInputs) error {
+	variables, err := stageVariables(dir)
+	if err != nil {
+		return err
+	}
+	values, missing, err := stageTfvars(variables, step, tfvars, inputs)
+	if err != nil {
+		return err
+	}
+	for _, name := range missing {
+		fmt.Printf("# required variable %s of stage %s has no value, add input %s to the tfvars file\n", name, step, name)
+	}
+	names := []string{}
+	for _, v := range variables {
+		names = append(names, v.Name)
+	}
+	return utils.WriteTfvarsValues(filepath.Join(dir, "terraform.tfvars"), names, values)
+}
+
+// globalInput returns the value of a global input, a field of GlobalTFVars or an input without a field, by name.
+func globalInput(tfvars GlobalTFVars, name string) (any, bool) {
+	v := reflect.ValueOf(tfvars)
+	for i := 0; i < v.NumField(); i++ {
+		if tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("hcl"), ","); tag != "" && tag == name {
+			return v.Field(i).Interface(), true
+		}
+	}
+	value, ok := tfvars.Extra[name]
+	return value, ok
+}
+
+// inputValue converts the Go value of an input, false is returned for nil values, like nil pointers.
+func inputValue(value any) (cty.Value, bool, error) {
+	if v, ok := value.(cty.Value); ok {
+		return v, true, nil
+	}
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return cty.NilVal, false, nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return cty.NilVal, false, nil
+	}
+	ty, err := gocty.ImpliedType(rv.Interface())
+	if err != nil {
+		return cty.NilVal, false, err
+	}
+	v, err := gocty.ToCtyValue(rv.Interface(), ty)
+	return v, err == nil, err
+}
+
+// stageCode is the Terraform code of a stage checked by ValidateStageVariables.
+type stageCode struct {
+	step   string
+	name   string
+	dir    string
+	inputs func() (StageInputs, error)
+}
+
+// ValidateStageVariables checks that the required variables of the Terraform code of the stages,
+// in the blueprint code, have a value in the tfvars file or in the outputs of the previous stages.
+// Stages whose code is not found, like the app infra code of a service of an example, are not checked.
+func ValidateStageVariables(g GlobalTFVars) []Finding {
+	stages := []stageCode{
+		{BootstrapStep, BootstrapStep, filepath.Join(g.EABCodePath, BootstrapStep), func() (StageInputs, error) { return bootstrapInputs(g) }},
+		{MultitenantStep, MultitenantStep, filepath.Join(g.EABCodePath, MultitenantStep), func() (StageInputs, error) { return multitenantInputs(g) }},
+		{FleetscopeStep, FleetscopeStep, filepath.Join(g.EABCodePath, FleetscopeStep), func() (StageInputs, error) { return fleetscopeInputs(BootstrapOutputs{}), nil }},
+		{AppFactoryStep, AppFactoryStep, filepath.Join(g.EABCodePath, AppFactoryStep), func() (StageInputs, error) { return appFactoryInputs(g, BootstrapOutputs{}), nil }},
+	}
+	for _, appGroupIndex := range appInfraServices(g) {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		stages = append(stages, stageCode{
+			step:   AppInfraStep,
+			name:   AppInfraStep + "." + appGroupIndex,
+			dir:    filepath.Join(g.EABCodePath, AppInfraStep, "apps", exampleName, serviceName, "envs", "shared"),
+			inputs: func() (StageInputs, error) { return appInfraInputs(g, BootstrapOutputs{}), nil },
+		})
+	}
+
+	findings := []Finding{}
+	for _, s := range stages {
+		if _, err := os.Stat(s.dir); err != nil {
+			continue
+		}
+		variables, err := stageVariables(s.dir)
+		if err != nil {
+			findings = append(findings, newFinding("stages.variables", s.name,
+				fmt.Sprintf("Failed to read the variables of the Terraform code in '%s': %s", s.dir, err.Error()),
+				"Check the Terraform code of the stage in the blueprint code."))
+			continue
+		}
+		// invalid inputs used by the stage inputs are reported by the schema validation
+		inputs, err := s.inputs()
+		if err != nil {
+			continue
+		}
+		_, missing, err := stageTfvars(variables, s.step, g, inputs)
+		if err != nil {
+			findings = append(findings, newFinding("stages.variables", s.name, err.Error(), "Check the type of the input in the tfvars file."))
+			continue
+		}
+		for _, name := range missing {
+			findings = append(findings, newFinding("stages.variables", s.name+"."+name,
+				fmt.Sprintf("Required variable '%s' of the Terraform code in '%s' has no value.", name, s.dir),
+				fmt.Sprintf("Add input '%s' to the tfvars file, it is passed to the stages that declare it.", name)).withSeverity(SeverityWarning))
+		}
+	}
+	return findings
+}
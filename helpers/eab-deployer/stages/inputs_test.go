@@ -0,0 +1,151 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+func writeStageCode(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func TestWriteStageTfvars(t *testing.T) {
+	dir := t.TempDir()
+	writeStageCode(t, dir, map[string]string{
+		"envs/shared/variables.tf": `
+variable "remote_state_bucket" {}
+variable "cloudbuildv2_repository_config" {}
+variable "buckets_force_destroy" {
+  default = false
+}
+variable "region" {}
+variable "bucket_kms_key" {
+  default = null
+}
+variable "custom_input" {}
+variable "missing_input" {}
+`,
+	})
+	g := readValidTFVars(t)
+	g.Extra = map[string]cty.Value{"custom_input": cty.StringVal("custom")}
+	g.BucketKMSKey = nil
+
+	sharedDir := filepath.Join(dir, "envs", "shared")
+	variables, err := stageVariables(sharedDir)
+	assert.NoError(t, err)
+	values, missing, err := stageTfvars(variables, AppInfraStep, g, appInfraInputs(g, BootstrapOutputs{StateBucket: "state-bucket"}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing_input"}, missing)
+	assert.Equal(t, cty.StringVal("state-bucket"), values["remote_state_bucket"])
+	assert.Equal(t, cty.True, values["buckets_force_destroy"], "mapped from bucket_force_destroy")
+	assert.Equal(t, cty.StringVal(g.Region), values["region"])
+	assert.Equal(t, cty.StringVal("custom"), values["custom_input"])
+	assert.Equal(t, cty.StringVal(g.AppServicesCloudbuildV2RepositoryConfig.RepoType), values["cloudbuildv2_repository_config"].GetAttr("repo_type"))
+	assert.NotContains(t, values, "bucket_kms_key", "nil inputs should not have a value")
+
+	assert.NoError(t, writeStageTfvars(sharedDir, AppInfraStep, g, appInfraInputs(g, BootstrapOutputs{StateBucket: "state-bucket"})))
+	var written struct {
+		RemoteStateBucket string               `hcl:"remote_state_bucket"`
+		Region            string               `hcl:"region"`
+		Extra             map[string]cty.Value `hcl:",remain"`
+	}
+	assert.NoError(t, utils.ReadTfvars(filepath.Join(sharedDir, "terraform.tfvars"), &written))
+	assert.Equal(t, "state-bucket", written.RemoteStateBucket)
+	assert.Equal(t, g.Region, written.Region)
+	assert.Contains(t, written.Extra, "custom_input")
+	assert.NotContains(t, written.Extra, "missing_input")
+
+	_, err = stageVariables(t.TempDir())
+	assert.ErrorContains(t, err, "no variables found")
+}
+
+func TestWriteStageTfvarsKeepsHandSetVariables(t *testing.T) {
+	dir := t.TempDir()
+	writeStageCode(t, dir, map[string]string{
+		"variables.tf": `
+variable "region" {}
+variable "custom_input" {
+  default = null
+}
+variable "log_level" {
+  default = "INFO"
+}
+`,
+		"terraform.tfvars": `log_level = "DEBUG"
+`,
+	})
+	g := readValidTFVars(t)
+	g.Extra = map[string]cty.Value{"custom_input": cty.StringVal("custom")}
+	assert.NoError(t, writeStageTfvars(dir, FleetscopeStep, g, StageInputs{}))
+
+	// custom_input was written from the global inputs, it is removed when the input is removed
+	g.Extra = nil
+	assert.NoError(t, writeStageTfvars(dir, FleetscopeStep, g, StageInputs{}))
+	var written struct {
+		Region string               `hcl:"region"`
+		Extra  map[string]cty.Value `hcl:",remain"`
+	}
+	assert.NoError(t, utils.ReadTfvars(filepath.Join(dir, "terraform.tfvars"), &written))
+	assert.Equal(t, g.Region, written.Region)
+	assert.Equal(t, map[string]cty.Value{"log_level": cty.StringVal("DEBUG")}, written.Extra, "the optional variable set by hand should be kept")
+}
+
+func TestStageVariablesOfEnvs(t *testing.T) {
+	dir := t.TempDir()
+	writeStageCode(t, dir, map[string]string{
+		"envs/development/variables.tf": `
+variable "envs" {}
+variable "deletion_protection" {
+  default = true
+}
+`,
+		"envs/production/variables.tf": `
+variable "envs" {}
+variable "deletion_protection" {}
+`,
+	})
+	variables, err := stageVariables(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Variable{
+		{Name: "envs", Required: true},
+		{Name: "deletion_protection", Required: true},
+	}, variables)
+}
+
+func TestValidateStageVariables(t *testing.T) {
+	g := readValidTFVars(t)
+	g.EABCodePath = t.TempDir()
+	assert.Empty(t, ValidateStageVariables(g), "stages without code should not be checked")
+
+	writeStageCode(t, g.EABCodePath, map[string]string{
+		"3-fleetscope/envs/development/variables.tf":                      `variable "remote_state_bucket" {}` + "\n" + `variable "fleet_input" {}`,
+		"5-appinfra/apps/default-example/hello-world/envs/shared/main.tf": `variable "environment_names" {}` + "\n" + `variable "service_input" {}`,
+	})
+	assert.Equal(t, []string{
+		"stages.variables 3-fleetscope.fleet_input",
+		"stages.variables 5-appinfra.default-example.hello-world.service_input",
+	}, checkIDs(ValidateStageVariables(g)))
+}
@@ -0,0 +1,299 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+const (
+	// ProfilesDir is the directory of the blueprint code with the examples that can be selected as profiles.
+	ProfilesDir = "examples"
+
+	// profileTFVarsFile is the file, in the root of an overlay, with the inputs of the example.
+	profileTFVarsFile = "terraform.tfvars"
+)
+
+// profileSteps are the steps with example overlays.
+var profileSteps = []string{FleetscopeStep, AppFactoryStep, AppInfraStep, AppSourceStep}
+
+// Profile is an example of the blueprint, in examples/<name>, deployed with the stages.
+// The directories of the example named after a step, like examples/cymbal-bank/3-fleetscope, are overlays merged with the code of the step.
+// The terraform.tfvars file in the root of an overlay has the inputs of the example, like its applications, that replace the global inputs.
+// Overlays are relative to the blueprint code, by step. The zero Profile has no overlays.
+type Profile struct {
+	Name     string
+	Overlays map[string]string
+}
+
+// Overlay is a directory merged with the code of a step in a stage repository, Dest is relative to the repository.
+type Overlay struct {
+	Src  string
+	Dest string
+}
+
+// LoadProfile loads the profile of the example with the given name in the blueprint code.
+// An empty name returns the zero Profile.
+func LoadProfile(eabPath, name string) (Profile, error) {
+	if name == "" {
+		return Profile{}, nil
+	}
+	profiles, err := ListProfiles(eabPath)
+	if err != nil {
+		return Profile{}, err
+	}
+	if !slices.Contains(profiles, name) {
+		return Profile{}, fmt.Errorf("unknown profile '%s', valid profiles are: %s", name, strings.Join(profiles, ", "))
+	}
+	p := Profile{Name: name, Overlays: map[string]string{}}
+	for _, step := range profileSteps {
+		dir := filepath.Join(ProfilesDir, name, step)
+		if isDir(filepath.Join(eabPath, dir)) {
+			p.Overlays[step] = dir
+		}
+	}
+	return p, nil
+}
+
+// ListProfiles lists the examples of the blueprint code with at least one overlay, sorted.
+func ListProfiles(eabPath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(eabPath, ProfilesDir))
+	if err != nil {
+		return nil, err
+	}
+	profiles := []string{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if slices.ContainsFunc(profileSteps, func(step string) bool { return isDir(filepath.Join(eabPath, ProfilesDir, e.Name(), step)) }) {
+			profiles = append(profiles, e.Name())
+		}
+	}
+	return profiles, nil
+}
+
+// ApplyTFVars replaces the global inputs with the inputs of the terraform.tfvars files of the overlays
+// and returns the names of the inputs replaced. The infra_project_apis required by the example are added to the global ones.
+// Inputs that are not global inputs, like the repositories of the example, are ignored.
+// Inputs set by the overrides, like -var options and TF_VAR_ environment variables, take precedence and are not replaced.
+func (p Profile) ApplyTFVars(eabPath string, tfvars *GlobalTFVars, overrides ...utils.Overrides) ([]string, error) {
+	applied := []string{}
+	fields := map[string]reflect.Value{}
+	v := reflect.ValueOf(tfvars).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("hcl"), ",")
+		if name != "" {
+			fields[name] = v.Field(i)
+		}
+	}
+	for _, step := range profileSteps {
+		dir, ok := p.Overlays[step]
+		if !ok {
+			continue
+		}
+		file := filepath.Join(eabPath, dir, profileTFVarsFile)
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		f, diags := hclparse.NewParser().ParseHCLFile(file)
+		if diags.HasErrors() {
+			return applied, diags
+		}
+		attrs, diags := f.Body.JustAttributes()
+		if diags.HasErrors() {
+			return applied, diags
+		}
+		for _, name := range sortedKeys(attrs) {
+			field, ok := fields[name]
+			if !ok {
+				fmt.Printf("# profile %s: input %s of %s is not a global input, it is ignored\n", p.Name, name, filepath.Join(dir, profileTFVarsFile))
+				continue
+			}
+			if slices.ContainsFunc(overrides, func(o utils.Overrides) bool { _, ok := o[name]; return ok }) {
+				fmt.Printf("# profile %s: input %s is overridden, the value of %s is ignored\n", p.Name, name, filepath.Join(dir, profileTFVarsFile))
+				continue
+			}
+			value := reflect.New(field.Type())
+			if err := decodeExampleInput(attrs[name].Expr, value.Interface()); err != nil {
+				return applied, fmt.Errorf("failed to decode input %s of %s: %w", name, filepath.Join(dir, profileTFVarsFile), err)
+			}
+			if name == "infra_project_apis" {
+				tfvars.InfraProjectAPIs = mergeAPIs(tfvars.InfraProjectAPIs, value.Elem().Interface().(*[]string))
+			} else {
+				field.Set(value.Elem())
+			}
+			applied = append(applied, name)
+		}
+	}
+	return applied, nil
+}
+
+// decodeExampleInput decodes an input of an example into target. The examples, like Terraform, omit the optional attributes
+// of objects, so all the attributes are optional and the missing ones are null.
+func decodeExampleInput(expr hcl.Expression, target any) error {
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return diags
+	}
+	ty, err := gocty.ImpliedType(target)
+	if err != nil {
+		return err
+	}
+	val, err = convert.Convert(val, optionalAttributes(ty))
+	if err != nil {
+		return err
+	}
+	return gocty.FromCtyValue(val, target)
+}
+
+// optionalAttributes returns ty with all the attributes of its objects, and of the objects it contains, optional.
+func optionalAttributes(ty cty.Type) cty.Type {
+	switch {
+	case ty.IsObjectType():
+		attrs := map[string]cty.Type{}
+		optional := []string{}
+		for name, attrType := range ty.AttributeTypes() {
+			attrs[name] = optionalAttributes(attrType)
+			optional = append(optional, name)
+		}
+		return cty.ObjectWithOptionalAttrs(attrs, optional)
+	case ty.IsMapType():
+		return cty.Map(optionalAttributes(ty.ElementType()))
+	case ty.IsListType():
+		return cty.List(optionalAttributes(ty.ElementType()))
+	case ty.IsSetType():
+		return cty.Set(optionalAttributes(ty.ElementType()))
+	}
+	return ty
+}
+
+// mergeAPIs returns the APIs of global followed by the APIs of example that are not in global.
+func mergeAPIs(global, example *[]string) *[]string {
+	if global == nil || example == nil {
+		return example
+	}
+	apis := slices.Clone(*global)
+	for _, api := range *example {
+		if !slices.Contains(apis, api) {
+			apis = append(apis, api)
+		}
+	}
+	return &apis
+}
+
+// overlays returns the overlays merged with the code of a step, with the root terraform.tfvars file excluded.
+// The service directories of the 5-appinfra overlay, examples/<name>/5-appinfra/<application>/<directory>, are merged
+// in apps/<application>/<service> for the services of the applications.
+func (p Profile) overlays(eabPath, step string, tfvars GlobalTFVars) []Overlay {
+	dir, ok := p.Overlays[step]
+	if !ok {
+		return nil
+	}
+	if step != AppInfraStep {
+		return []Overlay{{Src: dir}}
+	}
+	overlays := []Overlay{}
+	for _, appGroupIndex := range appInfraServices(tfvars) {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		if src := p.appInfraServiceDir(eabPath, exampleName, serviceName); src != "" {
+			overlays = append(overlays, Overlay{Src: src, Dest: filepath.Join("apps", exampleName, serviceName)})
+		}
+	}
+	return overlays
+}
+
+// appInfraServiceDir returns the directory of the 5-appinfra overlay, relative to the blueprint code, with the code of a service,
+// or an empty string if the overlay does not have it. The directories checked are <application>/<service>,
+// <application>/<prefix>-<service>, like cymbal-bank/ledger-balancereader, and <application>, if it has the envs of a single service.
+func (p Profile) appInfraServiceDir(eabPath, exampleName, serviceName string) string {
+	dir, ok := p.Overlays[AppInfraStep]
+	if !ok {
+		return ""
+	}
+	appDir := filepath.Join(dir, exampleName)
+	if isDir(filepath.Join(eabPath, appDir, serviceName)) {
+		return filepath.Join(appDir, serviceName)
+	}
+	matches, _ := filepath.Glob(filepath.Join(eabPath, appDir, "*-"+serviceName))
+	for _, m := range matches {
+		if isDir(m) {
+			return filepath.Join(appDir, filepath.Base(m))
+		}
+	}
+	if isDir(filepath.Join(eabPath, appDir, "envs")) {
+		return appDir
+	}
+	return ""
+}
+
+// appInfraServiceDir returns the directory, relative to the blueprint code, with the 5-appinfra code of a service,
+// in the overlay of the profile or in apps/<application>/<service> of the step code.
+func (c CommonConf) appInfraServiceDir(exampleName, serviceName string) string {
+	if dir := c.Profile.appInfraServiceDir(c.EABPath, exampleName, serviceName); dir != "" {
+		return dir
+	}
+	return filepath.Join(AppInfraStep, "apps", exampleName, serviceName)
+}
+
+// copyOverlays merges the overlays with the code copied to the repository, the files of the overlays replace the files of the step.
+// The terraform.tfvars file in the root of an overlay is not copied, its inputs are applied by ApplyTFVars.
+func copyOverlays(managed *utils.ManagedRepo, eabPath, repoPath string, overlays []Overlay) error {
+	for _, o := range overlays {
+		src := filepath.Join(eabPath, o.Src)
+		dest := filepath.Join(repoPath, o.Dest)
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		// services of the example can be missing in the code of the step
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Name() == profileTFVarsFile {
+				continue
+			}
+			if e.IsDir() {
+				err = managed.CopyDirectory(filepath.Join(src, e.Name()), filepath.Join(dest, e.Name()))
+			} else {
+				err = managed.CopyFile(filepath.Join(src, e.Name()), filepath.Join(dest, e.Name()))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isDir returns true if path is an existing directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,147 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+const exampleTFVars = `
+applications = {
+  "cymbal-bank" = {
+    "balancereader" = {
+      create_infra_project = false
+      create_admin_project = true
+    }
+    "frontend" = {
+      create_infra_project = false
+      create_admin_project = true
+    }
+  }
+}
+infra_project_apis = ["compute.googleapis.com", "sqladmin.googleapis.com"]
+cloudbuildv2_repository_config = {
+  repo_type = "GITHUBv2"
+}
+`
+
+func writeExample(t *testing.T) string {
+	eabPath := t.TempDir()
+	for _, dir := range []string{
+		"examples/cymbal-bank/3-fleetscope/config-sync",
+		"examples/cymbal-bank/4-appfactory",
+		"examples/cymbal-bank/5-appinfra/cymbal-bank/frontend/envs",
+		"examples/cymbal-bank/5-appinfra/cymbal-bank/ledger-balancereader/envs",
+		"examples/hpc/5-appinfra/hpc/envs",
+		"examples/no-overlays",
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(eabPath, dir), 0755))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(eabPath, "examples/cymbal-bank/4-appfactory", profileTFVarsFile), []byte(exampleTFVars), 0644))
+	return eabPath
+}
+
+func TestLoadProfile(t *testing.T) {
+	eabPath := writeExample(t)
+
+	profiles, err := ListProfiles(eabPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cymbal-bank", "hpc"}, profiles)
+
+	p, err := LoadProfile(eabPath, "")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{}, p)
+
+	p, err = LoadProfile(eabPath, "cymbal-bank")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		FleetscopeStep: "examples/cymbal-bank/3-fleetscope",
+		AppFactoryStep: "examples/cymbal-bank/4-appfactory",
+		AppInfraStep:   "examples/cymbal-bank/5-appinfra",
+	}, p.Overlays)
+
+	_, err = LoadProfile(eabPath, "no-overlays")
+	assert.ErrorContains(t, err, "unknown profile 'no-overlays', valid profiles are: cymbal-bank, hpc")
+}
+
+func TestApplyTFVars(t *testing.T) {
+	eabPath := writeExample(t)
+	p, err := LoadProfile(eabPath, "cymbal-bank")
+	assert.NoError(t, err)
+
+	g := readValidTFVars(t)
+	g.InfraProjectAPIs = &[]string{"container.googleapis.com", "compute.googleapis.com"}
+	applied, err := p.ApplyTFVars(eabPath, &g)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"applications", "infra_project_apis"}, applied)
+	assert.Equal(t, []string{"cymbal-bank.balancereader", "cymbal-bank.frontend"}, appInfraServices(g))
+	assert.Equal(t, []string{"container.googleapis.com", "compute.googleapis.com", "sqladmin.googleapis.com"}, *g.InfraProjectAPIs)
+}
+
+func TestApplyTFVarsOverrides(t *testing.T) {
+	eabPath := writeExample(t)
+	p, err := LoadProfile(eabPath, "cymbal-bank")
+	assert.NoError(t, err)
+
+	overrides := []utils.Overrides{{"infra_project_apis": `["container.googleapis.com"]`}}
+	g, err := ReadGlobalTFVars("testdata/valid.tfvars", overrides...)
+	assert.NoError(t, err)
+	applied, err := p.ApplyTFVars(eabPath, &g, overrides...)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"applications"}, applied)
+	assert.Equal(t, []string{"container.googleapis.com"}, *g.InfraProjectAPIs, "overrides should take precedence over the profile")
+}
+
+func TestProfileOverlays(t *testing.T) {
+	eabPath := writeExample(t)
+	p, err := LoadProfile(eabPath, "cymbal-bank")
+	assert.NoError(t, err)
+	g := readValidTFVars(t)
+	g.Applications = map[string]map[string]ApplicationService{
+		"cymbal-bank": {"balancereader": {}, "frontend": {}, "contacts": {}},
+	}
+
+	assert.Equal(t, []Overlay{{Src: "examples/cymbal-bank/3-fleetscope"}}, p.overlays(eabPath, FleetscopeStep, g))
+	assert.Nil(t, p.overlays(eabPath, AppSourceStep, g))
+	assert.Equal(t, []Overlay{
+		{Src: "examples/cymbal-bank/5-appinfra/cymbal-bank/ledger-balancereader", Dest: "apps/cymbal-bank/balancereader"},
+		{Src: "examples/cymbal-bank/5-appinfra/cymbal-bank/frontend", Dest: "apps/cymbal-bank/frontend"},
+	}, p.overlays(eabPath, AppInfraStep, g))
+
+	c := CommonConf{EABPath: eabPath, Profile: p}
+	assert.Equal(t, "5-appinfra/apps/cymbal-bank/contacts", c.appInfraServiceDir("cymbal-bank", "contacts"))
+
+	hpc, err := LoadProfile(eabPath, "hpc")
+	assert.NoError(t, err)
+	assert.Equal(t, "examples/hpc/5-appinfra/hpc", hpc.appInfraServiceDir(eabPath, "hpc", "hpc-team-a"))
+}
+
+func TestCopyOverlays(t *testing.T) {
+	eabPath := writeExample(t)
+	repo := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(eabPath, "examples/cymbal-bank/4-appfactory/main.tf"), []byte("example"), 0644))
+
+	m, err := utils.OpenManagedRepo(repo, func(string) bool { return false })
+	assert.NoError(t, err)
+	assert.NoError(t, copyOverlays(m, eabPath, repo, []Overlay{{Src: "examples/cymbal-bank/4-appfactory", Dest: "envs"}}))
+	assert.FileExists(t, filepath.Join(repo, "envs", "main.tf"))
+	assert.NoFileExists(t, filepath.Join(repo, "envs", profileTFVarsFile))
+}
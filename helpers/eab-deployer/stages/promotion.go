@@ -0,0 +1,324 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mitchellh/go-testing-interface"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/scm"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+const (
+	PromotionTimeout      = 24 * time.Hour
+	PromotionPollInterval = 30 * time.Second
+	// ChecksGracePeriod is the time to wait for the first check of a pull request, the checks of the
+	// Cloud Build triggers start a few seconds after the push. Pull requests without checks after it only wait for the approval.
+	ChecksGracePeriod = 5 * time.Minute
+
+	featureBranchPrefix = "eab-deployer"
+)
+
+// Promotion configures how the changes of a stage are promoted to the plan and environment branches of its repository.
+// With ForcePush, or for Cloud Source repositories, the branches are force-pushed.
+// Otherwise a feature branch is pushed and a pull request is opened to the plan branch, and then from the plan branch
+// to each environment branch, and the pull requests are merged when their checks pass and they are approved.
+type Promotion struct {
+	ForcePush     bool
+	RepoType      string
+	GitlabHostURI string
+	Token         string
+	Client        *http.Client
+	Timeout       time.Duration
+	PollInterval  time.Duration
+	ChecksGrace   time.Duration
+}
+
+// NewPromotion returns the promotion of the infrastructure repositories.
+// The token of the repositories is read from its secret when pull requests are used.
+func NewPromotion(t testing.TB, tfvars GlobalTFVars, forcePush bool, timeout time.Duration) (Promotion, error) {
+	return newPromotion(t, tfvars.InfraCloudbuildV2RepositoryConfig, forcePush, timeout)
+}
+
+// NewAppSourcePromotion returns the promotion of the main branch of the application source repositories.
+func NewAppSourcePromotion(t testing.TB, tfvars GlobalTFVars, forcePush bool, timeout time.Duration) (Promotion, error) {
+	return newPromotion(t, tfvars.AppServicesCloudbuildV2RepositoryConfig, forcePush, timeout)
+}
+
+func newPromotion(t testing.TB, config CloudbuildV2RepositoryConfig, forcePush bool, timeout time.Duration) (Promotion, error) {
+	p := Promotion{
+		ForcePush: forcePush,
+		RepoType:  config.RepoType,
+		Timeout:   timeout,
+	}
+	if !p.usePullRequests() {
+		return p, nil
+	}
+	if config.GitlabEnterpriseHostURI != nil {
+		p.GitlabHostURI = *config.GitlabEnterpriseHostURI
+	}
+	client, err := repositoryClient(config)
+	if err != nil {
+		return Promotion{}, err
+	}
+	p.Client = client
+	p.Token, err = repositoryToken(t, config)
+	if err != nil {
+		return Promotion{}, err
+	}
+	return p, nil
+}
+
+// usePullRequests returns true if the changes are promoted with pull requests.
+func (p Promotion) usePullRequests() bool {
+	return !p.ForcePush && (p.RepoType == scm.GitHubType || p.RepoType == scm.GitLabType)
+}
+
+// promote promotes the commits of the local branch source to the branch target of the remote repository
+// and returns the SHA of the commit built by the target branch trigger.
+// A target branch that does not exist in the remote repository is created with a push, there is nothing to review.
+func (p Promotion) promote(ctx context.Context, conf utils.GitRepo, source, target, title string) (string, error) {
+	if !p.usePullRequests() {
+		if source != target {
+			err := conf.CheckoutBranch(target)
+			if err != nil {
+				return "", err
+			}
+			// an existing environment branch gets the changes planned since it was created
+			err = conf.MergeBranch(source)
+			if err != nil {
+				return "", err
+			}
+		}
+		err := conf.PushBranch(target, "origin")
+		if err != nil {
+			return "", err
+		}
+		return conf.GetCommitSha()
+	}
+
+	err := conf.Fetch("origin")
+	if err != nil {
+		return "", err
+	}
+	exists, err := conf.HasRemoteBranch(target, "origin")
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		err = conf.CheckoutBranch(target)
+		if err != nil {
+			return "", err
+		}
+		if source != target {
+			err = conf.MergeBranch(source)
+			if err != nil {
+				return "", err
+			}
+		}
+		fmt.Printf("# branch %s does not exist in the repository, it is created with the commits of %s\n", target, source)
+		err = conf.PushHead(target, "origin")
+		if err != nil {
+			return "", err
+		}
+		return conf.GetCommitSha()
+	}
+
+	// environment branches are promoted from the reviewed plan branch of the remote repository
+	ref := source
+	if source != target {
+		ref = "origin/" + source
+	}
+	merged, err := conf.IsMerged(ref, "origin/"+target)
+	if err != nil {
+		return "", err
+	}
+	if merged {
+		fmt.Printf("# branch %s already has the commits of %s\n", target, source)
+		err = conf.ResetBranch(target, "origin")
+		if err != nil {
+			return "", err
+		}
+		return conf.GetCommitSha()
+	}
+
+	provider, path, err := p.provider(conf)
+	if err != nil {
+		return "", err
+	}
+	head := source
+	if source == target {
+		head, err = pushFeatureBranch(conf, target)
+		if err != nil {
+			return "", err
+		}
+	}
+	commitSha, err := p.mergePullRequest(ctx, provider, path, head, target, title)
+	if err != nil {
+		return "", err
+	}
+	if head != source {
+		if err := provider.DeleteBranch(ctx, path, head); err != nil {
+			fmt.Printf("# failed to delete branch %s: %s\n", head, err.Error())
+		}
+	}
+	err = conf.Fetch("origin")
+	if err != nil {
+		return "", err
+	}
+	err = conf.ResetBranch(target, "origin")
+	if err != nil {
+		return "", err
+	}
+	return commitSha, nil
+}
+
+// pushFeatureBranch pushes the last commit of the current branch to a new feature branch named after the target branch and the commit.
+func pushFeatureBranch(conf utils.GitRepo, target string) (string, error) {
+	sha, err := conf.GetCommitSha()
+	if err != nil {
+		return "", err
+	}
+	branch := fmt.Sprintf("%s/%s-%s", featureBranchPrefix, target, sha[:7])
+	return branch, conf.PushHead(branch, "origin")
+}
+
+// provider returns the provider of the remote repository of conf and the path of the repository.
+func (p Promotion) provider(conf utils.GitRepo) (scm.Provider, string, error) {
+	remoteURL, err := conf.RemoteURL("origin")
+	if err != nil {
+		return nil, "", err
+	}
+	_, path, err := scm.ParseRepositoryURL(remoteURL)
+	if err != nil {
+		return nil, "", err
+	}
+	provider, err := scm.NewProvider(p.RepoType, remoteURL, p.GitlabHostURI, p.Token, p.Client)
+	return provider, path, err
+}
+
+// mergePullRequest opens a pull request from head to base, or uses the one already open,
+// and returns the SHA of the merge commit once it is merged.
+func (p Promotion) mergePullRequest(ctx context.Context, provider scm.Provider, path, head, base, title string) (string, error) {
+	pr, err := provider.FindPullRequest(ctx, path, head, base)
+	if errors.Is(err, scm.ErrNotFound) {
+		pr, err = provider.CreatePullRequest(ctx, path, head, base, title,
+			fmt.Sprintf("Promotion of %s to %s opened by the Enterprise Application Blueprint deployer.\n\nThe deployer merges it when the checks pass and it is approved.", head, base))
+		if err == nil {
+			fmt.Printf("# opened pull request %s\n", pr.URL)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return p.waitPullRequest(ctx, provider, path, pr)
+}
+
+// waitPullRequest waits for the checks and the approval of a pull request and merges it.
+// A pull request merged by someone else is accepted, a closed pull request or a failed check is an error.
+func (p Promotion) waitPullRequest(ctx context.Context, provider scm.Provider, path string, pr scm.PullRequest) (string, error) {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = PromotionTimeout
+	}
+	interval := p.PollInterval
+	if interval == 0 {
+		interval = PromotionPollInterval
+	}
+	grace := p.ChecksGrace
+	if grace == 0 {
+		grace = ChecksGracePeriod
+	}
+	start := time.Now()
+	deadline := start.Add(timeout)
+	waiting := ""
+	for {
+		status, err := provider.GetPullRequest(ctx, path, pr.Number)
+		if err != nil {
+			return "", err
+		}
+		if status.Checks == scm.ChecksNone {
+			status.Checks = scm.ChecksPending
+			if time.Since(start) >= grace {
+				if waiting != "approval" {
+					fmt.Printf("# no checks were reported for pull request %s after %s, it is merged once approved\n", pr.URL, grace)
+				}
+				status.Checks = scm.ChecksSuccess
+			}
+		}
+		switch {
+		case status.State == scm.PullRequestMerged:
+			return status.MergeCommitSHA, nil
+		case status.State == scm.PullRequestClosed:
+			return "", fmt.Errorf("pull request %s was closed without being merged", pr.URL)
+		case status.Checks == scm.ChecksFailure:
+			return "", fmt.Errorf("checks of pull request %s failed", pr.URL)
+		case status.Checks == scm.ChecksSuccess && status.Approved:
+			fmt.Printf("# merging pull request %s\n", pr.URL)
+			return provider.MergePullRequest(ctx, path, pr.Number)
+		}
+
+		reason := "checks"
+		if status.Checks == scm.ChecksSuccess {
+			reason = "approval"
+		}
+		if reason != waiting {
+			fmt.Printf("# waiting for the %s of pull request %s\n", reason, pr.URL)
+			waiting = reason
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timeout waiting for the %s of pull request %s", reason, pr.URL)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pushPlanBuild pushes the current commit to the plan branch to trigger a plan build and returns the commit SHA.
+// The commit must have the commits of the plan branch of 'origin', it is not force pushed.
+// With pull requests the commit is pushed to a feature branch, that is deleted by the returned function, instead of the plan branch.
+func (p Promotion) pushPlanBuild(ctx context.Context, conf utils.GitRepo) (string, func(), error) {
+	cleanup := func() {}
+	sha, err := conf.GetCommitSha()
+	if err != nil {
+		return "", cleanup, err
+	}
+	if !p.usePullRequests() {
+		return sha, cleanup, conf.PushHead("plan", "origin")
+	}
+	provider, path, err := p.provider(conf)
+	if err != nil {
+		return "", cleanup, err
+	}
+	branch, err := pushFeatureBranch(conf, "plan")
+	if err != nil {
+		return "", cleanup, err
+	}
+	cleanup = func() {
+		if err := provider.DeleteBranch(ctx, path, branch); err != nil {
+			fmt.Printf("# failed to delete branch %s: %s\n", branch, err.Error())
+		}
+	}
+	return sha, cleanup, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/scm"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+// fakeProvider returns the pull request states in order, the last state is returned once the others are consumed.
+type fakeProvider struct {
+	scm.Provider
+	states  []scm.PullRequest
+	created int
+	merged  int
+	gets    int
+}
+
+func (f *fakeProvider) FindPullRequest(ctx context.Context, path, head, base string) (scm.PullRequest, error) {
+	return scm.PullRequest{}, scm.ErrNotFound
+}
+
+func (f *fakeProvider) CreatePullRequest(ctx context.Context, path, head, base, title, body string) (scm.PullRequest, error) {
+	f.created++
+	return scm.PullRequest{Number: 1, URL: "https://github.com/org/infra/pull/1", State: scm.PullRequestOpen}, nil
+}
+
+func (f *fakeProvider) GetPullRequest(ctx context.Context, path string, number int) (scm.PullRequest, error) {
+	f.gets++
+	pr := f.states[0]
+	if len(f.states) > 1 {
+		f.states = f.states[1:]
+	}
+	return pr, nil
+}
+
+func (f *fakeProvider) MergePullRequest(ctx context.Context, path string, number int) (string, error) {
+	f.merged++
+	return "merge-sha", nil
+}
+
+func TestMergePullRequest(t *testing.T) {
+	p := Promotion{RepoType: scm.GitHubType, Timeout: time.Second, PollInterval: time.Millisecond}
+	ctx := context.Background()
+
+	f := &fakeProvider{states: []scm.PullRequest{
+		{State: scm.PullRequestOpen, Checks: scm.ChecksPending},
+		{State: scm.PullRequestOpen, Checks: scm.ChecksSuccess},
+		{State: scm.PullRequestOpen, Checks: scm.ChecksSuccess, Approved: true},
+	}}
+	sha, err := p.mergePullRequest(ctx, f, "org/infra", "plan", "development", "Apply infra to development")
+	require.NoError(t, err)
+	assert.Equal(t, "merge-sha", sha)
+	assert.Equal(t, 1, f.created)
+	assert.Equal(t, 1, f.merged)
+
+	f = &fakeProvider{states: []scm.PullRequest{{State: scm.PullRequestMerged, MergeCommitSHA: "manual-merge-sha"}}}
+	sha, err = p.mergePullRequest(ctx, f, "org/infra", "plan", "development", "Apply infra to development")
+	require.NoError(t, err)
+	assert.Equal(t, "manual-merge-sha", sha, "pull requests merged by someone else are accepted")
+	assert.Equal(t, 0, f.merged)
+
+	f = &fakeProvider{states: []scm.PullRequest{{State: scm.PullRequestOpen, Checks: scm.ChecksFailure, Approved: true}}}
+	_, err = p.mergePullRequest(ctx, f, "org/infra", "plan", "development", "Apply infra to development")
+	assert.ErrorContains(t, err, "checks of pull request https://github.com/org/infra/pull/1 failed")
+	assert.Equal(t, 0, f.merged)
+
+	f = &fakeProvider{states: []scm.PullRequest{{State: scm.PullRequestClosed}}}
+	_, err = p.mergePullRequest(ctx, f, "org/infra", "plan", "development", "Apply infra to development")
+	assert.ErrorContains(t, err, "was closed without being merged")
+
+	// pull requests without checks are merged once approved after the grace period
+	p.ChecksGrace = 5 * time.Millisecond
+	f = &fakeProvider{states: []scm.PullRequest{{State: scm.PullRequestOpen, Checks: scm.ChecksNone, Approved: true}}}
+	sha, err = p.mergePullRequest(ctx, f, "org/infra", "plan", "development", "Apply infra to development")
+	require.NoError(t, err)
+	assert.Equal(t, "merge-sha", sha)
+	assert.Greater(t, f.gets, 1, "the checks should be waited during the grace period")
+
+	p.ChecksGrace = time.Minute
+	p.Timeout = 10 * time.Millisecond
+	f = &fakeProvider{states: []scm.PullRequest{{State: scm.PullRequestOpen, Checks: scm.ChecksNone, Approved: true}}}
+	_, err = p.mergePullRequest(ctx, f, "org/infra", "plan", "development", "Apply infra to development")
+	assert.ErrorContains(t, err, "timeout waiting for the checks")
+	assert.Equal(t, 0, f.merged)
+
+	f = &fakeProvider{states: []scm.PullRequest{{State: scm.PullRequestOpen, Checks: scm.ChecksSuccess}}}
+	_, err = p.mergePullRequest(ctx, f, "org/infra", "plan", "development", "Apply infra to development")
+	assert.ErrorContains(t, err, "timeout waiting for the approval")
+}
+
+func TestPromoteWithoutPullRequest(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	repo := filepath.Join(t.TempDir(), "repo")
+	for _, args := range [][]string{
+		{"init", "--bare", origin},
+		{"init", repo},
+		{"-C", repo, "checkout", "-b", "plan"},
+		{"-C", repo, "remote", "add", "origin", origin},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	conf := utils.GetRepoOnly(t, repo, logger.Discard)
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "main.tf"), []byte("\n"), 0644))
+	require.NoError(t, conf.CommitFiles("add main.tf"))
+	planSha, err := conf.GetCommitSha()
+	require.NoError(t, err)
+
+	// branches that do not exist in the repository are created without pull requests
+	p := Promotion{RepoType: scm.GitHubType}
+	sha, err := p.promote(context.Background(), conf, "plan", "plan", "Plan infra")
+	require.NoError(t, err)
+	assert.Equal(t, planSha, sha)
+	sha, err = p.promote(context.Background(), conf, "plan", "development", "Apply infra to development")
+	require.NoError(t, err)
+	assert.Equal(t, planSha, sha)
+
+	// branches that already have the commits are not promoted again
+	require.NoError(t, conf.CheckoutBranch("plan"))
+	sha, err = p.promote(context.Background(), conf, "plan", "development", "Apply infra to development")
+	require.NoError(t, err)
+	assert.Equal(t, planSha, sha)
+	branch, err := conf.GetCurrentBranch()
+	require.NoError(t, err)
+	assert.Equal(t, "development", branch)
+}
+
+func TestNewAppSourcePromotion(t *testing.T) {
+	g := readValidTFVars(t)
+	g.InfraCloudbuildV2RepositoryConfig.RepoType = scm.GitHubType
+	g.AppServicesCloudbuildV2RepositoryConfig.RepoType = "CSR"
+
+	// the application source repositories are promoted with their own repository config
+	p, err := NewAppSourcePromotion(t, g, false, PromotionTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, "CSR", p.RepoType)
+	assert.False(t, p.usePullRequests())
+
+	g.AppServicesCloudbuildV2RepositoryConfig.RepoType = scm.GitLabType
+	p, err = NewAppSourcePromotion(t, g, true, PromotionTimeout)
+	require.NoError(t, err)
+	assert.False(t, p.usePullRequests(), "force push should not use merge requests")
+}
@@ -0,0 +1,248 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/mitchellh/go-testing-interface"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/msg"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
+)
+
+const (
+	BootstrapStageName   = "gcp-bootstrap"
+	MultitenantStageName = "gcp-multitenant"
+	FleetscopeStageName  = "gcp-fleetscope"
+	AppFactoryStageName  = "gcp-appfactory"
+	AppInfraStageName    = "appinfra-hello-world"
+	AppSourceStageName   = "gcp-appsource-hello-world"
+
+	BootstrapOutputsName  = "bootstrap-outputs"
+	AppFactoryOutputsName = "appfactory-outputs"
+	AppInfraOutputsName   = "appinfra-outputs"
+)
+
+// StageOutputs lazily reads the outputs of the deployed stages.
+// Outputs are read the first time they are requested and reused after that.
+type StageOutputs struct {
+	t      testing.TB
+	tfvars GlobalTFVars
+	c      CommonConf
+
+	mu         sync.Mutex
+	bootstrap  *BootstrapOutputs
+	appFactory *AppFactoryOutputs
+	appInfra   map[string]AppInfraOutputs
+}
+
+// NewStageOutputs creates a lazy reader for the outputs of the deployed stages.
+func NewStageOutputs(t testing.TB, tfvars GlobalTFVars, c CommonConf) *StageOutputs {
+	return &StageOutputs{
+		t:      t,
+		tfvars: tfvars,
+		c:      c,
+	}
+}
+
+// Bootstrap returns the outputs of the 1-bootstrap stage.
+func (o *StageOutputs) Bootstrap() BootstrapOutputs {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.bootstrap == nil {
+		bo := GetBootstrapStepOutputs(o.t, o.c.EABPath)
+		o.bootstrap = &bo
+	}
+	return *o.bootstrap
+}
+
+// AppFactory returns the outputs of the 4-appfactory stage.
+func (o *StageOutputs) AppFactory() AppFactoryOutputs {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.appFactory == nil {
+		repo := o.tfvars.InfraCloudbuildV2RepositoryConfig.Repositories["applicationfactory"].RepositoryName
+		io := GetAppFactoryStepOutputs(o.t, filepath.Join(o.c.CheckoutPath, repo))
+		o.appFactory = &io
+	}
+	return *o.appFactory
+}
+
+// AppInfra returns the outputs of the 5-appinfra stage of a service of an application.
+func (o *StageOutputs) AppInfra(exampleName, serviceName string) AppInfraOutputs {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	appGroupIndex := fmt.Sprintf("%s.%s", exampleName, serviceName)
+	if ao, ok := o.appInfra[appGroupIndex]; ok {
+		return ao
+	}
+	if o.appInfra == nil {
+		o.appInfra = map[string]AppInfraOutputs{}
+	}
+	repo := o.tfvars.InfraCloudbuildV2RepositoryConfig.Repositories[serviceName].RepositoryName
+	ao := GetAppInfraStepOutputs(o.t, filepath.Join(o.c.CheckoutPath, repo), exampleName, serviceName)
+	o.appInfra[appGroupIndex] = ao
+	return ao
+}
+
+// RegisterDefaultStages registers the blueprint stages, 1-bootstrap to 6-appsource, in the given registry.
+// Additional stages can be registered in the same registry depending on these stages.
+func RegisterDefaultStages(t testing.TB, r *steps.Registry, s steps.Steps, tfvars GlobalTFVars, o *StageOutputs, c CommonConf) error {
+	defaultStages := []steps.Stage{
+		{
+			Name:        BootstrapStageName,
+			Description: BootstrapStep,
+			Outputs:     []string{BootstrapOutputsName},
+			Deploy: func() error {
+				msg.PrintStageMsg("Deploying 1-bootstrap stage")
+				return DeployBootstrapStage(t, s, tfvars, c)
+			},
+			Destroy: func() error {
+				msg.PrintStageMsg("Destroying 1-bootstrap stage")
+				return DestroyBootstrapStage(t, s, tfvars, c)
+			},
+			Plan: func() error {
+				return c.DryRunReport.record(PlanBootstrapStage(t, tfvars, c))
+			},
+			Drift: func() error {
+				return c.DriftReport.record(DriftBootstrapStage(t, c))
+			},
+		},
+		{
+			Name:        MultitenantStageName,
+			Description: MultitenantStep,
+			DependsOn:   []string{BootstrapStageName},
+			Inputs:      []string{BootstrapOutputsName},
+			Deploy: func() error {
+				msg.PrintStageMsg("Deploying 2-multitenant stage")
+				return DeployMultitenantStage(t, s, tfvars, o.Bootstrap(), c)
+			},
+			Destroy: func() error {
+				msg.PrintStageMsg("Destroying 2-multitenant stage")
+				return DestroyMultitenantStage(t, s, tfvars, o.Bootstrap(), c)
+			},
+			Plan: func() error {
+				return c.DryRunReport.record(PlanMultitenantStage(t, tfvars, o.Bootstrap(), c))
+			},
+			Drift: func() error {
+				return c.DriftReport.record(DriftMultitenantStage(t, tfvars, o.Bootstrap(), c))
+			},
+			Upgrade: func() error {
+				msg.PrintStageMsg("Upgrading 2-multitenant stage")
+				return UpgradeMultitenantStage(t, s, tfvars, o.Bootstrap(), c)
+			},
+		},
+		{
+			Name:        FleetscopeStageName,
+			Description: FleetscopeStep,
+			DependsOn:   []string{MultitenantStageName},
+			Inputs:      []string{BootstrapOutputsName},
+			Deploy: func() error {
+				msg.PrintStageMsg("Deploying 3-fleetscope stage")
+				return DeployFleetscopeStage(t, s, tfvars, o.Bootstrap(), c)
+			},
+			Destroy: func() error {
+				msg.PrintStageMsg("Destroying 3-fleetscope stage")
+				return DestroyFleetscopeStage(t, s, tfvars, o.Bootstrap(), c)
+			},
+			Plan: func() error {
+				return c.DryRunReport.record(PlanFleetscopeStage(t, tfvars, o.Bootstrap(), c))
+			},
+			Drift: func() error {
+				return c.DriftReport.record(DriftFleetscopeStage(t, tfvars, o.Bootstrap(), c))
+			},
+			Upgrade: func() error {
+				msg.PrintStageMsg("Upgrading 3-fleetscope stage")
+				return UpgradeFleetscopeStage(t, s, tfvars, o.Bootstrap(), c)
+			},
+		},
+		{
+			Name:        AppFactoryStageName,
+			Description: AppFactoryStep,
+			DependsOn:   []string{MultitenantStageName},
+			Inputs:      []string{BootstrapOutputsName},
+			Outputs:     []string{AppFactoryOutputsName},
+			Deploy: func() error {
+				msg.PrintStageMsg("Deploying 4-appfactory stage")
+				bo := o.Bootstrap()
+				if err := msg.ConfirmQuota(c.Context, bo.CBServiceAccountsEmails["applicationfactory"], c.DisablePrompt); err != nil {
+					return err
+				}
+				return DeployAppFactoryStage(t, s, tfvars, bo, c)
+			},
+			Destroy: func() error {
+				msg.PrintStageMsg("Destroying 4-appfactory stage")
+				return DestroyAppFactoryStage(t, s, tfvars, o.Bootstrap(), c)
+			},
+			Plan: func() error {
+				return c.DryRunReport.record(PlanAppFactoryStage(t, tfvars, o.Bootstrap(), c))
+			},
+			Drift: func() error {
+				return c.DriftReport.record(DriftAppFactoryStage(t, tfvars, o.Bootstrap(), c))
+			},
+			Upgrade: func() error {
+				msg.PrintStageMsg("Upgrading 4-appfactory stage")
+				return UpgradeAppFactoryStage(t, s, tfvars, o.Bootstrap(), c)
+			},
+		},
+		{
+			Name:        AppInfraStageName,
+			Description: AppInfraStep,
+			DependsOn:   []string{FleetscopeStageName},
+			Inputs:      []string{BootstrapOutputsName, AppFactoryOutputsName},
+			Outputs:     []string{AppInfraOutputsName},
+			Deploy: func() error {
+				msg.PrintStageMsg("Deploying 5-appinfra stage")
+				return DeployAppInfraStage(t, s, tfvars, o.Bootstrap(), o.AppFactory(), c)
+			},
+			Destroy: func() error {
+				msg.PrintStageMsg("Destroying 5-appinfra stage")
+				return DestroyAppInfraStage(t, s, tfvars, o.AppFactory(), c)
+			},
+			Plan: func() error {
+				return c.DryRunReport.record(PlanAppInfraStage(t, tfvars, o.Bootstrap(), o.AppFactory(), c))
+			},
+			Drift: func() error {
+				return c.DriftReport.record(DriftAppInfraStage(t, tfvars, o.AppFactory(), c))
+			},
+			Upgrade: func() error {
+				msg.PrintStageMsg("Upgrading 5-appinfra stage")
+				return UpgradeAppInfraStage(t, s, tfvars, o.Bootstrap(), o.AppFactory(), c)
+			},
+		},
+		{
+			Name:        AppSourceStageName,
+			Description: AppSourceStep,
+			Inputs:      []string{AppInfraOutputsName},
+			Deploy: func() error {
+				msg.PrintStageMsg("Deploying 6-appsource stage")
+				return DeployAppSourceStage(t, s, tfvars, o.AppInfra, c)
+			},
+			Plan: func() error {
+				return c.DryRunReport.record(PlanAppSourceStage(t, tfvars, o.AppInfra, c))
+			},
+		},
+	}
+
+	for _, stage := range defaultStages {
+		if err := r.Register(stage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-testing-interface"
+)
+
+const (
+	// selfLinkPrefix is the optional prefix of the self links of Compute Engine resources.
+	selfLinkPrefix          = `(?:https://www\.googleapis\.com/compute/v1/)?`
+	workerPoolIDPattern     = `projects/(?P<project>[^/]+)/locations/(?P<location>[^/]+)/workerPools/(?P<workerPool>[^/]+)`
+	kmsKeyPattern           = `projects/(?P<project>[^/]+)/locations/(?P<location>[^/]+)/keyRings/(?P<keyRing>[^/]+)/cryptoKeys/(?P<cryptoKey>[^/]+)`
+	subnetPattern           = selfLinkPrefix + `projects/(?P<project>[^/]+)/regions/(?P<region>[^/]+)/subnetworks/(?P<subnet>[^/]+)`
+	networkPattern          = selfLinkPrefix + `projects/(?P<project>[^/]+)/global/networks/(?P<network>[^/]+)`
+	servicePerimeterPattern = `^accessPolicies/(?P<policy>[^/]+)/servicePerimeters/(?P<perimeter>[^/]+)$`
+	accessLevelPattern      = `^accessPolicies/(?P<policy>[^/]+)/accessLevels/(?P<accessLevel>[^/]+)$`
+)
+
+var (
+	folderIDRegex = regexp.MustCompile(`^folders/[0-9]+$`)
+
+	// infraRepositories are the repositories of the infrastructure stages that are not created per application service.
+	infraRepositories = []string{"multitenant", "fleetscope", "applicationfactory"}
+
+	repoTypes             = []string{"CSR", "GITHUBv2", "GITLABv2"}
+	servicePerimeterModes = []string{"DRY_RUN", "ENFORCE"}
+)
+
+// OfflineValidators returns the validations of the tfvars file that do not call gcloud or Google Cloud APIs.
+// They are executed by the -validate_offline flag.
+func OfflineValidators(t testing.TB, g GlobalTFVars) []Validator {
+	return []Validator{
+		{Name: "basic-fields", Check: func() []Finding { return ValidateBasicFields(t, g) }},
+		{Name: "destroy-flags", Check: func() []Finding { return ValidateDestroyFlags(t, g) }},
+		{Name: "schema", Check: func() []Finding { return ValidateSchema(g) }},
+	}
+}
+
+// ValidateSchema validates the tfvars file without calling gcloud or Google Cloud APIs.
+// It checks the required inputs, the format of the resource names,
+// that the applications have the repositories and app configuration they need,
+// and that the environments are consistent.
+// Values with the placeholder REPLACE_ME are reported by ValidateBasicFields and are not checked again.
+func ValidateSchema(g GlobalTFVars) []Finding {
+	findings := []Finding{}
+	findings = append(findings, validateRequiredInputs(g)...)
+	findings = append(findings, validateResourceNames(g)...)
+	findings = append(findings, validateRepositoryConfigs(g)...)
+	findings = append(findings, validateApplications(g)...)
+	findings = append(findings, validateEnvs(g)...)
+	return findings
+}
+
+// validateRequiredInputs checks that the mandatory inputs are not empty.
+func validateRequiredInputs(g GlobalTFVars) []Finding {
+	findings := []Finding{}
+	required := []struct {
+		input string
+		value string
+	}{
+		{"project_id", g.ProjectID},
+		{"org_id", g.OrgID},
+		{"billing_account", g.BillingAccount},
+		{"common_folder_id", g.CommonFolderID},
+		{"workerpool_id", g.WorkerPoolID},
+		{"location", g.Location},
+		{"trigger_location", g.TriggerLocation},
+		{"region", g.Region},
+		{"eab_code_path", g.EABCodePath},
+		{"code_checkout_path", g.CodeCheckoutPath},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			findings = append(findings, newFinding("tfvars.required", r.input,
+				fmt.Sprintf("Input '%s' is required.", r.input),
+				fmt.Sprintf("Provide a value for input '%s' in the tfvars file.", r.input)))
+		}
+	}
+	return findings
+}
+
+// validateResourceNames checks the format of the resource names used by the deploy.
+func validateResourceNames(g GlobalTFVars) []Finding {
+	findings := []Finding{}
+	if checkFormat(g.CommonFolderID) && !folderIDRegex.MatchString(g.CommonFolderID) {
+		findings = append(findings, folderIDFormatFinding("common_folder_id", g.CommonFolderID))
+	}
+	if checkFormat(g.WorkerPoolID) && !matches(g.WorkerPoolID, workerPoolIDPattern) {
+		findings = append(findings, workerPoolFormatFinding(g.WorkerPoolID))
+	}
+	kmsKeys := map[string]*string{
+		"attestation_kms_key": g.AttestationKMSKey,
+		"bucket_kms_key":      g.BucketKMSKey,
+	}
+	for _, input := range []string{"attestation_kms_key", "bucket_kms_key"} {
+		key := kmsKeys[input]
+		if key != nil && checkFormat(*key) && !matches(*key, kmsKeyPattern) {
+			findings = append(findings, kmsKeyFormatFinding(input, *key))
+		}
+	}
+	if g.ServicePerimeterName != nil && checkFormat(*g.ServicePerimeterName) && !matches(*g.ServicePerimeterName, servicePerimeterPattern) {
+		findings = append(findings, newFinding("vpcsc.perimeter-format", "service_perimeter_name",
+			fmt.Sprintf("Service perimeter '%s' is not in the correct format.", *g.ServicePerimeterName),
+			"Use the format `accessPolicies/POLICY_ID/servicePerimeters/NAME`."))
+	}
+	if g.AccessLevelName != nil && checkFormat(*g.AccessLevelName) && !matches(*g.AccessLevelName, accessLevelPattern) {
+		findings = append(findings, newFinding("vpcsc.access-level-format", "access_level_name",
+			fmt.Sprintf("Access level '%s' is not in the correct format.", *g.AccessLevelName),
+			"Use the format `accessPolicies/POLICY_ID/accessLevels/NAME`."))
+	}
+	if g.ServicePerimeterMode != nil && !slices.Contains(servicePerimeterModes, *g.ServicePerimeterMode) {
+		findings = append(findings, newFinding("vpcsc.perimeter-mode", "service_perimeter_mode",
+			fmt.Sprintf("Service perimeter mode '%s' is not valid.", *g.ServicePerimeterMode),
+			fmt.Sprintf("Use one of: %s.", strings.Join(servicePerimeterModes, ", "))))
+	}
+	if g.ServicePerimeterName != nil && g.AccessLevelName == nil {
+		findings = append(findings, newFinding("vpcsc.access-level", "access_level_name",
+			"The access level is required when a service perimeter is provided.",
+			"Provide the associated Access Level name to be used with Service Perimeter."))
+	}
+	return findings
+}
+
+// validateRepositoryConfigs checks the repository type and that the repositories of the infrastructure stages are configured.
+func validateRepositoryConfigs(g GlobalTFVars) []Finding {
+	findings := []Finding{}
+	repoConfigs := map[string]CloudbuildV2RepositoryConfig{
+		"infra_cloudbuildv2_repository_config":        g.InfraCloudbuildV2RepositoryConfig,
+		"app_services_cloudbuildv2_repository_config": g.AppServicesCloudbuildV2RepositoryConfig,
+	}
+	for _, name := range []string{"infra_cloudbuildv2_repository_config", "app_services_cloudbuildv2_repository_config"} {
+		config := repoConfigs[name]
+		if !slices.Contains(repoTypes, config.RepoType) {
+			findings = append(findings, newFinding("repositories.type", name+".repo_type",
+				fmt.Sprintf("Repository type '%s' is not valid.", config.RepoType),
+				fmt.Sprintf("Use one of: %s.", strings.Join(repoTypes, ", "))))
+		}
+		for _, key := range sortedKeys(config.Repositories) {
+			if strings.TrimSpace(config.Repositories[key].RepositoryName) == "" {
+				findings = append(findings, newFinding("repositories.name", fmt.Sprintf("%s.repositories.%s", name, key),
+					fmt.Sprintf("Repository '%s' has no repository name.", key),
+					fmt.Sprintf("Provide 'repository_name' for repository '%s'.", key)))
+			}
+		}
+	}
+	for _, key := range infraRepositories {
+		if _, ok := g.InfraCloudbuildV2RepositoryConfig.Repositories[key]; !ok {
+			findings = append(findings, missingRepositoryFinding(key, fmt.Sprintf("The repository of the '%s' stage is not configured.", key)))
+		}
+	}
+	return findings
+}
+
+// validateApplications checks that each application has an app configuration
+// and that each application service has an infrastructure repository.
+func validateApplications(g GlobalTFVars) []Finding {
+	findings := []Finding{}
+	for _, app := range sortedKeys(g.Applications) {
+		if _, ok := g.Apps[app]; !ok {
+			findings = append(findings, newFinding("applications.app", "applications."+app,
+				fmt.Sprintf("Application '%s' has no entry in input 'apps'.", app),
+				fmt.Sprintf("Add '%s' to input 'apps' or remove it from input 'applications'.", app)))
+		}
+		for _, service := range sortedKeys(g.Applications[app]) {
+			if _, ok := g.InfraCloudbuildV2RepositoryConfig.Repositories[service]; !ok {
+				findings = append(findings, missingRepositoryFinding(service, fmt.Sprintf("Service '%s' of application '%s' has no infrastructure repository.", service, app)))
+			}
+		}
+	}
+	return findings
+}
+
+// validateEnvs checks that there is a production environment
+// and that the environments are consistent with the organization and the network projects.
+func validateEnvs(g GlobalTFVars) []Finding {
+	findings := []Finding{}
+	if _, ok := g.Envs["production"]; !ok {
+		findings = append(findings, newFinding("envs.production", "envs",
+			"There is no production environment.",
+			"At least one of the environments must be 'production'."))
+	}
+	for _, name := range sortedKeys(g.Envs) {
+		env := g.Envs[name]
+		input := "envs." + name
+		if checkFormat(env.FolderID) && !folderIDRegex.MatchString(env.FolderID) {
+			findings = append(findings, folderIDFormatFinding(input+".folder_id", env.FolderID))
+		}
+		if env.OrgID != g.OrgID {
+			findings = append(findings, newFinding("envs.org-id", input+".org_id",
+				fmt.Sprintf("Environment organization '%s' is not the organization '%s' of the deploy.", env.OrgID, g.OrgID),
+				"Use the same value for 'org_id' and the 'org_id' of the environments."))
+		}
+		if checkFormat(env.NetworkSelfLink) {
+			networkInfo, err := parseResourceName(env.NetworkSelfLink, networkPattern)
+			if err != nil {
+				findings = append(findings, newFinding("network.network-format", input+".network_self_link",
+					fmt.Sprintf("Network '%s' is not in the correct format.", env.NetworkSelfLink),
+					"Use the format `projects/PROJECT_ID/global/networks/NAME`."))
+			} else if networkInfo["project"] != env.NetworkProjectID {
+				findings = append(findings, networkProjectFinding(input+".network_self_link", env.NetworkSelfLink, env.NetworkProjectID))
+			}
+		}
+		if len(env.SubnetsSelfLinks) == 0 {
+			findings = append(findings, newFinding("network.subnets", input+".subnets_self_links",
+				fmt.Sprintf("Environment '%s' has no subnets.", name),
+				"Provide at least one subnet, a cluster is created in the region of each subnet."))
+		}
+		for i, subnet := range env.SubnetsSelfLinks {
+			if !checkFormat(subnet) {
+				continue
+			}
+			subnetInfo, err := parseResourceName(subnet, subnetPattern)
+			if err != nil {
+				findings = append(findings, subnetFormatFinding(subnet))
+				continue
+			}
+			if subnetInfo["project"] != env.NetworkProjectID {
+				findings = append(findings, networkProjectFinding(fmt.Sprintf("%s.subnets_self_links[%d]", input, i), subnet, env.NetworkProjectID))
+			}
+		}
+	}
+	return findings
+}
+
+func folderIDFormatFinding(input, folderID string) Finding {
+	return newFinding("tfvars.folder-format", input,
+		fmt.Sprintf("Folder '%s' is not in the correct format.", folderID),
+		"Use the format `folders/FOLDER_NUMBER`.")
+}
+
+func workerPoolFormatFinding(workerPoolID string) Finding {
+	return newFinding("workerpool.format", "workerpool_id",
+		fmt.Sprintf("Worker Pool ID '%s' is not in the correct format.", workerPoolID),
+		"Use the format `projects/PROJECT_ID/locations/LOCATION/workerPools/NAME`.")
+}
+
+func subnetFormatFinding(subnet string) Finding {
+	return newFinding("network.subnet-format", subnet,
+		fmt.Sprintf("Subnet '%s' is not in the correct format.", subnet),
+		"Use the format `projects/PROJECT_ID/regions/REGION/subnetworks/NAME`.")
+}
+
+func kmsKeyFormatFinding(input, key string) Finding {
+	return newFinding("tfvars.kms-key-format", input,
+		fmt.Sprintf("KMS key '%s' is not in the correct format.", key),
+		"Use the format `projects/PROJECT_ID/locations/LOCATION/keyRings/KEY_RING/cryptoKeys/KEY`.")
+}
+
+func missingRepositoryFinding(key, message string) Finding {
+	return newFinding("repositories.missing", "infra_cloudbuildv2_repository_config.repositories."+key,
+		message,
+		fmt.Sprintf("Add repository '%s' to input 'infra_cloudbuildv2_repository_config'.", key))
+}
+
+func networkProjectFinding(input, selfLink, networkProjectID string) Finding {
+	return newFinding("envs.network-project", input,
+		fmt.Sprintf("'%s' is not in the network project '%s' of the environment.", selfLink, networkProjectID),
+		"Use the network and subnets of the environment 'network_project_id'.")
+}
+
+// checkFormat checks if the format of a value should be validated,
+// empty values and values with the placeholder are reported by other checks.
+func checkFormat(value string) bool {
+	return value != "" && !strings.Contains(value, replaceME)
+}
+
+// parseResourceName extracts the parts of a resource name like extractInfoWithRegex,
+// but the whole input must match the pattern, so 'projects/a/locations/b/workerPools/c/extra' is not valid.
+func parseResourceName(input, pattern string) (map[string]string, error) {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$")
+	return extractInfoWithRegex(input, fmt.Sprintf("^(?:%s)$", pattern))
+}
+
+func matches(input, pattern string) bool {
+	_, err := parseResourceName(input, pattern)
+	return err == nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,158 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func readValidTFVars(t *testing.T) GlobalTFVars {
+	g, err := ReadGlobalTFVars("testdata/valid.tfvars")
+	assert.NoError(t, err)
+	return g
+}
+
+func checkIDs(findings []Finding) []string {
+	ids := []string{}
+	for _, f := range findings {
+		ids = append(ids, f.CheckID+" "+f.Resource)
+	}
+	return ids
+}
+
+func TestCheckString(t *testing.T) {
+	g := readValidTFVars(t)
+	assert.Empty(t, g.CheckString(replaceME))
+
+	key := "projects/REPLACE_ME/locations/us/keyRings/ring/cryptoKeys/key"
+	g.ProjectID = replaceME
+	g.BucketKMSKey = &key
+	dev := g.Envs["development"]
+	dev.SubnetsSelfLinks = []string{dev.SubnetsSelfLinks[0], "projects/REPLACE_ME/regions/us/subnetworks/sb"}
+	g.Envs["development"] = dev
+	g.InfraCloudbuildV2RepositoryConfig.Repositories["fleetscope"] = Repository{RepositoryName: replaceME}
+	g.Extra = map[string]cty.Value{
+		"custom": cty.ObjectVal(map[string]cty.Value{"zones": cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal(replaceME)})}),
+	}
+
+	assert.Equal(t, []string{
+		"project_id",
+		"envs.development.subnets_self_links[1]",
+		"infra_cloudbuildv2_repository_config.repositories.fleetscope.repository_name",
+		"bucket_kms_key",
+		"custom.zones[1]",
+	}, g.CheckString(replaceME))
+}
+
+func TestValidateSchema(t *testing.T) {
+	assert.Empty(t, ValidateSchema(readValidTFVars(t)))
+
+	tests := []struct {
+		name     string
+		change   func(g *GlobalTFVars)
+		expected []string
+	}{
+		{
+			name: "resource name formats",
+			change: func(g *GlobalTFVars) {
+				key := "kms-key"
+				mode := "ENFORCED"
+				g.CommonFolderID = "111111111111"
+				g.WorkerPoolID = "private-pool"
+				g.BucketKMSKey = &key
+				g.ServicePerimeterMode = &mode
+			},
+			expected: []string{
+				"tfvars.folder-format common_folder_id",
+				"workerpool.format workerpool_id",
+				"tfvars.kms-key-format bucket_kms_key",
+				"vpcsc.perimeter-mode service_perimeter_mode",
+			},
+		},
+		{
+			name: "resource names with extra segments",
+			change: func(g *GlobalTFVars) {
+				dev := g.Envs["development"]
+				dev.SubnetsSelfLinks = []string{dev.SubnetsSelfLinks[0] + "/extra"}
+				g.Envs["development"] = dev
+				g.WorkerPoolID = "xprojects/a/locations/b/workerPools/c/extra"
+			},
+			expected: []string{
+				"workerpool.format workerpool_id",
+				"network.subnet-format https://www.googleapis.com/compute/v1/projects/dev-network/regions/us-central1/subnetworks/eab-development-us-central1/extra",
+			},
+		},
+		{
+			name: "placeholders are not checked again",
+			change: func(g *GlobalTFVars) {
+				g.CommonFolderID = "folders/REPLACE_ME"
+				g.WorkerPoolID = "projects/REPLACE_ME/locations/REPLACE_ME/workerPools/REPLACE_ME"
+			},
+			expected: []string{},
+		},
+		{
+			name: "required inputs and access level",
+			change: func(g *GlobalTFVars) {
+				g.Region = ""
+				g.AccessLevelName = nil
+			},
+			expected: []string{
+				"tfvars.required region",
+				"vpcsc.access-level access_level_name",
+			},
+		},
+		{
+			name: "applications without repository and app",
+			change: func(g *GlobalTFVars) {
+				g.Applications["cymbal-bank"] = map[string]ApplicationService{"accounts": {}}
+				delete(g.InfraCloudbuildV2RepositoryConfig.Repositories, "fleetscope")
+			},
+			expected: []string{
+				"repositories.missing infra_cloudbuildv2_repository_config.repositories.fleetscope",
+				"applications.app applications.cymbal-bank",
+				"repositories.missing infra_cloudbuildv2_repository_config.repositories.accounts",
+			},
+		},
+		{
+			name: "inconsistent envs",
+			change: func(g *GlobalTFVars) {
+				prod := g.Envs["production"]
+				delete(g.Envs, "production")
+				prod.OrgID = "999999999999"
+				prod.NetworkProjectID = "other-network"
+				prod.SubnetsSelfLinks = append(prod.SubnetsSelfLinks, "subnet")
+				g.Envs["prod"] = prod
+			},
+			expected: []string{
+				"envs.production envs",
+				"envs.org-id envs.prod.org_id",
+				"envs.network-project envs.prod.network_self_link",
+				"envs.network-project envs.prod.subnets_self_links[0]",
+				"envs.network-project envs.prod.subnets_self_links[1]",
+				"network.subnet-format subnet",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := readValidTFVars(t)
+			tt.change(&g)
+			assert.Equal(t, tt.expected, checkIDs(ValidateSchema(g)))
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
+)
+
+// Targets restricts a deploy or destroy to some stages, environments and applications.
+// An empty list selects all of them, except for the shared environment, that is only selected with the other environments
+// when no environment is listed, and for the stages, that are only the stages of the applications when applications are listed.
+// Applications are selected by name, like "default-example", or by service, like "default-example.hello-world".
+type Targets struct {
+	Stages []string
+	Envs   []string
+	Apps   []string
+}
+
+// IsSet returns true if any target is set.
+func (tg Targets) IsSet() bool {
+	return len(tg.Stages) > 0 || tg.IsPartial()
+}
+
+// IsPartial returns true if only some environments or applications of the stages are selected.
+func (tg Targets) IsPartial() bool {
+	return len(tg.Envs) > 0 || len(tg.Apps) > 0
+}
+
+// Validate checks that the environments and applications exist in the global tfvars.
+func (tg Targets) Validate(tfvars GlobalTFVars) error {
+	for _, env := range tg.Envs {
+		if _, ok := tfvars.Envs[env]; !ok && env != "shared" {
+			return fmt.Errorf("unknown environment '%s', valid environments are: %s", env, strings.Join(sortedKeys(tfvars.Envs), ", "))
+		}
+	}
+	services := appInfraServices(tfvars)
+	for _, app := range tg.Apps {
+		if !slices.ContainsFunc(services, func(s string) bool { return s == app || strings.HasPrefix(s, app+".") }) {
+			return fmt.Errorf("unknown application '%s', valid applications are: %s", app, strings.Join(services, ", "))
+		}
+	}
+	return nil
+}
+
+// StageFilter returns the filter of the selected stages.
+// If applications are listed without stages, only the stages deploying the applications are selected.
+func (tg Targets) StageFilter(parallelism int) steps.StageFilter {
+	stages := tg.Stages
+	if len(stages) == 0 && len(tg.Apps) > 0 {
+		stages = []string{AppInfraStageName, AppSourceStageName}
+	}
+	return steps.StageFilter{Stages: stages, Partial: tg.IsPartial(), Parallelism: parallelism}
+}
+
+// includesEnv returns true if the environment is selected.
+// The shared environment must be listed to be selected when environments are listed.
+func (tg Targets) includesEnv(env string) bool {
+	return len(tg.Envs) == 0 || slices.Contains(tg.Envs, env)
+}
+
+// filterEnvs returns the selected environments.
+func (tg Targets) filterEnvs(envs []string) []string {
+	return slices.DeleteFunc(slices.Clone(envs), func(env string) bool { return !tg.includesEnv(env) })
+}
+
+// includesApp returns true if the service of the application is selected.
+func (tg Targets) includesApp(app, service string) bool {
+	return len(tg.Apps) == 0 || slices.Contains(tg.Apps, app) || slices.Contains(tg.Apps, fmt.Sprintf("%s.%s", app, service))
+}
@@ -0,0 +1,122 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
+)
+
+func TestTargets(t *testing.T) {
+	g := readValidTFVars(t)
+
+	assert.NoError(t, Targets{}.Validate(g))
+	assert.False(t, Targets{}.IsSet())
+	assert.NoError(t, Targets{Envs: []string{"development"}, Apps: []string{"default-example"}}.Validate(g))
+	assert.NoError(t, Targets{Apps: []string{"default-example.hello-world"}}.Validate(g))
+	assert.ErrorContains(t, Targets{Envs: []string{"staging"}}.Validate(g), "unknown environment 'staging'")
+	assert.ErrorContains(t, Targets{Apps: []string{"default"}}.Validate(g), "unknown application 'default'")
+
+	tg := Targets{Envs: []string{"development"}, Apps: []string{"default-example.hello-world"}}
+	assert.True(t, tg.IsPartial())
+	assert.Equal(t, []string{"development"}, tg.filterEnvs([]string{"shared", "development", "production"}))
+	assert.True(t, tg.includesApp("default-example", "hello-world"))
+	assert.False(t, tg.includesApp("default-example", "other"))
+}
+
+func TestDestroyTargets(t *testing.T) {
+	envs := map[string][]string{
+		MultitenantStageName: {"development", "nonproduction", "production"},
+		AppFactoryStageName:  {"shared"},
+		AppInfraStageName:    {"shared", "development", "nonproduction", "production"},
+	}
+	tests := []struct {
+		name      string
+		targets   Targets
+		destroyed []string
+	}{
+		{
+			name:    "applications without stages",
+			targets: Targets{Apps: []string{"default-example"}},
+			destroyed: []string{
+				AppSourceStageName,
+				"appinfra-hello-world.shared", "appinfra-hello-world.development", "appinfra-hello-world.nonproduction", "appinfra-hello-world.production",
+			},
+		},
+		{
+			name:    "environments without shared",
+			targets: Targets{Envs: []string{"development"}},
+			destroyed: []string{
+				AppSourceStageName,
+				"appinfra-hello-world.development",
+				"gcp-multitenant.development",
+			},
+		},
+		{
+			name:    "shared environment listed",
+			targets: Targets{Envs: []string{"shared", "development"}},
+			destroyed: []string{
+				AppSourceStageName,
+				"appinfra-hello-world.shared", "appinfra-hello-world.development",
+				"gcp-appfactory.shared",
+				"gcp-multitenant.development",
+			},
+		},
+		{
+			name:    "applications with stages",
+			targets: Targets{Stages: []string{AppSourceStep}, Apps: []string{"default-example"}},
+			destroyed: []string{
+				AppSourceStageName,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := steps.LoadSteps(filepath.Join(t.TempDir(), "steps.json"))
+			require.NoError(t, err)
+			destroyed := []string{}
+			r := steps.NewRegistry()
+			for _, st := range []steps.Stage{
+				{Name: MultitenantStageName, Description: MultitenantStep},
+				{Name: AppFactoryStageName, Description: AppFactoryStep, DependsOn: []string{MultitenantStageName}},
+				{Name: AppInfraStageName, Description: AppInfraStep, DependsOn: []string{AppFactoryStageName}},
+				{Name: AppSourceStageName, Description: AppSourceStep, DependsOn: []string{AppInfraStageName}},
+			} {
+				name := st.Name
+				st.Destroy = func() error {
+					if len(envs[name]) == 0 {
+						destroyed = append(destroyed, name)
+					}
+					for _, env := range tt.targets.filterEnvs(envs[name]) {
+						destroyed = append(destroyed, fmt.Sprintf("%s.%s", name, env))
+					}
+					return nil
+				}
+				require.NoError(t, r.Register(st))
+				require.NoError(t, s.CompleteStep(name))
+			}
+
+			require.NoError(t, s.DestroyStages(r, tt.targets.StageFilter(1)))
+			assert.Equal(t, tt.destroyed, destroyed)
+			assert.False(t, s.IsStepDestroyed(AppInfraStageName), "partial destructions should not destroy the stage")
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mitchellh/go-testing-interface"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/msg"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+// UpgradeTag returns the tag of the stage repositories upgraded to a version of the blueprint.
+func UpgradeTag(version string) string {
+	return fmt.Sprintf("eab-%s", version)
+}
+
+func UpgradeMultitenantStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) error {
+	stageConf, err := multitenantStageConf(t, tfvars, outputs, c)
+	if err != nil {
+		return err
+	}
+	return upgradeStage(t, stageConf, s, c)
+}
+
+func UpgradeFleetscopeStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) error {
+	stageConf, err := fleetscopeStageConf(t, tfvars, outputs, c)
+	if err != nil {
+		return err
+	}
+	return upgradeStage(t, stageConf, s, c)
+}
+
+func UpgradeAppFactoryStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, outputs BootstrapOutputs, c CommonConf) error {
+	stageConf, err := appFactoryStageConf(t, tfvars, outputs, c)
+	if err != nil {
+		return err
+	}
+	return upgradeStage(t, stageConf, s, c)
+}
+
+func UpgradeAppInfraStage(t testing.TB, s steps.Steps, tfvars GlobalTFVars, bootstrapOutputs BootstrapOutputs, outputs AppFactoryOutputs, c CommonConf) error {
+	inputs := appInfraInputs(tfvars, bootstrapOutputs)
+	services := slices.DeleteFunc(appInfraServices(tfvars), func(appGroupIndex string) bool {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		return !c.Targets.includesApp(exampleName, serviceName)
+	})
+	// services are upgraded one at a time because the changes are confirmed interactively
+	for _, appGroupIndex := range services {
+		exampleName, serviceName, _ := strings.Cut(appGroupIndex, ".")
+		stageConf, err := appInfraServiceStageConf(t, tfvars, inputs, exampleName, serviceName, outputs, c)
+		if err != nil {
+			return err
+		}
+		err = upgradeStage(t, stageConf, s, c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeStage copies the code of the new blueprint version to the stage repository, shows the changes,
+// and commits them in the plan branch tagged with the version.
+// The changes are then planned and applied per environment like in deployStage,
+// using steps named after the version, so an interrupted upgrade can be resumed.
+// Only the files of the blueprint code are overwritten, other files of the repository are kept.
+func upgradeStage(t testing.TB, sc StageConf, s steps.Steps, c CommonConf) error {
+	repo := sc.Stage
+	sc.Stage = fmt.Sprintf("%s.upgrade-%s", repo, c.UpgradeVersion)
+	commitStep := fmt.Sprintf("%s.commit", sc.Stage)
+	if !s.IsStepComplete(commitStep) {
+		files, err := upgradeChanges(t, sc, c)
+		if err != nil {
+			return discardUpgrade(sc.GitConf, err)
+		}
+		if len(files) == 0 {
+			fmt.Printf("# repository %s is already at version %s\n", repo, c.UpgradeVersion)
+			return nil
+		}
+		err = msg.ConfirmUpgrade(c.Context, sc.Repo, c.UpgradeVersion, files, c.DisablePrompt)
+		if err != nil {
+			return discardUpgrade(sc.GitConf, err)
+		}
+		err = s.RunStep(commitStep, func() error {
+			return commitUpgrade(sc.GitConf, c.UpgradeVersion)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return deployStage(t, sc, s, c)
+}
+
+// upgradeChanges copies the stage code to the plan branch of the stage repository and returns the changed files.
+func upgradeChanges(t testing.TB, sc StageConf, c CommonConf) ([]string, error) {
+	err := sc.GitConf.CheckoutBranch("plan")
+	if err != nil {
+		return nil, err
+	}
+	err = copyStepCode(t, sc.GitConf, c.EABPath, c.CheckoutPath, sc.Repo, sc.Step, sc.CustomTargetDirPath, sc.Overlays, sc.Envs, c.confirmOverwrite)
+	if err != nil {
+		return nil, err
+	}
+	return sc.GitConf.ChangedFiles()
+}
+
+// discardUpgrade discards the code copied by upgradeChanges, so the next deploy does not commit the changes without review,
+// and returns err.
+func discardUpgrade(conf utils.GitRepo, err error) error {
+	if discardErr := conf.DiscardChanges(); discardErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to discard the changes of the upgrade: %w", discardErr))
+	}
+	return err
+}
+
+// commitUpgrade commits the changes of the upgrade and tags the commit with the version.
+func commitUpgrade(conf utils.GitRepo, version string) error {
+	message := fmt.Sprintf("Upgrade to Enterprise Application Blueprint %s", version)
+	err := conf.CommitFiles(message)
+	if err != nil {
+		return err
+	}
+	err = conf.Tag(UpgradeTag(version), message)
+	if err != nil {
+		return err
+	}
+	return conf.PushTag(UpgradeTag(version), "origin")
+}
@@ -0,0 +1,119 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/steps"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/utils"
+)
+
+// upgradeTestStage returns the stage configuration of a multitenant repository cloned from a local bare repository,
+// with a plan branch, and the common configuration of the blueprint code to upgrade to.
+func upgradeTestStage(t *testing.T) (StageConf, CommonConf, string) {
+	eabPath := t.TempDir()
+	writeStageCode(t, eabPath, map[string]string{
+		"2-multitenant/main.tf":          "# multitenant\n",
+		"modules/cluster/main.tf":        "# cluster\n",
+		"build/cloudbuild-tf-apply.yaml": "steps: []\n",
+		"build/cloudbuild-tf-plan.yaml":  "steps: []\n",
+		"build/tf-wrapper.sh":            "environments_regex=\"^(development|nonproduction|production|shared)$\"\n",
+	})
+
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	checkoutPath := t.TempDir()
+	repo := filepath.Join(checkoutPath, "eab-multitenant")
+	for _, args := range [][]string{
+		{"init", "--bare", origin},
+		{"clone", origin, repo},
+		{"-C", repo, "checkout", "-b", "plan"},
+		{"-C", repo, "commit", "--allow-empty", "-m", "init"},
+		{"-C", repo, "push", "origin", "plan"},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	sc := StageConf{
+		Stage:   MultitenantStep,
+		Step:    MultitenantStep,
+		Repo:    "eab-multitenant",
+		GitConf: utils.GetRepoOnly(t, repo, logger.Discard),
+		Envs:    []string{"development"},
+	}
+	c := CommonConf{
+		Context:        context.Background(),
+		EABPath:        eabPath,
+		CheckoutPath:   checkoutPath,
+		DisablePrompt:  true,
+		UpgradeVersion: "v0.2.0",
+	}
+	return sc, c, origin
+}
+
+func TestUpgradeChanges(t *testing.T) {
+	sc, c, origin := upgradeTestStage(t)
+
+	files, err := upgradeChanges(t, sc, c)
+	require.NoError(t, err)
+	assert.Contains(t, files, "?? main.tf")
+	assert.Contains(t, files, "?? modules/cluster/main.tf")
+
+	require.NoError(t, commitUpgrade(sc.GitConf, c.UpgradeVersion))
+	tag, err := sc.GitConf.Describe()
+	require.NoError(t, err)
+	assert.Equal(t, "eab-v0.2.0", tag)
+	sha, err := sc.GitConf.GetCommitSha()
+	require.NoError(t, err)
+	out, err := exec.Command("git", "-C", origin, "rev-parse", "eab-v0.2.0^{commit}").CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Equal(t, sha, strings.TrimSpace(string(out)), "the tag should be pushed")
+
+	// a repository already at the version has no changes
+	files, err = upgradeChanges(t, sc, c)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	s, err := steps.LoadSteps(filepath.Join(t.TempDir(), "steps.json"))
+	require.NoError(t, err)
+	assert.NoError(t, upgradeStage(t, sc, s, c))
+	assert.False(t, s.IsStepComplete("2-multitenant.upgrade-v0.2.0.commit"))
+}
+
+func TestUpgradeStageDiscardsCanceledChanges(t *testing.T) {
+	sc, c, _ := upgradeTestStage(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Context = ctx
+	c.DisablePrompt = false
+	s, err := steps.LoadSteps(filepath.Join(t.TempDir(), "steps.json"))
+	require.NoError(t, err)
+
+	err = upgradeStage(t, sc, s, c)
+	assert.ErrorIs(t, err, context.Canceled)
+	files, err := sc.GitConf.ChangedFiles()
+	require.NoError(t, err)
+	assert.Empty(t, files, "the changes of a canceled upgrade should be discarded")
+	_, err = os.Stat(filepath.Join(c.CheckoutPath, sc.Repo, "main.tf"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -15,17 +15,20 @@
 package stages
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/gcp"
+	"github.com/GoogleCloudPlatform/terraform-google-enterprise-application/helpers/eab-deployer/scm"
 	"github.com/mitchellh/go-testing-interface"
 	"github.com/tidwall/gjson"
 )
@@ -74,6 +77,24 @@ var (
 	}
 )
 
+// Validators returns the validations of the deploy requirements executed by the -validate flag.
+// With forcePush the protection of the branches force-pushed by the helper is also checked.
+func Validators(t testing.TB, g GlobalTFVars, forcePush bool) []Validator {
+	return []Validator{
+		{Name: "components", Check: func() []Finding { return ValidateComponents(t) }},
+		{Name: "basic-fields", Check: func() []Finding { return ValidateBasicFields(t, g) }},
+		{Name: "destroy-flags", Check: func() []Finding { return ValidateDestroyFlags(t, g) }},
+		{Name: "schema", Check: func() []Finding { return ValidateSchema(g) }},
+		{Name: "stage-variables", Check: func() []Finding { return ValidateStageVariables(g) }},
+		{Name: "permissions", Check: func() []Finding { return ValidatePermissions(t, g) }},
+		{Name: "required-apis", Check: func() []Finding { return ValidateRequiredAPIs(t, g) }},
+		{Name: "repositories", Check: func() []Finding { return ValidateRepositories(t, g, forcePush) }},
+		{Name: "network", Check: func() []Finding { return ValidateNetworkRequirementes(t, g) }},
+		{Name: "private-worker-pool", Check: func() []Finding { return ValidatePrivateWorkerPoolRequirementes(t, g) }},
+		{Name: "vpc-sc", Check: func() []Finding { return ValidateVPCSCRequirements(t, g) }},
+	}
+}
+
 // ValidateDirectories checks if the required directories exist
 func ValidateDirectories(g GlobalTFVars) error {
 	_, err := os.Stat(g.EABCodePath)
@@ -88,151 +109,235 @@ func ValidateDirectories(g GlobalTFVars) error {
 }
 
 // ValidateComponents checks if gcloud Beta Components and Terraform Tools are installed
-func ValidateComponents(t testing.TB) error {
+func ValidateComponents(t testing.TB) []Finding {
 	gcpConf := gcp.NewGCP()
 	components := []string{
 		"beta",
 		"terraform-tools",
 	}
-	missing := []string{}
+	findings := []Finding{}
 	for _, c := range components {
 		if !gcpConf.IsComponentInstalled(t, c) {
-			missing = append(missing, fmt.Sprintf("'%s' not installed", c))
+			findings = append(findings, newFinding("components.installed", c,
+				fmt.Sprintf("Google Cloud SDK component '%s' is not installed.", c),
+				fmt.Sprintf("Run 'gcloud components install %s'.", c)))
 		}
 	}
-	if len(missing) > 0 {
-		return fmt.Errorf("missing Google Cloud SDK component:%v", missing)
-	}
-	return nil
+	return findings
 }
 
 // ValidateBasicFields validates if the values for the required field were provided
-func ValidateBasicFields(t testing.TB, g GlobalTFVars) {
-	// gcpConf := gcp.NewGCP()
-	fmt.Println("")
-	fmt.Println("# Validating tfvar file.")
-
-	g.CheckString(replaceME)
+func ValidateBasicFields(t testing.TB, g GlobalTFVars) []Finding {
+	findings := []Finding{}
+	for _, input := range g.CheckString(replaceME) {
+		findings = append(findings, newFinding("tfvars.placeholder", input,
+			fmt.Sprintf("Input '%s' has the placeholder value '%s'.", input, replaceME),
+			fmt.Sprintf("Replace value '%s' for input '%s' in the tfvars file.", replaceME, input)))
+	}
 
 	for namespaces := range g.NamespaceIDs {
 		if strings.Contains(namespaces, exampleDotCom) {
-			fmt.Println("# Replace value 'example.com' for input 'namespace_ids'")
+			findings = append(findings, newFinding("tfvars.placeholder", "namespace_ids",
+				fmt.Sprintf("Input 'namespace_ids' has the example value '%s'.", namespaces),
+				fmt.Sprintf("Replace value '%s' for input 'namespace_ids' in the tfvars file.", exampleDotCom)))
 		}
 	}
 
-	if g.InfraCloudbuildV2RepositoryConfig.RepoType == "GITHUBv2" &&
-		(g.InfraCloudbuildV2RepositoryConfig.GithubAppIDSecretID == nil || g.InfraCloudbuildV2RepositoryConfig.GithubSecretID == nil) {
-		fmt.Println("# You must provide `github_app_id_secret_id` and `github_secret_id` for infra_cloudbuildv2_repository_config")
+	repoConfigs := map[string]CloudbuildV2RepositoryConfig{
+		"infra_cloudbuildv2_repository_config":        g.InfraCloudbuildV2RepositoryConfig,
+		"app_services_cloudbuildv2_repository_config": g.AppServicesCloudbuildV2RepositoryConfig,
 	}
-	if g.AppServicesCloudbuildV2RepositoryConfig.RepoType == "GITHUBv2" &&
-		(g.AppServicesCloudbuildV2RepositoryConfig.GithubAppIDSecretID == nil || g.AppServicesCloudbuildV2RepositoryConfig.GithubSecretID == nil) {
-		fmt.Println("# You must provide `github_app_id_secret_id` and `github_secret_id` for app_services_cloudbuildv2_repository_config")
-	}
-
-	if g.InfraCloudbuildV2RepositoryConfig.RepoType == "GITLABv2" &&
-		(g.InfraCloudbuildV2RepositoryConfig.GitlabAuthorizerCredentialSecretID == nil || g.InfraCloudbuildV2RepositoryConfig.GitlabReadAuthorizerCredentialSecretID == nil || g.InfraCloudbuildV2RepositoryConfig.GitlabWebhookSecretID == nil) {
-		fmt.Println("# You must provide `gitlab_authorizer_credential_secret_id`, `gitlab_webhook_secret_id` and `gitlab_read_authorizer_credential_secret_id` for infra_cloudbuildv2_repository_config")
-	}
-	if g.AppServicesCloudbuildV2RepositoryConfig.RepoType == "GITLABv2" &&
-		(g.AppServicesCloudbuildV2RepositoryConfig.GitlabAuthorizerCredentialSecretID == nil || g.AppServicesCloudbuildV2RepositoryConfig.GitlabReadAuthorizerCredentialSecretID == nil || g.AppServicesCloudbuildV2RepositoryConfig.GitlabWebhookSecretID == nil) {
-		fmt.Println("# You must provide `gitlab_authorizer_credential_secret_id`, `gitlab_webhook_secret_id` and `gitlab_read_authorizer_credential_secret_id` for app_services_cloudbuildv2_repository_config")
+	for _, name := range []string{"infra_cloudbuildv2_repository_config", "app_services_cloudbuildv2_repository_config"} {
+		config := repoConfigs[name]
+		if config.RepoType == "GITHUBv2" && (config.GithubAppIDSecretID == nil || config.GithubSecretID == nil) {
+			findings = append(findings, newFinding("tfvars.github-secrets", name,
+				"GitHub repositories require the app ID and token secrets.",
+				fmt.Sprintf("Provide `github_app_id_secret_id` and `github_secret_id` for %s.", name)))
+		}
+		if config.RepoType == "GITLABv2" && (config.GitlabAuthorizerCredentialSecretID == nil || config.GitlabReadAuthorizerCredentialSecretID == nil || config.GitlabWebhookSecretID == nil) {
+			findings = append(findings, newFinding("tfvars.gitlab-secrets", name,
+				"GitLab repositories require the authorizer, read authorizer and webhook secrets.",
+				fmt.Sprintf("Provide `gitlab_authorizer_credential_secret_id`, `gitlab_webhook_secret_id` and `gitlab_read_authorizer_credential_secret_id` for %s.", name)))
+		}
 	}
+	return findings
 }
 
 // ValidateRequiredAPIs validates if the project has the required APIs enabled.
-func ValidateRequiredAPIs(t testing.TB, g GlobalTFVars) {
-	fmt.Println("")
-	fmt.Println("# Validating required APIs.")
-
+func ValidateRequiredAPIs(t testing.TB, g GlobalTFVars) []Finding {
+	findings := []Finding{}
 	for _, requiredAPI := range requiredAPIs {
 		if !gcp.NewGCP().IsApiEnabled(t, g.ProjectID, requiredAPI) {
-			fmt.Printf("# Project `%s` is missing required API: `%s` \n", g.ProjectID, requiredAPI)
+			findings = append(findings, newFinding("apis.enabled", fmt.Sprintf("projects/%s", g.ProjectID),
+				fmt.Sprintf("Project `%s` is missing required API: `%s`.", g.ProjectID, requiredAPI),
+				fmt.Sprintf("Run 'gcloud services enable %s --project %s'.", requiredAPI, g.ProjectID)).
+				withFix(enableAPIFix(g.ProjectID, requiredAPI)))
 		}
 	}
+	return findings
 }
 
-// ValidateRepositories checks if provided repositories are accessible.
-func ValidateRepositories(t testing.TB, g GlobalTFVars) {
-	if g.InfraCloudbuildV2RepositoryConfig.RepoType != "CSR" {
-		fmt.Println("")
-		fmt.Println("# Validating if repositories are accessible.")
-		var pat string
-
-		switch g.InfraCloudbuildV2RepositoryConfig.RepoType {
-		case "GITHUBv2":
-			pat = gcp.NewGCP().GetSecretValue(t, *g.InfraCloudbuildV2RepositoryConfig.GithubSecretID)
-		case "GITLABv2":
-			pat = gcp.NewGCP().GetSecretValue(t, *g.InfraCloudbuildV2RepositoryConfig.GitlabAuthorizerCredentialSecretID)
+// ValidateRepositories checks if the infrastructure and application services repositories exist, are private
+// and can be pushed with the token in the secret of their configuration.
+// With forcePush, it also checks if the branches force-pushed by the helper are protected:
+// the plan and environment branches of the infrastructure repositories and the main branch of the services repositories.
+func ValidateRepositories(t testing.TB, g GlobalTFVars, forcePush bool) []Finding {
+	envs := make([]string, 0, len(g.Envs))
+	for env := range g.Envs {
+		envs = append(envs, env)
+	}
+	infraBranches := append([]string{"plan"}, envBranches(envs)...)
+	findings := validateRepositoryConfig(t, "infra_cloudbuildv2_repository_config", g.InfraCloudbuildV2RepositoryConfig, repositoryBranches{pushed: infraBranches, reserved: infraBranches}, forcePush)
+	return append(findings, validateRepositoryConfig(t, "app_services_cloudbuildv2_repository_config", g.AppServicesCloudbuildV2RepositoryConfig, repositoryBranches{pushed: []string{"main"}}, forcePush)...)
+}
+
+// repositoryBranches are the branches pushed by the helper to the repositories of a configuration.
+// Reserved branches can not be the default branch of the repositories.
+type repositoryBranches struct {
+	pushed   []string
+	reserved []string
+}
+
+// validateRepositoryConfig checks the GitHub or GitLab repositories of the configuration in the given input.
+func validateRepositoryConfig(t testing.TB, input string, config CloudbuildV2RepositoryConfig, branches repositoryBranches, forcePush bool) []Finding {
+	if config.RepoType != scm.GitHubType && config.RepoType != scm.GitLabType {
+		return []Finding{}
+	}
+	token, err := repositoryToken(t, config)
+	if err != nil {
+		return []Finding{newFinding("repositories.accessible", input,
+			fmt.Sprintf("The repositories can not be checked: %v", err),
+			fmt.Sprintf("Provide the token secret in %s.", input))}
+	}
+	client, err := repositoryClient(config)
+	if err != nil {
+		return []Finding{newFinding("repositories.accessible", input,
+			fmt.Sprintf("Invalid GitLab Enterprise CA certificate: %v", err),
+			fmt.Sprintf("Check gitlab_enterprise_ca_certificate in %s.", input))}
+	}
+	return validateRepositories(context.Background(), input, config, branches, forcePush, token, client)
+}
+
+// repositoryToken returns the token of the GitHub or GitLab repositories from its secret.
+func repositoryToken(t testing.TB, config CloudbuildV2RepositoryConfig) (string, error) {
+	switch config.RepoType {
+	case scm.GitHubType:
+		if config.GithubSecretID == nil {
+			return "", fmt.Errorf("github_secret_id is required for %s repositories", config.RepoType)
+		}
+		return gcp.NewGCP().GetSecretValue(t, *config.GithubSecretID), nil
+	case scm.GitLabType:
+		if config.GitlabAuthorizerCredentialSecretID == nil {
+			return "", fmt.Errorf("gitlab_authorizer_credential_secret_id is required for %s repositories", config.RepoType)
 		}
+		return gcp.NewGCP().GetSecretValue(t, *config.GitlabAuthorizerCredentialSecretID), nil
+	}
+	return "", nil
+}
 
-		for _, repo := range g.InfraCloudbuildV2RepositoryConfig.Repositories {
-			repoParts := strings.Split(repo.RepositoryURL, "/")
+// repositoryClient returns the HTTP client for the repositories API, trusting the GitLab Enterprise CA certificate if set.
+func repositoryClient(config CloudbuildV2RepositoryConfig) (*http.Client, error) {
+	if config.GitlabEnterpriseCACertificate == nil || *config.GitlabEnterpriseCACertificate == "" {
+		return &http.Client{}, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM([]byte(*config.GitlabEnterpriseCACertificate)) {
+		return nil, fmt.Errorf("no certificate found in PEM")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
 
-			client := &http.Client{}
-			resp, err := client.Get(repo.RepositoryURL)
+// validateRepositories checks the repositories of the configuration with the given token and client.
+// Missing repositories have a fix that creates them as private repositories.
+// Protected branches are only reported with forcePush, pull requests are used to update them otherwise.
+func validateRepositories(ctx context.Context, input string, config CloudbuildV2RepositoryConfig, branches repositoryBranches, forcePush bool, token string, client *http.Client) []Finding {
+	findings := []Finding{}
+	hostURI := ""
+	if config.GitlabEnterpriseHostURI != nil {
+		hostURI = *config.GitlabEnterpriseHostURI
+	}
+	names := make([]string, 0, len(config.Repositories))
+	for name := range config.Repositories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		repoURL := config.Repositories[name].RepositoryURL
+		_, path, err := scm.ParseRepositoryURL(repoURL)
+		if err != nil {
+			findings = append(findings, newFinding("repositories.accessible", repoURL,
+				err.Error(),
+				fmt.Sprintf("Check the repository URL in %s.", input)))
+			continue
+		}
+		provider, err := scm.NewProvider(config.RepoType, repoURL, hostURI, token, client)
+		if err != nil {
+			findings = append(findings, newFinding("repositories.accessible", repoURL,
+				err.Error(),
+				fmt.Sprintf("Check the repository type in %s.", input)))
+			continue
+		}
+		repo, err := provider.GetRepository(ctx, path)
+		if errors.Is(err, scm.ErrNotFound) {
+			findings = append(findings, newFinding("repositories.exists", repoURL,
+				"Repository does not exist or the token in the secret can not access it.",
+				"Create the repository or grant the token access to it.").
+				withFix(createRepositoryFix(provider, repoURL, path)))
+			continue
+		}
+		if err != nil {
+			findings = append(findings, newFinding("repositories.accessible", repoURL,
+				fmt.Sprintf("Error getting the repository: %v", err),
+				"Check the repository URL and the token in the secret."))
+			continue
+		}
+		if !repo.CanPush {
+			findings = append(findings, newFinding("repositories.push", repoURL,
+				"The token in the secret can not push to the repository.",
+				"Grant the token write access to the repository."))
+		}
+		if !repo.Private {
+			findings = append(findings, newFinding("repositories.private", repoURL,
+				"Repository is PUBLIC.",
+				"Use a private repository.").withSeverity(SeverityWarning))
+		}
+		if slices.Contains(branches.reserved, repo.DefaultBranch) {
+			findings = append(findings, newFinding("repositories.default-branch", repoURL,
+				fmt.Sprintf("The default branch '%s' is a branch pushed by the helper to plan or apply changes.", repo.DefaultBranch),
+				"Use a default branch that is not 'plan' or an environment branch, like 'main'.").withSeverity(SeverityWarning))
+		}
+		if !forcePush {
+			continue
+		}
+		for _, branch := range branches.pushed {
+			protected, err := provider.IsBranchProtected(ctx, path, branch)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "# Error making request: %v\n", err)
+				findings = append(findings, newFinding("repositories.accessible", repoURL,
+					fmt.Sprintf("Error getting the protection of branch '%s': %v", branch, err),
+					"Check if the token in the secret has access to the repository."))
+				break
 			}
-			defer resp.Body.Close()
-
-			// Check for common success status codes (200-299).
-			if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
-				switch g.InfraCloudbuildV2RepositoryConfig.RepoType {
-				case "GITHUBv2":
-					repoURL := fmt.Sprintf("https://api.github.com/repos/%s/%s", repoParts[len(repoParts)-2], strings.ReplaceAll(repoParts[len(repoParts)-1], ".git", ""))
-					req, err := http.NewRequest("GET", repoURL, nil)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "Error creating request: %v\n", err)
-					}
-					req.Header.Add("Authorization", "Bearer "+pat)
-					resp, err := client.Do(req)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "Error making request: %v\n", err)
-					}
-					defer resp.Body.Close()
-
-					if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-						fmt.Printf("# Repository is accessible and PRIVATE! %s\n", repo.RepositoryURL)
-					} else {
-						fmt.Printf("# Repository %s is NOT ACCESSIBLE! %d\n", repo.RepositoryURL, resp.StatusCode)
-					}
-				case "GITLABv2":
-					repoURL := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s/%s", repoParts[len(repoParts)-2], strings.ReplaceAll(repoParts[len(repoParts)-1], ".git", ""))
-					req, err := http.NewRequest("HEAD", repoURL, nil)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "Error creating request: %v\n", err)
-					}
-
-					// GitLab uses the "PRIVATE-TOKEN" header for authentication with a PAT
-					req.Header.Add("PRIVATE-TOKEN", pat)
-
-					resp, err := client.Do(req)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "Error making request: %v\n", err)
-					}
-					defer resp.Body.Close()
-					if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-						fmt.Printf("# Repository is accessible and PRIVATE! %s\n", repo.RepositoryURL)
-					} else {
-						fmt.Printf("# Repository %s is NOT ACCESSIBLE! %d\n", repo.RepositoryURL, resp.StatusCode)
-					}
-				}
-			} else {
-				fmt.Printf("# Repository is PUBLIC! %s\n", repo.RepositoryURL)
+			if protected {
+				findings = append(findings, newFinding("repositories.branch-protection", repoURL,
+					fmt.Sprintf("Branch '%s' is protected, the helper force-pushes to it with -force_push.", branch),
+					fmt.Sprintf("Allow the token to force-push to branch '%s', remove the protection or promote the changes with pull requests.", branch)).withSeverity(SeverityWarning))
 			}
 		}
 	}
+	return findings
 }
 
-// ValidateRepositories checks if provided repositories are accessible.
-func ValidatePermissions(t testing.TB, g GlobalTFVars) {
-	fmt.Println("")
-	fmt.Println("# Validating if identity has required roles.")
+// ValidatePermissions checks if the identity running the deploy has the required roles.
+func ValidatePermissions(t testing.TB, g GlobalTFVars) []Finding {
+	findings := []Finding{}
 
-	workerPoolInfo, err := extractInfoWithRegex(g.WorkerPoolID, `projects/(?P<project>[^/]+)/locations/(?P<location>[^/]+)/workerPools/(?P<workerPool>[^/]+)`)
-	if err != nil {
-		fmt.Printf("# error extracting info for private workerpool. %v \n", err)
-	}
+	// values in the wrong format are reported by ValidateSchema and skipped
+	workerPoolInfo, _ := parseResourceName(g.WorkerPoolID, workerPoolIDPattern)
 
 	projectRoles := map[string][]string{
 		fmt.Sprintf("seedProject:%s", g.ProjectID): {
@@ -255,11 +360,7 @@ func ValidatePermissions(t testing.TB, g GlobalTFVars) {
 	}
 
 	if g.AttestationKMSKey != nil {
-		kmsInfo, err := extractInfoWithRegex(*g.AttestationKMSKey, `projects/(?P<project>[^/]+)/locations/(?P<location>[^/]+)/keyRings/(?P<keyRing>[^/]+)/cryptoKeys/(?P<cryptoKey>[^/]+)`)
-		if err != nil {
-			fmt.Printf("# error extracting info for ATTESTATION KMS PROJECT. %v \n", err)
-		}
-
+		kmsInfo, _ := parseResourceName(*g.AttestationKMSKey, kmsKeyPattern)
 		if len(kmsInfo) > 0 {
 			projectRoles[fmt.Sprintf("attestationKMSProject:%s", kmsInfo["project"])] = []string{
 				"roles/resourcemanager.projectIamAdmin",
@@ -268,11 +369,7 @@ func ValidatePermissions(t testing.TB, g GlobalTFVars) {
 	}
 
 	if g.BucketKMSKey != nil {
-		kmsInfo, err := extractInfoWithRegex(*g.BucketKMSKey, `projects/(?P<project>[^/]+)/locations/(?P<location>[^/]+)/keyRings/(?P<keyRing>[^/]+)/cryptoKeys/(?P<cryptoKey>[^/]+)`)
-		if err != nil {
-			fmt.Printf("# error extracting info for BUCKET KMS PROJECT. %v \n", err)
-		}
-
+		kmsInfo, _ := parseResourceName(*g.BucketKMSKey, kmsKeyPattern)
 		if len(kmsInfo) > 0 {
 			projectRoles[fmt.Sprintf("bucketKMSProject:%s", kmsInfo["project"])] = []string{
 				"roles/resourcemanager.projectIamAdmin",
@@ -298,160 +395,93 @@ func ValidatePermissions(t testing.TB, g GlobalTFVars) {
 		"roles/compute.xpnAdmin",
 	}
 
+	member := iamMember(gcp.NewGCP().GetActiveAccount(t))
+	firewallEndpointsPermissions := []string{
+		"networksecurity.firewallEndpoints.create",
+		"networksecurity.firewallEndpoints.delete",
+		"networksecurity.firewallEndpoints.get",
+		"networksecurity.firewallEndpoints.list",
+		"networksecurity.firewallEndpoints.update",
+		"networksecurity.firewallEndpoints.use",
+	}
+
 	for indexProject, roles := range projectRoles {
 		project := strings.Split(indexProject, ":")[1]
 		for _, role := range roles {
-			fmt.Printf("# Checking role %s at project %s. \n", role, project)
-
-			rolePermissions, err := gcp.NewGCP().GetRolePermissions(t, role)
-			if err != nil {
-				fmt.Printf("# Error getting roles: %v\n", err)
-				return
-			}
-
-			cleanPermission := []string{}
-			for _, permission := range rolePermissions {
-				if permission != "resourcemanager.projects.list" && permission != "networksecurity.firewallEndpoints.create" &&
-					permission != "networksecurity.firewallEndpoints.delete" && permission != "networksecurity.firewallEndpoints.get" &&
-					permission != "networksecurity.firewallEndpoints.list" && permission != "networksecurity.firewallEndpoints.update" &&
-					permission != "networksecurity.firewallEndpoints.use" {
-					cleanPermission = append(cleanPermission, permission)
-				}
-			}
-			identityPermissions, err := testIAMPermissions(t, cleanPermission, fmt.Sprintf("projects/%s", project))
+			f, err := checkRole(t, role, fmt.Sprintf("projects/%s", project), member, append([]string{"resourcemanager.projects.list"}, firewallEndpointsPermissions...))
 			if err != nil {
-				fmt.Printf("# Error testing roles: %v\n", err)
-				return
-			}
-
-			if len(intersection(cleanPermission, identityPermissions)) != len(cleanPermission) {
-				fmt.Printf("# Missing required role: %s \n", role)
+				return append(findings, permissionCheckFinding(role, fmt.Sprintf("projects/%s", project), err))
 			}
+			findings = append(findings, f...)
 		}
 	}
 
 	for _, role := range orgLevelRoles {
-		fmt.Printf("# Checking role %s at organization %s. \n", role, g.OrgID)
-
-		rolePermissions, err := gcp.NewGCP().GetRolePermissions(t, role)
+		f, err := checkRole(t, role, fmt.Sprintf("organizations/%s", g.OrgID), member, nil)
 		if err != nil {
-			fmt.Printf("# Error getting roles: %v\n", err)
-			return
-		}
-
-		identityPermissions, err := testIAMPermissions(t, rolePermissions, fmt.Sprintf("organizations/%s", g.OrgID))
-		if err != nil {
-			fmt.Printf("# Error testing roles: %v\n", err)
-			return
-		}
-
-		if len(intersection(rolePermissions, identityPermissions)) != len(rolePermissions) {
-			fmt.Printf("# Missing required role: %s \n", role)
+			return append(findings, permissionCheckFinding(role, fmt.Sprintf("organizations/%s", g.OrgID), err))
 		}
+		findings = append(findings, f...)
 	}
 
 	for _, role := range folderLevelRoles {
-		fmt.Printf("# Checking role %s at folder %s. \n", role, g.CommonFolderID)
-
-		rolePermissions, err := gcp.NewGCP().GetRolePermissions(t, role)
+		f, err := checkRole(t, role, g.CommonFolderID, member, append([]string{"resourcemanager.organizations.get"}, firewallEndpointsPermissions...))
 		if err != nil {
-			fmt.Printf("# Error getting roles: %v\n", err)
-			return
-		}
-		cleanPermission := []string{}
-		for _, permission := range rolePermissions {
-			if permission != "resourcemanager.organizations.get" && permission != "networksecurity.firewallEndpoints.create" &&
-				permission != "networksecurity.firewallEndpoints.delete" && permission != "networksecurity.firewallEndpoints.get" &&
-				permission != "networksecurity.firewallEndpoints.list" && permission != "networksecurity.firewallEndpoints.update" &&
-				permission != "networksecurity.firewallEndpoints.use" {
-				cleanPermission = append(cleanPermission, permission)
-			}
-		}
-
-		identityPermissions, err := testIAMPermissions(t, cleanPermission, g.CommonFolderID)
-		if err != nil {
-			fmt.Printf("# Error testing roles: %v\n", err)
-			return
-		}
-
-		if len(intersection(cleanPermission, identityPermissions)) != len(cleanPermission) {
-			fmt.Printf("# Missing required role: %s \n", role)
+			return append(findings, permissionCheckFinding(role, g.CommonFolderID, err))
 		}
+		findings = append(findings, f...)
 	}
+	return findings
 }
 
-// testIAMPermissions checks a set of permissions against a parent (projects/PROJECT_ID or folders/FORLDER_ID of organizations/ORG_ID) using the cloudresourcemanager:testIamPermissions V3 API
-func testIAMPermissions(t testing.TB, permissions []string, parent string) ([]string, error) {
-	client := &http.Client{}
-	identityPermissions := []string{}
-	chunkSize := 100
-
-	// avoid "The number of permissions (xxx) is greater than the maximum allowed (100).
-	for i := 0; i < len(permissions); i += chunkSize {
-		// Calculate the end index for the current chunk
-		end := i + chunkSize
-		if end > len(permissions) {
-			end = len(permissions)
-		}
-
-		// Extract the current chunk
-		chunk := permissions[i:end]
+// checkRole checks if the identity has all the permissions of the role on the parent resource.
+// The ignored permissions, that can not be tested on the parent resource, are not checked.
+func checkRole(t testing.TB, role, parent, member string, ignored []string) ([]Finding, error) {
+	rolePermissions, err := gcp.NewGCP().GetRolePermissions(t, role)
+	if err != nil {
+		return nil, err
+	}
 
-		requestBody := map[string][]string{"permissions": chunk}
-		jsonBody, _ := json.Marshal(requestBody)
-		req, err := http.NewRequest("POST", fmt.Sprintf("https://cloudresourcemanager.googleapis.com/v3/%s:testIamPermissions", parent), bytes.NewBuffer([]byte(jsonBody)))
-		req.Header.Add("Authorization", "Bearer "+gcp.NewGCP().GetAuthToken(t))
-		resp, err := client.Do(req)
-		if err != nil {
-			fmt.Printf("# Error making request: %v\n", err)
+	cleanPermission := []string{}
+	for _, permission := range rolePermissions {
+		if !slices.Contains(ignored, permission) {
+			cleanPermission = append(cleanPermission, permission)
 		}
-		defer resp.Body.Close()
+	}
+	identityPermissions, err := gcp.NewGCP().TestIAMPermissions(t, parent, cleanPermission)
+	if err != nil {
+		return nil, err
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body) // Read error body (ignore error to avoid shadowing)
-			return nil, fmt.Errorf("# Error request failed with status code: %d, body: %s \n", resp.StatusCode, string(bodyBytes))
-		} else {
-			bodyBytes, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return nil, fmt.Errorf("# Error failed to read response body: %w \n", err)
-			}
-			bodyJson := map[string][]string{}
-			err = json.Unmarshal(bodyBytes, &bodyJson)
-			if err != nil {
-				return nil, fmt.Errorf("failed to unmarshal JSON: %w \n", err)
-			}
-			identityPermissions = append(identityPermissions, bodyJson["permissions"]...)
-		}
+	if len(intersection(cleanPermission, identityPermissions)) != len(cleanPermission) {
+		return []Finding{newFinding("iam.role", parent,
+			fmt.Sprintf("Missing required role: %s.", role),
+			fmt.Sprintf("Grant the role %s on %s to the identity running the deploy.", role, parent)).
+			withFix(iamBindingFix(parent, member, role))}, nil
 	}
-	return identityPermissions, nil
+	return nil, nil
 }
 
-// ValidateDestroyFlags checks if the flags to allow the destruction of the infrastructure are enabled
-func ValidateDestroyFlags(t testing.TB, g GlobalTFVars) {
-	trueFlags := []string{}
-	falseFlags := []string{}
-	projectDeletion := false
+func permissionCheckFinding(role, parent string, err error) Finding {
+	return newFinding("iam.check", parent,
+		fmt.Sprintf("Failed to check role %s: %v", role, err),
+		"Check if the identity running the deploy can get roles and test IAM permissions.")
+}
 
+// ValidateDestroyFlags checks if the flags to allow the destruction of the infrastructure are enabled
+func ValidateDestroyFlags(t testing.TB, g GlobalTFVars) []Finding {
+	findings := []Finding{}
 	if !g.BucketForceDestroy {
-		trueFlags = append(trueFlags, "buckets_force_destroy")
+		findings = append(findings, newFinding("destroy.flags", "bucket_force_destroy",
+			"Buckets can not be destroyed by the helper.",
+			"To use the feature to destroy the deployment created by this helper, set 'bucket_force_destroy' to 'true' in the tfvars file.").withSeverity(SeverityWarning))
 	}
-
-	projectDeletion = g.DeletionProtection
-
-	if len(trueFlags) > 0 || len(falseFlags) > 0 || projectDeletion {
-		fmt.Println("# To use the feature to destroy the deployment created by this helper,")
-		if len(trueFlags) > 0 {
-			fmt.Println("# please set the following flags to 'true' in the tfvars file:")
-			fmt.Printf("# %s\n", strings.Join(trueFlags, ", "))
-		}
-		if len(falseFlags) > 0 {
-			fmt.Println("# please set the following flags to 'false' in the tfvars file:")
-			fmt.Printf("# %s\n", strings.Join(falseFlags, ", "))
-		}
-		if projectDeletion {
-			fmt.Println("# please set the project_deletion_policy input to 'DELETE' in the tfvars file")
-		}
+	if g.DeletionProtection {
+		findings = append(findings, newFinding("destroy.flags", "deletion_protection",
+			"Projects can not be destroyed by the helper.",
+			"To use the feature to destroy the deployment created by this helper, set 'deletion_protection' to 'false' in the tfvars file.").withSeverity(SeverityWarning))
 	}
+	return findings
 }
 
 func intersection(first, second []string) []string {
@@ -502,89 +532,102 @@ func ipRangeSize(ipRange string, minimunSize int) bool {
 
 }
 
-func ValidateNetworkRequirementes(t testing.TB, g GlobalTFVars) {
-	fmt.Println("# Checking Network Requirements.")
+// ValidateNetworkRequirementes checks if the subnets of the environments have private access and the required secondary ranges.
+func ValidateNetworkRequirementes(t testing.TB, g GlobalTFVars) []Finding {
+	findings := []Finding{}
 	for _, envs := range g.Envs {
 		for _, subnet := range envs.SubnetsSelfLinks {
-			fmt.Printf("# Checking subnet %s.", subnet)
-
-			subnetInfo, err := extractInfoWithRegex(subnet, `projects/(?P<project>[^/]+)/regions/(?P<region>[^/]+)/subnetworks/(?P<subnet>[^/]+)`)
+			subnetInfo, err := parseResourceName(subnet, subnetPattern)
 			if err != nil {
-				fmt.Printf("# error extracting info for subnet. %v \n", err)
-				return
+				// reported by ValidateSchema
+				continue
 			}
 
 			res := gcp.NewGCP().Runf(t, "compute networks subnets describe %s --region=%s --project=%s", subnetInfo["subnet"], subnetInfo["region"], subnetInfo["project"])
-			fmt.Println("# Checking Private Access.")
 			if !res.Get("privateIpGoogleAccess").Bool() {
-				fmt.Println("# Your subnet should have Private Access Enabled.")
+				findings = append(findings, newFinding("network.private-access", subnet,
+					"Subnet does not have Private Google Access enabled.",
+					fmt.Sprintf("Run 'gcloud compute networks subnets update %s --region=%s --project=%s --enable-private-ip-google-access'.", subnetInfo["subnet"], subnetInfo["region"], subnetInfo["project"])).
+					withFix(privateAccessFix(subnetInfo["project"], subnetInfo["region"], subnetInfo["subnet"])))
 			}
 
-			fmt.Println("# Checking existance of secondary ranges.")
 			if len(res.Get("secondaryIpRanges").Array()) < 2 {
-				fmt.Println("# Your subnet should have at least 2 secondary ranges.")
+				findings = append(findings, newFinding("network.secondary-ranges", subnet,
+					"Subnet should have at least 2 secondary ranges.",
+					"Add secondary ranges for the GKE pods and services to the subnet."))
 			}
 
-			fmt.Println("# Checking secondary ranges size.")
 			for _, ipRange := range res.Get("secondaryIpRanges").Array() {
 				if !ipRangeSize(ipRange.Get("ipCidrRange").String(), 18) {
-					fmt.Printf("# Your secondary range %s should have at least a /18. Current: %s \n", ipRange.Get("rangeName").String(), ipRange.Get("ipCidrRange").String())
+					findings = append(findings, newFinding("network.secondary-range-size", subnet,
+						fmt.Sprintf("Secondary range %s should have at least a /18. Current: %s.", ipRange.Get("rangeName").String(), ipRange.Get("ipCidrRange").String()),
+						"Use a secondary range with a /18 or larger prefix."))
 				}
 			}
 		}
 	}
-
+	return findings
 }
 
-func ValidatePrivateWorkerPoolRequirementes(t testing.TB, g GlobalTFVars) {
-	fmt.Println("# Checking Private Worker Pool requirements.")
-	workerPoolInfo, err := extractInfoWithRegex(g.WorkerPoolID, `projects/(?P<project>[^/]+)/locations/(?P<location>[^/]+)/workerPools/(?P<workerPool>[^/]+)`)
+// ValidatePrivateWorkerPoolRequirementes checks if the Cloud Build worker pool is private and has no public egress.
+func ValidatePrivateWorkerPoolRequirementes(t testing.TB, g GlobalTFVars) []Finding {
+	findings := []Finding{}
+	workerPoolInfo, err := parseResourceName(g.WorkerPoolID, workerPoolIDPattern)
 	if err != nil {
-		fmt.Println("Worker Pool ID is not in the correct format: `projects/PROJECT_ID/locations/LOCATION/workerPools/NAME`.")
+		// reported by ValidateSchema
+		return findings
 	}
 
-	res := gcp.NewGCP().Runf(t, "builds worker-pools describe %s --region=%s --project=%s", workerPoolInfo["workerPool"], workerPoolInfo["location"], workerPoolInfo["project"])
+	wp := gcp.NewGCP().GetWorkerPool(t, workerPoolInfo["project"], workerPoolInfo["location"], workerPoolInfo["workerPool"])
 
-	if res.Get("privatePoolV1Config").Get("networkConfig").Get("egressOption").String() != "NO_PUBLIC_EGRESS" {
-		fmt.Println("Your worker pool ALLOWS PUBLIC EGRESS! It should NOT.")
+	if wp.EgressOption != "NO_PUBLIC_EGRESS" {
+		findings = append(findings, newFinding("workerpool.public-egress", g.WorkerPoolID,
+			"Worker pool ALLOWS PUBLIC EGRESS.",
+			"Create the worker pool with the egress option NO_PUBLIC_EGRESS."))
 	}
 
-	if res.Get("privatePoolV1Config").Get("networkConfig").Get("peeredNetwork").String() == "" {
-		fmt.Println("Your worker pool is NOT private. Should have a peered Network.")
-		return
+	if wp.PeeredNetwork == "" {
+		return append(findings, newFinding("workerpool.private", g.WorkerPoolID,
+			"Worker pool is NOT private, it has no peered network.",
+			"Create the worker pool with a peered network."))
 	}
-	if !ipRangeSize(fmt.Sprintf("0.0.0.0%s", res.Get("privatePoolV1Config").Get("networkConfig").Get("peeredNetworkIpRange").String()), 24) {
-		fmt.Println("Your Peered IP range should be at least /24.")
+	if !ipRangeSize(fmt.Sprintf("0.0.0.0%s", wp.PeeredNetworkIPRange), 24) {
+		findings = append(findings, newFinding("workerpool.peered-range", g.WorkerPoolID,
+			"Peered IP range should be at least /24.",
+			"Use a peered network IP range with a /24 or larger prefix."))
 	}
-
+	return findings
 }
 
-func ValidateVPCSCRequirements(t testing.TB, g GlobalTFVars) {
-	fmt.Println("#Checking VPC-SC requirementes.")
-	if g.ServicePerimeterName != nil {
-		if g.AccessLevelName == nil {
-			fmt.Println("You must provide the associated Access Level name to be used with Service Perimeter.")
-			return
-		}
-
-		fmt.Println("#Checking if perimeter exists.")
-		res := gcp.NewGCP().Runf(t, "access-context-manager perimeters describe %s ", g.ServicePerimeterName)
-		found := false
-		fieldToCheck := "status"
-		if *g.ServicePerimeterMode == "DRY_RUN" {
-			fieldToCheck = "spec"
-		}
-		res.Get(fieldToCheck).Get("accessLevels").ForEach(func(k, v gjson.Result) bool {
-			if v.String() == *g.AccessLevelName {
-				found = true
-				return false
-			}
-			return true
-		})
-		if !found {
-			fmt.Println("#The access level provided does not match if the access levels associated with service perimeter.")
-		}
-	} else {
-		fmt.Println("#No Service Perimeter provided.")
-	}
+// ValidateVPCSCRequirements checks if the access level is associated with the service perimeter.
+func ValidateVPCSCRequirements(t testing.TB, g GlobalTFVars) []Finding {
+	findings := []Finding{}
+	if g.ServicePerimeterName == nil {
+		return append(findings, newFinding("vpcsc.perimeter", "service_perimeter_name",
+			"No Service Perimeter provided.", "").withSeverity(SeverityInfo))
+	}
+	// a missing access level is reported by ValidateSchema
+	if g.AccessLevelName == nil {
+		return findings
+	}
+
+	res := gcp.NewGCP().Runf(t, "access-context-manager perimeters describe %s ", *g.ServicePerimeterName)
+	found := false
+	fieldToCheck := "status"
+	if g.ServicePerimeterMode != nil && *g.ServicePerimeterMode == "DRY_RUN" {
+		fieldToCheck = "spec"
+	}
+	res.Get(fieldToCheck).Get("accessLevels").ForEach(func(k, v gjson.Result) bool {
+		if v.String() == *g.AccessLevelName {
+			found = true
+			return false
+		}
+		return true
+	})
+	if !found {
+		findings = append(findings, newFinding("vpcsc.access-level", *g.ServicePerimeterName,
+			fmt.Sprintf("The access level '%s' is not associated with the service perimeter.", *g.AccessLevelName),
+			"Add the access level to the service perimeter or provide an access level associated with it."))
+	}
+	return findings
 }
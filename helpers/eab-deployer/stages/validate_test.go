@@ -0,0 +1,113 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRepositories(t *testing.T) {
+	created := false
+	responses := map[string]string{
+		"/api/v3/repos/org/eab-multitenant":                     `{"full_name": "org/eab-multitenant", "private": true, "default_branch": "main", "permissions": {"push": true}}`,
+		"/api/v3/repos/org/eab-fleetscope":                      `{"full_name": "org/eab-fleetscope", "private": false, "default_branch": "plan", "permissions": {"push": false}}`,
+		"/api/v3/repos/org/eab-fleetscope/branches/production":  `{"name": "production", "protected": true}`,
+		"/api/v3/repos/org/eab-multitenant/branches/production": `{"name": "production", "protected": false}`,
+		"/api/v3/user": `{"login": "me"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/api/v3/orgs/org/repos" {
+			created = true
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(resp))
+	}))
+	defer server.Close()
+
+	config := CloudbuildV2RepositoryConfig{
+		RepoType: "GITHUBv2",
+		Repositories: map[string]Repository{
+			"multitenant":        {RepositoryName: "eab-multitenant", RepositoryURL: server.URL + "/org/eab-multitenant.git"},
+			"fleetscope":         {RepositoryName: "eab-fleetscope", RepositoryURL: server.URL + "/org/eab-fleetscope.git"},
+			"applicationfactory": {RepositoryName: "eab-applicationfactory", RepositoryURL: server.URL + "/org/eab-applicationfactory.git"},
+		},
+	}
+	branches := repositoryBranches{pushed: []string{"plan", "production"}, reserved: []string{"plan", "production"}}
+	findings := validateRepositories(context.Background(), "infra_cloudbuildv2_repository_config", config, branches, true, "token", server.Client())
+
+	checks := map[string][]string{}
+	for _, f := range findings {
+		checks[f.Resource] = append(checks[f.Resource], f.CheckID)
+	}
+	assert.Equal(t, []string{"repositories.exists"}, checks[server.URL+"/org/eab-applicationfactory.git"])
+	assert.Equal(t, []string{"repositories.push", "repositories.private", "repositories.default-branch", "repositories.branch-protection"}, checks[server.URL+"/org/eab-fleetscope.git"])
+	assert.Empty(t, checks[server.URL+"/org/eab-multitenant.git"])
+
+	// protected branches are updated with pull requests without -force_push
+	noForce := validateRepositories(context.Background(), "infra_cloudbuildv2_repository_config", config, branches, false, "token", server.Client())
+	assert.NotContains(t, checkIDs(noForce), "repositories.branch-protection "+server.URL+"/org/eab-fleetscope.git")
+	assert.Len(t, noForce, len(findings)-1)
+
+	// the main branch of the services repositories is their default branch
+	services := CloudbuildV2RepositoryConfig{
+		RepoType:     "GITHUBv2",
+		Repositories: map[string]Repository{"hello-world": {RepositoryName: "eab-multitenant", RepositoryURL: server.URL + "/org/eab-multitenant.git"}},
+	}
+	responses["/api/v3/repos/org/eab-multitenant/branches/main"] = `{"name": "main", "protected": true}`
+	assert.Equal(t, []string{"repositories.branch-protection " + server.URL + "/org/eab-multitenant.git"},
+		checkIDs(validateRepositories(context.Background(), "app_services_cloudbuildv2_repository_config", services, repositoryBranches{pushed: []string{"main"}}, true, "token", server.Client())))
+
+	require.NotNil(t, findings[0].Fix)
+	assert.Equal(t, "create-repository.org-eab-applicationfactory", findings[0].Fix.ID)
+	require.NoError(t, findings[0].Fix.apply(t))
+	assert.True(t, created)
+}
+
+func TestValidateRepositoriesWithoutTokenSecret(t *testing.T) {
+	g := readValidTFVars(t)
+	g.InfraCloudbuildV2RepositoryConfig = CloudbuildV2RepositoryConfig{RepoType: "GITHUBv2"}
+	assert.Equal(t, []string{"repositories.accessible infra_cloudbuildv2_repository_config"}, checkIDs(ValidateRepositories(t, g, false)))
+
+	g.InfraCloudbuildV2RepositoryConfig = CloudbuildV2RepositoryConfig{RepoType: "GITLABv2"}
+	findings := ValidateRepositories(t, g, false)
+	require.Len(t, findings, 1)
+	assert.Contains(t, findings[0].Message, "gitlab_authorizer_credential_secret_id is required")
+}
+
+func TestOnlineValidatorsSkipInvalidFormats(t *testing.T) {
+	g := readValidTFVars(t)
+	g.WorkerPoolID = "xprojects/a/locations/b/workerPools/c/extra"
+	dev := g.Envs["development"]
+	dev.SubnetsSelfLinks = []string{"subnet"}
+	g.Envs = map[string]Env{"development": dev}
+
+	// the format is reported once by ValidateSchema, the online validators do not call gcloud with invalid values
+	assert.Empty(t, ValidatePrivateWorkerPoolRequirementes(t, g))
+	assert.Empty(t, ValidateNetworkRequirementes(t, g))
+	assert.Contains(t, checkIDs(ValidateSchema(g)), "workerpool.format workerpool_id")
+	assert.Contains(t, checkIDs(ValidateSchema(g)), "network.subnet-format subnet")
+}
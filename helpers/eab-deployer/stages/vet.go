@@ -30,21 +30,29 @@ import (
 )
 
 // TerraformVet runs gcloud terraform vet on the plan of the provided terraform directory
-func TerraformVet(t testing.TB, terraformDir, policyPath, project string) error {
+// envVars are the environment variables used to run terraform.
+func TerraformVet(t testing.TB, terraformDir, policyPath, project string, envVars map[string]string) error {
 
 	fmt.Println("")
 	fmt.Println("# Running gcloud terraform vet")
 	fmt.Println("")
 
+	planDir, err := os.MkdirTemp("", "tfvet")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(planDir)
+
 	options := &terraform.Options{
 		TerraformDir:       terraformDir,
+		EnvVars:            envVars,
 		Logger:             logger.Discard,
 		NoColor:            true,
-		PlanFilePath:       filepath.Join(os.TempDir(), "plan.tfplan"),
+		PlanFilePath:       filepath.Join(planDir, "plan.tfplan"),
 		MaxRetries:         MaxErrorRetries,
 		TimeBetweenRetries: TimeBetweenErrorRetries,
 	}
-	_, err := terraform.PlanE(t, options)
+	_, err = terraform.PlanE(t, options)
 	if err != nil {
 		return err
 	}
@@ -54,7 +62,6 @@ func TerraformVet(t testing.TB, terraformDir, policyPath, project string) error
 	}
 	jsonFile, err := utils.WriteTmpFileWithExtension(jsonPlan, "json")
 	defer os.Remove(jsonFile)
-	defer os.Remove(options.PlanFilePath)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,214 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+)
+
+const (
+	// storageEmulatorHost is the environment variable with the address of a Cloud Storage emulator, like fake-gcs-server.
+	storageEmulatorHost = "STORAGE_EMULATOR_HOST"
+	generationHeader    = "X-Goog-Generation"
+)
+
+// ErrStateModified is returned when the state was modified by another process after it was read.
+var ErrStateModified = errors.New("state was modified by another process")
+
+// GCSStore keeps the state in a Cloud Storage object.
+// Writes use generation-match preconditions, so a write fails if the object changed since it was read.
+type GCSStore struct {
+	bucket     string
+	object     string
+	service    *storage.Service
+	generation int64
+}
+
+// NewGCSStore creates a state store for the given gs://BUCKET/OBJECT location.
+// If the STORAGE_EMULATOR_HOST environment variable is set, the store uses the emulator without authentication.
+func NewGCSStore(location string, opts ...option.ClientOption) (*GCSStore, error) {
+	bucket, object, found := strings.Cut(strings.TrimPrefix(location, gcsPrefix), "/")
+	if !found || bucket == "" || object == "" {
+		return nil, fmt.Errorf("invalid Cloud Storage location '%s', expected format is gs://BUCKET/OBJECT", location)
+	}
+	if host := os.Getenv(storageEmulatorHost); host != "" && len(opts) == 0 {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		opts = []option.ClientOption{
+			option.WithEndpoint(strings.TrimSuffix(host, "/") + "/storage/v1/"),
+			option.WithoutAuthentication(),
+		}
+	}
+	service, err := storage.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud Storage service: %w", err)
+	}
+	return &GCSStore{
+		bucket:  bucket,
+		object:  object,
+		service: service,
+	}, nil
+}
+
+// Location returns the gs:// location of the state object.
+func (g *GCSStore) Location() string {
+	return fmt.Sprintf("%s%s/%s", gcsPrefix, g.bucket, g.object)
+}
+
+// Read reads the state object and records its generation for the following writes.
+func (g *GCSStore) Read() ([]byte, error) {
+	data, generation, err := g.download(g.object)
+	if err != nil {
+		if isHTTPStatus(err, http.StatusNotFound) {
+			g.generation = 0
+			return nil, fmt.Errorf("state '%s': %w", g.Location(), os.ErrNotExist)
+		}
+		return nil, err
+	}
+	g.generation = generation
+	return data, nil
+}
+
+// Write replaces the state object if it was not modified since the last read or write.
+func (g *GCSStore) Write(data []byte) error {
+	generation, err := g.upload(g.object, data, g.generation)
+	if err != nil {
+		if isHTTPStatus(err, http.StatusPreconditionFailed) {
+			return fmt.Errorf("failed to save state '%s': %w", g.Location(), ErrStateModified)
+		}
+		return err
+	}
+	g.generation = generation
+	return nil
+}
+
+// Delete deletes the state object if it was not modified since the last read or write.
+func (g *GCSStore) Delete() error {
+	call := g.service.Objects.Delete(g.bucket, g.object)
+	if g.generation != 0 {
+		call = call.IfGenerationMatch(g.generation)
+	}
+	err := call.Do()
+	if isHTTPStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	if isHTTPStatus(err, http.StatusPreconditionFailed) {
+		return fmt.Errorf("failed to delete state '%s': %w", g.Location(), ErrStateModified)
+	}
+	return err
+}
+
+// Lock creates a lock object next to the state object.
+// The lock object is only created if it does not exist.
+func (g *GCSStore) Lock() (func() error, error) {
+	lockObject := LockFileName(g.object)
+	lockLocation := fmt.Sprintf("%s%s/%s", gcsPrefix, g.bucket, lockObject)
+	info, err := newLockInfo()
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < 2; i++ {
+		generation, err := g.upload(lockObject, content, 0)
+		if err == nil {
+			return func() error {
+				err := g.service.Objects.Delete(g.bucket, lockObject).IfGenerationMatch(generation).Do()
+				if isHTTPStatus(err, http.StatusNotFound) {
+					return nil
+				}
+				return err
+			}, nil
+		}
+		if !isHTTPStatus(err, http.StatusPreconditionFailed) {
+			return nil, err
+		}
+
+		data, holderGeneration, err := g.download(lockObject)
+		if isHTTPStatus(err, http.StatusNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var holder LockInfo
+		if err := json.Unmarshal(data, &holder); err != nil {
+			return nil, fmt.Errorf("steps file '%s' is locked, failed to read lock '%s': %w", g.Location(), lockLocation, err)
+		}
+		if !holder.isStale(info.Host) {
+			return nil, holder.lockedError(g.Location(), lockLocation)
+		}
+		fmt.Printf("# removing stale lock of process %d on steps file '%s'\n", holder.PID, g.Location())
+		err = g.service.Objects.Delete(g.bucket, lockObject).IfGenerationMatch(holderGeneration).Do()
+		if err != nil && !isHTTPStatus(err, http.StatusNotFound) && !isHTTPStatus(err, http.StatusPreconditionFailed) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("failed to lock steps file '%s'", g.Location())
+}
+
+// download reads the content and the generation of an object.
+func (g *GCSStore) download(object string) ([]byte, int64, error) {
+	resp, err := g.service.Objects.Get(g.bucket, object).Download()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	generation, err := strconv.ParseInt(resp.Header.Get(generationHeader), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid generation for object '%s': %w", object, err)
+	}
+	return data, generation, nil
+}
+
+// upload writes an object if its current generation matches the given generation.
+// A generation of zero means that the object must not exist.
+func (g *GCSStore) upload(object string, data []byte, generation int64) (int64, error) {
+	obj, err := g.service.Objects.Insert(g.bucket, &storage.Object{Name: object, ContentType: "application/json"}).
+		Media(bytes.NewReader(data), googleapi.ContentType("application/json")).
+		IfGenerationMatch(generation).
+		Do()
+	if err != nil {
+		return 0, err
+	}
+	return obj.Generation, nil
+}
+
+// isHTTPStatus checks if the error is a Google API error with the given HTTP status code.
+func isHTTPStatus(err error, code int) bool {
+	var e *googleapi.Error
+	return errors.As(err, &e) && e.Code == code
+}
@@ -0,0 +1,203 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeObject struct {
+	data       []byte
+	generation int64
+}
+
+// fakeGCS is a minimal Cloud Storage JSON API server supporting
+// media download, multipart upload and delete with generation-match preconditions.
+type fakeGCS struct {
+	mu         sync.Mutex
+	objects    map[string]fakeObject
+	generation int64
+}
+
+func newFakeGCS(t *testing.T) *fakeGCS {
+	f := &fakeGCS{objects: map[string]fakeObject{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	t.Setenv(storageEmulatorHost, server.URL)
+	return f
+}
+
+func writeGCSError(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": "%s"}}`, code, http.StatusText(code))
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := r.URL.EscapedPath()
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/upload/storage/v1/b/"):
+		bucket := strings.TrimSuffix(strings.TrimPrefix(path, "/upload/storage/v1/b/"), "/o")
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		metadata, err := mr.NextPart()
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest)
+			return
+		}
+		var obj struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(metadata).Decode(&obj); err != nil {
+			writeGCSError(w, http.StatusBadRequest)
+			return
+		}
+		media, err := mr.NextPart()
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(media)
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest)
+			return
+		}
+		key := bucket + "/" + obj.Name
+		if !f.matches(key, r.URL.Query()) {
+			writeGCSError(w, http.StatusPreconditionFailed)
+			return
+		}
+		f.generation++
+		f.objects[key] = fakeObject{data: data, generation: f.generation}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"bucket": "%s", "name": "%s", "generation": "%d"}`, bucket, obj.Name, f.generation)
+	case strings.HasPrefix(path, "/storage/v1/b/"):
+		bucket, object, _ := strings.Cut(strings.TrimPrefix(path, "/storage/v1/b/"), "/o/")
+		name, err := url.PathUnescape(object)
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest)
+			return
+		}
+		key := bucket + "/" + name
+		o, ok := f.objects[key]
+		if !ok {
+			writeGCSError(w, http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set(generationHeader, strconv.FormatInt(o.generation, 10))
+			w.Write(o.data)
+		case http.MethodDelete:
+			if !f.matches(key, r.URL.Query()) {
+				writeGCSError(w, http.StatusPreconditionFailed)
+				return
+			}
+			delete(f.objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeGCSError(w, http.StatusMethodNotAllowed)
+		}
+	default:
+		writeGCSError(w, http.StatusNotFound)
+	}
+}
+
+// matches checks the ifGenerationMatch precondition of the request.
+func (f *fakeGCS) matches(key string, query url.Values) bool {
+	if !query.Has("ifGenerationMatch") {
+		return true
+	}
+	expected, err := strconv.ParseInt(query.Get("ifGenerationMatch"), 10, 64)
+	if err != nil {
+		return false
+	}
+	return f.objects[key].generation == expected
+}
+
+func TestGCSStore(t *testing.T) {
+	newFakeGCS(t)
+	location := "gs://state-bucket/deploy/steps.json"
+
+	s, err := LoadSteps(location)
+	assert.NoError(t, err)
+	assert.Equal(t, location, s.File)
+	assert.NoError(t, s.CompleteStep("gcp-bootstrap"))
+	assert.NoError(t, s.FailStep("gcp-multitenant", "build failed"))
+
+	// a teammate resumes the deployment
+	r, err := LoadSteps(location)
+	assert.NoError(t, err)
+	assert.True(t, r.IsStepComplete("gcp-bootstrap"))
+	assert.Equal(t, "build failed", r.GetStepError("gcp-multitenant"))
+	assert.NoError(t, r.CompleteStep("gcp-multitenant"))
+
+	// the state changed after it was read, the write must fail
+	err = s.CompleteStep("gcp-fleetscope")
+	assert.True(t, errors.Is(err, ErrStateModified), "expected ErrStateModified, got %v", err)
+
+	assert.NoError(t, r.Delete())
+	d, err := LoadSteps(location)
+	assert.NoError(t, err)
+	assert.Empty(t, d.ListSteps())
+}
+
+func TestGCSStoreLock(t *testing.T) {
+	fake := newFakeGCS(t)
+	store, err := NewGCSStore("gs://state-bucket/steps.json")
+	assert.NoError(t, err)
+
+	release, err := store.Lock()
+	assert.NoError(t, err)
+	_, err = store.Lock()
+	assert.ErrorContains(t, err, "gs://state-bucket/steps.json' is locked by process")
+	assert.NoError(t, release())
+
+	release, err = store.Lock()
+	assert.NoError(t, err)
+	assert.NoError(t, release())
+
+	// lock held by a process in other host
+	other, err := json.Marshal(LockInfo{PID: 1, Host: "ci-runner", Created: time.Now()})
+	assert.NoError(t, err)
+	fake.objects["state-bucket/steps.json.lock"] = fakeObject{data: other, generation: 100}
+	_, err = store.Lock()
+	assert.ErrorContains(t, err, "locked by process 1 on host ci-runner")
+
+	_, err = NewGCSStore("gs://bucket-only")
+	assert.ErrorContains(t, err, "invalid Cloud Storage location")
+}
@@ -0,0 +1,155 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	lockSuffix = ".lock"
+)
+
+// LockInfo identifies the process holding the lock of a steps file.
+type LockInfo struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Created time.Time `json:"created"`
+}
+
+// FileLock is an advisory lock on a steps file.
+// The lock is a file next to the steps file, created exclusively, with the identity of the lock holder.
+type FileLock struct {
+	path string
+}
+
+// LockFileName returns the name of the lock file of the given steps file.
+func LockFileName(file string) string {
+	return file + lockSuffix
+}
+
+// AcquireLock locks the given steps file.
+// It fails if the lock is held by another process.
+// A lock left behind by a process that is no longer running in the same host is removed.
+func AcquireLock(file string) (*FileLock, error) {
+	path := LockFileName(file)
+	info, err := newLockInfo()
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(content)
+			if e := f.Close(); err == nil {
+				err = e
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return &FileLock{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		holder, err := readLockInfo(path)
+		if err != nil {
+			return nil, fmt.Errorf("steps file '%s' is locked, failed to read lock file '%s': %w", file, path, err)
+		}
+		if !holder.isStale(info.Host) {
+			return nil, holder.lockedError(file, path)
+		}
+		fmt.Printf("# removing stale lock of process %d on steps file '%s'\n", holder.PID, file)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("failed to lock steps file '%s'", file)
+}
+
+// Release removes the lock.
+func (l *FileLock) Release() error {
+	if l == nil {
+		return nil
+	}
+	err := os.Remove(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// newLockInfo creates the lock holder identity of the current process.
+func newLockInfo() (LockInfo, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return LockInfo{}, err
+	}
+	return LockInfo{
+		PID:     os.Getpid(),
+		Host:    host,
+		Created: time.Now().UTC(),
+	}, nil
+}
+
+// isStale checks if the lock holder is a process that is no longer running in the given host.
+func (i LockInfo) isStale(host string) bool {
+	return i.Host == host && !isProcessRunning(i.PID)
+}
+
+// lockedError creates the error returned when the state is locked by the lock holder.
+func (i LockInfo) lockedError(location, lockLocation string) error {
+	return fmt.Errorf("steps file '%s' is locked by process %d on host %s since %s. If the process is no longer running remove the lock '%s'",
+		location, i.PID, i.Host, i.Created.Format(time.RFC3339), lockLocation)
+}
+
+// readLockInfo reads the identity of the lock holder from the lock file.
+func readLockInfo(path string) (LockInfo, error) {
+	var info LockInfo
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(f, &info)
+	return info, err
+}
+
+// isProcessRunning checks if a process with the given PID is running in the current host.
+func isProcessRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	if err == nil {
+		return true
+	}
+	return !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH)
+}
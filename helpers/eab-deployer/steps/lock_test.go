@@ -0,0 +1,64 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "steps.json")
+
+	lock, err := AcquireLock(file)
+	assert.NoError(t, err)
+
+	host, err := os.Hostname()
+	assert.NoError(t, err)
+	_, err = AcquireLock(file)
+	assert.ErrorContains(t, err, fmt.Sprintf("locked by process %d on host %s", os.Getpid(), host))
+
+	assert.NoError(t, lock.Release())
+	lock, err = AcquireLock(file)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Release())
+}
+
+func TestAcquireStaleLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "steps.json")
+	host, err := os.Hostname()
+	assert.NoError(t, err)
+
+	// lock of a process that is not running in this host
+	stale, err := json.Marshal(LockInfo{PID: 2147483646, Host: host, Created: time.Now()})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(LockFileName(file), stale, 0644))
+	lock, err := AcquireLock(file)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Release())
+
+	// lock of a process in other host
+	other, err := json.Marshal(LockInfo{PID: 2147483646, Host: "other-host", Created: time.Now()})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(LockFileName(file), other, 0644))
+	_, err = AcquireLock(file)
+	assert.ErrorContains(t, err, "locked by process 2147483646 on host other-host")
+}
@@ -0,0 +1,65 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"errors"
+	"sync"
+)
+
+// RunParallel calls f for each item using at most parallelism concurrent calls.
+// With a parallelism of one or less, or a single item, the items are processed in order and the first error stops the execution.
+// Otherwise, no new calls are started after an error and the errors of all the calls started are joined.
+func RunParallel[T any](items []T, parallelism int, f func(T) error) error {
+	if parallelism <= 1 || len(items) == 1 {
+		for _, item := range items {
+			if err := f(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   []error
+		failed bool
+	)
+	sem := make(chan struct{}, parallelism)
+	for _, item := range items {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(item T) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := f(item); err != nil {
+				mu.Lock()
+				failed = true
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(item)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunParallel(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	processed := []string{}
+	err := RunParallel(keys, 2, func(key string) error {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		processed = append(processed, key)
+		mu.Unlock()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, keys, processed)
+	assert.Equal(t, 2, maxRunning, "at most two keys should be processed at the same time")
+
+	// no keys are started after the first error and the errors of the started keys are joined
+	started := []string{}
+	release := make(chan struct{})
+	err = RunParallel(keys, 2, func(key string) error {
+		mu.Lock()
+		started = append(started, key)
+		mu.Unlock()
+		if key == "a" {
+			<-release
+			return fmt.Errorf("failed")
+		}
+		close(release)
+		// b fails after a, so a is the first failure when c would start
+		time.Sleep(10 * time.Millisecond)
+		return fmt.Errorf("failed too")
+	})
+	assert.EqualError(t, err, "failed\nfailed too")
+	assert.ElementsMatch(t, []string{"a", "b"}, started)
+
+	// with a parallelism of one the keys are processed in order until the first error
+	processed = []string{}
+	err = RunParallel(keys, 1, func(key string) error {
+		processed = append(processed, key)
+		if key == "c" {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, []string{"a", "b", "c"}, processed)
+}
@@ -0,0 +1,423 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Stage is a unit of the deployment registered in a Registry.
+// Name is also the name of the step used to save the stage progress.
+// Inputs are outputs of other stages used by the stage, the stage depends on the stages that produce them.
+// Plan is optional, it reports the changes the stage would make without changing anything.
+// Drift is optional, it reports the differences between the deployed stage and its Terraform code.
+// Upgrade is optional, it rolls a new version of the stage code to the deployed stage.
+type Stage struct {
+	Name        string
+	Description string
+	DependsOn   []string
+	Inputs      []string
+	Outputs     []string
+	Deploy      func() error
+	Destroy     func() error
+	Plan        func() error
+	Drift       func() error
+	Upgrade     func() error
+}
+
+// Registry holds the stages of a deployment and the dependencies between them.
+type Registry struct {
+	stages map[string]Stage
+	names  []string
+}
+
+// NewRegistry creates an empty stage registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		stages: map[string]Stage{},
+	}
+}
+
+// Register adds a stage to the registry.
+// Stage names and the outputs produced by each stage must be unique.
+func (r *Registry) Register(stage Stage) error {
+	if stage.Name == "" {
+		return fmt.Errorf("stage name is required")
+	}
+	if _, ok := r.stages[stage.Name]; ok {
+		return fmt.Errorf("stage '%s' is already registered", stage.Name)
+	}
+	for _, o := range stage.Outputs {
+		if p := r.Producer(o); p != "" {
+			return fmt.Errorf("output '%s' of stage '%s' is already produced by stage '%s'", o, stage.Name, p)
+		}
+	}
+	r.stages[stage.Name] = stage
+	r.names = append(r.names, stage.Name)
+	return nil
+}
+
+// Get returns the stage with the given name.
+func (r *Registry) Get(name string) (Stage, bool) {
+	s, ok := r.stages[name]
+	return s, ok
+}
+
+// Names returns the names of the registered stages in registration order.
+func (r *Registry) Names() []string {
+	return append([]string{}, r.names...)
+}
+
+// Producer returns the name of the stage that produces the given output.
+func (r *Registry) Producer(output string) string {
+	for _, n := range r.names {
+		for _, o := range r.stages[n].Outputs {
+			if o == output {
+				return n
+			}
+		}
+	}
+	return ""
+}
+
+// dependencies returns the names of the stages a stage depends on, the stages in DependsOn and the producers of its inputs.
+func (r *Registry) dependencies(name string) []string {
+	deps := slices.Clone(r.stages[name].DependsOn)
+	for _, i := range r.stages[name].Inputs {
+		if p := r.Producer(i); p != "" && !slices.Contains(deps, p) {
+			deps = append(deps, p)
+		}
+	}
+	return deps
+}
+
+// Levels groups the stages in dependency levels.
+// A stage only depends on stages of previous levels, so the stages of a level are independent from each other.
+// Inside a level the stages keep the registration order.
+func (r *Registry) Levels() ([][]Stage, error) {
+	for _, n := range r.names {
+		for _, d := range r.stages[n].DependsOn {
+			if _, ok := r.stages[d]; !ok {
+				return nil, fmt.Errorf("stage '%s' depends on unknown stage '%s'", n, d)
+			}
+		}
+		for _, i := range r.stages[n].Inputs {
+			if r.Producer(i) == "" {
+				return nil, fmt.Errorf("stage '%s' uses output '%s' that no stage produces", n, i)
+			}
+		}
+	}
+
+	levels := [][]Stage{}
+	placed := map[string]bool{}
+	for len(placed) < len(r.names) {
+		level := []Stage{}
+		for _, n := range r.names {
+			if placed[n] {
+				continue
+			}
+			ready := true
+			for _, d := range r.dependencies(n) {
+				if !placed[d] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, r.stages[n])
+			}
+		}
+		if len(level) == 0 {
+			pending := []string{}
+			for _, n := range r.names {
+				if !placed[n] {
+					pending = append(pending, n)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between stages: %s", strings.Join(pending, ", "))
+		}
+		for _, st := range level {
+			placed[st.Name] = true
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// DeployOrder returns the stages in an order where each stage comes after the stages it depends on.
+func (r *Registry) DeployOrder() ([]Stage, error) {
+	levels, err := r.Levels()
+	if err != nil {
+		return nil, err
+	}
+	order := []Stage{}
+	for _, l := range levels {
+		order = append(order, l...)
+	}
+	return order, nil
+}
+
+// DestroyOrder returns the stages in the reverse of the deploy order.
+func (r *Registry) DestroyOrder() ([]Stage, error) {
+	order, err := r.DeployOrder()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order, nil
+}
+
+// StageFilter selects the stages executed by DeployStages and DestroyStages.
+// Stages are selected by name or description, all the stages are selected if Stages is empty.
+// Partial means that only some of the steps of the selected stages are executed,
+// so the progress of the stages themselves is not recorded.
+// Parallelism is the maximum number of stages of the same dependency level deployed or destroyed
+// at the same time, stages are executed one at a time if it is lower than 2.
+type StageFilter struct {
+	Stages      []string
+	Partial     bool
+	Parallelism int
+}
+
+// Select returns the names of the stages selected by the filter.
+func (r *Registry) Select(f StageFilter) (map[string]bool, error) {
+	selected := map[string]bool{}
+	if len(f.Stages) == 0 {
+		for _, n := range r.names {
+			selected[n] = true
+		}
+		return selected, nil
+	}
+	for _, target := range f.Stages {
+		found := false
+		for _, n := range r.names {
+			if n == target || r.stages[n].Description == target {
+				selected[n] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown stage '%s', valid stages are: %s", target, strings.Join(r.names, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// dependents returns the names of the stages that depend on the given stage.
+func (r *Registry) dependents(name string) []string {
+	d := []string{}
+	for _, n := range r.names {
+		if slices.Contains(r.dependencies(n), name) {
+			d = append(d, n)
+		}
+	}
+	return d
+}
+
+// DeployStages runs the deploy function of the selected stages in deploy order.
+// Each stage is executed as a step, so completed stages are not executed again.
+// The stages of a dependency level are executed in parallel, up to the parallelism of the filter.
+// Selected stages can not depend on stages that are not selected and not completed.
+func (s Steps) DeployStages(r *Registry, f StageFilter) error {
+	levels, err := r.Levels()
+	if err != nil {
+		return err
+	}
+	selected, err := r.Select(f)
+	if err != nil {
+		return err
+	}
+	for _, l := range levels {
+		for _, st := range l {
+			if !selected[st.Name] {
+				continue
+			}
+			for _, d := range r.dependencies(st.Name) {
+				if !selected[d] && !s.IsStepComplete(d) {
+					return fmt.Errorf("stage '%s' depends on stage '%s' that is not deployed", st.Name, d)
+				}
+			}
+		}
+	}
+	for _, l := range levels {
+		err = RunParallel(l, f.Parallelism, func(st Stage) error {
+			if st.Deploy == nil || !selected[st.Name] {
+				return nil
+			}
+			ss := s.levelSteps(l, f, st)
+			var err error
+			if f.Partial {
+				ss.logf("# starting stage '%s' partial execution\n", st.Name)
+				err = st.Deploy()
+			} else {
+				err = ss.RunStep(st.Name, st.Deploy)
+			}
+			if err != nil {
+				return fmt.Errorf("stage '%s' deploy failed: %w", st.Name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DestroyStages runs the destroy function of the selected stages in destroy order.
+// The stages of a dependency level are executed in parallel, up to the parallelism of the filter.
+// Stages without a destroy function are skipped.
+// Stages depending on the selected stages must be selected, destroyed or never deployed.
+func (s Steps) DestroyStages(r *Registry, f StageFilter) error {
+	levels, err := r.Levels()
+	if err != nil {
+		return err
+	}
+	selected, err := r.Select(f)
+	if err != nil {
+		return err
+	}
+	for _, n := range r.names {
+		if !selected[n] {
+			continue
+		}
+		for _, d := range r.dependents(n) {
+			if !selected[d] && s.StepExists(d) && !s.IsStepDestroyed(d) {
+				return fmt.Errorf("stage '%s' can not be destroyed before stage '%s' that depends on it", n, d)
+			}
+		}
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		// stages of a level are destroyed in the reverse of the registration order when executed one at a time
+		l := slices.Clone(levels[i])
+		slices.Reverse(l)
+		err = RunParallel(l, f.Parallelism, func(st Stage) error {
+			if st.Destroy == nil || !selected[st.Name] {
+				return nil
+			}
+			ss := s.levelSteps(l, f, st)
+			var err error
+			if f.Partial {
+				if !s.StepExists(st.Name) || s.IsStepDestroyed(st.Name) {
+					ss.logf("# skipping stage '%s' destruction\n", st.Name)
+					return nil
+				}
+				ss.logf("# starting stage '%s' partial destruction\n", st.Name)
+				err = st.Destroy()
+			} else {
+				err = ss.RunDestroyStep(st.Name, st.Destroy)
+			}
+			if err != nil {
+				return fmt.Errorf("stage '%s' destroy failed: %w", st.Name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// levelSteps returns the steps used to run a stage of a level, prefixed with the stage name
+// when the stages of the level run in parallel.
+func (s Steps) levelSteps(level []Stage, f StageFilter, st Stage) Steps {
+	if f.Parallelism > 1 && len(level) > 1 {
+		return s.WithLogPrefix(st.Name)
+	}
+	return s
+}
+
+// PlanStages runs the plan function of the registered stages in deploy order.
+// The progress of the steps is not changed.
+// Stages without a plan function, or depending on stages that are not completed,
+// can not be planned and are reported to skip with the reason.
+func (s Steps) PlanStages(r *Registry, skip func(stage, reason string)) error {
+	order, err := r.DeployOrder()
+	if err != nil {
+		return err
+	}
+	for _, st := range order {
+		if st.Plan == nil {
+			skip(st.Name, "stage does not support dry run")
+			continue
+		}
+		pending := []string{}
+		for _, d := range r.dependencies(st.Name) {
+			if !s.IsStepComplete(d) {
+				pending = append(pending, d)
+			}
+		}
+		if len(pending) > 0 {
+			skip(st.Name, fmt.Sprintf("depends on stages not deployed yet: %s", strings.Join(pending, ", ")))
+			continue
+		}
+		fmt.Printf("# planning stage '%s'\n", st.Name)
+		err = st.Plan()
+		if err != nil {
+			return fmt.Errorf("stage '%s' plan failed: %w", st.Name, err)
+		}
+	}
+	return nil
+}
+
+// DriftStages runs the drift function of the selected stages in deploy order.
+// The progress of the steps is not changed.
+// Stages without a drift function, or not completed, are reported to skip with the reason.
+func (s Steps) DriftStages(r *Registry, f StageFilter, skip func(stage, reason string)) error {
+	return s.runDeployedStages(r, f, "drift detection", func(st Stage) func() error { return st.Drift }, skip)
+}
+
+// UpgradeStages runs the upgrade function of the selected stages in deploy order.
+// Stages without an upgrade function, or not completed, are reported to skip with the reason.
+func (s Steps) UpgradeStages(r *Registry, f StageFilter, skip func(stage, reason string)) error {
+	return s.runDeployedStages(r, f, "upgrade", func(st Stage) func() error { return st.Upgrade }, skip)
+}
+
+// runDeployedStages runs an action of the selected stages that are completed, in deploy order.
+func (s Steps) runDeployedStages(r *Registry, f StageFilter, action string, fn func(Stage) func() error, skip func(stage, reason string)) error {
+	order, err := r.DeployOrder()
+	if err != nil {
+		return err
+	}
+	selected, err := r.Select(f)
+	if err != nil {
+		return err
+	}
+	for _, st := range order {
+		if !selected[st.Name] {
+			continue
+		}
+		run := fn(st)
+		if run == nil {
+			skip(st.Name, fmt.Sprintf("stage does not support %s", action))
+			continue
+		}
+		if !s.IsStepComplete(st.Name) {
+			skip(st.Name, "stage is not deployed")
+			continue
+		}
+		fmt.Printf("# starting stage '%s' %s\n", st.Name, action)
+		err = run()
+		if err != nil {
+			return fmt.Errorf("stage '%s' %s failed: %w", st.Name, action, err)
+		}
+	}
+	return nil
+}
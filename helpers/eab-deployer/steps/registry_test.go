@@ -0,0 +1,321 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stageNames(stages []Stage) []string {
+	names := []string{}
+	for _, s := range stages {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestRegistryOrder(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "appinfra", DependsOn: []string{"fleetscope", "appfactory"}}))
+	assert.NoError(t, r.Register(Stage{Name: "bootstrap", Outputs: []string{"bootstrap-outputs"}}))
+	assert.NoError(t, r.Register(Stage{Name: "fleetscope", DependsOn: []string{"multitenant"}}))
+	assert.NoError(t, r.Register(Stage{Name: "appfactory", DependsOn: []string{"multitenant"}}))
+	assert.NoError(t, r.Register(Stage{Name: "multitenant", DependsOn: []string{"bootstrap"}}))
+
+	levels, err := r.Levels()
+	assert.NoError(t, err)
+	assert.Len(t, levels, 4)
+	assert.Equal(t, []string{"fleetscope", "appfactory"}, stageNames(levels[2]))
+
+	deploy, err := r.DeployOrder()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bootstrap", "multitenant", "fleetscope", "appfactory", "appinfra"}, stageNames(deploy))
+
+	destroy, err := r.DestroyOrder()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"appinfra", "appfactory", "fleetscope", "multitenant", "bootstrap"}, stageNames(destroy))
+
+	assert.Equal(t, "bootstrap", r.Producer("bootstrap-outputs"))
+	assert.Error(t, r.Register(Stage{Name: "bootstrap"}), "duplicated stage should fail")
+	assert.Error(t, r.Register(Stage{Name: "other", Outputs: []string{"bootstrap-outputs"}}), "duplicated output should fail")
+}
+
+func TestRegistryInputs(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "appinfra", Inputs: []string{"appfactory-outputs"}}))
+	assert.NoError(t, r.Register(Stage{Name: "appfactory", Inputs: []string{"bootstrap-outputs"}, Outputs: []string{"appfactory-outputs"}}))
+	assert.NoError(t, r.Register(Stage{Name: "bootstrap", Outputs: []string{"bootstrap-outputs"}}))
+
+	deploy, err := r.DeployOrder()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bootstrap", "appfactory", "appinfra"}, stageNames(deploy))
+	assert.Equal(t, []string{"appinfra"}, r.dependents("appfactory"))
+
+	assert.NoError(t, r.Register(Stage{Name: "other", Inputs: []string{"missing-outputs"}}))
+	_, err = r.DeployOrder()
+	assert.ErrorContains(t, err, "stage 'other' uses output 'missing-outputs' that no stage produces")
+}
+
+func TestRegistryInvalidDependencies(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "one", DependsOn: []string{"missing"}}))
+	_, err := r.DeployOrder()
+	assert.ErrorContains(t, err, "unknown stage 'missing'")
+
+	r = NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "one", DependsOn: []string{"two"}}))
+	assert.NoError(t, r.Register(Stage{Name: "two", DependsOn: []string{"one"}}))
+	_, err = r.DeployOrder()
+	assert.ErrorContains(t, err, "dependency cycle")
+}
+
+func TestDeployAndDestroyStages(t *testing.T) {
+	s, err := LoadSteps(filepath.Join(t.TempDir(), "stages.json"))
+	assert.NoError(t, err)
+
+	calls := []string{}
+	r := NewRegistry()
+	for _, n := range []string{"one", "two", "three"} {
+		stage := Stage{
+			Name: n,
+			Deploy: func() error {
+				calls = append(calls, "deploy-"+n)
+				return nil
+			},
+		}
+		if n != "three" {
+			stage.Destroy = func() error {
+				calls = append(calls, "destroy-"+n)
+				return nil
+			}
+		}
+		if n == "two" {
+			stage.DependsOn = []string{"one"}
+		}
+		if n == "three" {
+			stage.DependsOn = []string{"two"}
+		}
+		assert.NoError(t, r.Register(stage))
+	}
+
+	assert.NoError(t, s.DeployStages(r, StageFilter{}))
+	assert.NoError(t, s.DestroyStages(r, StageFilter{}))
+	assert.Equal(t, []string{"deploy-one", "deploy-two", "deploy-three", "destroy-two", "destroy-one"}, calls)
+	assert.True(t, s.IsStepDestroyed("one"))
+	assert.True(t, s.IsStepComplete("three"))
+
+	r = NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "bad", Deploy: func() error { return fmt.Errorf("failed") }}))
+	err = s.DeployStages(r, StageFilter{})
+	assert.ErrorContains(t, err, "stage 'bad' deploy failed")
+	assert.Equal(t, "failed", s.GetStepError("bad"))
+}
+
+func TestParallelStages(t *testing.T) {
+	s, err := LoadSteps(filepath.Join(t.TempDir(), "stages.json"))
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	calls := []string{}
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	// the stages of the second level only finish when both are running
+	started := sync.WaitGroup{}
+	started.Add(2)
+	concurrent := func(n string) func() error {
+		return func() error {
+			started.Done()
+			done := make(chan struct{})
+			go func() { started.Wait(); close(done) }()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("stage %s is not running concurrently", n)
+			}
+			record("deploy-" + n)
+			return nil
+		}
+	}
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "one", Deploy: func() error { record("deploy-one"); return nil }}))
+	assert.NoError(t, r.Register(Stage{Name: "two", DependsOn: []string{"one"}, Deploy: concurrent("two")}))
+	assert.NoError(t, r.Register(Stage{Name: "three", DependsOn: []string{"one"}, Deploy: concurrent("three")}))
+	assert.NoError(t, r.Register(Stage{Name: "four", DependsOn: []string{"two", "three"}, Deploy: func() error { record("deploy-four"); return nil }}))
+
+	assert.NoError(t, s.DeployStages(r, StageFilter{Parallelism: 2}))
+	assert.Equal(t, "deploy-one", calls[0])
+	assert.ElementsMatch(t, []string{"deploy-two", "deploy-three"}, calls[1:3])
+	assert.Equal(t, "deploy-four", calls[3])
+
+	// failed stages stop the next levels and their errors are joined
+	s, err = LoadSteps(filepath.Join(t.TempDir(), "stages.json"))
+	assert.NoError(t, err)
+	calls = []string{}
+	r = NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "one", Deploy: func() error { return fmt.Errorf("one failed") }}))
+	assert.NoError(t, r.Register(Stage{Name: "two", Deploy: func() error { return fmt.Errorf("two failed") }}))
+	assert.NoError(t, r.Register(Stage{Name: "three", DependsOn: []string{"one", "two"}, Deploy: func() error { record("deploy-three"); return nil }}))
+	err = s.DeployStages(r, StageFilter{Parallelism: 2})
+	assert.ErrorContains(t, err, "stage 'one' deploy failed: one failed")
+	assert.ErrorContains(t, err, "stage 'two' deploy failed: two failed")
+	assert.Empty(t, calls)
+}
+
+func TestFilteredStages(t *testing.T) {
+	s, err := LoadSteps(filepath.Join(t.TempDir(), "stages.json"))
+	assert.NoError(t, err)
+
+	calls := []string{}
+	r := NewRegistry()
+	for _, st := range []Stage{
+		{Name: "one", Description: "1-one"},
+		{Name: "two", Description: "2-two", DependsOn: []string{"one"}},
+		{Name: "three", Description: "3-three", DependsOn: []string{"two"}},
+	} {
+		n := st.Name
+		st.Deploy = func() error {
+			calls = append(calls, "deploy-"+n)
+			return nil
+		}
+		st.Destroy = func() error {
+			calls = append(calls, "destroy-"+n)
+			return nil
+		}
+		assert.NoError(t, r.Register(st))
+	}
+
+	err = s.DeployStages(r, StageFilter{Stages: []string{"missing"}})
+	assert.ErrorContains(t, err, "unknown stage 'missing'")
+	err = s.DeployStages(r, StageFilter{Stages: []string{"2-two"}})
+	assert.EqualError(t, err, "stage 'two' depends on stage 'one' that is not deployed")
+	assert.Empty(t, calls)
+
+	assert.NoError(t, s.DeployStages(r, StageFilter{Stages: []string{"1-one", "two"}}))
+	assert.NoError(t, s.DeployStages(r, StageFilter{Stages: []string{"three"}, Partial: true}))
+	assert.Equal(t, []string{"deploy-one", "deploy-two", "deploy-three"}, calls)
+	assert.True(t, s.IsStepComplete("two"))
+	assert.False(t, s.StepExists("three"), "partial executions must not complete the stage")
+
+	assert.NoError(t, s.WithRerun().DeployStages(r, StageFilter{Stages: []string{"two"}}))
+	assert.Equal(t, "deploy-two", calls[len(calls)-1])
+
+	assert.NoError(t, s.CompleteStep("three"))
+	err = s.DestroyStages(r, StageFilter{Stages: []string{"two"}})
+	assert.EqualError(t, err, "stage 'two' can not be destroyed before stage 'three' that depends on it")
+
+	calls = []string{}
+	assert.NoError(t, s.DestroyStages(r, StageFilter{Stages: []string{"three"}, Partial: true}))
+	assert.NoError(t, s.DestroyStages(r, StageFilter{Stages: []string{"two", "three"}}))
+	assert.Equal(t, []string{"destroy-three", "destroy-three", "destroy-two"}, calls)
+	assert.True(t, s.IsStepDestroyed("two"))
+}
+
+func TestPlanStages(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "stages.json")
+	s, err := LoadSteps(file)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CompleteStep("one"))
+
+	planned := []string{}
+	plan := func(n string) func() error {
+		return func() error {
+			planned = append(planned, n)
+			return nil
+		}
+	}
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "one", Plan: plan("one")}))
+	assert.NoError(t, r.Register(Stage{Name: "two", DependsOn: []string{"one"}, Plan: plan("two")}))
+	assert.NoError(t, r.Register(Stage{Name: "three", DependsOn: []string{"two"}, Plan: plan("three")}))
+	assert.NoError(t, r.Register(Stage{Name: "four", DependsOn: []string{"one"}}))
+
+	skipped := map[string]string{}
+	err = s.PlanStages(r, func(stage, reason string) {
+		skipped[stage] = reason
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"one", "two"}, planned)
+	assert.Equal(t, map[string]string{
+		"three": "depends on stages not deployed yet: two",
+		"four":  "stage does not support dry run",
+	}, skipped)
+
+	// planning does not change the progress
+	assert.False(t, s.StepExists("two"))
+	l, err := LoadSteps(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"one COMPLETED"}, l.ListSteps())
+
+	r = NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "bad", Plan: func() error { return fmt.Errorf("failed") }}))
+	assert.ErrorContains(t, s.PlanStages(r, func(string, string) {}), "stage 'bad' plan failed: failed")
+}
+
+func TestDriftStages(t *testing.T) {
+	s, err := LoadSteps(filepath.Join(t.TempDir(), "stages.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, s.CompleteStep("one"))
+	assert.NoError(t, s.CompleteStep("three"))
+
+	checked := []string{}
+	drift := func(n string) func() error {
+		return func() error {
+			checked = append(checked, n)
+			return nil
+		}
+	}
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "one", Drift: drift("one")}))
+	assert.NoError(t, r.Register(Stage{Name: "two", DependsOn: []string{"one"}, Drift: drift("two")}))
+	assert.NoError(t, r.Register(Stage{Name: "three", DependsOn: []string{"one"}}))
+
+	skipped := map[string]string{}
+	err = s.DriftStages(r, StageFilter{}, func(stage, reason string) {
+		skipped[stage] = reason
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"one"}, checked)
+	assert.Equal(t, map[string]string{
+		"two":   "stage is not deployed",
+		"three": "stage does not support drift detection",
+	}, skipped)
+
+	checked = []string{}
+	assert.NoError(t, s.DriftStages(r, StageFilter{Stages: []string{"two"}}, func(string, string) {}))
+	assert.Empty(t, checked)
+
+	r = NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "one", Upgrade: drift("upgrade-one")}))
+	assert.NoError(t, r.Register(Stage{Name: "two", DependsOn: []string{"one"}, Upgrade: drift("upgrade-two")}))
+	skipped = map[string]string{}
+	assert.NoError(t, s.UpgradeStages(r, StageFilter{}, func(stage, reason string) {
+		skipped[stage] = reason
+	}))
+	assert.Equal(t, []string{"upgrade-one"}, checked)
+	assert.Equal(t, map[string]string{"two": "stage is not deployed"}, skipped)
+
+	r = NewRegistry()
+	assert.NoError(t, r.Register(Stage{Name: "one", Upgrade: func() error { return fmt.Errorf("failed") }}))
+	assert.EqualError(t, s.UpgradeStages(r, StageFilter{}, func(string, string) {}), "stage 'one' upgrade failed: failed")
+}
@@ -0,0 +1,122 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	TableFormat = "table"
+	JSONFormat  = "json"
+)
+
+// sortedSteps returns the steps sorted by name.
+func (s Steps) sortedSteps() []Step {
+	defer s.lock()()
+	list := make([]Step, 0, len(s.Steps))
+	for _, step := range s.Steps {
+		list = append(list, step)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// WriteReport writes the steps to w in the given format, table or json.
+func (s Steps) WriteReport(w io.Writer, format string) error {
+	switch format {
+	case TableFormat:
+		return s.WriteTable(w)
+	case JSONFormat:
+		return s.WriteJSON(w)
+	default:
+		return fmt.Errorf("invalid steps report format '%s', valid formats are '%s' and '%s'", format, TableFormat, JSONFormat)
+	}
+}
+
+// WriteTable writes the steps to w as a table.
+// The errors of the previous attempts of a step are listed after the step.
+func (s Steps) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tATTEMPTS\tSTART\tDURATION\tOPERATOR\tCOMMIT\tERROR")
+	for _, step := range s.sortedSteps() {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			step.Name,
+			step.Status,
+			step.Attempts,
+			formatTime(step.StartTime),
+			formatDuration(step.Duration()),
+			valueOrDash(step.Operator),
+			valueOrDash(shortCommit(step.Commit)),
+			valueOrDash(firstLine(step.Error)),
+		)
+		// the last error is already shown in the step row
+		for _, h := range step.History {
+			if step.Status == failedStatus && h.Attempt == step.Attempts && h.Error == step.Error {
+				continue
+			}
+			fmt.Fprintf(tw, "  attempt %d\t%s\t\t%s\t\t\t\t%s\n", h.Attempt, failedStatus, h.Time.Format(time.RFC3339), firstLine(h.Error))
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the steps to w as a JSON array sorted by step name.
+func (s Steps) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.sortedSteps())
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.String()
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
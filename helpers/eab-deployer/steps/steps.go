@@ -16,10 +16,13 @@ package steps
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -30,14 +33,56 @@ const (
 )
 
 type Step struct {
-	Name   string `json:"name"`
-	Status string `json:"status"`
-	Error  string `json:"error"`
+	Name      string      `json:"name"`
+	Status    string      `json:"status"`
+	Error     string      `json:"error"`
+	StartTime *time.Time  `json:"start_time,omitempty"`
+	EndTime   *time.Time  `json:"end_time,omitempty"`
+	Attempts  int         `json:"attempts,omitempty"`
+	Operator  string      `json:"operator,omitempty"`
+	Commit    string      `json:"commit,omitempty"`
+	History   []StepError `json:"history,omitempty"`
 }
 
+// StepError is an error of a previous attempt of a step.
+type StepError struct {
+	Attempt int       `json:"attempt"`
+	Time    time.Time `json:"time"`
+	Error   string    `json:"error"`
+}
+
+// RunInfo identifies who is running the steps and which version of the code is used.
+type RunInfo struct {
+	Operator string
+	Commit   string
+}
+
+// Steps holds the execution state of the steps.
+// It is safe for concurrent use by steps executed in parallel.
 type Steps struct {
-	File  string          `json:"file"`
-	Steps map[string]Step `json:"steps"`
+	File    string          `json:"file"`
+	Steps   map[string]Step `json:"steps"`
+	mu      *sync.Mutex
+	store   StateStore
+	runInfo *RunInfo
+	rerun   bool
+	prefix  string
+}
+
+// now returns the current time used in the step records.
+var now = defaultNow
+
+func defaultNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// Duration returns the duration of the last execution of the step.
+// It is zero if the step has not finished.
+func (s Step) Duration() time.Duration {
+	if s.StartTime == nil || s.EndTime == nil {
+		return 0
+	}
+	return s.EndTime.Sub(*s.StartTime)
 }
 
 // String creates a string representation of the step
@@ -48,73 +93,163 @@ func (s Step) String() string {
 	return fmt.Sprintf("%s %s error:%s", s.Name, s.Status, s.Error)
 }
 
-// DeleteStepsFile deletes the whole steps file
+// DeleteStepsFile deletes the whole steps file and its backups
 func DeleteStepsFile(file string) error {
-	_, err := os.Stat(file)
-	if err != nil && !os.IsNotExist(err) {
+	store, err := NewStateStore(file)
+	if err != nil {
 		return err
 	}
-	if !os.IsNotExist(err) {
-		return os.Remove(file)
-	}
-	return nil
+	return store.Delete()
 }
 
-// LoadSteps loads a previous execution steps from the given file.
+// LoadSteps loads a previous execution steps from the given location.
+// The location is a local file path or a Cloud Storage object in the format gs://BUCKET/OBJECT.
 func LoadSteps(file string) (Steps, error) {
+	store, err := NewStateStore(file)
+	if err != nil {
+		return Steps{}, err
+	}
+	return LoadStepsFromStore(store)
+}
+
+// LoadStepsFromStore loads a previous execution steps from the given state store.
+func LoadStepsFromStore(store StateStore) (Steps, error) {
 	var s Steps
-	_, err := os.Stat(file)
-	if err != nil && !os.IsNotExist(err) {
+	f, err := store.Read()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return s, err
 	}
-	if os.IsNotExist(err) {
-		fmt.Printf("# creating new steps file '%s'.\n", file)
-		s = Steps{
-			File: file,
-		}
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("# creating new steps file '%s'.\n", store.Location())
 	} else {
-		f, err := os.ReadFile(file)
-		if err != nil {
-			return s, err
-		}
 		err = json.Unmarshal(f, &s)
 		if err != nil {
 			return s, err
 		}
-		s.File = file
 	}
+	s.File = store.Location()
 	if s.Steps == nil {
 		s.Steps = map[string]Step{}
 	}
+	s.store = store
+	s.mu = &sync.Mutex{}
+	s.runInfo = &RunInfo{}
 	return s, nil
 }
 
-// SaveSteps saves the current execution state of the steps in the file that was loaded.
+// SetRunInfo sets the operator and the code commit recorded in the steps executed from now on.
+func (s Steps) SetRunInfo(info RunInfo) {
+	defer s.lock()()
+	if s.runInfo != nil {
+		*s.runInfo = info
+	}
+}
+
+// lock locks the steps state and returns the function to unlock it.
+func (s Steps) lock() func() {
+	if s.mu == nil {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// SaveSteps saves the current execution state of the steps in the store that was loaded.
 func (s Steps) SaveSteps() error {
+	defer s.lock()()
+	return s.save()
+}
+
+// save writes the steps to the store. The caller must hold the lock.
+func (s Steps) save() error {
 	f, err := json.MarshalIndent(s, "", "    ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.File, f, 0644)
+	if s.store == nil {
+		return fmt.Errorf("steps '%s' were not loaded from a state store", s.File)
+	}
+	return s.store.Write(f)
+}
+
+// Delete deletes the steps from the store that was loaded.
+func (s Steps) Delete() error {
+	defer s.lock()()
+	if s.store == nil {
+		return DeleteStepsFile(s.File)
+	}
+	return s.store.Delete()
+}
+
+// updateStep updates a step, keeping its audit information, and saves the steps file.
+func (s Steps) updateStep(name string, update func(step *Step)) error {
+	defer s.lock()()
+	step := s.Steps[name]
+	step.Name = name
+	update(&step)
+	s.Steps[name] = step
+	return s.save()
+}
+
+// setStatus sets the status and the error of a step.
+// The end time is set for all the statuses except pending.
+func (s Steps) setStatus(name, status, err string) error {
+	return s.updateStep(name, func(step *Step) {
+		step.Status = status
+		step.Error = err
+		if status == pendingStatus {
+			step.EndTime = nil
+			return
+		}
+		end := now()
+		step.EndTime = &end
+		if err != "" {
+			step.History = append(step.History, StepError{
+				Attempt: step.Attempts,
+				Time:    end,
+				Error:   err,
+			})
+		}
+	})
+}
+
+// startStep records the start of a new attempt to execute a step.
+func (s Steps) startStep(name string) error {
+	return s.updateStep(name, func(step *Step) {
+		start := now()
+		step.StartTime = &start
+		step.EndTime = nil
+		step.Attempts++
+		if step.Status == "" {
+			step.Status = pendingStatus
+		}
+		if s.runInfo != nil {
+			step.Operator = s.runInfo.Operator
+			step.Commit = s.runInfo.Commit
+		}
+	})
+}
+
+// getStep gets a step and checks if it exists.
+func (s Steps) getStep(name string) (Step, bool) {
+	defer s.lock()()
+	v, ok := s.Steps[name]
+	return v, ok
 }
 
 // CompleteStep marks a given step as completed.
 func (s Steps) CompleteStep(name string) error {
-	s.Steps[name] = Step{
-		Name:   name,
-		Status: completedStatus,
-	}
-	err := s.SaveSteps()
+	err := s.setStatus(name, completedStatus, "")
 	if err != nil {
 		return err
 	}
-	fmt.Printf("# completing step '%s' execution\n", name)
+	s.logf("# completing step '%s' execution\n", name)
 	return nil
 }
 
 // IsStepComplete checks if the given step is completed.
 func (s Steps) IsStepComplete(name string) bool {
-	v, ok := s.Steps[name]
+	v, ok := s.getStep(name)
 	if ok {
 		return v.Status == completedStatus
 	}
@@ -123,22 +258,13 @@ func (s Steps) IsStepComplete(name string) bool {
 
 // StepExists checks if the given step exists
 func (s Steps) StepExists(name string) bool {
-	_, ok := s.Steps[name]
+	_, ok := s.getStep(name)
 	return ok
 }
 
 // FailStep marks a given step as failed and saves the error message.
 func (s Steps) FailStep(name string, err string) error {
-	s.Steps[name] = Step{
-		Name:   name,
-		Status: failedStatus,
-		Error:  err,
-	}
-	e := s.SaveSteps()
-	if e != nil {
-		return e
-	}
-	return nil
+	return s.setStatus(name, failedStatus, err)
 }
 
 func isNested(name string) bool {
@@ -151,15 +277,11 @@ func parent(name string) string {
 
 // ResetStep resets the execution status of a given step and its parent.
 func (s Steps) ResetStep(name string) error {
-	s.Steps[name] = Step{
-		Name:   name,
-		Status: pendingStatus,
-	}
-	err := s.SaveSteps()
+	err := s.setStatus(name, pendingStatus, "")
 	if err != nil {
 		return err
 	}
-	fmt.Printf("# resetting step '%s' execution\n", name)
+	s.logf("# resetting step '%s' execution\n", name)
 	if isNested(name) {
 		return s.ResetStep(parent(name))
 	}
@@ -168,7 +290,7 @@ func (s Steps) ResetStep(name string) error {
 
 // GetStepError gets the error message save in an step.
 func (s Steps) GetStepError(name string) string {
-	v, ok := s.Steps[name]
+	v, ok := s.getStep(name)
 	if ok {
 		return v.Error
 	}
@@ -177,6 +299,7 @@ func (s Steps) GetStepError(name string) string {
 
 // ListSteps lists the executed steps.
 func (s Steps) ListSteps() []string {
+	defer s.lock()()
 	l := []string{}
 	for _, v := range s.Steps {
 		l = append(l, v.String())
@@ -185,15 +308,40 @@ func (s Steps) ListSteps() []string {
 	return l
 }
 
+// WithRerun returns a copy of the steps that executes again the completed steps.
+func (s Steps) WithRerun() Steps {
+	s.rerun = true
+	return s
+}
+
+// WithLogPrefix returns a copy of the steps that adds the given prefix to the messages they print,
+// so the steps executed in parallel can be told apart.
+func (s Steps) WithLogPrefix(prefix string) Steps {
+	s.prefix = prefix
+	return s
+}
+
+// logf prints a message adding the log prefix, if any.
+func (s Steps) logf(format string, args ...interface{}) {
+	if s.prefix != "" {
+		format = "[" + strings.ReplaceAll(s.prefix, "%", "%%") + "] " + format
+	}
+	fmt.Printf(format, args...)
+}
+
 // RunStep executes a step and marks it as completed or failed.
-// Completed steps are not executed again.
+// Completed steps are not executed again, unless the steps are set to rerun them.
 func (s Steps) RunStep(step string, f func() error) error {
-	if s.IsStepComplete(step) {
-		fmt.Printf("# skipping step '%s' execution\n", step)
+	if s.IsStepComplete(step) && !s.rerun {
+		s.logf("# skipping step '%s' execution\n", step)
 		return nil
 	}
-	fmt.Printf("# starting step '%s' execution\n", step)
-	err := f()
+	s.logf("# starting step '%s' execution\n", step)
+	err := s.startStep(step)
+	if err != nil {
+		return err
+	}
+	err = f()
 	if err != nil {
 		e := s.FailStep(step, err.Error())
 		if e != nil {
@@ -206,7 +354,7 @@ func (s Steps) RunStep(step string, f func() error) error {
 
 // IsStepDestroyed checks is the step was destroyed
 func (s Steps) IsStepDestroyed(name string) bool {
-	v, ok := s.Steps[name]
+	v, ok := s.getStep(name)
 	if ok {
 		return v.Status == destroyedStatus
 	}
@@ -215,26 +363,26 @@ func (s Steps) IsStepDestroyed(name string) bool {
 
 // DestroyStep destroys the given step
 func (s Steps) DestroyStep(name string) error {
-	s.Steps[name] = Step{
-		Name:   name,
-		Status: destroyedStatus,
-	}
-	err := s.SaveSteps()
+	err := s.setStatus(name, destroyedStatus, "")
 	if err != nil {
 		return err
 	}
-	fmt.Printf("# destroying step '%s'\n", name)
+	s.logf("# destroying step '%s'\n", name)
 	return nil
 }
 
 // RunDestroyStep destroys a step and marks it as destroyed or failed.
 func (s Steps) RunDestroyStep(step string, f func() error) error {
 	if s.IsStepDestroyed(step) || !s.StepExists(step) {
-		fmt.Printf("# skipping step '%s' destruction\n", step)
+		s.logf("# skipping step '%s' destruction\n", step)
 		return nil
 	}
-	fmt.Printf("# starting step '%s' destruction\n", step)
-	err := f()
+	s.logf("# starting step '%s' destruction\n", step)
+	err := s.startStep(step)
+	if err != nil {
+		return err
+	}
+	err = f()
 	if err != nil {
 		e := s.FailStep(step, err.Error())
 		if e != nil {
@@ -15,9 +15,14 @@
 package steps
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -132,3 +137,122 @@ func TestProcessSteps(t *testing.T) {
 	}
 	assert.ElementsMatch(t, expectedSteps, s.ListSteps())
 }
+
+func TestConcurrentSteps(t *testing.T) {
+	s, err := LoadSteps(filepath.Join(t.TempDir(), "concurrent.json"))
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := s.RunStep(fmt.Sprintf("service-%d", i), func() error {
+				return s.RunStep(fmt.Sprintf("service-%d.plan", i), func() error {
+					return nil
+				})
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	l, err := LoadSteps(s.File)
+	assert.NoError(t, err)
+	assert.Len(t, l.ListSteps(), 40)
+	for i := 0; i < 20; i++ {
+		assert.True(t, l.IsStepComplete(fmt.Sprintf("service-%d", i)))
+	}
+}
+
+func TestRecoverStepsFromBackup(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "steps.json")
+	s, err := LoadSteps(file)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CompleteStep("one"))
+	assert.NoError(t, s.CompleteStep("two"))
+	assert.NoError(t, s.CompleteStep("three"))
+	assert.NoError(t, s.CompleteStep("four"))
+	assert.NoError(t, s.CompleteStep("five"))
+
+	for i := 1; i <= backupCount; i++ {
+		assert.FileExists(t, BackupFileName(file, i))
+	}
+	assert.NoFileExists(t, BackupFileName(file, backupCount+1))
+
+	// a partially written steps file is recovered from the most recent backup
+	assert.NoError(t, os.WriteFile(file, []byte(`{"file": "steps.json", "steps": {`), 0644))
+	r, err := LoadSteps(file)
+	assert.NoError(t, err)
+	assert.Equal(t, file, r.File)
+	assert.True(t, r.IsStepComplete("four"))
+	assert.False(t, r.IsStepComplete("five"))
+
+	// the recovered steps replace the invalid file on the next save
+	assert.NoError(t, r.CompleteStep("five"))
+	l, err := LoadSteps(file)
+	assert.NoError(t, err)
+	assert.Len(t, l.ListSteps(), 5)
+
+	assert.NoError(t, DeleteStepsFile(file))
+	assert.NoFileExists(t, file)
+	assert.NoFileExists(t, BackupFileName(file, 1))
+}
+
+func TestStepHistory(t *testing.T) {
+	clock := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+	t.Cleanup(func() { now = defaultNow })
+
+	file := filepath.Join(t.TempDir(), "steps.json")
+	s, err := LoadSteps(file)
+	assert.NoError(t, err)
+	s.SetRunInfo(RunInfo{Operator: "operator@example.com", Commit: "0123456789abcdef"})
+
+	err = s.RunStep("gcp-bootstrap", func() error { return fmt.Errorf("quota exceeded") })
+	assert.ErrorContains(t, err, "quota exceeded")
+	err = s.RunStep("gcp-bootstrap", func() error { return nil })
+	assert.NoError(t, err)
+
+	// history survives reloading the steps file
+	r, err := LoadSteps(file)
+	assert.NoError(t, err)
+	step := r.Steps["gcp-bootstrap"]
+	assert.Equal(t, completedStatus, step.Status)
+	assert.Equal(t, 2, step.Attempts)
+	assert.Equal(t, "operator@example.com", step.Operator)
+	assert.Equal(t, "0123456789abcdef", step.Commit)
+	assert.Equal(t, time.Minute, step.Duration())
+	assert.Equal(t, []StepError{{Attempt: 1, Time: time.Date(2025, 3, 1, 10, 2, 0, 0, time.UTC), Error: "quota exceeded"}}, step.History)
+
+	// reset keeps the audit trail
+	assert.NoError(t, r.ResetStep("gcp-bootstrap"))
+	step = r.Steps["gcp-bootstrap"]
+	assert.Equal(t, pendingStatus, step.Status)
+	assert.Equal(t, 2, step.Attempts)
+	assert.Len(t, step.History, 1)
+}
+
+func TestWriteReport(t *testing.T) {
+	s, err := LoadSteps("./testdata/history.json")
+	assert.NoError(t, err)
+
+	var table strings.Builder
+	assert.NoError(t, s.WriteReport(&table, TableFormat))
+	expected, err := os.ReadFile("./testdata/history_table.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), table.String())
+
+	var out strings.Builder
+	assert.NoError(t, s.WriteReport(&out, JSONFormat))
+	var steps []Step
+	assert.NoError(t, json.Unmarshal([]byte(out.String()), &steps))
+	assert.Len(t, steps, 3)
+	assert.Equal(t, "gcp-bootstrap", steps[0].Name)
+	assert.Equal(t, 2, steps[1].Attempts)
+
+	assert.ErrorContains(t, s.WriteReport(&out, "yaml"), "invalid steps report format 'yaml'")
+}
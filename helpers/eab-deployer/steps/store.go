@@ -0,0 +1,167 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steps
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// backupCount is the number of backups of the steps file that are kept.
+	backupCount = 3
+	gcsPrefix   = "gs://"
+)
+
+// StateStore persists the execution state of the steps.
+type StateStore interface {
+	// Location returns the location of the state.
+	Location() string
+	// Read reads the state. It returns an error matching os.ErrNotExist if there is no state.
+	Read() ([]byte, error)
+	// Write replaces the state.
+	Write(data []byte) error
+	// Delete deletes the state.
+	Delete() error
+	// Lock locks the state for the current process and returns the function to release the lock.
+	Lock() (func() error, error)
+}
+
+// NewStateStore creates the state store for the given location.
+// Locations in the format gs://BUCKET/OBJECT use a Cloud Storage object, other locations use a local file.
+func NewStateStore(location string) (StateStore, error) {
+	if strings.HasPrefix(location, gcsPrefix) {
+		return NewGCSStore(location)
+	}
+	return NewLocalStore(location), nil
+}
+
+// LocalStore keeps the state in a local file.
+// The file is replaced atomically on each write and the previous versions are kept as backups.
+type LocalStore struct {
+	file string
+}
+
+// NewLocalStore creates a state store for the given local file.
+func NewLocalStore(file string) *LocalStore {
+	return &LocalStore{file: file}
+}
+
+// Location returns the path of the steps file.
+func (l *LocalStore) Location() string {
+	return l.file
+}
+
+// Read reads the steps file.
+// If the steps file is not valid, the most recent valid backup is returned.
+func (l *LocalStore) Read() ([]byte, error) {
+	f, err := os.ReadFile(l.file)
+	if err != nil {
+		return nil, err
+	}
+	if json.Valid(f) {
+		return f, nil
+	}
+	for i := 1; i <= backupCount; i++ {
+		b, e := os.ReadFile(BackupFileName(l.file, i))
+		if e == nil && json.Valid(b) {
+			fmt.Printf("# steps file '%s' is invalid.\n", l.file)
+			fmt.Printf("# recovered steps from backup '%s'.\n", BackupFileName(l.file, i))
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("steps file '%s' is invalid and no valid backup was found", l.file)
+}
+
+// Write writes the content to a temporary file that replaces the steps file,
+// so the steps file is never left partially written. The previous version is kept as a backup.
+func (l *LocalStore) Write(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(l.file), filepath.Base(l.file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err = rotateBackups(l.file); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.file)
+}
+
+// Delete deletes the steps file and its backups.
+func (l *LocalStore) Delete() error {
+	for i := 1; i <= backupCount; i++ {
+		err := os.Remove(BackupFileName(l.file, i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err := os.Remove(l.file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Lock acquires the advisory lock of the steps file.
+func (l *LocalStore) Lock() (func() error, error) {
+	lock, err := AcquireLock(l.file)
+	if err != nil {
+		return nil, err
+	}
+	return lock.Release, nil
+}
+
+// BackupFileName returns the name of the n-th backup of the given steps file, the most recent being the first.
+func BackupFileName(file string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", file, n)
+}
+
+// rotateBackups shifts the existing backups of the steps file and saves the current steps file as the most recent backup.
+func rotateBackups(file string) error {
+	current, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// an invalid steps file is not worth a backup
+	if !json.Valid(current) {
+		return nil
+	}
+	for i := backupCount - 1; i > 0; i-- {
+		err = os.Rename(BackupFileName(file, i), BackupFileName(file, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.WriteFile(BackupFileName(file, 1), current, 0644)
+}
@@ -59,7 +59,7 @@ func cloneGit(t testing.TB, repositoryUrl, path string, logger *logger.Logger) G
 
 	if os.IsNotExist(err) {
 		cmd := exec.Command("git", "clone", repositoryUrl, path)
-		fmt.Printf("Executing command %s", cmd)
+		logger.Logf(t, "Executing command %s", cmd)
 		// Run the command and capture its standard output
 		output, err := cmd.Output()
 		if err != nil {
@@ -67,7 +67,7 @@ func cloneGit(t testing.TB, repositoryUrl, path string, logger *logger.Logger) G
 		}
 		// Convert the output to a string and trim whitespace
 		branchName := strings.TrimSpace(string(output))
-		fmt.Printf("Current Git branch: %s\n", branchName)
+		logger.Logf(t, "Current Git branch: %s", branchName)
 	}
 
 	return GitRepo{
@@ -98,6 +98,56 @@ func (g GitRepo) PushBranch(branch, remote string) error {
 	return err
 }
 
+// PushHead pushes the last commit of the current branch to a branch of 'remote' repository without overwriting it.
+// The push fails if the remote branch has commits that are not in the current branch.
+func (g GitRepo) PushHead(branch, remote string) error {
+	_, err := g.conf.RunCmdE("push", remote, fmt.Sprintf("HEAD:refs/heads/%s", branch))
+	return err
+}
+
+// Fetch fetches the branches of 'remote' repository.
+func (g GitRepo) Fetch(remote string) error {
+	_, err := g.conf.RunCmdE("fetch", "--prune", remote)
+	return err
+}
+
+// HasRemoteBranch checks if a branch exists in 'remote' repository.
+func (g GitRepo) HasRemoteBranch(branch, remote string) (bool, error) {
+	s, err := g.conf.RunCmdE("ls-remote", "--heads", remote, fmt.Sprintf("refs/heads/%s", branch))
+	if err != nil {
+		return false, err
+	}
+	return s != "", nil
+}
+
+// IsMerged checks if all the commits of ref are in the commit history of into.
+func (g GitRepo) IsMerged(ref, into string) (bool, error) {
+	s, err := g.conf.RunCmdE("rev-list", "--count", fmt.Sprintf("%s..%s", into, ref))
+	if err != nil {
+		return false, err
+	}
+	return s == "0", nil
+}
+
+// ResetBranch checkouts a branch pointing to the same commit as the branch of 'remote' repository.
+// The branch is created if it does not exist, local commits not in the remote branch are discarded.
+func (g GitRepo) ResetBranch(branch, remote string) error {
+	_, err := g.conf.RunCmdE("checkout", "-B", branch, fmt.Sprintf("%s/%s", remote, branch))
+	return err
+}
+
+// CheckoutDetached checkouts a commit, branch or remote branch, like origin/plan, without a local branch.
+// Local branches are not changed by the commits made after it.
+func (g GitRepo) CheckoutDetached(ref string) error {
+	_, err := g.conf.RunCmdE("checkout", "--detach", ref)
+	return err
+}
+
+// RemoteURL gets the URL of 'remote' repository.
+func (g GitRepo) RemoteURL(remote string) (string, error) {
+	return g.conf.RunCmdE("remote", "get-url", remote)
+}
+
 // CheckoutBranch checkouts a branch.
 // If the branch does not exist it will be created.
 func (g GitRepo) CheckoutBranch(branch string) error {
@@ -132,6 +182,45 @@ func (g GitRepo) CommitFiles(msg string) error {
 	return err
 }
 
+// DiscardChanges discards the pending changes of the repository, the changes of the tracked files and the untracked files.
+func (g GitRepo) DiscardChanges() error {
+	_, err := g.conf.RunCmdE("reset", "--hard", "HEAD")
+	if err != nil {
+		return err
+	}
+	_, err = g.conf.RunCmdE("clean", "-fd")
+	return err
+}
+
+// CommitEmpty creates a commit without changes, used to trigger a new build of the branch.
+func (g GitRepo) CommitEmpty(msg string) error {
+	_, err := g.conf.RunCmdE("commit", "--allow-empty", "-m", fmt.Sprintf("'%s'", msg))
+	return err
+}
+
+// MergeBranch merges a branch into the current branch.
+func (g GitRepo) MergeBranch(branch string) error {
+	_, err := g.conf.RunCmdE("merge", "--no-edit", branch)
+	return err
+}
+
+// Tag creates an annotated tag in the last commit of the current branch, replacing an existing tag with the same name.
+func (g GitRepo) Tag(name, msg string) error {
+	_, err := g.conf.RunCmdE("tag", "--force", "--annotate", name, "-m", fmt.Sprintf("'%s'", msg))
+	return err
+}
+
+// PushTag pushes a tag to 'remote' repository.
+func (g GitRepo) PushTag(name, remote string) error {
+	_, err := g.conf.RunCmdE("push", "--force", remote, fmt.Sprintf("refs/tags/%s", name))
+	return err
+}
+
+// Describe returns the most recent tag reachable from the last commit, or the abbreviated commit SHA if there are no tags.
+func (g GitRepo) Describe() (string, error) {
+	return g.conf.RunCmdE("describe", "--tags", "--always")
+}
+
 // AddRemote adds a remote to the repository
 func (g GitRepo) AddRemote(name, url string) error {
 	_, err := g.conf.RunCmdE("remote", "add", name, url)
@@ -150,3 +239,21 @@ func GetRepoOnly(t testing.TB, path string, logger *logger.Logger) GitRepo {
 		conf: git.NewCmdConfig(t, git.WithDir(path), git.WithLogger(logger)),
 	}
 }
+
+// ChangedFiles lists the pending changes in the repository that would be committed by CommitFiles,
+// in the format "<status> <path>", where status is the git short status, like "M" or "??".
+func (g GitRepo) ChangedFiles() ([]string, error) {
+	s, err := g.conf.RunCmdE("status", "--porcelain", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		status, path, found := strings.Cut(strings.TrimSpace(line), " ")
+		if !found {
+			continue
+		}
+		files = append(files, fmt.Sprintf("%s %s", status, strings.TrimSpace(path)))
+	}
+	return files, nil
+}
@@ -93,8 +93,15 @@ func TestGitCSR(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Test GetCommitSha
-	_, err = localCSR.GetCommitSha()
+	sha, err := localCSR.GetCommitSha()
 	assert.NoError(t, err)
+
+	// Test CommitEmpty
+	err = localCSR.CommitEmpty("empty commit")
+	assert.NoError(t, err)
+	newSha, err := localCSR.GetCommitSha()
+	assert.NoError(t, err)
+	assert.NotEqual(t, sha, newSha, "an empty commit should be created")
 }
 
 func TestGitClone_NonCSR(t *testing.T) {
@@ -137,3 +144,116 @@ func TestGitClone_NonCSR(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, hasUpstream, "branch 'unit-test' should have a remote")
 }
+
+func TestChangedFiles(t *testing.T) {
+	repo := createLocalRepo(t, "my-changed-repo")
+	local := GetRepoOnly(t, repo, logger.Discard)
+
+	files, err := local.ChangedFiles()
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+	err = os.WriteFile(filepath.Join(repo, "README.md"), []byte("# Changed\n"), 0644)
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(repo, "envs", "shared"), 0755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(repo, "envs", "shared", "main.tf"), []byte("\n"), 0644)
+	assert.NoError(t, err)
+
+	files, err = local.ChangedFiles()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"M README.md", "?? envs/shared/main.tf"}, files)
+}
+
+func TestTagAndMerge(t *testing.T) {
+	repo := createLocalRepo(t, "my-tag-repo")
+	originPath := filepath.Join(t.TempDir(), "my-tag-repo-origin")
+	err := CopyDirectory(repo, originPath)
+	assert.NoError(t, err)
+	local := GetRepoOnly(t, repo, logger.Discard)
+	err = local.AddRemote("origin", originPath)
+	assert.NoError(t, err)
+
+	sha, err := local.GetCommitSha()
+	assert.NoError(t, err)
+	version, err := local.Describe()
+	assert.NoError(t, err)
+	assert.Equal(t, sha[:7], version[:7], "without tags the version is the commit SHA")
+
+	err = local.Tag("v1.0.0", "first version")
+	assert.NoError(t, err)
+	err = local.Tag("v1.0.0", "first version again")
+	assert.NoError(t, err, "existing tags should be replaced")
+	err = local.PushTag("v1.0.0", "origin")
+	assert.NoError(t, err)
+	version, err = local.Describe()
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", version)
+
+	current, err := local.GetCurrentBranch()
+	assert.NoError(t, err)
+	err = local.CheckoutBranch("upgrade")
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(repo, "main.tf"), []byte("\n"), 0644)
+	assert.NoError(t, err)
+	err = local.CommitFiles("add main.tf")
+	assert.NoError(t, err)
+	err = local.CheckoutBranch(current)
+	assert.NoError(t, err)
+	err = local.MergeBranch("upgrade")
+	assert.NoError(t, err)
+	files, err := FindFiles(repo, "main.tf")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "'main.tf' file should be merged")
+}
+
+func TestPushHeadAndReset(t *testing.T) {
+	repo := createLocalRepo(t, "my-promotion-repo")
+	originPath := filepath.Join(t.TempDir(), "my-promotion-repo-origin")
+	err := CopyDirectory(repo, originPath)
+	assert.NoError(t, err)
+	local := GetRepoOnly(t, repo, logger.Discard)
+	err = local.AddRemote("origin", originPath)
+	assert.NoError(t, err)
+
+	url, err := local.RemoteURL("origin")
+	assert.NoError(t, err)
+	assert.Equal(t, originPath, url)
+
+	exists, err := local.HasRemoteBranch("plan", "origin")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	err = local.CheckoutBranch("plan")
+	assert.NoError(t, err)
+	err = local.PushHead("plan", "origin")
+	assert.NoError(t, err)
+	exists, err = local.HasRemoteBranch("plan", "origin")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	err = os.WriteFile(filepath.Join(repo, "main.tf"), []byte("\n"), 0644)
+	assert.NoError(t, err)
+	err = local.CommitFiles("add main.tf")
+	assert.NoError(t, err)
+	err = local.PushHead("feature", "origin")
+	assert.NoError(t, err)
+	err = local.Fetch("origin")
+	assert.NoError(t, err)
+
+	merged, err := local.IsMerged("plan", "origin/plan")
+	assert.NoError(t, err)
+	assert.False(t, merged, "the new commit is not in the remote plan branch")
+	merged, err = local.IsMerged("plan", "origin/feature")
+	assert.NoError(t, err)
+	assert.True(t, merged)
+
+	err = local.ResetBranch("plan", "origin")
+	assert.NoError(t, err)
+	merged, err = local.IsMerged("origin/plan", "plan")
+	assert.NoError(t, err)
+	assert.True(t, merged)
+	merged, err = local.IsMerged("origin/feature", "plan")
+	assert.NoError(t, err)
+	assert.False(t, merged, "the local commit should be discarded")
+}
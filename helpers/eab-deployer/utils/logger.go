@@ -17,6 +17,7 @@ package utils
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/gruntwork-io/terratest/modules/logger"
 	grunttest "github.com/gruntwork-io/terratest/modules/testing"
@@ -31,6 +32,14 @@ func NewCustomLogger() CustomLogger {
 		baseFmt: "  # %s",
 	}
 }
+
+// NewPrefixedLogger creates a logger that adds the given prefix to each line,
+// so the output of steps executed in parallel can be told apart.
+func NewPrefixedLogger(prefix string) CustomLogger {
+	return CustomLogger{
+		baseFmt: "  [" + strings.ReplaceAll(prefix, "%", "%%") + "] # %s",
+	}
+}
 func (c CustomLogger) Logf(t grunttest.TestingT, format string, args ...interface{}) {
 	fmt.Fprintln(os.Stdout, fmt.Sprintf(c.baseFmt, fmt.Sprintf(format, args...)))
 }
@@ -41,3 +50,12 @@ func GetLogger(quiet bool) *logger.Logger {
 	}
 	return logger.New(NewCustomLogger())
 }
+
+// GetPrefixedLogger returns a logger that adds the given prefix to each line.
+// A discard logger is returned unchanged.
+func GetPrefixedLogger(l *logger.Logger, prefix string) *logger.Logger {
+	if l == logger.Discard {
+		return l
+	}
+	return logger.New(NewPrefixedLogger(prefix))
+}
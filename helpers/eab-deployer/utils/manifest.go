@@ -0,0 +1,233 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ManifestFile is the name of the file, in the root of a stage repository, listing the files owned by the blueprint.
+const ManifestFile = ".eab-managed-files.json"
+
+// Manifest lists the files of a repository owned by the blueprint, by path relative to the repository,
+// with the SHA-256 of their content when they were last written.
+type Manifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// ManagedRepo copies the blueprint code to a repository updating only the files owned by the blueprint.
+// Files with local changes, whose content is not the one last written, are only overwritten if Confirm returns true.
+// Files not owned by the blueprint are never changed.
+// A repository without manifest, deployed before the manifest existed, is adopted:
+// the files of the blueprint are overwritten without confirmation, like they were before, and recorded in the manifest.
+type ManagedRepo struct {
+	Dir      string
+	Confirm  func(path string) bool
+	manifest Manifest
+	adopt    bool
+	adopted  bool
+	written  map[string]bool
+	kept     map[string]bool
+}
+
+// OpenManagedRepo reads the manifest of the repository in dir.
+// If it does not exist an empty manifest is used and the files of the blueprint in the repository are adopted.
+func OpenManagedRepo(dir string, confirm func(path string) bool) (*ManagedRepo, error) {
+	m := &ManagedRepo{
+		Dir:      dir,
+		Confirm:  confirm,
+		manifest: Manifest{Files: map[string]string{}},
+		written:  map[string]bool{},
+		kept:     map[string]bool{},
+	}
+	buf, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		m.adopt = true
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &m.manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, ManifestFile), err)
+	}
+	if m.manifest.Files == nil {
+		m.manifest.Files = map[string]string{}
+	}
+	return m, nil
+}
+
+// CopyDirectory copies a directory to dest, in the repository, like CopyDirectory.
+func (m *ManagedRepo) CopyDirectory(src, dest string) error {
+	err := os.MkdirAll(dest, 0755)
+	if err != nil {
+		return err
+	}
+	files, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Name() == TerraformTempDir || f.Name() == TerraformLockFile {
+			continue
+		}
+		if f.IsDir() {
+			err = m.CopyDirectory(filepath.Join(src, f.Name()), filepath.Join(dest, f.Name()))
+		} else if !isSymlinkToDir(filepath.Join(src, f.Name())) {
+			err = m.CopyFile(filepath.Join(src, f.Name()), filepath.Join(dest, f.Name()))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyFile copies a file to dest, in the repository, unless dest has local changes that are not confirmed to be overwritten.
+// A file already copied since the repository was opened, like a file of the step code replaced by an overlay, is overwritten.
+func (m *ManagedRepo) CopyFile(src, dest string) error {
+	rel, err := m.relPath(dest)
+	if err != nil {
+		return err
+	}
+	if m.written[rel] {
+		return CopyFile(src, dest)
+	}
+	current, err := os.ReadFile(dest)
+	if errors.Is(err, os.ErrNotExist) {
+		m.written[rel] = true
+		return CopyFile(src, dest)
+	}
+	if err != nil {
+		return err
+	}
+	source, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	hash, managed := m.manifest.Files[rel]
+	if !bytes.Equal(current, source) && m.adopt {
+		if !m.adopted {
+			fmt.Printf("# %s has no %s, the files of the blueprint are overwritten and recorded in it, local changes are in the git history\n", m.Dir, ManifestFile)
+			m.adopted = true
+		}
+	} else if !bytes.Equal(current, source) && (!managed || hash != fileHash(current)) && !m.Confirm(rel) {
+		fmt.Printf("# keeping local changes of %s\n", rel)
+		m.kept[rel] = true
+		return nil
+	}
+	m.written[rel] = true
+	return CopyFile(src, dest)
+}
+
+// Save removes the files owned by the blueprint that were not copied since the repository was opened,
+// unless they have local changes, and writes the manifest with the content of the copied files.
+// Files with local changes that were kept keep the hash of the content last written by the blueprint.
+func (m *ManagedRepo) Save() error {
+	for rel, hash := range m.manifest.Files {
+		if m.written[rel] || m.kept[rel] {
+			continue
+		}
+		delete(m.manifest.Files, rel)
+		path := filepath.Join(m.Dir, filepath.FromSlash(rel))
+		current, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fileHash(current) != hash {
+			fmt.Printf("# %s is no longer part of the blueprint and has local changes, it is kept\n", rel)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	for rel := range m.written {
+		current, err := os.ReadFile(filepath.Join(m.Dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		m.manifest.Files[rel] = fileHash(current)
+	}
+	buf, err := json.MarshalIndent(m.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(m.Dir, ManifestFile), append(buf, '\n'), 0644)
+}
+
+// relPath returns the path of a file of the repository relative to the repository, with forward slashes.
+func (m *ManagedRepo) relPath(path string) (string, error) {
+	rel, err := filepath.Rel(m.Dir, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not in the repository %s", path, m.Dir)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// fileHash returns the hex encoded SHA-256 of the content of a file.
+func fileHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// MergeGitignore adds the patterns of content missing in the .gitignore file, keeping the existing patterns and comments.
+// The file is created with content if it does not exist.
+func MergeGitignore(filename, content string) error {
+	current, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.WriteFile(filename, []byte(content), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(current), "\r\n", "\n"), "\n")
+	missing := []string{}
+	for _, l := range strings.Split(content, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") || slices.Contains(lines, l) || slices.Contains(missing, l) {
+			continue
+		}
+		missing = append(missing, l)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	merged := strings.TrimRight(string(current), "\n")
+	if merged != "" {
+		merged += "\n\n"
+	}
+	merged += "# Enterprise Application Blueprint\n" + strings.Join(missing, "\n") + "\n"
+	s, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(merged), s.Mode())
+}
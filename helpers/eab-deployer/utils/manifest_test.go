@@ -0,0 +1,161 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readFile(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestManagedRepo(t *testing.T) {
+	src := t.TempDir()
+	repo := t.TempDir()
+	_, err := writeTempFile(src, "main.tf", "v1")
+	assert.NoError(t, err)
+	_, err = writeTempFile(src, "old.tf", "v1")
+	assert.NoError(t, err)
+	_, err = writeTempFile(src, "edited.tf", "v1")
+	assert.NoError(t, err)
+	_, err = writeTempFile(repo, "custom.tf", "user")
+	assert.NoError(t, err)
+
+	confirmed := []string{}
+	confirm := func(answer bool) func(string) bool {
+		return func(path string) bool {
+			confirmed = append(confirmed, path)
+			return answer
+		}
+	}
+
+	// first copy
+	m, err := OpenManagedRepo(repo, confirm(false))
+	assert.NoError(t, err)
+	assert.NoError(t, m.CopyDirectory(src, filepath.Join(repo, "envs")))
+	assert.NoError(t, m.Save())
+	assert.Empty(t, confirmed)
+	assert.Equal(t, "v1", readFile(t, filepath.Join(repo, "envs", "main.tf")))
+
+	// new blueprint version with a removed file, and a local edit of a managed file
+	_, err = writeTempFile(src, "main.tf", "v2")
+	assert.NoError(t, err)
+	_, err = writeTempFile(src, "edited.tf", "v2")
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(filepath.Join(src, "old.tf")))
+	_, err = writeTempFile(filepath.Join(repo, "envs"), "edited.tf", "local")
+	assert.NoError(t, err)
+
+	m, err = OpenManagedRepo(repo, confirm(false))
+	assert.NoError(t, err)
+	assert.NoError(t, m.CopyDirectory(src, filepath.Join(repo, "envs")))
+	assert.NoError(t, m.Save())
+	assert.Equal(t, []string{"envs/edited.tf"}, confirmed)
+	assert.Equal(t, "v2", readFile(t, filepath.Join(repo, "envs", "main.tf")))
+	assert.Equal(t, "local", readFile(t, filepath.Join(repo, "envs", "edited.tf")), "local changes should be kept")
+	assert.NoFileExists(t, filepath.Join(repo, "envs", "old.tf"), "files removed from the blueprint should be removed")
+	assert.Equal(t, "user", readFile(t, filepath.Join(repo, "custom.tf")), "user files should not be changed")
+
+	// the local edit is still detected and can be overwritten
+	confirmed = []string{}
+	m, err = OpenManagedRepo(repo, confirm(true))
+	assert.NoError(t, err)
+	assert.NoError(t, m.CopyDirectory(src, filepath.Join(repo, "envs")))
+	assert.NoError(t, m.Save())
+	assert.Equal(t, []string{"envs/edited.tf"}, confirmed)
+	assert.Equal(t, "v2", readFile(t, filepath.Join(repo, "envs", "edited.tf")))
+
+	// a file copied again in the same run, like an overlay of the step code, is overwritten without confirmation
+	overlay := t.TempDir()
+	_, err = writeTempFile(overlay, "main.tf", "overlay")
+	assert.NoError(t, err)
+	confirmed = []string{}
+	m, err = OpenManagedRepo(repo, confirm(false))
+	assert.NoError(t, err)
+	assert.NoError(t, m.CopyDirectory(src, filepath.Join(repo, "envs")))
+	assert.NoError(t, m.CopyFile(filepath.Join(overlay, "main.tf"), filepath.Join(repo, "envs", "main.tf")))
+	assert.NoError(t, m.Save())
+	assert.Empty(t, confirmed)
+	assert.Equal(t, "overlay", readFile(t, filepath.Join(repo, "envs", "main.tf")))
+
+	assert.ErrorContains(t, m.CopyFile(filepath.Join(src, "main.tf"), filepath.Join(src, "other.tf")), "is not in the repository")
+	_, err = writeTempFile(repo, ManifestFile, "{")
+	assert.NoError(t, err)
+	_, err = OpenManagedRepo(repo, confirm(true))
+	assert.ErrorContains(t, err, "failed to parse")
+}
+
+func TestManagedRepoWithoutManifest(t *testing.T) {
+	src := t.TempDir()
+	repo := t.TempDir()
+	_, err := writeTempFile(src, "main.tf", "v2")
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, "envs"), 0755))
+	_, err = writeTempFile(filepath.Join(repo, "envs"), "main.tf", "v1")
+	assert.NoError(t, err)
+	_, err = writeTempFile(filepath.Join(repo, "envs"), "custom.tf", "user")
+	assert.NoError(t, err)
+
+	confirmed := []string{}
+	confirm := func(path string) bool {
+		confirmed = append(confirmed, path)
+		return false
+	}
+
+	// repositories deployed before the manifest are adopted, even if the prompt is disabled
+	m, err := OpenManagedRepo(repo, confirm)
+	assert.NoError(t, err)
+	assert.NoError(t, m.CopyDirectory(src, filepath.Join(repo, "envs")))
+	assert.NoError(t, m.Save())
+	assert.Empty(t, confirmed)
+	assert.Equal(t, "v2", readFile(t, filepath.Join(repo, "envs", "main.tf")))
+	assert.Equal(t, "user", readFile(t, filepath.Join(repo, "envs", "custom.tf")))
+	assert.Contains(t, readFile(t, filepath.Join(repo, ManifestFile)), `"envs/main.tf"`)
+	assert.NotContains(t, readFile(t, filepath.Join(repo, ManifestFile)), `"envs/custom.tf"`)
+
+	// once adopted, local changes are kept unless confirmed
+	_, err = writeTempFile(filepath.Join(repo, "envs"), "main.tf", "local")
+	assert.NoError(t, err)
+	m, err = OpenManagedRepo(repo, confirm)
+	assert.NoError(t, err)
+	assert.NoError(t, m.CopyDirectory(src, filepath.Join(repo, "envs")))
+	assert.NoError(t, m.Save())
+	assert.Equal(t, []string{"envs/main.tf"}, confirmed)
+	assert.Equal(t, "local", readFile(t, filepath.Join(repo, "envs", "main.tf")))
+}
+
+func TestMergeGitignore(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, ".gitignore")
+	content := "# tf files\n*.tfstate\n.terraform.lock.hcl\n"
+
+	assert.NoError(t, MergeGitignore(f, content))
+	assert.Equal(t, content, readFile(t, f))
+
+	_, err := writeTempFile(dir, ".gitignore", "# custom\n*.tfstate\n.env\n")
+	assert.NoError(t, err)
+	assert.NoError(t, MergeGitignore(f, content))
+	assert.Equal(t, "# custom\n*.tfstate\n.env\n\n# Enterprise Application Blueprint\n.terraform.lock.hcl\n", readFile(t, f))
+
+	assert.NoError(t, MergeGitignore(f, content))
+	assert.Equal(t, "# custom\n*.tfstate\n.env\n\n# Enterprise Application Blueprint\n.terraform.lock.hcl\n", readFile(t, f), "merging again should not change the file")
+}
@@ -15,29 +15,293 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
 	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
 )
 
+// TFVarEnvPrefix is the prefix of the environment variables with the values of Terraform variables.
+const TFVarEnvPrefix = "TF_VAR_"
+
+// writtenVariablesComment starts the first line of a file written by WriteTfvarsValues, followed by the variables written.
+const writtenVariablesComment = "# Variables written by eab-deployer:"
+
+// Overrides are values of variables that replace the values of a tfvars file, like the -var options
+// and the TF_VAR_ environment variables of Terraform. Values of string variables are used as they are,
+// other values are HCL expressions, like ["a", "b"].
+type Overrides map[string]string
+
+// String returns the overrides as name=value options sorted by name.
+func (o Overrides) String() string {
+	options := []string{}
+	for _, name := range slices.Sorted(maps.Keys(o)) {
+		options = append(options, name+"="+o[name])
+	}
+	return strings.Join(options, " ")
+}
+
+// Set adds the override of a name=value option.
+func (o Overrides) Set(option string) error {
+	name, value, ok := strings.Cut(option, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("invalid variable override '%s', the format is name=value", option)
+	}
+	o[name] = value
+	return nil
+}
+
+// EnvOverrides returns the overrides of the TF_VAR_<name> variables of an environment, like os.Environ().
+func EnvOverrides(environ []string) Overrides {
+	o := Overrides{}
+	for _, env := range environ {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, TFVarEnvPrefix) && len(name) > len(TFVarEnvPrefix) {
+			o[strings.TrimPrefix(name, TFVarEnvPrefix)] = value
+		}
+	}
+	return o
+}
+
 // ReadTfvars reads a valid terraform tfvars file into the provided struct.
-func ReadTfvars(filename string, val interface{}) error {
+// The values of the overrides replace the values of the file, later overrides take precedence.
+// Attributes without a field are read into the remain field of the struct, a map[string]cty.Value
+// tagged `hcl:",remain"`, and are ignored if the struct does not have one.
+func ReadTfvars(filename string, val interface{}, overrides ...Overrides) error {
 	f, d := hclparse.NewParser().ParseHCLFile(filename)
 	if d.HasErrors() {
 		return d
 	}
-	d = gohcl.DecodeBody(f.Body, nil, val)
+	attrs, d := f.Body.JustAttributes()
 	if d.HasErrors() {
 		return d
 	}
+	values := Overrides{}
+	for _, o := range overrides {
+		maps.Copy(values, o)
+	}
+
+	rv := reflect.ValueOf(val).Elem()
+	known := map[string]bool{}
+	var remain reflect.Value
+	var diags hcl.Diagnostics
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		name, option, _ := strings.Cut(field.Tag.Get("hcl"), ",")
+		if option == "remain" {
+			remain = rv.Field(i)
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		known[name] = true
+		var expr hcl.Expression
+		if value, ok := values[name]; ok {
+			v, err := overrideValue(name, value, field.Type)
+			if err != nil {
+				return err
+			}
+			expr = hcl.StaticExpr(v, f.Body.MissingItemRange())
+		} else if attr, ok := attrs[name]; ok {
+			expr = attr.Expr
+		} else {
+			if field.Type.Kind() != reflect.Pointer && option != "optional" {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Missing required argument",
+					Detail:   fmt.Sprintf("The argument %q is required, but no definition was found.", name),
+					Subject:  f.Body.MissingItemRange().Ptr(),
+				})
+			}
+			continue
+		}
+		diags = append(diags, gohcl.DecodeExpression(expr, nil, rv.Field(i).Addr().Interface())...)
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+	if !remain.IsValid() {
+		return nil
+	}
+
+	extra := map[string]cty.Value{}
+	for name, attr := range attrs {
+		if known[name] {
+			continue
+		}
+		v, d := attr.Expr.Value(nil)
+		if d.HasErrors() {
+			return d
+		}
+		extra[name] = v
+	}
+	for name, value := range values {
+		if known[name] {
+			continue
+		}
+		v, err := overrideValue(name, value, nil)
+		if err != nil {
+			return err
+		}
+		extra[name] = v
+	}
+	remain.Set(reflect.ValueOf(extra))
 	return nil
 }
 
-// WriteTfvars writes a valid terraform tfvars file from the provided struct.
-func WriteTfvars(filename string, val interface{}) error {
+// overrideValue returns the value of the override of a variable with the Go type ty.
+// The value of a string variable is used as it is, other values are HCL expressions.
+// The value of a variable without a type, like a variable without a field, is a string if it is not a valid expression.
+func overrideValue(name, value string, ty reflect.Type) (cty.Value, error) {
+	for ty != nil && ty.Kind() == reflect.Pointer {
+		ty = ty.Elem()
+	}
+	if ty != nil && ty.Kind() == reflect.String {
+		return cty.StringVal(value), nil
+	}
+	expr, d := hclsyntax.ParseExpression([]byte(value), fmt.Sprintf("<value for var.%s>", name), hcl.InitialPos)
+	if !d.HasErrors() {
+		var v cty.Value
+		v, d = expr.Value(nil)
+		if !d.HasErrors() {
+			return v, nil
+		}
+	}
+	if ty == nil {
+		return cty.StringVal(value), nil
+	}
+	return cty.NilVal, d
+}
+
+// WriteTfvarsValues writes a valid terraform tfvars file with the values of the variables, in order.
+// The variables written are listed in the first line of the file. When the file exists, the variables written
+// the last time that no longer have a value are removed, and the attributes set by hand are kept.
+func WriteTfvarsValues(filename string, variables []string, values map[string]cty.Value) error {
 	f := hclwrite.NewEmptyFile()
-	gohcl.EncodeIntoBody(val, f.Body())
-	return os.WriteFile(filename, f.Bytes(), 0644)
+	names := []string{}
+	for _, name := range variables {
+		if v, ok := values[name]; ok {
+			f.Body().SetAttributeValue(name, v)
+			names = append(names, name)
+		}
+	}
+	current, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		written, rest := cutWrittenVariables(current)
+		existing, d := hclwrite.ParseConfig(rest, filename, hcl.InitialPos)
+		if !d.HasErrors() {
+			f = mergeTfvars(existing, f, written, names)
+		}
+	}
+	header := strings.TrimSpace(writtenVariablesComment + " " + strings.Join(names, ", "))
+	return os.WriteFile(filename, append([]byte(header+"\n"), f.Bytes()...), 0644)
+}
+
+// cutWrittenVariables returns the variables listed in the first line of a file written by WriteTfvarsValues
+// and the content of the file without that line. Files without the line have no variables written.
+func cutWrittenVariables(content []byte) ([]string, []byte) {
+	line, rest, _ := strings.Cut(string(content), "\n")
+	list, ok := strings.CutPrefix(line, writtenVariablesComment)
+	if !ok {
+		return nil, content
+	}
+	written := []string{}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			written = append(written, name)
+		}
+	}
+	return written, []byte(rest)
+}
+
+// mergeTfvars updates the existing file with the attributes, in order, of the generated file.
+// Attributes with the same value keep their formatting, and fields missing in the generated file, like nil pointers, are removed.
+func mergeTfvars(existing, generated *hclwrite.File, fields, names []string) *hclwrite.File {
+	body := existing.Body()
+	for _, name := range fields {
+		if generated.Body().GetAttribute(name) == nil {
+			body.RemoveAttribute(name)
+		}
+	}
+	for _, name := range names {
+		attr := generated.Body().GetAttribute(name)
+		if attr == nil {
+			continue
+		}
+		if current := body.GetAttribute(name); current != nil && sameValue(current, attr) {
+			continue
+		}
+		body.SetAttributeRaw(name, attr.Expr().BuildTokens(nil))
+	}
+	return existing
+}
+
+// sameValue returns true if the expressions of both attributes have the same value.
+func sameValue(a, b *hclwrite.Attribute) bool {
+	va, okA := attributeValue(a)
+	vb, okB := attributeValue(b)
+	return okA && okB && va.RawEquals(vb)
+}
+
+// attributeValue evaluates the expression of an attribute, false is returned if it is not a constant value.
+func attributeValue(attr *hclwrite.Attribute) (cty.Value, bool) {
+	expr, d := hclsyntax.ParseExpression(attr.Expr().BuildTokens(nil).Bytes(), "", hcl.InitialPos)
+	if d.HasErrors() {
+		return cty.NilVal, false
+	}
+	v, d := expr.Value(nil)
+	return v, !d.HasErrors()
+}
+
+// Variable is a variable declared in Terraform code, it is required if it does not have a default value.
+type Variable struct {
+	Name     string
+	Required bool
+}
+
+// ReadVariables returns the variables declared in the Terraform files of a directory, in the order of the files and of their declarations.
+func ReadVariables(dir string) ([]Variable, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	schema := &hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{{Type: "variable", LabelNames: []string{"name"}}}}
+	variableSchema := &hcl.BodySchema{Attributes: []hcl.AttributeSchema{{Name: "default"}}}
+	parser := hclparse.NewParser()
+	variables := []Variable{}
+	for _, file := range files {
+		f, d := parser.ParseHCLFile(file)
+		if d.HasErrors() {
+			return nil, d
+		}
+		content, _, d := f.Body.PartialContent(schema)
+		if d.HasErrors() {
+			return nil, d
+		}
+		for _, b := range content.Blocks {
+			attrs, _, d := b.Body.PartialContent(variableSchema)
+			if d.HasErrors() {
+				return nil, d
+			}
+			_, hasDefault := attrs.Attributes["default"]
+			variables = append(variables, Variable{Name: b.Labels[0], Required: !hasDefault})
+		}
+	}
+	return variables, nil
 }
@@ -15,13 +15,13 @@
 package utils
 
 import (
-	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
 )
 
-func TestWriteReadTfvars(t *testing.T) {
+func TestReadTfvars(t *testing.T) {
 
 	type nested struct {
 		Name  string `cty:"name"`
@@ -35,55 +35,183 @@ func TestWriteReadTfvars(t *testing.T) {
 		Nested   *[]nested `hcl:"nested"`
 	}
 
-	optional := "no"
-	nestedValue := nested{
-		Name:  "cloud",
-		Value: "GCP",
-	}
-	tests := []struct {
-		name string
-		tfv  tfvars
-	}{
-		{
-			name: "required",
-			tfv: tfvars{
-				Required: "yes",
-				Slice:    []string{"one", "two"},
-			},
-		},
-		{
-			name: "optional",
-			tfv: tfvars{
-				Required: "yes",
-				Slice:    []string{"one", "two"},
-				Optional: &optional,
-				Nested:   &[]nested{nestedValue},
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dir := t.TempDir()
-			file := filepath.Join(dir, "test.tfvars")
-			err := WriteTfvars(file, tt.tfv)
-			assert.NoError(t, err)
-
-			var read tfvars
-			err = ReadTfvars(file, &read)
-			assert.NoError(t, err)
-			assert.Equal(t, tt.tfv.Required, read.Required, "Required value should be %s", tt.tfv.Required)
-			assert.Equal(t, tt.tfv.Optional, read.Optional, "Optional value should be equal")
-			assert.Equal(t, tt.tfv.Nested, read.Nested, "Nested value should be equal")
-			assert.Len(t, read.Slice, 2, "Slice should have 2 elements")
-			assert.Contains(t, read.Slice, "one", "Slice should have element 'one'")
-			assert.Contains(t, read.Slice, "two", "Slice should have element 'two'")
-			if tt.name == "optional" {
-				assert.Equal(t, *read.Optional, "no", "Optional value should be 'no'")
-				assert.Contains(t, *read.Nested, nestedValue, "Should have the nested value")
-			} else {
-				assert.Nil(t, read.Optional, "Optional value should be 'nil'")
-				assert.Nil(t, read.Nested, "Nested value should be 'nil'")
-			}
-		})
-	}
+	file, err := writeTempFile(t.TempDir(), "test.tfvars", `
+required = "yes"
+slice    = ["one", "two"]
+optional = "no"
+nested = [{
+  name  = "cloud"
+  value = "GCP"
+}]
+`)
+	assert.NoError(t, err)
+	var read tfvars
+	assert.NoError(t, ReadTfvars(file, &read))
+	assert.Equal(t, "yes", read.Required)
+	assert.Equal(t, []string{"one", "two"}, read.Slice)
+	assert.Equal(t, "no", *read.Optional)
+	assert.Equal(t, []nested{{Name: "cloud", Value: "GCP"}}, *read.Nested)
+
+	file, err = writeTempFile(t.TempDir(), "test.tfvars", `
+required = "yes"
+slice    = ["one", "two"]
+`)
+	assert.NoError(t, err)
+	read = tfvars{}
+	assert.NoError(t, ReadTfvars(file, &read))
+	assert.Nil(t, read.Optional, "Optional value should be 'nil'")
+	assert.Nil(t, read.Nested, "Nested value should be 'nil'")
+}
+
+type overridden struct {
+	Name   string               `hcl:"name"`
+	Labels *string              `hcl:"labels"`
+	Zones  []string             `hcl:"zones"`
+	Count  *int                 `hcl:"count"`
+	Extra  map[string]cty.Value `hcl:",remain"`
+}
+
+func TestReadTfvarsOverrides(t *testing.T) {
+	file, err := writeTempFile(t.TempDir(), "test.tfvars", `
+# the name of the deployment
+name  = "file"
+zones = ["a", "b"]
+
+custom = {
+  key = "value"
+}
+`)
+	assert.NoError(t, err)
+
+	var read overridden
+	err = ReadTfvars(file, &read,
+		EnvOverrides([]string{"TF_VAR_name=env", "TF_VAR_count=2", "TF_VAR_=ignored", "PATH=/bin"}),
+		Overrides{"name": "var", "labels": `{"a" = "b"}`, "zones": `["c"]`, "other": "not an expression"},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "var", read.Name, "-var overrides should take precedence")
+	assert.Equal(t, `{"a" = "b"}`, *read.Labels, "string values should not be parsed")
+	assert.Equal(t, []string{"c"}, read.Zones)
+	assert.Equal(t, 2, *read.Count)
+	assert.Equal(t, map[string]cty.Value{
+		"custom": cty.ObjectVal(map[string]cty.Value{"key": cty.StringVal("value")}),
+		"other":  cty.StringVal("not an expression"),
+	}, read.Extra)
+
+	err = ReadTfvars(file, &read, Overrides{"count": "two"})
+	assert.ErrorContains(t, err, "var.count")
+
+	missing, err := writeTempFile(t.TempDir(), "test.tfvars", `zones = []`)
+	assert.NoError(t, err)
+	err = ReadTfvars(missing, &read)
+	assert.ErrorContains(t, err, `The argument "name" is required`)
+}
+
+func TestOverrides(t *testing.T) {
+	o := Overrides{}
+	assert.NoError(t, o.Set("name=a=b"))
+	assert.NoError(t, o.Set(" zones =[]"))
+	assert.Error(t, o.Set("name"))
+	assert.Error(t, o.Set("=value"))
+	assert.Equal(t, "name=a=b zones=[]", o.String())
+}
+
+func TestWriteTfvarsValuesKeepsFile(t *testing.T) {
+	file, err := writeTempFile(t.TempDir(), "test.tfvars", `# Variables written by eab-deployer: name, zones
+# deployment
+name = "old" # renamed
+
+zones = [
+  "a",
+  "b",
+]
+custom = true
+`)
+	assert.NoError(t, err)
+
+	err = WriteTfvarsValues(file, []string{"name", "zones", "region"}, map[string]cty.Value{
+		"name":   cty.StringVal("new"),
+		"zones":  cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		"region": cty.StringVal("us-central1"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `# Variables written by eab-deployer: name, zones, region
+# deployment
+name = "new" # renamed
+
+zones = [
+  "a",
+  "b",
+]
+custom = true
+region = "us-central1"
+`, readFile(t, file), "comments, formatting and unchanged values should be kept")
+
+	var read overridden
+	assert.NoError(t, ReadTfvars(file, &read))
+	assert.Equal(t, "new", read.Name)
+	assert.Equal(t, map[string]cty.Value{"custom": cty.True, "region": cty.StringVal("us-central1")}, read.Extra)
+}
+
+func TestWriteTfvarsValues(t *testing.T) {
+	file, err := writeTempFile(t.TempDir(), "test.tfvars", `# Variables written by eab-deployer: zones, labels
+# stage inputs
+zones  = ["a"]
+labels = "removed"
+region = "us-central1"
+custom = true
+`)
+	assert.NoError(t, err)
+
+	err = WriteTfvarsValues(file, []string{"name", "zones", "labels", "region"}, map[string]cty.Value{
+		"name":  cty.StringVal("stage"),
+		"zones": cty.ListVal([]cty.Value{cty.StringVal("a")}),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `# Variables written by eab-deployer: name, zones
+# stage inputs
+zones  = ["a"]
+region = "us-central1"
+custom = true
+name   = "stage"
+`, readFile(t, file), "variables set by hand should be kept")
+
+	// files without the list of variables written keep all their attributes
+	file, err = writeTempFile(t.TempDir(), "test.tfvars", `labels = "kept"
+`)
+	assert.NoError(t, err)
+	assert.NoError(t, WriteTfvarsValues(file, []string{"labels"}, map[string]cty.Value{}))
+	assert.Equal(t, `# Variables written by eab-deployer:
+labels = "kept"
+`, readFile(t, file))
+}
+
+func TestReadVariables(t *testing.T) {
+	dir := t.TempDir()
+	_, err := writeTempFile(dir, "variables.tf", `
+variable "zones" {
+  type = list(string)
+}
+
+variable "name" {}
+`)
+	assert.NoError(t, err)
+	_, err = writeTempFile(dir, "main.tf", `
+variable "region" {
+  default = "us-central1"
+}
+
+locals {
+  name = var.name
+}
+`)
+	assert.NoError(t, err)
+
+	variables, err := ReadVariables(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []Variable{
+		{Name: "region", Required: false},
+		{Name: "zones", Required: true},
+		{Name: "name", Required: true},
+	}, variables)
 }